@@ -0,0 +1,271 @@
+package kvsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AdminOption configures the handler returned by AdminHandler
+type AdminOption func(*adminHandler)
+
+// WithAdminTask registers a task the admin handler can trigger by name, e.g. a FullResyncTask
+func WithAdminTask(name string, task TaskFunc) AdminOption {
+	return func(h *adminHandler) {
+		h.tasks[name] = &adminTask{task: task, status: AdminTaskStatus{Name: name}}
+	}
+}
+
+// AdminTaskStatus is the status of a task triggered through the admin handler, or run by the Scheduler of
+// the KVSync when Scheduled is set
+type AdminTaskStatus struct {
+	Name         string
+	Running      bool
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    string
+	Runs         int64
+	Failures     int64
+	Scheduled    bool
+	// NextRun and Skipped are those of scheduled tasks, see TaskStatus
+	NextRun time.Time
+	Skipped int64
+}
+
+type adminTask struct {
+	task   TaskFunc
+	status AdminTaskStatus
+}
+
+// WithAdminContext sets the lifetime of the tasks triggered through the admin handler, they are cancelled once it
+// is done. It defaults to the context the KVSync was created with.
+func WithAdminContext(ctx context.Context) AdminOption {
+	return func(h *adminHandler) {
+		h.ctx = ctx
+	}
+}
+
+type adminHandler struct {
+	kvSync KVSync
+	ctx    context.Context
+	tasks  map[string]*adminTask
+	mutex  sync.Mutex
+	mux    *http.ServeMux
+}
+
+// AdminHandler returns an HTTP handler for operating a KVSync, to be mounted on an ops mux:
+//
+//	GET  /health       200, or 503 when HealthCheck fails
+//	GET  /stats        Stats as JSON
+//	GET  /queue        queue depth and capacity
+//	POST /pause        pauses syncing, see KVSync.Pause
+//	POST /resume       resumes syncing
+//	GET  /tasks        the status of the tasks registered with WithAdminTask, then of Options.Scheduler
+//	POST /tasks/{name} runs a task in the background, 409 if it is already running
+//	GET  /keys/{key}   the value stored under a key, of a model registered with RegisterModel, and its Envelope
+//
+// It performs no authentication, expose it on an internal listener or wrap it in your own middleware.
+func AdminHandler(kvSync KVSync, opts ...AdminOption) http.Handler {
+	h := &adminHandler{
+		kvSync: kvSync,
+		tasks:  make(map[string]*adminTask),
+		mux:    http.NewServeMux(),
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.ctx == nil {
+		h.ctx = lifetimeOf(kvSync)
+	}
+
+	h.mux.HandleFunc("/health", allowMethod(http.MethodGet, h.health))
+	h.mux.HandleFunc("/stats", allowMethod(http.MethodGet, h.stats))
+	h.mux.HandleFunc("/queue", allowMethod(http.MethodGet, h.queue))
+	h.mux.HandleFunc("/pause", allowMethod(http.MethodPost, h.pause))
+	h.mux.HandleFunc("/resume", allowMethod(http.MethodPost, h.resume))
+	h.mux.HandleFunc("/tasks", allowMethod(http.MethodGet, h.taskStatuses))
+	h.mux.HandleFunc("/tasks/", allowMethod(http.MethodPost, h.runTask))
+	h.mux.HandleFunc("/keys/", allowMethod(http.MethodGet, h.key))
+
+	return h
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *adminHandler) health(w http.ResponseWriter, r *http.Request) {
+	if err := h.kvSync.HealthCheck(r.Context()); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"Healthy": true})
+}
+
+func (h *adminHandler) stats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, h.kvSync.Stats())
+}
+
+func (h *adminHandler) queue(w http.ResponseWriter, _ *http.Request) {
+	stats := h.kvSync.Stats()
+
+	writeJSON(w, http.StatusOK, map[string]int{"Queued": stats.Queued, "QueueCapacity": stats.QueueCapacity})
+}
+
+func (h *adminHandler) pause(w http.ResponseWriter, _ *http.Request) {
+	h.kvSync.Pause()
+
+	writeJSON(w, http.StatusOK, map[string]bool{"Paused": h.kvSync.Paused()})
+}
+
+func (h *adminHandler) resume(w http.ResponseWriter, _ *http.Request) {
+	h.kvSync.Resume()
+
+	writeJSON(w, http.StatusOK, map[string]bool{"Paused": h.kvSync.Paused()})
+}
+
+func (h *adminHandler) taskStatuses(w http.ResponseWriter, _ *http.Request) {
+	h.mutex.Lock()
+	statuses := make([]AdminTaskStatus, 0, len(h.tasks))
+	for _, t := range h.tasks {
+		statuses = append(statuses, t.status)
+	}
+	h.mutex.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	for _, task := range h.kvSync.Stats().Tasks {
+		status := AdminTaskStatus{
+			Name:         task.Name,
+			Running:      task.Running,
+			LastRun:      task.LastRun,
+			LastDuration: task.LastDuration,
+			Runs:         task.Runs,
+			Failures:     task.Failures,
+			Scheduled:    true,
+			NextRun:      task.NextRun,
+			Skipped:      task.Skipped,
+		}
+		if task.LastErr != nil {
+			status.LastError = task.LastErr.Error()
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (h *adminHandler) runTask(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/tasks/")
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	t, ok := h.tasks[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown task "+name))
+		return
+	}
+
+	if t.status.Running {
+		writeError(w, http.StatusConflict, errors.New("task "+name+" is already running"))
+		return
+	}
+
+	t.status.Running = true
+	// the run outlives the request, keeping the values of its context such as its trace ID and actor
+	go h.run(valuesContext{Context: h.ctx, values: r.Context()}, t)
+
+	writeJSON(w, http.StatusAccepted, t.status)
+}
+
+func (h *adminHandler) run(ctx context.Context, t *adminTask) {
+	started := time.Now()
+	err := t.task(ctx)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	t.status.Running = false
+	t.status.LastRun = started
+	t.status.LastDuration = time.Since(started)
+	t.status.LastError = ""
+	t.status.Runs++
+	if err != nil {
+		t.status.LastError = err.Error()
+		t.status.Failures++
+	}
+}
+
+func (h *adminHandler) key(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/keys/")
+
+	value, info, err := h.kvSync.FetchAnyWithInfo(key)
+	switch {
+	case errors.Is(err, ErrKeyNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	case info.Type != "":
+		writeJSON(w, http.StatusOK, map[string]any{"Key": key, "Model": ModelName(value), "Value": value, "Envelope": info})
+	default:
+		writeJSON(w, http.StatusOK, map[string]any{"Key": key, "Model": ModelName(value), "Value": value})
+	}
+}
+
+// valuesContext has the deadline and cancellation of a context and the values of another, falling back to the
+// values of the former
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesContext) Value(key any) any {
+	if value := c.values.Value(key); value != nil {
+		return value
+	}
+
+	return c.Context.Value(key)
+}
+
+// lifetimeOf returns the context a KVSync was created with
+func lifetimeOf(k KVSync) context.Context {
+	if impl, ok := k.(*kvSync); ok {
+		return impl.ctx
+	}
+
+	return context.Background()
+}
+
+func allowMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"Error": err.Error()})
+}
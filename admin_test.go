@@ -0,0 +1,174 @@
+package kvsync_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminHandler(t *testing.T) {
+	kvsync.RegisterModel[Profile]()
+
+	store, s := setUpStore()
+	store.Marshaler = &kvsync.EnvelopeMarshaler{}
+
+	scheduler := &kvsync.Scheduler{}
+	scheduler.Add("sweep", kvsync.Every(10*time.Millisecond), func(ctx context.Context) error {
+		return errors.New("sweep failed")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scheduler.Start(ctx)
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store, QueueSize: 4, Scheduler: scheduler})
+	assert.NoError(t, kvSync.SyncAndWait(context.Background(), &SyncedUser{UUID: "admin-uuid"}))
+	assert.NoError(t, store.Put("profile:1", Profile{ID: 1, FirstName: "Ada"}))
+
+	release := make(chan struct{})
+	actors := make(chan string, 1)
+	handler := kvsync.AdminHandler(kvSync,
+		kvsync.WithAdminTask("resync", func(ctx context.Context) error {
+			<-release
+			if ctx.Err() == nil {
+				actors <- kvsync.Actor(ctx)
+			}
+
+			return errors.New("resync failed")
+		}),
+	)
+	withActor := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(kvsync.WithActor(r.Context(), "ops")))
+	})
+	server := httptest.NewServer(http.StripPrefix("/admin", withActor))
+	defer server.Close()
+
+	call := func(method, path string, dest any) int {
+		req, err := http.NewRequest(method, server.URL+"/admin"+path, nil)
+		assert.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		if dest != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(dest))
+		}
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/health", nil))
+
+	var stats kvsync.Stats
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/stats", &stats))
+	assert.Equal(t, 1, stats.Workers)
+	assert.Equal(t, 4, stats.QueueCapacity)
+	assert.Equal(t, kvsync.ModelStats{Synced: 3}, stats.Models["kvsync_test.SyncedUser"])
+	if assert.Len(t, stats.Tasks, 1) {
+		assert.Equal(t, "sweep", stats.Tasks[0].Name)
+		assert.False(t, stats.Tasks[0].NextRun.IsZero())
+	}
+
+	var queue map[string]int
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/queue", &queue))
+	assert.Equal(t, map[string]int{"Queued": 0, "QueueCapacity": 4}, queue)
+
+	var paused map[string]bool
+	assert.Equal(t, http.StatusMethodNotAllowed, call(http.MethodGet, "/pause", nil))
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/pause", &paused))
+	assert.True(t, paused["Paused"])
+	assert.True(t, kvSync.Paused())
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/resume", &paused))
+	assert.False(t, paused["Paused"])
+
+	var status kvsync.AdminTaskStatus
+	assert.Equal(t, http.StatusAccepted, call(http.MethodPost, "/tasks/resync", &status))
+	assert.True(t, status.Running)
+	assert.Equal(t, http.StatusConflict, call(http.MethodPost, "/tasks/resync", nil))
+	assert.Equal(t, http.StatusNotFound, call(http.MethodPost, "/tasks/unknown", nil))
+
+	close(release)
+	assert.Equal(t, "ops", <-actors, "tasks run with the values of the request context, past the response")
+	assert.Eventually(t, func() bool {
+		var statuses []kvsync.AdminTaskStatus
+		call(http.MethodGet, "/tasks", &statuses)
+
+		return len(statuses) == 2 && !statuses[0].Running && statuses[0].LastError == "resync failed" &&
+			statuses[1].Scheduled && statuses[1].Runs > 0 && statuses[1].LastError == "sweep failed"
+	}, time.Second, 10*time.Millisecond)
+
+	var key struct {
+		Key      string
+		Model    string
+		Value    Profile
+		Envelope kvsync.Envelope
+	}
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/keys/profile:1", &key))
+	assert.Equal(t, "kvsync_test.Profile", key.Model)
+	assert.Equal(t, Profile{ID: 1, FirstName: "Ada"}, key.Value)
+	assert.Equal(t, "kvsync_test.Profile", key.Envelope.Type)
+	assert.False(t, key.Envelope.SyncedAt.IsZero())
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/keys/profile:2", nil))
+
+	s.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, call(http.MethodGet, "/health", nil))
+}
+
+func TestAdminHandler_TaskLifetime(t *testing.T) {
+	store, s := setUpStore()
+	defer s.Close()
+
+	run := func(handler http.Handler) {
+		r := httptest.NewRequest(http.MethodPost, "/tasks/wait", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r.WithContext(kvsync.WithActor(r.Context(), "ops")))
+		assert.Equal(t, http.StatusAccepted, w.Code)
+	}
+
+	lastError := func(handler http.Handler) string {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tasks", nil))
+
+		var statuses []kvsync.AdminTaskStatus
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&statuses))
+
+		return statuses[0].LastError
+	}
+
+	actors := make(chan string, 2)
+	wait := kvsync.WithAdminTask("wait", func(ctx context.Context) error {
+		actors <- kvsync.Actor(ctx)
+		<-ctx.Done()
+
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	kvSync := kvsync.NewKVSync(ctx, kvsync.Options{Store: store})
+	handler := kvsync.AdminHandler(kvSync, wait)
+
+	run(handler)
+	assert.Equal(t, "ops", <-actors)
+	cancel()
+	assert.Eventually(t, func() bool {
+		return lastError(handler) == context.Canceled.Error()
+	}, time.Second, 10*time.Millisecond, "tasks are cancelled with the KVSync")
+
+	adminCtx, adminCancel := context.WithCancel(context.Background())
+	handler = kvsync.AdminHandler(kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store}), wait,
+		kvsync.WithAdminContext(adminCtx))
+
+	run(handler)
+	assert.Equal(t, "ops", <-actors)
+	adminCancel()
+	assert.Eventually(t, func() bool {
+		return lastError(handler) == context.Canceled.Error()
+	}, time.Second, 10*time.Millisecond, "tasks are cancelled with the context of the handler")
+}
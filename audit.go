@@ -0,0 +1,180 @@
+package kvsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"gorm.io/gorm"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditTable is the table of AuditRecord written by GormAuditSink, create it with AutoMigrate(&AuditRecord{})
+const AuditTable = "kvsync_audit"
+
+// AuditReportKeyName is the key name of the reports of records the AuditSink failed to append
+const AuditReportKeyName = "@audit"
+
+// Audited actions
+const (
+	AuditWrite  = "write"
+	AuditDelete = "delete"
+)
+
+// AuditRecord records a key written or deleted by KVSync
+type AuditRecord struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement"`
+	// Actor is the actor of the context the sync was triggered with, see WithActor
+	Actor string `gorm:"size:255"`
+	// Source identifies the instance that wrote or deleted the key, its hostname
+	Source    string    `gorm:"size:255"`
+	TraceID   string    `gorm:"size:64"`
+	Model     string    `gorm:"size:255"`
+	Key       string    `gorm:"size:1024"`
+	Action    string    `gorm:"size:16"`
+	Operation Operation `gorm:"size:16"`
+	// ValueHash is the hex SHA-256 of the JSON encoding of the value written, empty for deletes
+	ValueHash string `gorm:"size:64"`
+	Timestamp time.Time
+}
+
+func (AuditRecord) TableName() string {
+	return AuditTable
+}
+
+// AuditSink appends audit records to an append-only store, e.g. a file, a table or a Kafka topic. The records
+// of an entity are appended together, once its keys are written or deleted.
+type AuditSink interface {
+	Append(records []AuditRecord) error
+}
+
+// AuditSinkFunc adapts a function to an AuditSink
+type AuditSinkFunc func(records []AuditRecord) error
+
+func (f AuditSinkFunc) Append(records []AuditRecord) error {
+	return f(records)
+}
+
+// JSONAuditSink appends audit records to Writer as JSON lines, e.g. to a file opened with O_APPEND
+type JSONAuditSink struct {
+	Writer io.Writer
+
+	mutex sync.Mutex
+}
+
+func (j *JSONAuditSink) Append(records []AuditRecord) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	encoder := json.NewEncoder(j.Writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GormAuditSink inserts audit records into AuditTable
+type GormAuditSink struct {
+	DB *gorm.DB
+}
+
+func (g *GormAuditSink) Append(records []AuditRecord) error {
+	return g.DB.Create(&records).Error
+}
+
+// RetentionTask returns a scheduled task enforcing the retention of audit records, deleting those older than
+// retention in batches of batchSize, 1000 when not positive
+func (g *GormAuditSink) RetentionTask(retention time.Duration, batchSize int) TaskFunc {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	return func(ctx context.Context) error {
+		cutoff := time.Now().Add(-retention)
+
+		for {
+			var ids []uint64
+			err := g.DB.WithContext(ctx).Model(&AuditRecord{}).Where("timestamp < ?", cutoff).
+				Order("id").Limit(batchSize).Pluck("id", &ids).Error
+			if err != nil || len(ids) == 0 {
+				return err
+			}
+
+			if err = g.DB.WithContext(ctx).Delete(&AuditRecord{}, ids).Error; err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// audit appends the records of the keys of an entity written or deleted without error, reporting failures
+func (k *kvSync) audit(entity any, action string, specs map[string]KeySpec, values map[string]any, errs map[string]error, item queueItem, report bool) {
+	if k.auditSink == nil || k.dryRun {
+		return
+	}
+
+	now := time.Now()
+	records := make([]AuditRecord, 0, len(specs))
+	for keyName, spec := range specs {
+		if errs[spec.Key] != nil {
+			continue
+		}
+
+		record := AuditRecord{
+			Actor:     item.actor,
+			Source:    k.auditSource(),
+			TraceID:   item.traceID,
+			Model:     ModelName(entity),
+			Key:       spec.Key,
+			Action:    action,
+			Operation: item.operation,
+			Timestamp: now,
+		}
+		if action == AuditWrite {
+			record.ValueHash = valueHash(values[keyName])
+		}
+		records = append(records, record)
+	}
+
+	if len(records) == 0 {
+		return
+	}
+
+	if err := k.auditSink.Append(records); err != nil && report {
+		k.reports <- Report{
+			Model:     entity,
+			KeyName:   AuditReportKeyName,
+			Err:       err,
+			TraceID:   item.traceID,
+			Operation: item.operation,
+			Attempt:   item.attempt,
+			Timestamp: time.Now(),
+		}
+	}
+}
+
+func (k *kvSync) auditSource() string {
+	k.auditSourceOnce.Do(func() {
+		k.auditSourceName, _ = os.Hostname()
+	})
+
+	return k.auditSourceName
+}
+
+// valueHash returns the hex SHA-256 of the JSON encoding of a value, or an empty string if it has none
+func valueHash(value any) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,176 @@
+package kvsync_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingAuditSink struct {
+	records []kvsync.AuditRecord
+	mutex   sync.Mutex
+}
+
+func (r *recordingAuditSink) Append(records []kvsync.AuditRecord) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.records = append(r.records, records...)
+
+	return nil
+}
+
+func (r *recordingAuditSink) byAction(action string) []kvsync.AuditRecord {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var records []kvsync.AuditRecord
+	for _, record := range r.records {
+		if record.Action == action {
+			records = append(records, record)
+		}
+	}
+
+	return records
+}
+
+func TestAuditSink(t *testing.T) {
+	sink := &recordingAuditSink{}
+	kvSync, err := kvsync.New(context.Background(),
+		kvsync.WithStore(&kvsync.InMemoryStore{Store: make(map[string]any)}),
+		kvsync.WithAuditSink(sink),
+	)
+	assert.NoError(t, err)
+
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	assert.NoError(t, db.Callback().Create().After("gorm:create").Register("kvsync:create", kvSync.GormCallback()))
+	assert.NoError(t, db.Callback().Delete().After("gorm:delete").Register("kvsync:delete", kvSync.GormDeleteCallback()))
+
+	ctx := kvsync.WithTraceID(kvsync.WithActor(context.Background(), "alice"), "trace-1")
+	user := SyncedUser{UUID: "audit-uuid", Username: "audit-username"}
+	assert.NoError(t, db.WithContext(ctx).Create(&user).Error)
+
+	assert.Eventually(t, func() bool {
+		return len(sink.byAction(kvsync.AuditWrite)) == 3
+	}, time.Second, 5*time.Millisecond)
+
+	for _, record := range sink.byAction(kvsync.AuditWrite) {
+		assert.Equal(t, "alice", record.Actor)
+		assert.Equal(t, "trace-1", record.TraceID)
+		assert.Equal(t, "kvsync_test.SyncedUser", record.Model)
+		assert.Equal(t, kvsync.OperationCreate, record.Operation)
+		assert.Len(t, record.ValueHash, 64)
+		assert.False(t, record.Timestamp.IsZero())
+	}
+
+	assert.NoError(t, db.WithContext(kvsync.WithActor(context.Background(), "bob")).Delete(&user).Error)
+
+	assert.Eventually(t, func() bool {
+		return len(sink.byAction(kvsync.AuditDelete)) == 3
+	}, time.Second, 5*time.Millisecond)
+
+	keys := make([]string, 0, 3)
+	for _, record := range sink.byAction(kvsync.AuditDelete) {
+		assert.Equal(t, "bob", record.Actor)
+		assert.Empty(t, record.ValueHash)
+		keys = append(keys, record.Key)
+	}
+	assert.ElementsMatch(t, []string{"user:id:1", "user:uuid:audit-uuid", "user:composite:1_audit-uuid"}, keys)
+}
+
+func TestAuditSink_Failure(t *testing.T) {
+	reports := make(chan kvsync.Report, 10)
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: &kvsync.InMemoryStore{Store: make(map[string]any)},
+		AuditSink: kvsync.AuditSinkFunc(func(records []kvsync.AuditRecord) error {
+			return errors.New("audit log unavailable")
+		}),
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+
+	assert.NoError(t, kvSync.SyncAndWait(context.Background(), &SyncedUser{UUID: "audit-uuid"}), "auditing doesn't fail syncs")
+
+	assert.Eventually(t, func() bool {
+		select {
+		case r := <-reports:
+			return r.KeyName == kvsync.AuditReportKeyName && r.Err != nil
+		default:
+			return false
+		}
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestJSONAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := &kvsync.JSONAuditSink{Writer: &buf}
+
+	assert.NoError(t, sink.Append([]kvsync.AuditRecord{{Key: "user:id:1", Action: kvsync.AuditWrite}}))
+	assert.NoError(t, sink.Append([]kvsync.AuditRecord{{Key: "user:id:1", Action: kvsync.AuditDelete}}))
+
+	decoder := json.NewDecoder(&buf)
+	for _, action := range []string{kvsync.AuditWrite, kvsync.AuditDelete} {
+		var record kvsync.AuditRecord
+		assert.NoError(t, decoder.Decode(&record))
+		assert.Equal(t, action, record.Action)
+	}
+}
+
+func TestGormAuditSink(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	assert.NoError(t, db.AutoMigrate(&kvsync.AuditRecord{}))
+	defer func() {
+		_ = db.Migrator().DropTable(&kvsync.AuditRecord{})
+	}()
+
+	sink := &kvsync.GormAuditSink{DB: db}
+	assert.NoError(t, sink.Append([]kvsync.AuditRecord{
+		{Key: "user:id:1", Action: kvsync.AuditWrite, Actor: "alice"},
+		{Key: "user:id:1", Action: kvsync.AuditDelete, Actor: "bob"},
+	}))
+
+	var records []kvsync.AuditRecord
+	assert.NoError(t, db.Order("id").Find(&records).Error)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "bob", records[1].Actor)
+}
+
+func TestGormAuditSink_RetentionTask(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	assert.NoError(t, db.AutoMigrate(&kvsync.AuditRecord{}))
+	defer func() {
+		_ = db.Migrator().DropTable(&kvsync.AuditRecord{})
+	}()
+
+	sink := &kvsync.GormAuditSink{DB: db}
+	assert.NoError(t, sink.Append([]kvsync.AuditRecord{
+		{Key: "user:id:1", Timestamp: time.Now().Add(-48 * time.Hour)},
+		{Key: "user:id:2", Timestamp: time.Now().Add(-25 * time.Hour)},
+		{Key: "user:id:3", Timestamp: time.Now().Add(-26 * time.Hour)},
+		{Key: "user:id:4", Timestamp: time.Now()},
+	}))
+
+	assert.NoError(t, sink.RetentionTask(24*time.Hour, 2)(context.Background()))
+
+	var keys []string
+	assert.NoError(t, db.Model(&kvsync.AuditRecord{}).Order("id").Pluck("key", &keys).Error)
+	assert.Equal(t, []string{"user:id:4"}, keys)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, sink.Append([]kvsync.AuditRecord{{Key: "user:id:5", Timestamp: time.Now().Add(-48 * time.Hour)}}))
+	assert.Error(t, sink.RetentionTask(24*time.Hour, 0)(ctx))
+}
@@ -0,0 +1,538 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"time"
+)
+
+// BackfillStatus is the state of a backfill job
+type BackfillStatus string
+
+const (
+	BackfillRunning   BackfillStatus = "running"
+	BackfillCompleted BackfillStatus = "completed"
+	BackfillAborted   BackfillStatus = "aborted"
+	BackfillFailed    BackfillStatus = "failed"
+	BackfillPaused    BackfillStatus = "paused"
+)
+
+// TimeWindow is a daily time range in a location, e.g. 01:00–05:00. It may span midnight.
+type TimeWindow struct {
+	// Start and End are offsets from midnight
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+// Contains reports whether t falls within the window
+func (w TimeWindow) Contains(t time.Time) bool {
+	offset := w.offset(t)
+
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+
+	return offset >= w.Start || offset < w.End
+}
+
+// NextStart returns the next time the window opens after t
+func (w TimeWindow) NextStart(t time.Time) time.Time {
+	t = t.In(w.location())
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	next := midnight.Add(w.Start)
+	if !next.After(t) {
+		next = midnight.AddDate(0, 0, 1).Add(w.Start)
+	}
+
+	return next
+}
+
+func (w TimeWindow) offset(t time.Time) time.Duration {
+	t = t.In(w.location())
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
+
+func (w TimeWindow) location() *time.Location {
+	if w.Location == nil {
+		return time.UTC
+	}
+
+	return w.Location
+}
+
+// BackfillCheckpoint is the resumable state of a backfill job, stored in the KVStore so that
+// any replica can list, resume or abort the job
+type BackfillCheckpoint struct {
+	JobID     string
+	Model     string
+	LastPK    string
+	Processed int64
+	Failed    int64
+	// Total is the number of rows counted when the job started, 0 unless CountRows is set
+	Total     int64
+	StartedBy string
+	StartedAt time.Time
+	UpdatedAt time.Time
+	Status    BackfillStatus
+	Error     string
+}
+
+// BackfillProgress is reported by a Backfiller after every batch
+type BackfillProgress struct {
+	JobID     string
+	Model     string
+	LastPK    string
+	Processed int64
+	Failed    int64
+	Total     int64
+	// Rate is the number of rows handled per second since the job was started or resumed
+	Rate float64
+	// ETA estimates the time left, 0 when the total is unknown
+	ETA time.Duration
+}
+
+type backfillIndex struct {
+	JobIDs []string
+}
+
+// Backfiller syncs the existing rows of a model in primary key order, checkpointing its progress
+type Backfiller struct {
+	DB     *gorm.DB
+	KVSync KVSync
+	// Store is where checkpoints are kept, usually the same store the models are synced to
+	Store KVStore
+	// BatchSize is the number of rows loaded per query, defaults to 500
+	BatchSize int
+	// Instance identifies the replica running the jobs, recorded as StartedBy
+	Instance string
+	// Prefix is prepended to checkpoint keys and lock names, defaults to "backfill:"
+	Prefix string
+	// Window optionally restricts jobs to a maintenance window, jobs are paused outside of it
+	// and resumed automatically when it opens again
+	Window *TimeWindow
+	// KillSwitch optionally pauses jobs while engaged, they are resumed automatically when it is released
+	KillSwitch *KillSwitch
+	// MigrateLegacyKeys deletes the legacy keys of every synced row, see LegacyKeyer
+	MigrateLegacyKeys bool
+	// Locker optionally ensures a job runs on a single replica at a time, the lock is renewed every batch.
+	// It also serializes the updates of the index of jobs across replicas.
+	Locker Locker
+	// LockTTL bounds how long a crashed replica holds the lock of its job, defaults to 10 minutes
+	LockTTL time.Duration
+	// CountRows counts the rows of the model when a job starts, so that progress reports an ETA.
+	// Counting is a full scan on some databases.
+	CountRows bool
+	// Progress is optionally called after every batch
+	Progress func(BackfillProgress)
+}
+
+// Start starts a new backfill job and runs it until completion, abortion or failure
+func (b *Backfiller) Start(ctx context.Context, jobID string, model any) (*BackfillCheckpoint, error) {
+	if err := b.lock(ctx, jobID); err != nil {
+		return nil, err
+	}
+	defer b.unlock(jobID)
+
+	now := time.Now()
+	checkpoint := &BackfillCheckpoint{
+		JobID:     jobID,
+		Model:     ModelName(model),
+		StartedBy: b.Instance,
+		StartedAt: now,
+		UpdatedAt: now,
+		Status:    BackfillRunning,
+	}
+
+	if err := b.addToIndex(ctx, jobID); err != nil {
+		return nil, err
+	}
+
+	if err := b.save(checkpoint); err != nil {
+		return nil, err
+	}
+
+	return b.run(ctx, checkpoint, model)
+}
+
+// Resume resumes an interrupted backfill job from its last checkpoint
+func (b *Backfiller) Resume(ctx context.Context, jobID string, model any) (*BackfillCheckpoint, error) {
+	if err := b.lock(ctx, jobID); err != nil {
+		return nil, err
+	}
+	defer b.unlock(jobID)
+
+	checkpoint, err := b.Checkpoint(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	if checkpoint.Model != ModelName(model) {
+		return nil, fmt.Errorf("job %s backfills %s, not %s", jobID, checkpoint.Model, ModelName(model))
+	}
+
+	if checkpoint.Status == BackfillCompleted || checkpoint.Status == BackfillAborted {
+		return nil, fmt.Errorf("job %s is %s", jobID, checkpoint.Status)
+	}
+
+	checkpoint.Status = BackfillRunning
+	checkpoint.Error = ""
+
+	return b.run(ctx, checkpoint, model)
+}
+
+// Abort marks a job as aborted, the replica running it stops after its current batch
+func (b *Backfiller) Abort(jobID string) error {
+	checkpoint, err := b.Checkpoint(jobID)
+	if err != nil {
+		return err
+	}
+
+	checkpoint.Status = BackfillAborted
+	checkpoint.UpdatedAt = time.Now()
+
+	return b.save(checkpoint)
+}
+
+// Checkpoint fetches the checkpoint of a job
+func (b *Backfiller) Checkpoint(jobID string) (*BackfillCheckpoint, error) {
+	var checkpoint BackfillCheckpoint
+
+	if err := b.Store.Fetch(b.checkpointKey(jobID), &checkpoint); err != nil {
+		return nil, err
+	}
+
+	return &checkpoint, nil
+}
+
+// List returns the checkpoints of all known jobs
+func (b *Backfiller) List() ([]BackfillCheckpoint, error) {
+	index, err := b.index()
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints := make([]BackfillCheckpoint, 0, len(index.JobIDs))
+	for _, jobID := range index.JobIDs {
+		checkpoint, err := b.Checkpoint(jobID)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, *checkpoint)
+	}
+
+	return checkpoints, nil
+}
+
+func (b *Backfiller) run(ctx context.Context, checkpoint *BackfillCheckpoint, model any) (*BackfillCheckpoint, error) {
+	modelType := reflect.TypeOf(resolvePointer(model))
+
+	pk, err := primaryField(b.DB, model)
+	if err != nil {
+		return b.fail(checkpoint, err)
+	}
+
+	batchSize := b.BatchSize
+	if batchSize < 1 {
+		batchSize = 500
+	}
+
+	if b.CountRows && checkpoint.Total == 0 {
+		if err := b.DB.WithContext(ctx).Model(model).Count(&checkpoint.Total).Error; err != nil {
+			return b.fail(checkpoint, err)
+		}
+	}
+
+	started := time.Now()
+	startedAt := checkpoint.Processed + checkpoint.Failed
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return b.fail(checkpoint, err)
+		}
+
+		// another replica may have aborted the job
+		if stored, err := b.Checkpoint(checkpoint.JobID); err == nil && stored.Status == BackfillAborted {
+			return stored, nil
+		}
+
+		if !b.ready(time.Now()) {
+			if aborted, err := b.pause(ctx, checkpoint); err != nil || aborted {
+				return checkpoint, err
+			}
+
+			continue
+		}
+
+		// the lock may have expired while paused and been taken over by another replica
+		if err := b.lock(ctx, checkpoint.JobID); err != nil {
+			return checkpoint, err
+		}
+
+		rows := reflect.New(reflect.SliceOf(modelType))
+
+		query := b.DB.WithContext(ctx).Order(pk.DBName).Limit(batchSize)
+		if checkpoint.LastPK != "" {
+			query = query.Where(clause.Gt{Column: clause.Column{Name: pk.DBName}, Value: checkpoint.LastPK})
+		}
+
+		if err := query.Find(rows.Interface()).Error; err != nil {
+			return b.fail(checkpoint, err)
+		}
+
+		slice := rows.Elem()
+		if slice.Len() == 0 {
+			checkpoint.Status = BackfillCompleted
+			checkpoint.UpdatedAt = time.Now()
+
+			return checkpoint, b.save(checkpoint)
+		}
+
+		for i := 0; i < slice.Len(); i++ {
+			if err := b.sync(slice.Index(i).Interface()); err != nil {
+				checkpoint.Failed++
+			} else {
+				checkpoint.Processed++
+			}
+		}
+
+		lastPK, _ := pk.ValueOf(ctx, slice.Index(slice.Len()-1))
+		checkpoint.LastPK = fmt.Sprint(lastPK)
+		checkpoint.UpdatedAt = time.Now()
+
+		if err := b.save(checkpoint); err != nil {
+			return checkpoint, err
+		}
+
+		if b.Progress != nil {
+			b.Progress(progress(checkpoint, checkpoint.Processed+checkpoint.Failed-startedAt, time.Since(started)))
+		}
+	}
+}
+
+// progress computes the progress of a job that handled done rows in elapsed since it was started or resumed
+func progress(checkpoint *BackfillCheckpoint, done int64, elapsed time.Duration) BackfillProgress {
+	p := BackfillProgress{
+		JobID:     checkpoint.JobID,
+		Model:     checkpoint.Model,
+		LastPK:    checkpoint.LastPK,
+		Processed: checkpoint.Processed,
+		Failed:    checkpoint.Failed,
+		Total:     checkpoint.Total,
+	}
+
+	if elapsed > 0 {
+		p.Rate = float64(done) / elapsed.Seconds()
+	}
+
+	// rows inserted since the count make the remainder negative, the ETA then stays 0
+	if remaining := p.Total - p.Processed - p.Failed; remaining > 0 && p.Rate > 0 {
+		p.ETA = time.Duration(float64(remaining) / p.Rate * float64(time.Second))
+	}
+
+	return p
+}
+
+func (b *Backfiller) sync(entity any) error {
+	if b.MigrateLegacyKeys {
+		return b.KVSync.MigrateLegacyKeys(entity)
+	}
+
+	return b.KVSync.Sync(entity)
+}
+
+// ready reports whether jobs may run at t
+func (b *Backfiller) ready(t time.Time) bool {
+	return !b.KillSwitch.Engaged() && (b.Window == nil || b.Window.Contains(t))
+}
+
+// pause pauses a job until the maintenance window opens and the kill switch is released, returning true
+// if it got aborted meanwhile. A job whose context is done while paused stays paused and can be resumed.
+func (b *Backfiller) pause(ctx context.Context, checkpoint *BackfillCheckpoint) (bool, error) {
+	checkpoint.Status = BackfillPaused
+	checkpoint.UpdatedAt = time.Now()
+	if err := b.save(checkpoint); err != nil {
+		return false, err
+	}
+
+	for !b.ready(time.Now()) {
+		// wake up regularly to notice abortions by other replicas
+		wait := time.Minute
+		if b.Window != nil && !b.Window.Contains(time.Now()) {
+			if untilStart := time.Until(b.Window.NextStart(time.Now())); untilStart < wait {
+				wait = untilStart
+			}
+		}
+		if b.KillSwitch.Engaged() && b.KillSwitch.interval() < wait {
+			wait = b.KillSwitch.interval()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		case <-timer.C:
+		}
+
+		if stored, err := b.Checkpoint(checkpoint.JobID); err == nil && stored.Status == BackfillAborted {
+			*checkpoint = *stored
+			return true, nil
+		}
+	}
+
+	checkpoint.Status = BackfillRunning
+	checkpoint.UpdatedAt = time.Now()
+
+	return false, b.save(checkpoint)
+}
+
+// lock acquires or renews the lock of a job, failing with ErrLocked when another replica holds it
+func (b *Backfiller) lock(ctx context.Context, jobID string) error {
+	if b.Locker == nil {
+		return nil
+	}
+
+	lockTTL := b.LockTTL
+	if lockTTL <= 0 {
+		lockTTL = 10 * time.Minute
+	}
+
+	locked, err := b.Locker.TryLock(ctx, b.lockName(jobID), lockTTL)
+	if err != nil {
+		return err
+	}
+
+	if !locked {
+		return fmt.Errorf("job %s: %w", jobID, ErrLocked)
+	}
+
+	return nil
+}
+
+func (b *Backfiller) unlock(jobID string) {
+	if b.Locker != nil {
+		_ = b.Locker.Unlock(context.Background(), b.lockName(jobID))
+	}
+}
+
+func (b *Backfiller) lockName(jobID string) string {
+	return b.prefix() + "lock:job:" + jobID
+}
+
+func (b *Backfiller) fail(checkpoint *BackfillCheckpoint, err error) (*BackfillCheckpoint, error) {
+	checkpoint.Status = BackfillFailed
+	checkpoint.Error = err.Error()
+	checkpoint.UpdatedAt = time.Now()
+
+	_ = b.save(checkpoint)
+
+	return checkpoint, err
+}
+
+func (b *Backfiller) save(checkpoint *BackfillCheckpoint) error {
+	return b.Store.Put(b.checkpointKey(checkpoint.JobID), *checkpoint)
+}
+
+func (b *Backfiller) index() (*backfillIndex, error) {
+	var index backfillIndex
+
+	// a missing index simply means no job has been started yet
+	err := b.Store.Fetch(b.indexKey(), &index)
+	if errors.Is(err, ErrKeyNotFound) {
+		return &backfillIndex{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &index, nil
+}
+
+// addToIndex adds a job to the index. With a Locker the index is read and written back under a lock, so that
+// replicas starting jobs at the same time don't overwrite each other's.
+func (b *Backfiller) addToIndex(ctx context.Context, jobID string) error {
+	if b.Locker != nil {
+		if err := b.lockIndex(ctx); err != nil {
+			return err
+		}
+		defer func() {
+			_ = b.Locker.Unlock(context.Background(), b.indexLockName())
+		}()
+	}
+
+	index, err := b.index()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range index.JobIDs {
+		if id == jobID {
+			return errors.New("job " + jobID + " already exists")
+		}
+	}
+
+	index.JobIDs = append(index.JobIDs, jobID)
+
+	return b.Store.Put(b.indexKey(), *index)
+}
+
+// lockIndex waits for the lock of the index, held only while it is updated
+func (b *Backfiller) lockIndex(ctx context.Context) error {
+	for {
+		locked, err := b.Locker.TryLock(ctx, b.indexLockName(), 10*time.Second)
+		if err != nil || locked {
+			return err
+		}
+
+		timer := time.NewTimer(10 * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (b *Backfiller) indexKey() string {
+	return b.prefix() + "jobs"
+}
+
+func (b *Backfiller) indexLockName() string {
+	return b.prefix() + "lock:index"
+}
+
+func (b *Backfiller) checkpointKey(jobID string) string {
+	return b.prefix() + "job:" + jobID
+}
+
+func (b *Backfiller) prefix() string {
+	if b.Prefix == "" {
+		return "backfill:"
+	}
+
+	return b.Prefix
+}
+
+// primaryField returns the primary key field of a Gorm model
+func primaryField(db *gorm.DB, model any) (*schema.Field, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+
+	if stmt.Schema.PrioritizedPrimaryField == nil {
+		return nil, fmt.Errorf("model %s has no primary key", stmt.Schema.Name)
+	}
+
+	return stmt.Schema.PrioritizedPrimaryField, nil
+}
@@ -0,0 +1,360 @@
+package kvsync_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackfiller(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	for i := 1; i <= 5; i++ {
+		db.Create(&SyncedUser{
+			UUID:     fmt.Sprintf("backfill-uuid-%d", i),
+			Username: fmt.Sprintf("backfill-username-%d", i),
+		})
+	}
+
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	backfiller := &kvsync.Backfiller{
+		DB: db,
+		KVSync: kvsync.NewKVSync(context.Background(), kvsync.Options{
+			Store: store,
+		}),
+		Store:     store,
+		BatchSize: 2,
+		Instance:  "replica-1",
+	}
+
+	checkpoint, err := backfiller.Start(context.Background(), "job-1", &SyncedUser{})
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.BackfillCompleted, checkpoint.Status)
+	assert.Equal(t, int64(5), checkpoint.Processed)
+	assert.Equal(t, "5", checkpoint.LastPK)
+	assert.Equal(t, "replica-1", checkpoint.StartedBy)
+
+	fetched := SyncedUser{UUID: "backfill-uuid-3"}
+	assert.NoError(t, backfiller.KVSync.Fetch(&fetched, "uuid"))
+	assert.Equal(t, "backfill-username-3", fetched.Username)
+
+	_, err = backfiller.Start(context.Background(), "job-1", &SyncedUser{})
+	assert.Error(t, err, "job IDs are unique")
+
+	_, err = backfiller.Resume(context.Background(), "job-1", &SyncedUser{})
+	assert.Error(t, err, "completed jobs cannot be resumed")
+
+	jobs, err := backfiller.List()
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "job-1", jobs[0].JobID)
+}
+
+func TestBackfiller_ResumeAfterAbort(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	backfiller := &kvsync.Backfiller{
+		DB: db,
+		KVSync: kvsync.NewKVSync(context.Background(), kvsync.Options{
+			Store: store,
+		}),
+		Store: store,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	checkpoint, err := backfiller.Start(ctx, "job-2", &SyncedUser{})
+	assert.Error(t, err)
+	assert.Equal(t, kvsync.BackfillFailed, checkpoint.Status)
+
+	db.Create(&SyncedUser{UUID: "resume-uuid", Username: "resume-username"})
+
+	checkpoint, err = backfiller.Resume(context.Background(), "job-2", &SyncedUser{})
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.BackfillCompleted, checkpoint.Status)
+	assert.Equal(t, int64(1), checkpoint.Processed)
+
+	assert.NoError(t, backfiller.Abort("job-2"))
+	_, err = backfiller.Resume(context.Background(), "job-2", &SyncedUser{})
+	assert.Error(t, err)
+}
+
+func TestTimeWindow(t *testing.T) {
+	night := kvsync.TimeWindow{Start: 23 * time.Hour, End: 5 * time.Hour}
+
+	assert.True(t, night.Contains(time.Date(2024, 6, 1, 23, 30, 0, 0, time.UTC)))
+	assert.True(t, night.Contains(time.Date(2024, 6, 1, 1, 0, 0, 0, time.UTC)))
+	assert.False(t, night.Contains(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)))
+	assert.Equal(t,
+		time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC),
+		night.NextStart(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)))
+	assert.Equal(t,
+		time.Date(2024, 6, 2, 23, 0, 0, 0, time.UTC),
+		night.NextStart(time.Date(2024, 6, 1, 23, 30, 0, 0, time.UTC)))
+}
+
+func TestBackfiller_PausedOutsideWindow(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	opensIn := now.Sub(midnight) + time.Hour
+
+	backfiller := &kvsync.Backfiller{
+		DB: db,
+		KVSync: kvsync.NewKVSync(context.Background(), kvsync.Options{
+			Store: store,
+		}),
+		Store:  store,
+		Window: &kvsync.TimeWindow{Start: opensIn, End: opensIn + time.Minute},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	checkpoint, err := backfiller.Start(ctx, "job-3", &SyncedUser{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, kvsync.BackfillPaused, checkpoint.Status)
+
+	stored, err := backfiller.Checkpoint("job-3")
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.BackfillPaused, stored.Status)
+}
+
+func TestBackfiller_Progress(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	for i := 1; i <= 5; i++ {
+		db.Create(&SyncedUser{
+			UUID:     fmt.Sprintf("progress-uuid-%d", i),
+			Username: fmt.Sprintf("progress-username-%d", i),
+		})
+	}
+
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	var events []kvsync.BackfillProgress
+	backfiller := &kvsync.Backfiller{
+		DB: db,
+		KVSync: kvsync.NewKVSync(context.Background(), kvsync.Options{
+			Store: store,
+		}),
+		Store:     store,
+		BatchSize: 2,
+		CountRows: true,
+		Progress: func(p kvsync.BackfillProgress) {
+			events = append(events, p)
+		},
+	}
+
+	checkpoint, err := backfiller.Start(context.Background(), "job-progress", &SyncedUser{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), checkpoint.Total)
+
+	assert.Len(t, events, 3)
+	assert.Equal(t, int64(2), events[0].Processed)
+	assert.Equal(t, int64(5), events[0].Total)
+	assert.Equal(t, "2", events[0].LastPK)
+	assert.Greater(t, events[0].Rate, float64(0))
+	assert.Greater(t, events[0].ETA, time.Duration(0))
+	assert.Equal(t, int64(5), events[2].Processed)
+	assert.Equal(t, time.Duration(0), events[2].ETA)
+
+	stored, err := backfiller.Checkpoint("job-progress")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), stored.Total, "the total is kept for resumed jobs")
+}
+
+// slowIndexStore fails or delays the reads of the index of backfill jobs
+type slowIndexStore struct {
+	*kvsync.InMemoryStore
+	fetchErr error
+}
+
+func (s *slowIndexStore) Fetch(key string, dest any) error {
+	if key == "backfill:jobs" {
+		if s.fetchErr != nil {
+			return s.fetchErr
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return s.InMemoryStore.Fetch(key, dest)
+}
+
+func TestBackfiller_IndexFetchError(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	store := &slowIndexStore{InMemoryStore: &kvsync.InMemoryStore{Store: make(map[string]any)}}
+	backfiller := &kvsync.Backfiller{
+		DB:     db,
+		KVSync: kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store}),
+		Store:  store,
+	}
+
+	_, err := backfiller.Start(context.Background(), "job-a", &SyncedUser{})
+	assert.NoError(t, err)
+
+	store.fetchErr = kvsync.ErrStoreUnavailable
+	_, err = backfiller.Start(context.Background(), "job-b", &SyncedUser{})
+	assert.ErrorIs(t, err, kvsync.ErrStoreUnavailable)
+	_, err = backfiller.List()
+	assert.ErrorIs(t, err, kvsync.ErrStoreUnavailable)
+
+	store.fetchErr = nil
+	jobs, err := backfiller.List()
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1, "the index is not overwritten")
+}
+
+func TestBackfiller_ConcurrentStarts(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	store := &slowIndexStore{InMemoryStore: &kvsync.InMemoryStore{Store: make(map[string]any)}}
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			replica := &kvsync.Backfiller{
+				DB:     db,
+				KVSync: kvSync,
+				Store:  store,
+				Locker: &kvsync.RedisLocker{Client: redisStore.Client, Owner: fmt.Sprintf("replica-%d", i)},
+			}
+			_, err := replica.Start(context.Background(), fmt.Sprintf("job-%d", i), &SyncedUser{})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	jobs, err := (&kvsync.Backfiller{Store: store}).List()
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 5, "no replica overwrites the jobs of the others")
+}
+
+// storeLocker keeps its locks in a key-value store, next to the checkpoints of the jobs
+type storeLocker struct {
+	store *kvsync.InMemoryStore
+	names []string
+}
+
+func (l *storeLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	l.names = append(l.names, name)
+	return true, l.store.Put(name, "locked")
+}
+
+func (l *storeLocker) Unlock(ctx context.Context, name string) error {
+	return l.store.Delete(name)
+}
+
+func TestBackfiller_LockNames(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Create(&SyncedUser{UUID: "lock-names-uuid"}).Error)
+
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	locker := &storeLocker{store: store}
+
+	backfiller := &kvsync.Backfiller{
+		DB:     db,
+		KVSync: kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store}),
+		Store:  store,
+		Locker: locker,
+	}
+
+	checkpoint, err := backfiller.Start(context.Background(), "job-locks", &SyncedUser{})
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.BackfillCompleted, checkpoint.Status)
+	assert.Contains(t, locker.names, "backfill:lock:index")
+	assert.Contains(t, locker.names, "backfill:lock:job:job-locks")
+
+	stored, err := backfiller.Checkpoint("job-locks")
+	assert.NoError(t, err, "releasing the lock of the job leaves its checkpoint")
+	assert.Equal(t, kvsync.BackfillCompleted, stored.Status)
+
+	jobs, err := backfiller.List()
+	assert.NoError(t, err, "releasing the lock of the index leaves the index")
+	assert.Len(t, jobs, 1)
+}
+
+func TestBackfiller_PausedByKillSwitch(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Create(&SyncedUser{UUID: "kill-switch-uuid"}).Error)
+
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	killSwitch := &kvsync.KillSwitch{Store: store, Interval: 5 * time.Millisecond}
+	assert.NoError(t, killSwitch.Engage("maintenance"))
+
+	backfiller := &kvsync.Backfiller{
+		DB: db,
+		KVSync: kvsync.NewKVSync(context.Background(), kvsync.Options{
+			Store: store,
+		}),
+		Store:      store,
+		KillSwitch: killSwitch,
+	}
+
+	paused := func(jobID string) func() bool {
+		return func() bool {
+			checkpoint, err := backfiller.Checkpoint(jobID)
+			return err == nil && checkpoint.Status == kvsync.BackfillPaused
+		}
+	}
+
+	done := make(chan *kvsync.BackfillCheckpoint)
+	go func() {
+		checkpoint, err := backfiller.Start(context.Background(), "job-released", &SyncedUser{})
+		assert.NoError(t, err)
+		done <- checkpoint
+	}()
+
+	assert.Eventually(t, paused("job-released"), time.Second, 5*time.Millisecond)
+	assert.NoError(t, killSwitch.Release())
+	assert.Equal(t, kvsync.BackfillCompleted, (<-done).Status, "jobs resume once the kill switch is released")
+
+	assert.NoError(t, killSwitch.Engage("maintenance"))
+	go func() {
+		checkpoint, err := backfiller.Start(context.Background(), "job-aborted", &SyncedUser{})
+		assert.NoError(t, err)
+		done <- checkpoint
+	}()
+
+	assert.Eventually(t, paused("job-aborted"), time.Second, 5*time.Millisecond)
+	assert.NoError(t, backfiller.Abort("job-aborted"))
+	assert.Equal(t, kvsync.BackfillAborted, (<-done).Status, "paused jobs notice abortions")
+}
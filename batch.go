@@ -0,0 +1,90 @@
+package kvsync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// BatchOptions tune SyncAll
+type BatchOptions struct {
+	// Concurrency bounds the number of entities queued or being synced at once, defaults to the number of workers
+	Concurrency int
+	// SyncOptions apply to every entity
+	SyncOptions []SyncOption
+}
+
+// BatchError aggregates the errors of the entities SyncAll could not sync, or DeleteAfterExec could not delete
+type BatchError struct {
+	// Errs holds the error of each entity by position, nil for the synced ones
+	Errs []error
+}
+
+func (e *BatchError) Error() string {
+	failed := 0
+	var first error
+	for _, err := range e.Errs {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+
+	return fmt.Sprintf("%d of %d entities failed to sync, first error: %v", failed, len(e.Errs), first)
+}
+
+// Unwrap returns the first error
+func (e *BatchError) Unwrap() error {
+	for _, err := range e.Errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SyncAll syncs entities across the worker pool and waits for all of them, e.g. for imports. It returns
+// a *BatchError when any entity fails, entities not queued before the context is done fail with its error.
+func (k *kvSync) SyncAll(ctx context.Context, entities []any, opts BatchOptions) error {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = k.pool.workers
+	}
+
+	errs := make([]error, len(entities))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+queue:
+	for i, entity := range entities {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			for j := i; j < len(entities); j++ {
+				errs[j] = ctx.Err()
+			}
+			break queue
+		}
+
+		wg.Add(1)
+		go func(i int, entity any) {
+			defer wg.Done()
+
+			errs[i] = k.SyncAndWait(ctx, entity, opts.SyncOptions...)
+			<-slots
+		}(i, entity)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return &BatchError{Errs: errs}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package kvsync_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSyncAll(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:   store,
+		Workers: 4,
+	})
+
+	entities := make([]any, 0, 101)
+	for i := 1; i <= 100; i++ {
+		entities = append(entities, &SyncedUser{UUID: fmt.Sprintf("imported-%d", i)})
+	}
+
+	assert.NoError(t, kvSync.SyncAll(context.Background(), entities, kvsync.BatchOptions{Concurrency: 8}))
+	assert.Contains(t, store.Store, "user:uuid:imported-1")
+	assert.Contains(t, store.Store, "user:uuid:imported-100")
+
+	err := kvSync.SyncAll(context.Background(), append(entities[:1:1], &UnsyncedUser{}), kvsync.BatchOptions{})
+	var batchErr *kvsync.BatchError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.NoError(t, batchErr.Errs[0])
+	assert.ErrorIs(t, batchErr.Errs[1], kvsync.ErrNotSyncable)
+	assert.ErrorIs(t, err, kvsync.ErrNotSyncable)
+	assert.Contains(t, err.Error(), "1 of 2 entities failed to sync, first error: ")
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = kvSync.SyncAll(canceled, entities, kvsync.BatchOptions{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,135 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// BypassResult counts the rows a detection went through
+type BypassResult struct {
+	Rows int
+	// Stale counts the rows whose keys were missing or synced before their last update, and got re-synced
+	Stale int
+}
+
+// BypassDetector re-syncs the rows written without going through KVSync, e.g. by raw SQL, migrations or
+// other services. It polls the rows updated recently and compares their UpdatedAt with the SyncedAt of
+// the envelopes of their keys, so the store must implement InfoFetcher and write envelopes, see
+// EnvelopeMarshaler. Rows with missing keys are re-synced as well.
+type BypassDetector struct {
+	DB     *gorm.DB
+	KVSync KVSync
+	// Models are the models checked, they need an UpdatedAt field
+	Models []any
+	// Lookback is how far back rows are checked on every run, defaults to 10 minutes. It should exceed the
+	// interval of the runs and the clock skew between the database and the replicas.
+	Lookback time.Duration
+	// BatchSize is the number of rows loaded per query, defaults to 500
+	BatchSize int
+	// DryRun counts the stale rows without re-syncing them
+	DryRun bool
+}
+
+// Detect checks the rows of every model updated within Lookback, re-syncing the stale ones
+func (b *BypassDetector) Detect(ctx context.Context) (BypassResult, error) {
+	var result BypassResult
+
+	lookback := b.Lookback
+	if lookback <= 0 {
+		lookback = 10 * time.Minute
+	}
+
+	batchSize := b.BatchSize
+	if batchSize < 1 {
+		batchSize = 500
+	}
+
+	since := time.Now().Add(-lookback)
+	for _, model := range b.Models {
+		stmt := &gorm.Statement{DB: b.DB}
+		if err := stmt.Parse(model); err != nil {
+			return result, err
+		}
+		updatedAt := stmt.Schema.LookUpField("UpdatedAt")
+
+		err := updatedSince(ctx, b.DB, model, since, batchSize, func(rows reflect.Value, _ time.Time) error {
+			for i := 0; i < rows.Len(); i++ {
+				row := rows.Index(i)
+				value, _ := updatedAt.ValueOf(ctx, row)
+				rowUpdatedAt, _ := value.(time.Time)
+
+				stale, err := b.stale(row, rowUpdatedAt)
+				if err != nil {
+					return err
+				}
+
+				result.Rows++
+				if !stale {
+					continue
+				}
+				result.Stale++
+
+				if !b.DryRun {
+					if err = b.KVSync.Sync(row.Interface()); err != nil {
+						return err
+					}
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// Task returns Detect as a scheduled task
+func (b *BypassDetector) Task() TaskFunc {
+	return func(ctx context.Context) error {
+		_, err := b.Detect(ctx)
+
+		return err
+	}
+}
+
+// stale reports whether a key of a row is missing or was synced before the row's last update
+func (b *BypassDetector) stale(row reflect.Value, updatedAt time.Time) (bool, error) {
+	specs, ok := syncKeySpecs(row.Interface())
+	if !ok {
+		return false, ErrNotSyncable
+	}
+
+	keyNames := make([]string, 0, len(specs))
+	for keyName := range specs {
+		keyNames = append(keyNames, keyName)
+	}
+	sort.Strings(keyNames)
+
+	for _, keyName := range keyNames {
+		// the keys of the destination are those of the row
+		dest := reflect.New(row.Type())
+		dest.Elem().Set(row)
+
+		info, err := b.KVSync.FetchWithInfo(dest.Interface(), keyName)
+		if errors.Is(err, ErrKeyNotFound) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		// envelopes are serialized with millisecond precision by BSON
+		if info.SyncedAt.Before(updatedAt.Truncate(time.Millisecond)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
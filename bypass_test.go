@@ -0,0 +1,65 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBypassDetector(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+	redisStore.Marshaler = &kvsync.EnvelopeMarshaler{}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: redisStore})
+
+	for _, uuid := range []string{"bypass-uuid-1", "bypass-uuid-2"} {
+		user := SyncedUser{UUID: uuid, Username: "synced"}
+		assert.NoError(t, db.Create(&user).Error)
+		assert.NoError(t, kvSync.Sync(&user))
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, db.Exec("UPDATE synced_users SET username = ?, updated_at = ? WHERE uuid = ?", "bypassed", time.Now(), "bypass-uuid-1").Error)
+	assert.NoError(t, db.Exec("INSERT INTO synced_users (uuid, username, created_at, updated_at) VALUES (?, ?, ?, ?)", "bypass-uuid-3", "inserted", time.Now(), time.Now()).Error)
+
+	detector := &kvsync.BypassDetector{
+		DB:     db,
+		KVSync: kvSync,
+		Models: []any{&SyncedUser{}},
+		DryRun: true,
+	}
+
+	result, err := detector.Detect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.BypassResult{Rows: 3, Stale: 2}, result)
+
+	fetched := SyncedUser{UUID: "bypass-uuid-1"}
+	assert.NoError(t, kvSync.Fetch(&fetched, "uuid"))
+	assert.Equal(t, "synced", fetched.Username, "dry runs re-sync nothing")
+
+	detector.DryRun = false
+	result, err = detector.Detect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Stale)
+
+	assert.NoError(t, kvSync.Fetch(&fetched, "uuid"))
+	assert.Equal(t, "bypassed", fetched.Username)
+	fetched = SyncedUser{UUID: "bypass-uuid-3"}
+	assert.NoError(t, kvSync.Fetch(&fetched, "uuid"))
+	assert.Equal(t, "inserted", fetched.Username)
+
+	assert.NoError(t, detector.Task()(context.Background()))
+	result, err = detector.Detect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.BypassResult{Rows: 3, Stale: 0}, result)
+
+	detector.Models = []any{&User{}}
+	_, err = detector.Detect(context.Background())
+	assert.Error(t, err, "models need an UpdatedAt field")
+}
@@ -0,0 +1,277 @@
+package kvsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"io"
+	"reflect"
+)
+
+// ChangeEvent is a row change captured from the database log, e.g. by Postgres logical decoding or the MySQL binlog
+type ChangeEvent struct {
+	Table     string
+	Operation Operation
+	// Columns are the values of inserted and updated rows by column name
+	Columns map[string]any
+	// OldColumns are the values of updated and deleted rows before the change, as far as the log provides them.
+	// Deleting the keys of deleted rows and those left behind by updates requires all columns, e.g. with
+	// REPLICA IDENTITY FULL on Postgres or binlog_row_image=FULL on MySQL.
+	OldColumns map[string]any
+}
+
+// ChangeSource streams change events, Next blocks until one is available and returns io.EOF once exhausted
+type ChangeSource interface {
+	Next(ctx context.Context) (ChangeEvent, error)
+}
+
+// ChannelSource is a ChangeSource fed by a channel, for adapting log readers such as MySQL binlog clients.
+// Closing the channel exhausts the source.
+type ChannelSource <-chan ChangeEvent
+
+func (s ChannelSource) Next(ctx context.Context) (ChangeEvent, error) {
+	select {
+	case <-ctx.Done():
+		return ChangeEvent{}, ctx.Err()
+	case event, ok := <-s:
+		if !ok {
+			return ChangeEvent{}, io.EOF
+		}
+
+		return event, nil
+	}
+}
+
+// Wal2JSONSource is a ChangeSource decoding the format-version 1 output of the wal2json Postgres plugin,
+// e.g. the output of pg_recvlogical --plugin=wal2json
+type Wal2JSONSource struct {
+	Reader io.Reader
+
+	decoder *json.Decoder
+	pending []ChangeEvent
+}
+
+type wal2JSONMessage struct {
+	Change []struct {
+		Kind         string   `json:"kind"`
+		Table        string   `json:"table"`
+		ColumnNames  []string `json:"columnnames"`
+		ColumnValues []any    `json:"columnvalues"`
+		OldKeys      struct {
+			KeyNames  []string `json:"keynames"`
+			KeyValues []any    `json:"keyvalues"`
+		} `json:"oldkeys"`
+	} `json:"change"`
+}
+
+func (s *Wal2JSONSource) Next(ctx context.Context) (ChangeEvent, error) {
+	if s.decoder == nil {
+		s.decoder = json.NewDecoder(s.Reader)
+		s.decoder.UseNumber()
+	}
+
+	for len(s.pending) == 0 {
+		if err := ctx.Err(); err != nil {
+			return ChangeEvent{}, err
+		}
+
+		var message wal2JSONMessage
+		if err := s.decoder.Decode(&message); err != nil {
+			return ChangeEvent{}, err
+		}
+
+		for _, change := range message.Change {
+			event := ChangeEvent{
+				Table:      change.Table,
+				Columns:    wal2JSONColumns(change.ColumnNames, change.ColumnValues),
+				OldColumns: wal2JSONColumns(change.OldKeys.KeyNames, change.OldKeys.KeyValues),
+			}
+
+			switch change.Kind {
+			case "insert":
+				event.Operation = OperationCreate
+			case "update":
+				event.Operation = OperationUpdate
+			case "delete":
+				event.Operation = OperationDelete
+			default:
+				continue
+			}
+
+			s.pending = append(s.pending, event)
+		}
+	}
+
+	event := s.pending[0]
+	s.pending = s.pending[1:]
+
+	return event, nil
+}
+
+// wal2JSONColumns maps column values by name, numbers are kept as strings for Gorm to parse into their fields
+func wal2JSONColumns(names []string, values []any) map[string]any {
+	if len(names) == 0 {
+		return nil
+	}
+
+	columns := make(map[string]any, len(names))
+	for i, name := range names {
+		if i >= len(values) {
+			break
+		}
+
+		if number, ok := values[i].(json.Number); ok {
+			columns[name] = number.String()
+		} else {
+			columns[name] = values[i]
+		}
+	}
+
+	return columns
+}
+
+// ChangeConsumer feeds change events through the sync pipeline, covering writes that bypass the Gorm
+// callbacks such as raw SQL or other services. Inserted and updated rows are reloaded by primary key and
+// synced, the keys of deleted rows and those left behind by updates are deleted.
+type ChangeConsumer struct {
+	DB     *gorm.DB
+	KVSync KVSync
+	// Store is where keys are deleted, the one KVSync syncs to
+	Store  KVStore
+	Source ChangeSource
+	// Models are the synced models, events of other tables are ignored
+	Models []any
+}
+
+// Run applies events until the source is exhausted or fails, or until an event cannot be applied
+func (c *ChangeConsumer) Run(ctx context.Context) error {
+	for {
+		event, err := c.Source.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := c.Apply(ctx, event); err != nil {
+			return fmt.Errorf("cannot apply %s of table %s: %w", event.Operation, event.Table, err)
+		}
+	}
+}
+
+// Apply syncs a single change event
+func (c *ChangeConsumer) Apply(ctx context.Context, event ChangeEvent) error {
+	sch, ok, err := c.schema(event.Table)
+	if err != nil || !ok {
+		return err
+	}
+
+	if event.Operation == OperationDelete {
+		old, err := decodeRow(ctx, sch, event.OldColumns)
+		if err != nil {
+			return err
+		}
+
+		return c.deleteKeys(old, nil)
+	}
+
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil {
+		return fmt.Errorf("table %s has no primary key", event.Table)
+	}
+
+	pkValue, ok := event.Columns[pk.DBName]
+	if !ok {
+		return fmt.Errorf("event has no value for primary key %s", pk.DBName)
+	}
+
+	row, found := findRow(c.DB.WithContext(ctx), sch.ModelType, clause.Eq{Column: clause.Column{Name: pk.DBName}, Value: pkValue})
+	if !found {
+		// the row got deleted or soft deleted since
+		deleted, err := decodeRow(ctx, sch, event.Columns)
+		if err != nil {
+			return err
+		}
+
+		return c.deleteKeys(deleted, nil)
+	}
+
+	if err := c.KVSync.SyncAndWait(ctx, row); err != nil {
+		return err
+	}
+
+	if event.Operation != OperationUpdate || len(event.OldColumns) == 0 {
+		return nil
+	}
+
+	// without the whole old row, keys left behind cannot be told apart
+	old, err := decodeRow(ctx, sch, event.OldColumns)
+	if err != nil {
+		return nil
+	}
+
+	return c.deleteKeys(old, row)
+}
+
+// deleteKeys deletes the keys of an old row, or only those it no longer produces once updated to current
+func (c *ChangeConsumer) deleteKeys(old any, current any) error {
+	specs, ok := syncKeySpecs(old)
+	if !ok {
+		return nil
+	}
+
+	if current != nil {
+		specs = staleKeySpecs(specs, current)
+	}
+
+	for _, spec := range specs {
+		if err := deleteKey(c.Store, spec.Key); err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// schema returns the schema of the registered model of a table
+func (c *ChangeConsumer) schema(table string) (*schema.Schema, bool, error) {
+	for _, model := range c.Models {
+		stmt := &gorm.Statement{DB: c.DB}
+		if err := stmt.Parse(model); err != nil {
+			return nil, false, err
+		}
+
+		if stmt.Schema.Table == table {
+			return stmt.Schema, true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
+// decodeRow sets the fields of a new row from column values, all columns are required
+func decodeRow(ctx context.Context, sch *schema.Schema, columns map[string]any) (any, error) {
+	row := reflect.New(sch.ModelType).Elem()
+
+	for _, field := range sch.Fields {
+		if field.DBName == "" {
+			continue
+		}
+
+		value, ok := columns[field.DBName]
+		if !ok {
+			return nil, fmt.Errorf("column %s of table %s is missing, the whole row must be logged", field.DBName, sch.Table)
+		}
+
+		if err := field.Set(ctx, row, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return row.Interface(), nil
+}
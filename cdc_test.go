@@ -0,0 +1,86 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChangeConsumer(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	row := func(uuid string) map[string]any {
+		return map[string]any{"id": "1", "created_at": now, "updated_at": now, "deleted_at": nil, "uuid": uuid, "username": "cdc"}
+	}
+
+	events := make(chan kvsync.ChangeEvent, 10)
+	consumer := &kvsync.ChangeConsumer{
+		DB:     db,
+		KVSync: kvSync,
+		Store:  store,
+		Source: kvsync.ChannelSource(events),
+		Models: []any{&SyncedUser{}},
+	}
+
+	// raw SQL bypasses the Gorm callbacks
+	assert.NoError(t, db.Exec("INSERT INTO synced_users (id, created_at, updated_at, uuid, username) VALUES (1, ?, ?, 'cdc-uuid', 'cdc')", now, now).Error)
+	events <- kvsync.ChangeEvent{Table: "synced_users", Operation: kvsync.OperationCreate, Columns: row("cdc-uuid")}
+
+	assert.NoError(t, db.Exec("UPDATE synced_users SET uuid = 'cdc-uuid-2' WHERE id = 1").Error)
+	events <- kvsync.ChangeEvent{Table: "synced_users", Operation: kvsync.OperationUpdate, Columns: row("cdc-uuid-2"), OldColumns: row("cdc-uuid")}
+
+	events <- kvsync.ChangeEvent{Table: "unsynced_table", Operation: kvsync.OperationCreate}
+	close(events)
+
+	assert.NoError(t, consumer.Run(context.Background()))
+	assert.Contains(t, store.Store, "user:uuid:cdc-uuid-2")
+	assert.NotContains(t, store.Store, "user:uuid:cdc-uuid")
+	assert.Len(t, store.Store, 3)
+
+	assert.NoError(t, db.Exec("DELETE FROM synced_users WHERE id = 1").Error)
+	assert.NoError(t, consumer.Apply(context.Background(), kvsync.ChangeEvent{Table: "synced_users", Operation: kvsync.OperationDelete, OldColumns: row("cdc-uuid-2")}))
+	assert.Empty(t, store.Store)
+
+	// deleting keys requires the whole old row
+	assert.Error(t, consumer.Apply(context.Background(), kvsync.ChangeEvent{Table: "synced_users", Operation: kvsync.OperationDelete, OldColumns: map[string]any{"id": "1"}}))
+}
+
+func TestWal2JSONSource(t *testing.T) {
+	source := &kvsync.Wal2JSONSource{Reader: strings.NewReader(`
+{"change":[
+	{"kind":"insert","schema":"public","table":"synced_users","columnnames":["id","uuid"],"columntypes":["bigint","text"],"columnvalues":[1,"wal-uuid"]},
+	{"kind":"message","prefix":"ignored"},
+	{"kind":"delete","schema":"public","table":"synced_users","oldkeys":{"keynames":["id","uuid"],"keytypes":["bigint","text"],"keyvalues":[2,"deleted-uuid"]}}
+]}
+{"change":[{"kind":"update","schema":"public","table":"synced_users","columnnames":["id","uuid"],"columnvalues":[1,"wal-uuid-2"]}]}
+`)}
+
+	event, err := source.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.ChangeEvent{Table: "synced_users", Operation: kvsync.OperationCreate, Columns: map[string]any{"id": "1", "uuid": "wal-uuid"}}, event)
+
+	event, err = source.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.ChangeEvent{Table: "synced_users", Operation: kvsync.OperationDelete, OldColumns: map[string]any{"id": "2", "uuid": "deleted-uuid"}}, event)
+
+	event, err = source.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.OperationUpdate, event.Operation)
+
+	_, err = source.Next(context.Background())
+	assert.ErrorIs(t, err, io.EOF)
+}
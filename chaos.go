@@ -0,0 +1,162 @@
+package kvsync
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ChaosStore injects faults into the calls of a store, to test how the retries, failover and dead letters of
+// an application hold up. Faults are random, set Seed for reproducible runs in CI.
+type ChaosStore struct {
+	Store KVStore
+	// ErrorRate is the probability, from 0 to 1, of a call failing without reaching the store
+	ErrorRate float64
+	// PartialFailureRate is the probability of a write reaching the store but failing anyway, as when a
+	// connection drops before the reply
+	PartialFailureRate float64
+	// Err is the injected error, defaults to ErrStoreUnavailable
+	Err error
+	// Latency delays every call, plus a random delay up to LatencyJitter
+	Latency       time.Duration
+	LatencyJitter time.Duration
+	// Ops restricts the faults to some operations, e.g. OpPut, defaults to all
+	Ops []string
+	// Seed seeds the random faults when non-zero
+	Seed int64
+
+	rand  *rand.Rand
+	once  sync.Once
+	mutex sync.Mutex
+}
+
+func (c *ChaosStore) Fetch(key string, dest any) error {
+	return c.call(OpFetch, func() error {
+		return c.Store.Fetch(key, dest)
+	})
+}
+
+func (c *ChaosStore) Put(key string, value any) error {
+	return c.call(OpPut, func() error {
+		return c.Store.Put(key, value)
+	})
+}
+
+func (c *ChaosStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	return c.call(OpPut, func() error {
+		return putWithTTL(c.Store, key, value, ttl)
+	})
+}
+
+func (c *ChaosStore) Delete(key string) error {
+	return c.call(OpDelete, func() error {
+		return deleteKey(c.Store, key)
+	})
+}
+
+func (c *ChaosStore) Exists(key string) (found bool, err error) {
+	err = c.call(OpExists, func() error {
+		found, err = exists(c.Store, key)
+		return err
+	})
+
+	return found, err
+}
+
+func (c *ChaosStore) TTL(key string) (ttl time.Duration, err error) {
+	err = c.call(OpTTL, func() error {
+		ttl, err = keyTTL(c.Store, key)
+		return err
+	})
+
+	return ttl, err
+}
+
+func (c *ChaosStore) Touch(key string, ttl time.Duration) error {
+	return c.call(OpTouch, func() error {
+		return touchKey(c.Store, key, ttl)
+	})
+}
+
+func (c *ChaosStore) Keys(prefix string, limit int, cursor string) (keys []string, next string, err error) {
+	err = c.call(OpKeys, func() error {
+		keys, next, err = scan(c.Store, prefix, limit, cursor)
+		return err
+	})
+
+	return keys, next, err
+}
+
+func (c *ChaosStore) Ping(ctx context.Context) error {
+	return c.call(OpPing, func() error {
+		return ping(ctx, c.Store)
+	})
+}
+
+func (c *ChaosStore) call(op string, call func() error) error {
+	if !c.affects(op) {
+		return call()
+	}
+
+	delay, fail, partial := c.roll()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	if fail {
+		return c.fault(op)
+	}
+
+	err := call()
+	if err == nil && partial && op != OpFetch && op != OpPing && op != OpKeys && op != OpExists && op != OpTTL {
+		return c.fault(op)
+	}
+
+	return err
+}
+
+// roll draws the faults of a call
+func (c *ChaosStore) roll() (delay time.Duration, fail bool, partial bool) {
+	c.once.Do(func() {
+		seed := c.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		c.rand = rand.New(rand.NewSource(seed))
+	})
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delay = c.Latency
+	if c.LatencyJitter > 0 {
+		delay += time.Duration(c.rand.Int63n(int64(c.LatencyJitter)))
+	}
+
+	return delay, c.rand.Float64() < c.ErrorRate, c.rand.Float64() < c.PartialFailureRate
+}
+
+func (c *ChaosStore) fault(op string) error {
+	err := c.Err
+	if err == nil {
+		err = ErrStoreUnavailable
+	}
+
+	return fmt.Errorf("chaos: injected %s fault: %w", op, err)
+}
+
+func (c *ChaosStore) affects(op string) bool {
+	if len(c.Ops) == 0 {
+		return true
+	}
+
+	for _, o := range c.Ops {
+		if o == op {
+			return true
+		}
+	}
+
+	return false
+}
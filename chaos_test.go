@@ -0,0 +1,71 @@
+package kvsync_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestChaosStore(t *testing.T) {
+	memory := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	store := &kvsync.ChaosStore{Store: memory, ErrorRate: 0.5, Seed: 1}
+
+	failures := 0
+	for i := 0; i < 200; i++ {
+		err := store.Put(fmt.Sprintf("user:%d", i), User{ID: i})
+		if err != nil {
+			assert.ErrorIs(t, err, kvsync.ErrStoreUnavailable)
+			failures++
+		}
+	}
+	assert.InDelta(t, 100, failures, 30)
+	assert.Len(t, memory.Store, 200-failures)
+
+	// the same seed injects the same faults
+	replay := &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{Store: make(map[string]any)}, ErrorRate: 0.5, Seed: 1}
+	replayed := 0
+	for i := 0; i < 200; i++ {
+		if replay.Put(fmt.Sprintf("user:%d", i), User{ID: i}) != nil {
+			replayed++
+		}
+	}
+	assert.Equal(t, failures, replayed)
+}
+
+func TestChaosStore_PartialFailures(t *testing.T) {
+	errBroken := errors.New("broken pipe")
+	memory := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	store := &kvsync.ChaosStore{Store: memory, PartialFailureRate: 1, Err: errBroken}
+
+	assert.ErrorIs(t, store.Put("user:1", User{ID: 1}), errBroken)
+	assert.Equal(t, User{ID: 1}, memory.Store["user:1"])
+
+	var user User
+	assert.NoError(t, store.Fetch("user:1", &user))
+}
+
+func TestChaosStore_OpsAndLatency(t *testing.T) {
+	memory := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	store := kvsync.Chain(kvsync.Chaos(&kvsync.ChaosStore{
+		ErrorRate: 1,
+		Latency:   10 * time.Millisecond,
+		Ops:       []string{kvsync.OpDelete},
+	}))(memory)
+
+	started := time.Now()
+	assert.NoError(t, store.Put("user:1", User{ID: 1}))
+	assert.Less(t, time.Since(started), 10*time.Millisecond)
+
+	started = time.Now()
+	assert.ErrorIs(t, store.(kvsync.Deleter).Delete("user:1"), kvsync.ErrStoreUnavailable)
+	assert.GreaterOrEqual(t, time.Since(started), 10*time.Millisecond)
+	assert.Len(t, memory.Store, 1)
+}
+
+func TestChaosStore_OptionalInterfaces(t *testing.T) {
+	assertOptionalInterfaces(t, &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{Store: make(map[string]any)}, LatencyJitter: time.Millisecond})
+	assertOptionalInterfacesFail(t, &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{}, ErrorRate: 1}, kvsync.ErrStoreUnavailable)
+}
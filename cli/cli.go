@@ -0,0 +1,400 @@
+// Package cli implements the kvsync command, running operations against a database and a Redis store:
+//
+//	kvsync [flags] backfill [-job ID] [-resume] [-batch N] [-progress D] <model>
+//	kvsync [flags] verify [-batch N] <model>
+//	kvsync [flags] purge-prefix <prefix>
+//	kvsync [flags] get <key>
+//	kvsync [flags] stats
+//
+// backfill and verify are only available with Models and a Dialector, the kvsync binary has neither and ships the
+// other subcommands. Build a binary of your own passing them:
+//
+//	func main() {
+//		c := &cli.CLI{Models: []any{&User{}}, Dialector: postgres.Open}
+//		if err := c.Run(context.Background(), os.Args[1:]); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// CLI runs the kvsync subcommands
+type CLI struct {
+	// Models are the models backfill and verify accept, named by ModelName or table name. Without them, these
+	// subcommands are not available.
+	Models []any
+	// Dialector opens the database of a DSN, required by backfill and verify
+	Dialector func(dsn string) gorm.Dialector
+	Stdout    io.Writer
+	Stderr    io.Writer
+}
+
+type command struct {
+	usage string
+	run   func(c *CLI, ctx context.Context, env *env, args []string) error
+	// models is set for the commands loading the rows of Models
+	models bool
+}
+
+var commands = map[string]command{
+	"backfill":     {"backfill [-job ID] [-resume] [-batch N] [-progress D] <model>", (*CLI).backfill, true},
+	"verify":       {"verify [-batch N] <model>", (*CLI).verify, true},
+	"purge-prefix": {"purge-prefix <prefix>", (*CLI).purgePrefix, false},
+	"get":          {"get <key>", (*CLI).get, false},
+	"stats":        {"stats", (*CLI).stats, false},
+}
+
+var commandNames = []string{"backfill", "verify", "purge-prefix", "get", "stats"}
+
+// env holds the global flags, opening connections on demand
+type env struct {
+	dsn       string
+	redisAddr string
+	prefix    string
+	marshaler string
+	envelope  bool
+
+	dialector func(dsn string) gorm.Dialector
+	client    redis.UniversalClient
+}
+
+// Run parses the global flags and runs a subcommand
+func (c *CLI) Run(ctx context.Context, args []string) error {
+	e := &env{dialector: c.Dialector}
+
+	flags := c.flagSet("kvsync")
+	flags.StringVar(&e.dsn, "dsn", os.Getenv("KVSYNC_DSN"), "database DSN, defaults to $KVSYNC_DSN")
+	flags.StringVar(&e.redisAddr, "redis", envOr("KVSYNC_REDIS", "localhost:6379"), "comma-separated Redis addresses, defaults to $KVSYNC_REDIS")
+	flags.StringVar(&e.prefix, "prefix", "kvsync:", "prefix of the Redis keys")
+	flags.StringVar(&e.marshaler, "marshaler", "bson", "serialization of the values, bson or json")
+	flags.BoolVar(&e.envelope, "envelope", false, "values are wrapped in envelopes")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: kvsync [flags] <command> [args]\n\ncommands:")
+		for _, name := range commandNames {
+			if c.available(commands[name]) {
+				fmt.Fprintln(flags.Output(), "  "+commands[name].usage)
+			}
+		}
+		fmt.Fprintln(flags.Output(), "\nflags:")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if e.marshaler != "bson" && e.marshaler != "json" {
+		return fmt.Errorf("unknown marshaler %q", e.marshaler)
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+
+		return errors.New("missing command")
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown command %q", flags.Arg(0))
+	}
+
+	if !c.available(cmd) {
+		return fmt.Errorf("command %q needs models and a database driver, build a binary of your own passing them to cli.CLI", flags.Arg(0))
+	}
+	defer e.close()
+
+	return cmd.run(c, ctx, e, flags.Args()[1:])
+}
+
+// available reports whether a command can run with the models and database driver of the CLI
+func (c *CLI) available(cmd command) bool {
+	return !cmd.models || (len(c.Models) > 0 && c.Dialector != nil)
+}
+
+func (c *CLI) flagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr())
+
+	return flags
+}
+
+func (c *CLI) backfill(ctx context.Context, e *env, args []string) error {
+	flags := c.flagSet("backfill")
+	jobID := flags.String("job", "", "job ID, defaults to the model and the current time")
+	resume := flags.Bool("resume", false, "resume the job instead of starting it")
+	batchSize := flags.Int("batch", 500, "rows loaded per query")
+	every := flags.Duration("progress", 0, "print progress at this interval, counting the rows first")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	model, err := c.model(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	db, err := e.db()
+	if err != nil {
+		return err
+	}
+
+	store := e.store()
+	kvSync, err := kvsync.New(ctx, kvsync.WithStore(store))
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	backfiller := &kvsync.Backfiller{
+		DB:        db,
+		KVSync:    waitingSync{KVSync: kvSync, ctx: ctx},
+		Store:     store,
+		BatchSize: *batchSize,
+		Instance:  hostname,
+		Locker:    &kvsync.RedisLocker{Client: e.redis(), Prefix: e.prefix + "lock:"},
+	}
+
+	if *every > 0 {
+		var printed time.Time
+		backfiller.CountRows = true
+		backfiller.Progress = func(p kvsync.BackfillProgress) {
+			if time.Since(printed) < *every {
+				return
+			}
+			printed = time.Now()
+			fmt.Fprintf(c.stdout(), "job %s: %d/%d synced, %d failed, %.0f rows/s, ETA %s\n", p.JobID, p.Processed, p.Total,
+				p.Failed, p.Rate, p.ETA.Round(time.Second))
+		}
+	}
+
+	if *jobID == "" {
+		if *resume {
+			return errors.New("resuming requires -job")
+		}
+		*jobID = fmt.Sprintf("%s-%s", kvsync.ModelName(model), time.Now().UTC().Format("20060102150405"))
+	}
+
+	var checkpoint *kvsync.BackfillCheckpoint
+	if *resume {
+		checkpoint, err = backfiller.Resume(ctx, *jobID, model)
+	} else {
+		checkpoint, err = backfiller.Start(ctx, *jobID, model)
+	}
+
+	if checkpoint != nil {
+		fmt.Fprintf(c.stdout(), "job %s %s: %d synced, %d failed\n", checkpoint.JobID, checkpoint.Status, checkpoint.Processed, checkpoint.Failed)
+	}
+
+	return err
+}
+
+func (c *CLI) verify(ctx context.Context, e *env, args []string) error {
+	flags := c.flagSet("verify")
+	batchSize := flags.Int("batch", 500, "rows loaded per query")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	model, err := c.model(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	db, err := e.db()
+	if err != nil {
+		return err
+	}
+
+	verifier := &kvsync.Verifier{DB: db, Store: e.store(), BatchSize: *batchSize}
+	result, err := verifier.Verify(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range result.Missing {
+		fmt.Fprintln(c.stdout(), "missing", key)
+	}
+	for _, key := range result.Mismatched {
+		fmt.Fprintln(c.stdout(), "mismatched", key)
+	}
+	fmt.Fprintf(c.stdout(), "%d rows, %d keys verified\n", result.Rows, result.Keys)
+
+	if len(result.Missing) > 0 || len(result.Mismatched) > 0 {
+		return fmt.Errorf("%d missing and %d mismatched keys", len(result.Missing), len(result.Mismatched))
+	}
+
+	return nil
+}
+
+func (c *CLI) purgePrefix(_ context.Context, e *env, args []string) error {
+	if len(args) != 1 || args[0] == "" {
+		return errors.New("usage: purge-prefix <prefix>")
+	}
+
+	if err := e.store().DeleteByPrefix(args[0]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout(), "purged keys starting with %q\n", args[0])
+
+	return nil
+}
+
+func (c *CLI) get(_ context.Context, e *env, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: get <key>")
+	}
+
+	store := e.store()
+	stream, err := store.FetchStream(args[0])
+	if errors.Is(err, redis.Nil) {
+		return fmt.Errorf("key %s: %w", args[0], kvsync.ErrKeyNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return err
+	}
+
+	var value map[string]any
+	if err = store.Marshaler.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	return printJSON(c.stdout(), value)
+}
+
+func (c *CLI) stats(_ context.Context, e *env, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: stats")
+	}
+
+	counts, err := countKeys(e.store())
+	if err != nil {
+		return err
+	}
+
+	printCounts(c.stdout(), counts)
+
+	backfiller := &kvsync.Backfiller{Store: e.store()}
+	checkpoints, err := backfiller.List()
+	if err != nil {
+		return err
+	}
+
+	for _, checkpoint := range checkpoints {
+		fmt.Fprintf(c.stdout(), "backfill %s (%s) %s: %d synced, %d failed, updated %s\n", checkpoint.JobID,
+			checkpoint.Model, checkpoint.Status, checkpoint.Processed, checkpoint.Failed, checkpoint.UpdatedAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// model returns the model named by the only argument
+func (c *CLI) model(args []string) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected one model")
+	}
+
+	names := make([]string, 0, len(c.Models))
+	for _, model := range c.Models {
+		name := kvsync.ModelName(model)
+		if args[0] == name || args[0] == tableName(model) {
+			return model, nil
+		}
+		names = append(names, name)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("unknown model %s, this binary has no models", args[0])
+	}
+
+	return nil, fmt.Errorf("unknown model %s, expected one of %s", args[0], strings.Join(names, ", "))
+}
+
+func (c *CLI) stdout() io.Writer {
+	if c.Stdout == nil {
+		return os.Stdout
+	}
+
+	return c.Stdout
+}
+
+func (c *CLI) stderr() io.Writer {
+	if c.Stderr == nil {
+		return os.Stderr
+	}
+
+	return c.Stderr
+}
+
+func (e *env) db() (*gorm.DB, error) {
+	if e.dsn == "" {
+		return nil, errors.New("missing -dsn")
+	}
+
+	return gorm.Open(e.dialector(e.dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+}
+
+func (e *env) redis() redis.UniversalClient {
+	if e.client == nil {
+		e.client = redis.NewUniversalClient(&redis.UniversalOptions{Addrs: strings.Split(e.redisAddr, ",")})
+	}
+
+	return e.client
+}
+
+func (e *env) store() *kvsync.RedisStore {
+	var marshaler kvsync.MarshalingAdapter = &kvsync.BSONMarshalingAdapter{}
+	if e.marshaler == "json" {
+		marshaler = &kvsync.CanonicalJSONMarshalingAdapter{}
+	}
+
+	if e.envelope {
+		marshaler = &kvsync.EnvelopeMarshaler{Marshaler: marshaler}
+	}
+
+	return &kvsync.RedisStore{Client: e.redis(), Prefix: e.prefix, Marshaler: marshaler}
+}
+
+func (e *env) close() {
+	if e.client != nil {
+		_ = e.client.Close()
+	}
+}
+
+// waitingSync syncs synchronously, so that backfills only complete once all their rows are written
+type waitingSync struct {
+	kvsync.KVSync
+	ctx context.Context
+}
+
+func (w waitingSync) Sync(entity any, opts ...kvsync.SyncOption) error {
+	return w.SyncAndWait(w.ctx, entity, opts...)
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return fallback
+}
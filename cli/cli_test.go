@@ -0,0 +1,106 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ndthuan/kvsync"
+	"github.com/ndthuan/kvsync/cli"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"path/filepath"
+	"testing"
+)
+
+type Product struct {
+	ID   uint
+	SKU  string
+	Name string
+}
+
+func (p Product) SyncKeys() map[string]string {
+	return map[string]string{
+		"id":  fmt.Sprintf("product:id:%d", p.ID),
+		"sku": fmt.Sprintf("product:sku:%s", p.SKU),
+	}
+}
+
+func TestCLI(t *testing.T) {
+	mr := miniredis.RunT(t)
+	dsn := filepath.Join(t.TempDir(), "cli.db")
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&Product{}))
+	for i := 1; i <= 3; i++ {
+		db.Create(&Product{SKU: fmt.Sprintf("sku-%d", i), Name: fmt.Sprintf("product %d", i)})
+	}
+
+	run := func(args ...string) (string, error) {
+		var stdout bytes.Buffer
+		c := &cli.CLI{Models: []any{&Product{}}, Dialector: sqlite.Open, Stdout: &stdout, Stderr: &bytes.Buffer{}}
+		err := c.Run(context.Background(), append([]string{"-dsn", dsn, "-redis", mr.Addr()}, args...))
+
+		return stdout.String(), err
+	}
+
+	out, err := run("verify", "products")
+	assert.EqualError(t, err, "6 missing and 0 mismatched keys")
+	assert.Contains(t, out, "missing product:id:1\n")
+
+	out, err = run("backfill", "-job", "products-1", "-batch", "2", "products")
+	assert.NoError(t, err)
+	assert.Equal(t, "job products-1 completed: 3 synced, 0 failed\n", out)
+
+	out, err = run("verify", "cli_test.Product")
+	assert.NoError(t, err)
+	assert.Equal(t, "3 rows, 6 keys verified\n", out)
+
+	out, err = run("get", "product:sku:sku-2")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"name": "product 2"`)
+
+	_, err = run("get", "product:sku:unknown")
+	assert.ErrorIs(t, err, kvsync.ErrKeyNotFound)
+
+	out, err = run("stats")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "product    6\n")
+	assert.Contains(t, out, "backfill products-1 (cli_test.Product) completed: 3 synced, 0 failed")
+
+	out, err = run("purge-prefix", "product:sku:")
+	assert.NoError(t, err)
+	assert.Equal(t, "purged keys starting with \"product:sku:\"\n", out)
+
+	out, err = run("verify", "products")
+	assert.Error(t, err)
+	assert.Contains(t, out, "missing product:sku:sku-1\n")
+
+	_, err = run("backfill", "users")
+	assert.EqualError(t, err, "unknown model users, expected one of cli_test.Product")
+
+	_, err = run("unknown")
+	assert.EqualError(t, err, `unknown command "unknown"`)
+}
+
+func TestCLI_WithoutModels(t *testing.T) {
+	mr := miniredis.RunT(t)
+	assert.NoError(t, mr.Set("kvsync:product:id:1", "value"))
+
+	var stdout, stderr bytes.Buffer
+	c := &cli.CLI{Stdout: &stdout, Stderr: &stderr}
+
+	err := c.Run(context.Background(), []string{"-redis", mr.Addr(), "backfill", "products"})
+	assert.EqualError(t, err, `command "backfill" needs models and a database driver, build a binary of your own passing them to cli.CLI`)
+
+	err = c.Run(context.Background(), []string{"-redis", mr.Addr(), "stats"})
+	assert.NoError(t, err)
+	assert.Contains(t, stdout.String(), "product    1\n")
+
+	err = c.Run(context.Background(), []string{"-redis", mr.Addr()})
+	assert.EqualError(t, err, "missing command")
+	assert.Contains(t, stderr.String(), "  stats\n")
+	assert.NotContains(t, stderr.String(), "backfill")
+}
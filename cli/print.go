@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"gorm.io/gorm/schema"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// countKeys counts the keys of a store by namespace, the part of the key before the first colon
+func countKeys(store kvsync.KeyScanner) (map[string]int, error) {
+	counts := make(map[string]int)
+
+	cursor := ""
+	for {
+		keys, next, err := store.Keys("", 1000, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			namespace, _, _ := strings.Cut(key, ":")
+			counts[namespace]++
+		}
+
+		if next == "" {
+			return counts, nil
+		}
+		cursor = next
+	}
+}
+
+func printCounts(w io.Writer, counts map[string]int) {
+	namespaces := make([]string, 0, len(counts))
+	total := 0
+	for namespace, count := range counts {
+		namespaces = append(namespaces, namespace)
+		total += count
+	}
+	sort.Strings(namespaces)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tKEYS")
+	for _, namespace := range namespaces {
+		fmt.Fprintf(tw, "%s\t%d\n", namespace, counts[namespace])
+	}
+	fmt.Fprintf(tw, "total\t%d\n", total)
+	_ = tw.Flush()
+}
+
+func printJSON(w io.Writer, value any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}
+
+func tableName(model any) string {
+	s, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		return ""
+	}
+
+	return s.Table
+}
@@ -0,0 +1,29 @@
+// Command kvsync runs operations against the Redis store models are synced to:
+//
+//	kvsync -redis localhost:6379 stats
+//	kvsync get user:id:42
+//	kvsync purge-prefix user:
+//
+// This binary knows no models nor database driver, so it ships without backfill and verify. It doubles as a
+// template for a binary of your own passing them to cli.CLI, see the documentation of package cli.
+package main
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync/cli"
+	"log"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("kvsync: ")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := (&cli.CLI{}).Run(ctx, os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
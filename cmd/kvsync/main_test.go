@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestMain_PurgePrefix(t *testing.T) {
+	mr := miniredis.RunT(t)
+	assert.NoError(t, mr.Set("kvsync:user:id:1", "value"))
+	assert.NoError(t, mr.Set("kvsync:product:id:1", "value"))
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"kvsync", "-redis", mr.Addr(), "purge-prefix", "user:"}
+
+	main()
+
+	assert.False(t, mr.Exists("kvsync:user:id:1"))
+	assert.True(t, mr.Exists("kvsync:product:id:1"))
+}
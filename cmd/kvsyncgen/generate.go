@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"time"
+	"unicode"
+)
+
+// syncKey is a key declared with a kvsync:"key=..." struct tag
+type syncKey struct {
+	name string
+	expr string
+	ttl  time.Duration
+}
+
+// model is a struct declaring sync keys
+type model struct {
+	name string
+	keys []syncKey
+}
+
+// findModels returns the structs of a file declaring keys with struct tags, restricted to types when not empty
+func findModels(file *ast.File, types map[string]bool) ([]model, error) {
+	var models []model
+
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			if !ok || (len(types) > 0 && !types[typeSpec.Name.Name]) {
+				continue
+			}
+
+			m := model{name: typeSpec.Name.Name}
+			receiver := receiverName(m.name)
+
+			for _, field := range structType.Fields.List {
+				if field.Tag == nil {
+					continue
+				}
+
+				tag, err := strconv.Unquote(field.Tag.Value)
+				if err != nil {
+					return nil, err
+				}
+
+				key, ok, err := parseKeyTag(reflect.StructTag(tag).Get("kvsync"), fieldName(field), receiver)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", m.name, fieldName(field), err)
+				}
+				if ok {
+					m.keys = append(m.keys, key)
+				}
+			}
+
+			if len(m.keys) > 0 {
+				models = append(models, m)
+			}
+		}
+	}
+
+	return models, nil
+}
+
+// parseKeyTag parses the key=, keyname= and ttl= options of a kvsync tag
+func parseKeyTag(tag string, field string, receiver string) (syncKey, bool, error) {
+	key := syncKey{name: strings.ToLower(field)}
+	var tmpl string
+
+	for _, option := range strings.Split(tag, ",") {
+		switch {
+		case strings.HasPrefix(option, "key="):
+			tmpl = strings.TrimPrefix(option, "key=")
+		case strings.HasPrefix(option, "keyname="):
+			key.name = strings.TrimPrefix(option, "keyname=")
+		case strings.HasPrefix(option, "ttl="):
+			ttl, err := time.ParseDuration(strings.TrimPrefix(option, "ttl="))
+			if err != nil {
+				return syncKey{}, false, err
+			}
+			key.ttl = ttl
+		}
+	}
+
+	if tmpl == "" {
+		return syncKey{}, false, nil
+	}
+
+	expr, err := templateExpr(tmpl, receiver)
+	if err != nil {
+		return syncKey{}, false, err
+	}
+	key.expr = expr
+
+	return key, true, nil
+}
+
+// templateExpr translates a key template into a Go expression concatenating its parts, supporting
+// {{.Field}} and {{part .Field}}, both formatted with kvsync.KeyPart like kvsync.TagKeySpecs does
+func templateExpr(tmpl string, receiver string) (string, error) {
+	trees, err := parse.Parse("key", tmpl, "{{", "}}", map[string]any{"part": fmt.Sprint})
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, node := range trees["key"].Root.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			parts = append(parts, strconv.Quote(string(n.Text)))
+		case *parse.ActionNode:
+			part, err := actionExpr(n, receiver)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		default:
+			return "", fmt.Errorf("unsupported template node %q", node.String())
+		}
+	}
+
+	if len(parts) == 0 {
+		return `""`, nil
+	}
+
+	return strings.Join(parts, " + "), nil
+}
+
+func actionExpr(action *parse.ActionNode, receiver string) (string, error) {
+	if len(action.Pipe.Decl) > 0 || len(action.Pipe.Cmds) != 1 {
+		return "", fmt.Errorf("unsupported action %s", action)
+	}
+
+	args := action.Pipe.Cmds[0].Args
+	switch {
+	case len(args) == 1:
+		if field, ok := args[0].(*parse.FieldNode); ok {
+			return "kvsync.KeyPart(" + receiver + "." + strings.Join(field.Ident, ".") + ")", nil
+		}
+	case len(args) == 2:
+		ident, isIdent := args[0].(*parse.IdentifierNode)
+		field, isField := args[1].(*parse.FieldNode)
+		if isIdent && isField && ident.Ident == "part" {
+			return "kvsync.KeyPart(" + receiver + "." + strings.Join(field.Ident, ".") + ")", nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported action %s", action)
+}
+
+// generate renders the SyncKeys, or SyncKeySpecs when a key has a TTL, methods of models
+func generate(pkg string, models []model) ([]byte, error) {
+	var buf bytes.Buffer
+
+	usesKVSync, usesTime := false, false
+	for _, m := range models {
+		for _, key := range m.keys {
+			usesKVSync = usesKVSync || strings.Contains(key.expr, "kvsync.KeyPart(") || hasTTL(m)
+			usesTime = usesTime || key.ttl > 0
+		}
+	}
+
+	fmt.Fprintf(&buf, "// Code generated by kvsyncgen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg)
+	if usesKVSync {
+		buf.WriteString("\t\"github.com/ndthuan/kvsync\"\n")
+	}
+	if usesTime {
+		buf.WriteString("\t\"time\"\n")
+	}
+	buf.WriteString(")\n")
+
+	for _, m := range models {
+		keys := append([]syncKey(nil), m.keys...)
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].name < keys[j].name
+		})
+
+		receiver := receiverName(m.name)
+
+		if hasTTL(m) {
+			fmt.Fprintf(&buf, "\nfunc (%s %s) SyncKeySpecs() map[string]kvsync.KeySpec {\n\treturn map[string]kvsync.KeySpec{\n", receiver, m.name)
+			for _, key := range keys {
+				fmt.Fprintf(&buf, "\t\t%q: {Key: %s", key.name, key.expr)
+				if key.ttl > 0 {
+					fmt.Fprintf(&buf, ", TTL: %s", durationExpr(key.ttl))
+				}
+				buf.WriteString("},\n")
+			}
+		} else {
+			fmt.Fprintf(&buf, "\nfunc (%s %s) SyncKeys() map[string]string {\n\treturn map[string]string{\n", receiver, m.name)
+			for _, key := range keys {
+				fmt.Fprintf(&buf, "\t\t%q: %s,\n", key.name, key.expr)
+			}
+		}
+
+		buf.WriteString("\t}\n}\n")
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+func durationExpr(d time.Duration) string {
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+	} {
+		if d%unit.d == 0 {
+			return fmt.Sprintf("%d * %s", d/unit.d, unit.name)
+		}
+	}
+
+	return fmt.Sprintf("time.Duration(%d)", d)
+}
+
+func hasTTL(m model) bool {
+	for _, key := range m.keys {
+		if key.ttl > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func receiverName(typeName string) string {
+	return string(unicode.ToLower([]rune(typeName)[0]))
+}
+
+func fieldName(field *ast.Field) string {
+	if len(field.Names) > 0 {
+		return field.Names[0].Name
+	}
+
+	// embedded field
+	switch t := field.Type.(type) {
+	case *ast.StarExpr:
+		return fieldName(&ast.Field{Type: t.X})
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+
+	return ""
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const models = `package models
+
+import "gorm.io/gorm"
+
+type User struct {
+	gorm.Model ` + "`kvsync:\"key=user:id:{{.ID}}\"`" + `
+	UUID     [16]byte ` + "`kvsync:\"key=user:uuid:{{part .UUID}}\"`" + `
+	Username string   ` + "`kvsync:\"key=user:composite:{{.ID}}_{{.Username}},keyname=composite,ttl=1h\"`" + `
+}
+
+type Product struct {
+	SKU string ` + "`kvsync:\"key=product:{{.SKU}}\"`" + `
+}
+
+type Unsynced struct {
+	Name string ` + "`json:\"name\"`" + `
+}
+`
+
+const want = `// Code generated by kvsyncgen. DO NOT EDIT.
+
+package models
+
+import (
+	"github.com/ndthuan/kvsync"
+	"time"
+)
+
+func (p Product) SyncKeys() map[string]string {
+	return map[string]string{
+		"sku": "product:" + kvsync.KeyPart(p.SKU),
+	}
+}
+
+func (u User) SyncKeySpecs() map[string]kvsync.KeySpec {
+	return map[string]kvsync.KeySpec{
+		"composite": {Key: "user:composite:" + kvsync.KeyPart(u.ID) + "_" + kvsync.KeyPart(u.Username), TTL: 1 * time.Hour},
+		"model":     {Key: "user:id:" + kvsync.KeyPart(u.ID)},
+		"uuid":      {Key: "user:uuid:" + kvsync.KeyPart(u.UUID)},
+	}
+}
+`
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "models.go"), []byte(models), 0644))
+
+	output := filepath.Join(dir, "kvsync_keys_gen.go")
+	assert.NoError(t, run(dir, nil, output))
+
+	generated, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, want, string(generated))
+
+	// the generated file is skipped when regenerating
+	assert.NoError(t, run(dir, map[string]bool{"Product": true}, output))
+	generated, err = os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(generated), "User")
+}
+
+func TestMain_Type(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "models.go"), []byte(models), 0644))
+
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{"kvsyncgen", "-type", "Product", dir}
+
+	main()
+
+	generated, err := os.ReadFile(filepath.Join(dir, "kvsync_keys_gen.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(generated), "func (p Product) SyncKeys()")
+	assert.NotContains(t, string(generated), "User")
+}
+
+func TestTemplateExpr_Unsupported(t *testing.T) {
+	_, err := templateExpr("user:{{if .Admin}}admin{{end}}", "u")
+	assert.Error(t, err)
+
+	_, err = templateExpr("user:{{printf \"%d\" .ID}}", "u")
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+// Command kvsyncgen generates the SyncKeys or SyncKeySpecs methods of structs declaring their sync keys with
+// kvsync struct tags, avoiding runtime template evaluation. Typical usage, in the file declaring the models:
+//
+//	//go:generate kvsyncgen -type User,Product
+//
+// Flags:
+//
+//	-type    comma-separated struct names, defaults to all structs with key tags
+//	-output  output file, defaults to kvsync_keys_gen.go in the package directory
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("kvsyncgen: ")
+
+	typeNames := flag.String("type", "", "comma-separated struct names, defaults to all structs with key tags")
+	output := flag.String("output", "", "output file, defaults to kvsync_keys_gen.go in the package directory")
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	types := make(map[string]bool)
+	for _, name := range strings.Split(*typeNames, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			types[name] = true
+		}
+	}
+
+	if *output == "" {
+		*output = filepath.Join(dir, "kvsync_keys_gen.go")
+	}
+
+	if err := run(dir, types, *output); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(dir string, types map[string]bool, output string) error {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		name := info.Name()
+
+		return !strings.HasSuffix(name, "_test.go") && filepath.Join(dir, name) != filepath.Clean(output)
+	}, 0)
+	if err != nil {
+		return err
+	}
+
+	if len(pkgs) != 1 {
+		return fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs))
+	}
+
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+
+	var models []model
+	for _, file := range pkg.Files {
+		found, err := findModels(file, types)
+		if err != nil {
+			return err
+		}
+		models = append(models, found...)
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].name < models[j].name
+	})
+
+	if len(models) == 0 {
+		return fmt.Errorf("no struct with key tags found in %s", dir)
+	}
+
+	src, err := generate(pkg.Name, models)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(output, src, 0644)
+}
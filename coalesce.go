@@ -0,0 +1,203 @@
+package kvsync
+
+import (
+	"encoding/json"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CoalescingStats are the fetch deduplication statistics of a key pattern
+type CoalescingStats struct {
+	// Loads is the number of fetches that hit the underlying store
+	Loads int64
+	// Deduplicated is the number of fetches served by another caller's in-flight load
+	Deduplicated int64
+	// Stampedes is the number of loads joined by at least StampedeThreshold callers
+	Stampedes int64
+	// MaxConcurrent is the highest number of callers that shared one load
+	MaxConcurrent int64
+}
+
+type coalescedCall struct {
+	done     chan struct{}
+	destType reflect.Type
+	// payload is the loaded value marshaled to JSON, unmarshaled by every waiting caller into its own copy
+	payload []byte
+	err     error
+	callers int64
+}
+
+// CoalescingStore wraps a KVStore so that concurrent Fetches of the same key share a single load,
+// keeping statistics of the prevented duplicate loads per key pattern. Callers sharing a load get their own
+// copy of the value, decoded from its JSON encoding. The optional interfaces of the wrapped store are
+// forwarded without coalescing.
+type CoalescingStore struct {
+	KVStore
+	// StampedeThreshold is the number of concurrent callers of a key counted as a stampede, defaults to 10
+	StampedeThreshold int
+	// Pattern maps a key to the pattern its statistics are aggregated under,
+	// defaults to the key up to its last colon
+	Pattern func(key string) string
+
+	calls map[string]*coalescedCall
+	stats map[string]*CoalescingStats
+	mutex sync.Mutex
+}
+
+// NewCoalescingStore creates a new CoalescingStore
+func NewCoalescingStore(store KVStore) *CoalescingStore {
+	return &CoalescingStore{
+		KVStore: store,
+	}
+}
+
+func (c *CoalescingStore) Fetch(key string, dest any) error {
+	destVal := reflect.ValueOf(dest)
+	if destVal.Kind() != reflect.Ptr || destVal.IsNil() {
+		return c.KVStore.Fetch(key, dest)
+	}
+
+	c.mutex.Lock()
+
+	if c.calls == nil {
+		c.calls = make(map[string]*coalescedCall)
+		c.stats = make(map[string]*CoalescingStats)
+	}
+
+	stats := c.patternStats(key)
+
+	if call, ok := c.calls[key]; ok && call.destType == destVal.Type() {
+		call.callers++
+		stats.Deduplicated++
+		c.mutex.Unlock()
+
+		<-call.done
+
+		if call.err != nil {
+			return call.err
+		}
+
+		destVal.Elem().Set(reflect.Zero(destVal.Type().Elem()))
+		if err := json.Unmarshal(call.payload, dest); err != nil {
+			return &MarshalError{Key: key, Unmarshal: true, Err: err}
+		}
+
+		return nil
+	}
+
+	call := &coalescedCall{
+		done:     make(chan struct{}),
+		destType: destVal.Type(),
+		callers:  1,
+	}
+	c.calls[key] = call
+	stats.Loads++
+
+	c.mutex.Unlock()
+
+	defer c.finish(key, call, stats)
+
+	if call.err = c.KVStore.Fetch(key, dest); call.err != nil {
+		return call.err
+	}
+
+	if payload, err := json.Marshal(dest); err != nil {
+		call.err = &MarshalError{Key: key, Err: err}
+	} else {
+		call.payload = payload
+	}
+
+	return nil
+}
+
+func (c *CoalescingStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	return putWithTTL(c.KVStore, key, value, ttl)
+}
+
+func (c *CoalescingStore) Delete(key string) error {
+	return deleteKey(c.KVStore, key)
+}
+
+func (c *CoalescingStore) Exists(key string) (bool, error) {
+	return exists(c.KVStore, key)
+}
+
+func (c *CoalescingStore) TTL(key string) (time.Duration, error) {
+	return keyTTL(c.KVStore, key)
+}
+
+func (c *CoalescingStore) Touch(key string, ttl time.Duration) error {
+	return touchKey(c.KVStore, key, ttl)
+}
+
+func (c *CoalescingStore) Keys(prefix string, limit int, cursor string) ([]string, string, error) {
+	return scan(c.KVStore, prefix, limit, cursor)
+}
+
+// finish ends the load of a key, even when the wrapped store panicked, releasing the callers waiting for it
+func (c *CoalescingStore) finish(key string, call *coalescedCall, stats *CoalescingStats) {
+	if r := recover(); r != nil {
+		call.err = &PanicError{Value: r, Stack: debug.Stack()}
+		defer panic(r)
+	}
+
+	c.mutex.Lock()
+	delete(c.calls, key)
+	if call.callers > stats.MaxConcurrent {
+		stats.MaxConcurrent = call.callers
+	}
+	if call.callers >= int64(c.stampedeThreshold()) {
+		stats.Stampedes++
+	}
+	c.mutex.Unlock()
+
+	close(call.done)
+}
+
+// Stats returns the deduplication statistics by key pattern
+func (c *CoalescingStore) Stats() map[string]CoalescingStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := make(map[string]CoalescingStats, len(c.stats))
+	for pattern, s := range c.stats {
+		stats[pattern] = *s
+	}
+
+	return stats
+}
+
+func (c *CoalescingStore) patternStats(key string) *CoalescingStats {
+	pattern := c.pattern(key)
+
+	stats, ok := c.stats[pattern]
+	if !ok {
+		stats = &CoalescingStats{}
+		c.stats[pattern] = stats
+	}
+
+	return stats
+}
+
+func (c *CoalescingStore) pattern(key string) string {
+	if c.Pattern != nil {
+		return c.Pattern(key)
+	}
+
+	if i := strings.LastIndex(key, ":"); i >= 0 {
+		return key[:i+1] + "*"
+	}
+
+	return key
+}
+
+func (c *CoalescingStore) stampedeThreshold() int {
+	if c.StampedeThreshold < 1 {
+		return 10
+	}
+
+	return c.StampedeThreshold
+}
@@ -0,0 +1,160 @@
+package kvsync_test
+
+import (
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type blockingStore struct {
+	*kvsync.InMemoryStore
+	release chan struct{}
+}
+
+func (b *blockingStore) Fetch(key string, dest any) error {
+	<-b.release
+
+	return b.InMemoryStore.Fetch(key, dest)
+}
+
+func TestCoalescingStore(t *testing.T) {
+	store := &blockingStore{
+		InMemoryStore: &kvsync.InMemoryStore{Store: make(map[string]any)},
+		release:       make(chan struct{}),
+	}
+	assert.NoError(t, store.Put("user:id:1", SyncedUser{Username: "coalesced"}))
+
+	coalescing := kvsync.NewCoalescingStore(store)
+	coalescing.StampedeThreshold = 5
+
+	var wg sync.WaitGroup
+	users := make([]SyncedUser, 10)
+	for i := range users {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, coalescing.Fetch("user:id:1", &users[i]))
+		}(i)
+	}
+
+	assert.Eventually(t, func() bool {
+		return coalescing.Stats()["user:id:*"].Deduplicated == 9
+	}, time.Second, time.Millisecond)
+
+	close(store.release)
+	wg.Wait()
+
+	for _, user := range users {
+		assert.Equal(t, "coalesced", user.Username)
+	}
+
+	assert.Equal(t, kvsync.CoalescingStats{
+		Loads:         1,
+		Deduplicated:  9,
+		Stampedes:     1,
+		MaxConcurrent: 10,
+	}, coalescing.Stats()["user:id:*"])
+
+	assert.Error(t, coalescing.Fetch("user:id:2", &SyncedUser{}))
+	assert.Equal(t, int64(2), coalescing.Stats()["user:id:*"].Loads)
+}
+
+// explodingStore panics fetching once released
+type explodingStore struct {
+	*kvsync.InMemoryStore
+	release chan struct{}
+}
+
+func (p *explodingStore) Fetch(key string, dest any) error {
+	<-p.release
+
+	panic("broken marshaler")
+}
+
+func TestCoalescingStore_Copies(t *testing.T) {
+	type Tagged struct {
+		ID     int
+		Tags   []string
+		Labels map[string]string
+	}
+
+	store := &blockingStore{
+		InMemoryStore: &kvsync.InMemoryStore{Store: make(map[string]any)},
+		release:       make(chan struct{}),
+	}
+	assert.NoError(t, store.Put("tagged:1", Tagged{ID: 1, Tags: []string{"a"}, Labels: map[string]string{"k": "v"}}))
+
+	coalescing := kvsync.NewCoalescingStore(store)
+
+	var wg sync.WaitGroup
+	values := make([]Tagged, 3)
+	values[1].Tags = []string{"stale", "values"}
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, coalescing.Fetch("tagged:1", &values[i]))
+		}(i)
+	}
+
+	assert.Eventually(t, func() bool {
+		return coalescing.Stats()["tagged:*"].Deduplicated == 2
+	}, time.Second, time.Millisecond)
+
+	close(store.release)
+	wg.Wait()
+
+	values[0].Tags[0] = "mutated"
+	values[0].Labels["k"] = "mutated"
+
+	for _, value := range values[1:] {
+		assert.Equal(t, Tagged{ID: 1, Tags: []string{"a"}, Labels: map[string]string{"k": "v"}}, value, "callers get their own copy")
+	}
+}
+
+func TestCoalescingStore_Panic(t *testing.T) {
+	store := &explodingStore{
+		InMemoryStore: &kvsync.InMemoryStore{Store: make(map[string]any)},
+		release:       make(chan struct{}),
+	}
+	coalescing := kvsync.NewCoalescingStore(store)
+
+	recovered := make(chan any)
+	go func() {
+		defer func() {
+			recovered <- recover()
+		}()
+		_ = coalescing.Fetch("user:id:1", &SyncedUser{})
+	}()
+
+	assert.Eventually(t, func() bool {
+		return coalescing.Stats()["user:id:*"].Loads == 1
+	}, time.Second, time.Millisecond)
+
+	waited := make(chan error)
+	go func() {
+		waited <- coalescing.Fetch("user:id:1", &SyncedUser{})
+	}()
+
+	assert.Eventually(t, func() bool {
+		return coalescing.Stats()["user:id:*"].Deduplicated == 1
+	}, time.Second, time.Millisecond)
+
+	close(store.release)
+	assert.Equal(t, "broken marshaler", <-recovered, "the panic reaches the loading caller")
+
+	var panicErr *kvsync.PanicError
+	assert.ErrorAs(t, <-waited, &panicErr, "waiting callers are released")
+	assert.Equal(t, "broken marshaler", panicErr.Value)
+
+	assert.Panics(t, func() {
+		_ = coalescing.Fetch("user:id:1", &SyncedUser{})
+	}, "the failed load is not shared with later callers")
+}
+
+func TestCoalescingStore_OptionalInterfaces(t *testing.T) {
+	assertOptionalInterfaces(t, kvsync.NewCoalescingStore(&kvsync.InMemoryStore{Store: make(map[string]any)}))
+	assertOptionalInterfacesFail(t, kvsync.NewCoalescingStore(&kvsync.ChaosStore{Store: &kvsync.InMemoryStore{}, ErrorRate: 1}), kvsync.ErrStoreUnavailable)
+}
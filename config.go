@@ -0,0 +1,284 @@
+package kvsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ModelConfig is the runtime configuration of a model type
+type ModelConfig struct {
+	// TTL overrides the expiration of all keys of the model when positive
+	TTL time.Duration
+	// KeyTTLs overrides the expiration of individual keys by key name, taking precedence over TTL
+	KeyTTLs map[string]time.Duration
+	// Keys routes the model to the named keys only when set, its other keys are no longer written
+	Keys []string
+	// Exclude filters out entities having one of the listed values, formatted with fmt.Sprint, in the named field,
+	// e.g. {"TenantID": {"42"}}, like the Filter option
+	Exclude map[string][]string
+	// Disabled stops syncing the model
+	Disabled bool
+}
+
+// Config is the runtime configuration of models, keyed by ModelName
+type Config struct {
+	Models map[string]ModelConfig
+}
+
+// Validate checks the configuration for invalid values
+func (c Config) Validate() error {
+	for model, mc := range c.Models {
+		if mc.TTL < 0 {
+			return fmt.Errorf("model %s: negative TTL", model)
+		}
+
+		for keyName, ttl := range mc.KeyTTLs {
+			if ttl < 0 {
+				return fmt.Errorf("model %s: negative TTL for key %s", model, keyName)
+			}
+		}
+
+		for _, keyName := range mc.Keys {
+			if keyName == "" {
+				return fmt.Errorf("model %s: empty key name", model)
+			}
+		}
+
+		for field := range mc.Exclude {
+			if field == "" {
+				return fmt.Errorf("model %s: empty excluded field name", model)
+			}
+		}
+	}
+
+	return nil
+}
+
+// model returns the configuration of a model, the zero ModelConfig when it has none
+func (c Config) model(name string) ModelConfig {
+	return c.Models[name]
+}
+
+// routes reports whether the model is routed to a key name
+func (mc ModelConfig) routes(keyName string) bool {
+	if len(mc.Keys) == 0 {
+		return true
+	}
+
+	for _, routed := range mc.Keys {
+		if routed == keyName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// excludes reports whether an entity has an excluded value in one of its fields
+func (mc ModelConfig) excludes(entity any) bool {
+	if len(mc.Exclude) == 0 {
+		return false
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(entity))
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+
+	for field, values := range mc.Exclude {
+		f := v.FieldByName(field)
+		if !f.IsValid() || !f.CanInterface() {
+			continue
+		}
+
+		formatted := fmt.Sprint(f.Interface())
+		for _, value := range values {
+			if formatted == value {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ConfigSource loads a Config, e.g. from a file or a remote configuration service
+type ConfigSource interface {
+	Load(ctx context.Context) (Config, error)
+}
+
+// ConfigRegistry holds the active Config, which can be swapped atomically at runtime
+type ConfigRegistry struct {
+	// Validators run against a new Config in addition to Config.Validate before it is applied
+	Validators []func(Config) error
+	// OnSwap listeners are notified after a new Config is applied, an error rolls the swap back
+	OnSwap []func(Config) error
+
+	current  atomic.Value
+	previous *Config
+	mutex    sync.Mutex
+}
+
+// NewConfigRegistry creates a ConfigRegistry with an initial Config
+func NewConfigRegistry(initial Config) (*ConfigRegistry, error) {
+	if err := initial.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := &ConfigRegistry{}
+	r.current.Store(initial)
+
+	return r, nil
+}
+
+// Load returns the active Config
+func (r *ConfigRegistry) Load() Config {
+	c, _ := r.current.Load().(Config)
+
+	return c
+}
+
+// Swap validates and applies a new Config. The active Config is kept when validation fails,
+// and restored when an OnSwap listener fails.
+func (r *ConfigRegistry) Swap(c Config) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	for _, validate := range r.Validators {
+		if err := validate(c); err != nil {
+			return err
+		}
+	}
+
+	old, err := r.apply(c)
+	if err != nil {
+		return fmt.Errorf("config rolled back: %w", err)
+	}
+
+	r.previous = &old
+
+	return nil
+}
+
+// Rollback restores the Config that was active before the last successful Swap, notifying the OnSwap listeners
+// like Swap. The active Config is kept when a listener fails.
+func (r *ConfigRegistry) Rollback() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.previous == nil {
+		return fmt.Errorf("no previous config to roll back to")
+	}
+
+	if _, err := r.apply(*r.previous); err != nil {
+		return fmt.Errorf("rollback reverted: %w", err)
+	}
+
+	r.previous = nil
+
+	return nil
+}
+
+// apply stores a Config and notifies the OnSwap listeners, restoring the active Config when one fails.
+// It returns the Config that was active before.
+func (r *ConfigRegistry) apply(c Config) (Config, error) {
+	old := r.Load()
+	r.current.Store(c)
+
+	for _, onSwap := range r.OnSwap {
+		if err := onSwap(c); err != nil {
+			r.current.Store(old)
+
+			return old, err
+		}
+	}
+
+	return old, nil
+}
+
+// Watch polls a ConfigSource at an interval until the context is done, swapping in every loaded Config.
+// Load and Swap errors are passed to onError, if set, and leave the active Config untouched.
+func (r *ConfigRegistry) Watch(ctx context.Context, source ConfigSource, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c, err := source.Load(ctx)
+			if err == nil {
+				err = r.Swap(c)
+			}
+
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// FileConfigSource loads a Config from a JSON file such as:
+//
+//	{"models": {"models.User": {"ttl": "30m", "key_ttls": {"composite": "5m"}, "keys": ["uuid"],
+//		"exclude": {"TenantID": ["42"]}, "disabled": false}}}
+type FileConfigSource struct {
+	Path string
+}
+
+type fileModelConfig struct {
+	TTL      string              `json:"ttl"`
+	KeyTTLs  map[string]string   `json:"key_ttls"`
+	Keys     []string            `json:"keys"`
+	Exclude  map[string][]string `json:"exclude"`
+	Disabled bool                `json:"disabled"`
+}
+
+func (f *FileConfigSource) Load(_ context.Context) (Config, error) {
+	b, err := os.ReadFile(f.Path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var file struct {
+		Models map[string]fileModelConfig `json:"models"`
+	}
+	if err = json.Unmarshal(b, &file); err != nil {
+		return Config{}, err
+	}
+
+	c := Config{Models: make(map[string]ModelConfig, len(file.Models))}
+	for model, fmc := range file.Models {
+		mc := ModelConfig{Keys: fmc.Keys, Exclude: fmc.Exclude, Disabled: fmc.Disabled}
+
+		if fmc.TTL != "" {
+			if mc.TTL, err = time.ParseDuration(fmc.TTL); err != nil {
+				return Config{}, fmt.Errorf("model %s: %w", model, err)
+			}
+		}
+
+		if len(fmc.KeyTTLs) > 0 {
+			mc.KeyTTLs = make(map[string]time.Duration, len(fmc.KeyTTLs))
+			for keyName, ttl := range fmc.KeyTTLs {
+				if mc.KeyTTLs[keyName], err = time.ParseDuration(ttl); err != nil {
+					return Config{}, fmt.Errorf("model %s, key %s: %w", model, keyName, err)
+				}
+			}
+		}
+
+		c.Models[model] = mc
+	}
+
+	return c, nil
+}
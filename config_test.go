@@ -0,0 +1,156 @@
+package kvsync_test
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ndthuan/kvsync"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigRegistry_Swap(t *testing.T) {
+	registry, err := kvsync.NewConfigRegistry(kvsync.Config{})
+	assert.NoError(t, err)
+
+	valid := kvsync.Config{Models: map[string]kvsync.ModelConfig{
+		"kvsync_test.SyncedUser": {TTL: time.Hour},
+	}}
+	invalid := kvsync.Config{Models: map[string]kvsync.ModelConfig{
+		"kvsync_test.SyncedUser": {TTL: -time.Hour},
+	}}
+
+	assert.NoError(t, registry.Swap(valid))
+	assert.Error(t, registry.Swap(invalid))
+	assert.Equal(t, valid, registry.Load(), "invalid config is not applied")
+
+	registry.OnSwap = append(registry.OnSwap, func(c kvsync.Config) error {
+		return errors.New("listener error")
+	})
+	assert.Error(t, registry.Swap(kvsync.Config{}))
+	assert.Equal(t, valid, registry.Load(), "failed swap is rolled back")
+
+	assert.Error(t, registry.Rollback())
+	assert.Equal(t, valid, registry.Load(), "failed rollback is reverted")
+
+	var notified []kvsync.Config
+	registry.OnSwap = []func(kvsync.Config) error{func(c kvsync.Config) error {
+		notified = append(notified, c)
+
+		return nil
+	}}
+	assert.NoError(t, registry.Rollback())
+	assert.Equal(t, kvsync.Config{}, registry.Load())
+	assert.Equal(t, []kvsync.Config{{}}, notified, "rollbacks notify the listeners")
+	assert.Error(t, registry.Rollback())
+}
+
+func TestConfig_Validate(t *testing.T) {
+	for name, mc := range map[string]kvsync.ModelConfig{
+		"negative TTL":         {TTL: -time.Hour},
+		"negative key TTL":     {KeyTTLs: map[string]time.Duration{"uuid": -time.Hour}},
+		"empty key name":       {Keys: []string{""}},
+		"empty excluded field": {Exclude: map[string][]string{"": {"42"}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, kvsync.Config{Models: map[string]kvsync.ModelConfig{"kvsync_test.SyncedUser": mc}}.Validate())
+		})
+	}
+}
+
+func TestConfigRegistry_WatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kvsync.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"models": {"kvsync_test.SyncedUser": {"ttl": "30m", "key_ttls": {"composite": "5m"}}}}`), 0o600))
+
+	registry, err := kvsync.NewConfigRegistry(kvsync.Config{})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go registry.Watch(ctx, &kvsync.FileConfigSource{Path: path}, 5*time.Millisecond, nil)
+
+	assert.Eventually(t, func() bool {
+		return registry.Load().Models["kvsync_test.SyncedUser"].TTL == 30*time.Minute
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 5*time.Minute, registry.Load().Models["kvsync_test.SyncedUser"].KeyTTLs["composite"])
+}
+
+func TestFileConfigSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kvsync.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"models": {"kvsync_test.SyncedUser": {"keys": ["uuid"], "exclude": {"Username": ["bot"]}}}}`), 0o600))
+
+	c, err := (&kvsync.FileConfigSource{Path: path}).Load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.ModelConfig{
+		Keys:    []string{"uuid"},
+		Exclude: map[string][]string{"Username": {"bot"}},
+	}, c.Models["kvsync_test.SyncedUser"])
+}
+
+func TestKVSync_Config(t *testing.T) {
+	miniRedis := miniredis.RunT(t)
+
+	registry, err := kvsync.NewConfigRegistry(kvsync.Config{Models: map[string]kvsync.ModelConfig{
+		"kvsync_test.SyncedUser": {
+			TTL:     30 * time.Minute,
+			KeyTTLs: map[string]time.Duration{"composite": 5 * time.Minute},
+		},
+	}})
+	assert.NoError(t, err)
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: &kvsync.RedisStore{
+			Client:     redis.NewClient(&redis.Options{Addr: miniRedis.Addr()}),
+			Expiration: time.Hour,
+		},
+		Config: registry,
+	})
+
+	assert.NoError(t, kvSync.Sync(SyncedUser{UUID: "config-uuid"}))
+	assert.Equal(t, 30*time.Minute, miniRedis.TTL("kvsync:user:uuid:config-uuid"))
+	assert.Equal(t, 5*time.Minute, miniRedis.TTL("kvsync:user:composite:0_config-uuid"))
+
+	assert.NoError(t, registry.Swap(kvsync.Config{Models: map[string]kvsync.ModelConfig{
+		"kvsync_test.SyncedUser": {Disabled: true},
+	}}))
+	assert.Error(t, kvSync.Sync(SyncedUser{UUID: "disabled-uuid"}))
+	assert.False(t, miniRedis.Exists("kvsync:user:uuid:disabled-uuid"))
+}
+
+func TestKVSync_ConfigRoutingAndFilters(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+
+	registry, err := kvsync.NewConfigRegistry(kvsync.Config{})
+	assert.NoError(t, err)
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:  store,
+		Config: registry,
+	})
+
+	assert.NoError(t, registry.Swap(kvsync.Config{Models: map[string]kvsync.ModelConfig{
+		"kvsync_test.SyncedUser": {Keys: []string{"uuid"}},
+	}}))
+	assert.NoError(t, kvSync.Sync(SyncedUser{UUID: "routed-uuid"}))
+	assert.Contains(t, store.Store, "user:uuid:routed-uuid")
+	assert.NotContains(t, store.Store, "user:composite:0_routed-uuid", "unrouted keys are not written")
+
+	assert.NoError(t, registry.Swap(kvsync.Config{Models: map[string]kvsync.ModelConfig{
+		"kvsync_test.SyncedUser": {Exclude: map[string][]string{"Username": {"bot"}}},
+	}}))
+	assert.NoError(t, kvSync.Sync(SyncedUser{UUID: "bot-uuid", Username: "bot"}))
+	assert.NotContains(t, store.Store, "user:uuid:bot-uuid", "excluded entities are filtered")
+
+	assert.NoError(t, kvSync.Sync(&SyncedUser{UUID: "alice-uuid", Username: "alice"}))
+	assert.Contains(t, store.Store, "user:uuid:alice-uuid")
+	assert.Contains(t, store.Store, "user:composite:0_alice-uuid", "all keys are routed again")
+
+	assert.NoError(t, registry.Rollback())
+	assert.NoError(t, kvSync.Sync(SyncedUser{UUID: "bot-uuid", Username: "bot"}))
+	assert.Contains(t, store.Store, "user:uuid:bot-uuid", "rolled back filters no longer apply")
+	assert.NotContains(t, store.Store, "user:composite:0_bot-uuid", "rolled back routing applies again")
+}
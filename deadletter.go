@@ -0,0 +1,153 @@
+package kvsync
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DeadLetter is an entity whose sync failed, kept for replay
+type DeadLetter struct {
+	Model    any
+	Keys     []string
+	TraceID  string
+	Err      error
+	FailedAt time.Time
+	// Attempts is the number of times the entity failed to sync
+	Attempts int
+}
+
+type deadLetterEntry struct {
+	item   queueItem
+	letter DeadLetter
+}
+
+// DeadLetterQueue keeps the entities that could not be written to the store, in failure order,
+// until they are replayed with KVSync.ReplayDeadLetters. An entity fetch-missed by a reader is
+// retried immediately instead, so that actively requested data recovers first after an outage.
+type DeadLetterQueue struct {
+	// MaxSize bounds the queue, dropping the oldest entries, defaults to 10000
+	MaxSize int
+
+	entries *list.List
+	byKey   map[string]*list.Element
+	mutex   sync.Mutex
+}
+
+// Len returns the number of entities in the queue
+func (q *DeadLetterQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.entries == nil {
+		return 0
+	}
+
+	return q.entries.Len()
+}
+
+// Entries returns the queued dead letters in replay order
+func (q *DeadLetterQueue) Entries() []DeadLetter {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.entries == nil {
+		return nil
+	}
+
+	letters := make([]DeadLetter, 0, q.entries.Len())
+	for e := q.entries.Front(); e != nil; e = e.Next() {
+		letters = append(letters, e.Value.(*deadLetterEntry).letter)
+	}
+
+	return letters
+}
+
+// push queues a failed entity, at the front when it is being actively requested
+func (q *DeadLetterQueue) push(item queueItem, err error, front bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.entries == nil {
+		q.entries = list.New()
+		q.byKey = make(map[string]*list.Element)
+	}
+
+	entry := &deadLetterEntry{
+		item: item,
+		letter: DeadLetter{
+			Model:    item.entity,
+			TraceID:  item.traceID,
+			Err:      err,
+			FailedAt: time.Now(),
+			Attempts: item.attempt,
+		},
+	}
+	for _, spec := range item.specs {
+		entry.letter.Keys = append(entry.letter.Keys, spec.Key)
+		// a newer failure of the same entity supersedes the older one
+		if old, ok := q.byKey[spec.Key]; ok {
+			q.remove(old)
+		}
+	}
+
+	var e *list.Element
+	if front {
+		e = q.entries.PushFront(entry)
+	} else {
+		e = q.entries.PushBack(entry)
+	}
+
+	for _, key := range entry.letter.Keys {
+		q.byKey[key] = e
+	}
+
+	maxSize := q.MaxSize
+	if maxSize < 1 {
+		maxSize = 10000
+	}
+
+	for q.entries.Len() > maxSize {
+		q.remove(q.entries.Front())
+	}
+}
+
+// take removes and returns the entity queued under a key
+func (q *DeadLetterQueue) take(key string) (queueItem, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	e, ok := q.byKey[key]
+	if !ok {
+		return queueItem{}, false
+	}
+
+	q.remove(e)
+
+	return e.Value.(*deadLetterEntry).item, true
+}
+
+// pop removes and returns the entity at the front of the queue
+func (q *DeadLetterQueue) pop() (queueItem, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.entries == nil || q.entries.Len() == 0 {
+		return queueItem{}, false
+	}
+
+	e := q.entries.Front()
+	q.remove(e)
+
+	return e.Value.(*deadLetterEntry).item, true
+}
+
+func (q *DeadLetterQueue) remove(e *list.Element) {
+	for _, key := range e.Value.(*deadLetterEntry).letter.Keys {
+		if q.byKey[key] == e {
+			delete(q.byKey, key)
+		}
+	}
+
+	q.entries.Remove(e)
+}
@@ -0,0 +1,90 @@
+package kvsync_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+type outageStore struct {
+	kvsync.InMemoryStore
+	down  bool
+	mutex sync.Mutex
+}
+
+func (o *outageStore) Put(key string, value any) error {
+	o.mutex.Lock()
+	down := o.down
+	o.mutex.Unlock()
+
+	if down {
+		return errors.New("store is down")
+	}
+
+	return o.InMemoryStore.Put(key, value)
+}
+
+func (o *outageStore) setDown(down bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.down = down
+}
+
+func TestDeadLetters(t *testing.T) {
+	store := &outageStore{InMemoryStore: kvsync.InMemoryStore{Store: make(map[string]any)}}
+	deadLetters := &kvsync.DeadLetterQueue{}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:       store,
+		DeadLetters: deadLetters,
+	})
+
+	store.setDown(true)
+	assert.NoError(t, kvSync.Sync(&ProjectedUser{ID: 1, Name: "Ada"}))
+	assert.NoError(t, kvSync.Sync(&ViewedUser{ID: 2, Name: "Grace"}))
+	assert.Equal(t, 2, deadLetters.Len())
+
+	entries := deadLetters.Entries()
+	assert.Equal(t, []string{"projected_user:id:1"}, entries[0].Keys)
+	assert.EqualError(t, entries[0].Err, "store is down")
+
+	assert.Error(t, kvSync.Fetch(&ViewedUser{ID: 2}, "full"), "the retry fails while the store is down")
+	assert.Equal(t, 2, deadLetters.Len())
+	assert.IsType(t, ViewedUser{}, deadLetters.Entries()[0].Model, "the requested entity is retried first")
+	assert.Equal(t, 2, deadLetters.Entries()[0].Attempts)
+
+	store.setDown(false)
+
+	fetched := ViewedUser{ID: 2}
+	assert.NoError(t, kvSync.Fetch(&fetched, "full"))
+	assert.Equal(t, "Grace", fetched.Name)
+	assert.Equal(t, 1, deadLetters.Len())
+
+	assert.Equal(t, 1, kvSync.ReplayDeadLetters())
+	assert.Equal(t, 0, deadLetters.Len())
+	assert.Contains(t, store.Store, "projected_user:id:1")
+}
+
+func TestDeadLetterQueue_MaxSize(t *testing.T) {
+	store := &outageStore{InMemoryStore: kvsync.InMemoryStore{Store: make(map[string]any)}, down: true}
+	deadLetters := &kvsync.DeadLetterQueue{MaxSize: 2}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:       store,
+		DeadLetters: deadLetters,
+	})
+
+	for id := 1; id <= 3; id++ {
+		assert.NoError(t, kvSync.Sync(&ProjectedUser{ID: id}))
+	}
+	assert.NoError(t, kvSync.Sync(&ProjectedUser{ID: 3, Name: "newer"}))
+
+	entries := deadLetters.Entries()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, []string{"projected_user:id:2"}, entries[0].Keys)
+	assert.Equal(t, ProjectedUser{ID: 3, Name: "newer"}, entries[1].Model)
+}
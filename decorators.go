@@ -0,0 +1,209 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Operations of stores, as passed to decorators
+const (
+	OpFetch  = "fetch"
+	OpPut    = "put"
+	OpDelete = "delete"
+	OpPing   = "ping"
+	OpKeys   = "keys"
+	OpExists = "exists"
+	OpTTL    = "ttl"
+	OpTouch  = "touch"
+)
+
+// decorator runs every call of a store through around, keeping the optional interfaces of stores working
+type decorator struct {
+	store  KVStore
+	around func(op string, key string, call func() error) error
+}
+
+func (d *decorator) Fetch(key string, dest any) error {
+	return d.around(OpFetch, key, func() error {
+		return d.store.Fetch(key, dest)
+	})
+}
+
+func (d *decorator) Put(key string, value any) error {
+	return d.around(OpPut, key, func() error {
+		return d.store.Put(key, value)
+	})
+}
+
+func (d *decorator) PutWithTTL(key string, value any, ttl time.Duration) error {
+	return d.around(OpPut, key, func() error {
+		return putWithTTL(d.store, key, value, ttl)
+	})
+}
+
+func (d *decorator) Delete(key string) error {
+	return d.around(OpDelete, key, func() error {
+		return deleteKey(d.store, key)
+	})
+}
+
+func (d *decorator) Exists(key string) (found bool, err error) {
+	err = d.around(OpExists, key, func() error {
+		found, err = exists(d.store, key)
+		return err
+	})
+
+	return found, err
+}
+
+func (d *decorator) TTL(key string) (ttl time.Duration, err error) {
+	err = d.around(OpTTL, key, func() error {
+		ttl, err = keyTTL(d.store, key)
+		return err
+	})
+
+	return ttl, err
+}
+
+func (d *decorator) Touch(key string, ttl time.Duration) error {
+	return d.around(OpTouch, key, func() error {
+		return touchKey(d.store, key, ttl)
+	})
+}
+
+// Keys scans the keys of the store, the prefix being passed to around as the key
+func (d *decorator) Keys(prefix string, limit int, cursor string) (keys []string, next string, err error) {
+	err = d.around(OpKeys, prefix, func() error {
+		keys, next, err = scan(d.store, prefix, limit, cursor)
+		return err
+	})
+
+	return keys, next, err
+}
+
+func (d *decorator) Ping(ctx context.Context) error {
+	return d.around(OpPing, "", func() error {
+		return ping(ctx, d.store)
+	})
+}
+
+// OperationStats are the statistics of an operation of a MetricsStore
+type OperationStats struct {
+	Calls int64
+	// Errors excludes misses
+	Errors int64
+	Misses int64
+	// Duration is the total duration of the calls
+	Duration time.Duration
+}
+
+// MetricsStore counts the calls, errors, misses and durations of every operation of a store
+type MetricsStore struct {
+	decorator
+	// Observe is optionally invoked after every call, e.g. to feed Prometheus histograms
+	Observe func(op string, key string, duration time.Duration, err error)
+
+	stats map[string]*OperationStats
+	mutex sync.Mutex
+}
+
+// WithMetrics wraps a store in a MetricsStore
+func WithMetrics(store KVStore) *MetricsStore {
+	m := &MetricsStore{stats: make(map[string]*OperationStats)}
+	m.decorator = decorator{store: store, around: m.measure}
+
+	return m
+}
+
+// Stats returns the statistics by operation
+func (m *MetricsStore) Stats() map[string]OperationStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats := make(map[string]OperationStats, len(m.stats))
+	for op, s := range m.stats {
+		stats[op] = *s
+	}
+
+	return stats
+}
+
+func (m *MetricsStore) measure(op string, key string, call func() error) error {
+	started := time.Now()
+	err := call()
+	duration := time.Since(started)
+
+	m.mutex.Lock()
+	s, ok := m.stats[op]
+	if !ok {
+		s = &OperationStats{}
+		m.stats[op] = s
+	}
+	s.Calls++
+	s.Duration += duration
+	if errors.Is(err, ErrKeyNotFound) {
+		s.Misses++
+	} else if err != nil {
+		s.Errors++
+	}
+	m.mutex.Unlock()
+
+	if m.Observe != nil {
+		m.Observe(op, key, duration, err)
+	}
+
+	return err
+}
+
+// Logger is implemented by *log.Logger and most logging libraries
+type Logger interface {
+	Printf(format string, args ...any)
+}
+
+// WithLogging wraps a store, logging its failed calls. Misses are not failures.
+func WithLogging(store KVStore, logger Logger) KVStore {
+	return &decorator{store: store, around: func(op string, key string, call func() error) error {
+		started := time.Now()
+
+		err := call()
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			logger.Printf("kvsync: %s %q failed after %s: %v", op, key, time.Since(started), err)
+		}
+
+		return err
+	}}
+}
+
+// LogReports returns a ReportCallback logging the failed writes and deletes of a KVSync with their trace ID, which
+// the store calls seen by WithLogging carry no context for, see KVSync.Subscribe
+func LogReports(logger Logger) ReportCallback {
+	return func(report Report) {
+		if report.Err == nil || errors.Is(report.Err, ErrKeyNotFound) {
+			return
+		}
+
+		logger.Printf("kvsync: %s %q failed after %s (trace %s): %v",
+			report.Operation, report.Key, report.Duration, report.TraceID, report.Err)
+	}
+}
+
+// Tracer starts a span for a call of a store, returning the function ending it with the call's error.
+// It adapts tracing libraries such as OpenTelemetry, whose spans have no parent here since stores take
+// no context.
+type Tracer interface {
+	StartSpan(op string, key string) (end func(err error))
+}
+
+// WithTracing wraps a store, tracing every call
+func WithTracing(store KVStore, tracer Tracer) KVStore {
+	return &decorator{store: store, around: func(op string, key string, call func() error) error {
+		end := tracer.StartSpan(op, key)
+
+		err := call()
+		end(err)
+
+		return err
+	}}
+}
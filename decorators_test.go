@@ -0,0 +1,178 @@
+package kvsync_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"testing"
+	"time"
+)
+
+type recordingTracer struct {
+	spans []string
+}
+
+func (r *recordingTracer) StartSpan(op string, key string) func(err error) {
+	return func(err error) {
+		span := op + " " + key
+		if err != nil {
+			span += " failed"
+		}
+		r.spans = append(r.spans, span)
+	}
+}
+
+func TestStoreDecorators(t *testing.T) {
+	redisStore, s := setUpStore()
+	defer s.Close()
+
+	var logs bytes.Buffer
+	tracer := &recordingTracer{}
+
+	metrics := kvsync.WithMetrics(kvsync.WithTracing(kvsync.WithLogging(redisStore, log.New(&logs, "", 0)), tracer))
+
+	var observed []string
+	metrics.Observe = func(op string, key string, duration time.Duration, err error) {
+		observed = append(observed, op+" "+key)
+	}
+
+	var store kvsync.KVStore = metrics
+	assert.NoError(t, store.Put("user:1", User{ID: 1, Name: "Alice"}))
+	assert.NoError(t, store.(kvsync.TTLStore).PutWithTTL("user:2", User{ID: 2}, time.Minute))
+	assert.Equal(t, time.Minute, s.TTL("kvsync:user:2"))
+
+	var user User
+	assert.NoError(t, store.Fetch("user:1", &user))
+	assert.Equal(t, "Alice", user.Name)
+	assert.ErrorIs(t, store.Fetch("user:3", &user), kvsync.ErrKeyNotFound)
+	assert.Empty(t, logs.String(), "misses are not logged")
+
+	s.Close()
+	assert.ErrorIs(t, store.(kvsync.Deleter).Delete("user:1"), kvsync.ErrStoreUnavailable)
+	assert.Error(t, store.(kvsync.Pinger).Ping(context.Background()))
+
+	stats := metrics.Stats()
+	assert.Equal(t, int64(2), stats[kvsync.OpPut].Calls)
+	assert.Equal(t, kvsync.OperationStats{Calls: 2, Misses: 1, Duration: stats[kvsync.OpFetch].Duration}, stats[kvsync.OpFetch])
+	assert.Equal(t, int64(1), stats[kvsync.OpDelete].Errors)
+	assert.Equal(t, int64(1), stats[kvsync.OpPing].Errors)
+
+	assert.Equal(t, []string{"put user:1", "put user:2", "fetch user:1", "fetch user:3", "delete user:1", "ping "}, observed)
+	assert.Equal(t, []string{"put user:1", "put user:2", "fetch user:1", "fetch user:3 failed", "delete user:1 failed", "ping  failed"}, tracer.spans)
+	assert.Contains(t, logs.String(), `kvsync: delete "user:1" failed after`)
+}
+
+func TestLogReports(t *testing.T) {
+	var logs bytes.Buffer
+	logReport := kvsync.LogReports(log.New(&logs, "", 0))
+
+	logReport(kvsync.Report{Key: "user:1", Operation: kvsync.OperationCreate, TraceID: "written"})
+	logReport(kvsync.Report{Key: "user:2", Operation: kvsync.OperationDelete, TraceID: "missing", Err: kvsync.ErrKeyNotFound})
+	assert.Empty(t, logs.String(), "successes and misses are not logged")
+
+	logReport(kvsync.Report{
+		Key:       "user:3",
+		Operation: kvsync.OperationUpdate,
+		TraceID:   "failed",
+		Duration:  time.Second,
+		Err:       kvsync.ErrStoreUnavailable,
+	})
+	assert.Equal(t, "kvsync: update \"user:3\" failed after 1s (trace failed): store is unavailable\n", logs.String())
+}
+
+func TestStoreDecorators_Keys(t *testing.T) {
+	memory := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	assert.NoError(t, memory.Put("user:1", User{ID: 1}))
+	assert.NoError(t, memory.Put("order:1", Order{ID: 1}))
+
+	tracer := &recordingTracer{}
+	var store kvsync.KVStore = kvsync.WithTracing(memory, tracer)
+
+	keys, next, err := store.(kvsync.KeyScanner).Keys("user:", 10, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user:1"}, keys)
+	assert.Empty(t, next)
+	assert.Equal(t, []string{"keys user:"}, tracer.spans)
+
+	_, _, err = kvsync.WithTracing(erroneousStore{}, tracer).(kvsync.KeyScanner).Keys("user:", 10, "")
+	assert.EqualError(t, err, "store does not support scanning keys")
+}
+
+func TestStoreDecorators_OptionalInterfaces(t *testing.T) {
+	var logs bytes.Buffer
+	tracer := &recordingTracer{}
+	wrap := kvsync.Chain(kvsync.Metrics(new(*kvsync.MetricsStore)), kvsync.Logging(log.New(&logs, "", 0)), kvsync.Tracing(tracer))
+
+	assertOptionalInterfaces(t, wrap(&kvsync.InMemoryStore{Store: make(map[string]any)}))
+	assert.Empty(t, logs.String())
+	assert.Contains(t, tracer.spans, "touch optional:1")
+
+	assertOptionalInterfacesFail(t, wrap(&kvsync.ChaosStore{Store: &kvsync.InMemoryStore{}, ErrorRate: 1}), kvsync.ErrStoreUnavailable)
+	assert.Contains(t, logs.String(), `kvsync: ttl "optional:1" failed after`)
+}
+
+// assertOptionalInterfaces checks that a store wrapping empty InMemoryStores or RedisStores forwards the
+// optional interfaces of stores: expirations, existence checks, and scans and pings when it implements them
+func assertOptionalInterfaces(t *testing.T, store kvsync.KVStore) {
+	t.Helper()
+
+	assert.NoError(t, store.(kvsync.TTLStore).PutWithTTL("optional:1", User{ID: 1}, time.Minute))
+
+	found, err := store.(kvsync.ExistenceChecker).Exists("optional:1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	ttl, err := store.(kvsync.TouchStore).TTL("optional:1")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+
+	assert.NoError(t, store.(kvsync.TouchStore).Touch("optional:1", time.Hour))
+	ttl, err = store.(kvsync.TouchStore).TTL("optional:1")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+
+	assert.ErrorIs(t, store.(kvsync.TouchStore).Touch("optional:2", time.Hour), kvsync.ErrKeyNotFound)
+	_, err = store.(kvsync.TouchStore).TTL("optional:2")
+	assert.ErrorIs(t, err, kvsync.ErrKeyNotFound)
+
+	if scanner, ok := store.(kvsync.KeyScanner); ok {
+		keys, _, err := scanner.Keys("optional:", 10, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"optional:1"}, keys)
+	}
+
+	if pinger, ok := store.(kvsync.Pinger); ok {
+		assert.NoError(t, pinger.Ping(context.Background()))
+	}
+
+	assert.NoError(t, store.(kvsync.Deleter).Delete("optional:1"))
+	found, err = store.(kvsync.ExistenceChecker).Exists("optional:1")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+// assertOptionalInterfacesFail checks that a store forwards the errors of the optional interfaces of stores
+func assertOptionalInterfacesFail(t *testing.T, store kvsync.KVStore, target error) {
+	t.Helper()
+
+	assert.ErrorIs(t, store.(kvsync.TTLStore).PutWithTTL("optional:1", User{ID: 1}, time.Minute), target)
+	assert.ErrorIs(t, store.(kvsync.Deleter).Delete("optional:1"), target)
+
+	_, err := store.(kvsync.ExistenceChecker).Exists("optional:1")
+	assert.ErrorIs(t, err, target)
+
+	_, err = store.(kvsync.TouchStore).TTL("optional:1")
+	assert.ErrorIs(t, err, target)
+	assert.ErrorIs(t, store.(kvsync.TouchStore).Touch("optional:1", time.Hour), target)
+
+	if scanner, ok := store.(kvsync.KeyScanner); ok {
+		_, _, err = scanner.Keys("optional:", 10, "")
+		assert.ErrorIs(t, err, target)
+	}
+
+	if pinger, ok := store.(kvsync.Pinger); ok {
+		assert.ErrorIs(t, pinger.Ping(context.Background()), target)
+	}
+}
@@ -0,0 +1,63 @@
+package kvsync
+
+import (
+	"fmt"
+)
+
+// SizingStore is an optional interface for stores able to tell the serialized size of a value without
+// writing it, reported in dry-run mode to estimate memory usage, see Options.DryRun
+type SizingStore interface {
+	Size(key string, value any) (int, error)
+}
+
+// measure validates and measures the values of an entity in place of writing them, returning the errors
+// and serialized sizes by key. Sizes are measured with the per-operation marshaler if any, or by stores
+// implementing SizingStore.
+func (k *kvSync) measure(values map[string]any, specs map[string]KeySpec, marshaler MarshalingAdapter) (map[string]error, map[string]int) {
+	errs := make(map[string]error, len(specs))
+	sizes := make(map[string]int, len(specs))
+	keyNames := make(map[string]string, len(specs))
+
+	for keyName, spec := range specs {
+		if spec.Key == "" {
+			errs[spec.Key] = fmt.Errorf("key %s is empty", keyName)
+			continue
+		}
+
+		if other, ok := keyNames[spec.Key]; ok {
+			errs[spec.Key] = fmt.Errorf("key %s is shared by key names %s and %s", spec.Key, other, keyName)
+			continue
+		}
+		keyNames[spec.Key] = keyName
+
+		var size int
+		var err error
+		if marshaler != nil {
+			var b []byte
+			if b, err = marshaler.Marshal(values[keyName]); err != nil {
+				err = &MarshalError{Key: spec.Key, Err: err}
+			}
+			size = len(b)
+		} else if sizingStore, ok := k.store.(SizingStore); ok {
+			size, err = sizingStore.Size(spec.Key, values[keyName])
+		}
+
+		errs[spec.Key], sizes[spec.Key] = err, size
+	}
+
+	return errs, sizes
+}
+
+// Size returns the number of bytes a value takes once serialized with RedisStore.Marshaler, as a whole even when chunked
+func (r *RedisStore) Size(key string, value any) (int, error) {
+	if r.Marshaler == nil {
+		r.Marshaler = &BSONMarshalingAdapter{}
+	}
+
+	b, err := encodeValue(value, r.Marshaler)
+	if err != nil {
+		return 0, &MarshalError{Key: key, Err: err}
+	}
+
+	return len(b), nil
+}
@@ -0,0 +1,83 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDryRun(t *testing.T) {
+	store, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	reports := make(chan kvsync.Report, 10)
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:  store,
+		DryRun: true,
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+
+	receive := func(n int) []kvsync.Report {
+		var received []kvsync.Report
+		for i := 0; i < n; i++ {
+			select {
+			case r := <-reports:
+				assert.NoError(t, r.Err)
+				assert.True(t, r.DryRun)
+				received = append(received, r)
+			case <-time.After(time.Second):
+				t.Fatal("no report received")
+			}
+		}
+		return received
+	}
+
+	user := &SyncedUser{UUID: "dry-run-uuid", Username: "dry-run-username"}
+	assert.NoError(t, db.Create(user).Error)
+	for _, r := range receive(3) {
+		assert.Greater(t, r.Size, 0)
+	}
+	assert.Empty(t, miniRedis.Keys())
+
+	assert.NoError(t, kvSync.Sync(user))
+	receive(3)
+
+	assert.NoError(t, kvSync.Sync(user, kvsync.WithMarshaler(&kvsync.CanonicalJSONMarshalingAdapter{})))
+	for _, r := range receive(3) {
+		assert.Greater(t, r.Size, 0)
+	}
+
+	assert.NoError(t, db.Delete(user).Error)
+	receive(3)
+	assert.Empty(t, miniRedis.Keys())
+}
+
+func TestDryRun_KeepsKeys(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: map[string]any{"user:id:1": SyncedUser{}},
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:  store,
+		DryRun: true,
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+
+	user := &SyncedUser{UUID: "kept-uuid"}
+	assert.NoError(t, db.Create(user).Error)
+	assert.NoError(t, db.Delete(user).Error)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, map[string]any{"user:id:1": SyncedUser{}}, store.Store)
+}
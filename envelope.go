@@ -0,0 +1,171 @@
+package kvsync
+
+import (
+	"fmt"
+	"hash/crc32"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"time"
+)
+
+// Envelope wraps a stored value with metadata describing it
+type Envelope struct {
+	// Type is the ModelName of the value
+	Type string
+	// SchemaVersion is the version of the value's struct schema, see SchemaVersioned
+	SchemaVersion int
+	SyncedAt      time.Time
+	// Source identifies the instance that wrote the value
+	Source string
+	// Build identifies the release of the service that wrote the value, e.g. its VCS revision
+	Build string
+	// Payload is the value serialized by the wrapped MarshalingAdapter
+	Payload []byte
+	// Checksum is the CRC-32 (Castagnoli) of Payload, zero in envelopes written before checksums
+	Checksum uint32
+}
+
+// SchemaVersioned is an optional interface for models declaring the version of their struct schema.
+// Models not implementing it are at version 0.
+type SchemaVersioned interface {
+	SchemaVersion() int
+}
+
+// SchemaMigrator is an optional interface for models able to populate themselves from payloads written
+// with another schema version, typically by unmarshaling into the old struct and converting it
+type SchemaMigrator interface {
+	MigrateSchema(fromVersion int, payload []byte, unmarshal func(data []byte, v any) error) error
+}
+
+// InfoFetcher is implemented by stores able to return the Envelope a value was stored with
+type InfoFetcher interface {
+	// FetchWithInfo fetches a value into dest and returns its envelope, without the payload
+	FetchWithInfo(key string, dest any) (Envelope, error)
+}
+
+// EnvelopeMarshaler is a MarshalingAdapter wrapping values in an Envelope, so that struct schemas can
+// evolve without invalidating the whole cache: on Unmarshal, payloads with another schema version are
+// handed to the destination's SchemaMigrator, or rejected. Values written without an envelope are still
+// read as is. Payloads are checksummed, and fail to unmarshal with ErrCorrupted once altered.
+type EnvelopeMarshaler struct {
+	// Marshaler serializes both the payload and the envelope, defaults to BSONMarshalingAdapter
+	Marshaler MarshalingAdapter
+	// Source identifies this instance in envelopes, defaults to the hostname
+	Source string
+	// Build identifies this release in envelopes, defaults to the VCS revision or module version
+	// stamped in the binary by the Go toolchain
+	Build string
+}
+
+func (e *EnvelopeMarshaler) Marshal(v any) ([]byte, error) {
+	payload, err := e.marshaler().Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.marshaler().Marshal(Envelope{
+		Type:          ModelName(v),
+		SchemaVersion: schemaVersion(v),
+		SyncedAt:      time.Now().UTC(),
+		Source:        e.source(),
+		Build:         e.build(),
+		Payload:       payload,
+		Checksum:      checksum(payload),
+	})
+}
+
+func (e *EnvelopeMarshaler) Unmarshal(data []byte, v any) error {
+	envelope, err := e.Decode(data)
+	if err != nil || envelope.Payload == nil {
+		// not an envelope, the value was written before envelopes were enabled
+		return e.marshaler().Unmarshal(data, v)
+	}
+
+	if sum := checksum(envelope.Payload); envelope.Checksum != 0 && sum != envelope.Checksum {
+		return fmt.Errorf("%w: %s payload checksum is %08x instead of %08x", ErrCorrupted, envelope.Type, sum, envelope.Checksum)
+	}
+
+	if envelope.SchemaVersion == schemaVersion(v) {
+		return e.marshaler().Unmarshal(envelope.Payload, v)
+	}
+
+	if migrator, ok := v.(SchemaMigrator); ok {
+		return migrator.MigrateSchema(envelope.SchemaVersion, envelope.Payload, e.marshaler().Unmarshal)
+	}
+
+	return fmt.Errorf("%s: cannot read schema version %d as version %d", envelope.Type, envelope.SchemaVersion, schemaVersion(v))
+}
+
+// Decode decodes the envelope of a stored value without decoding its payload
+func (e *EnvelopeMarshaler) Decode(data []byte) (Envelope, error) {
+	var envelope Envelope
+	err := e.marshaler().Unmarshal(data, &envelope)
+
+	return envelope, err
+}
+
+func (e *EnvelopeMarshaler) marshaler() MarshalingAdapter {
+	if e.Marshaler == nil {
+		e.Marshaler = &BSONMarshalingAdapter{}
+	}
+
+	return e.Marshaler
+}
+
+func (e *EnvelopeMarshaler) source() string {
+	if e.Source == "" {
+		e.Source, _ = os.Hostname()
+	}
+
+	return e.Source
+}
+
+func (e *EnvelopeMarshaler) build() string {
+	if e.Build == "" {
+		e.Build = buildStamp()
+	}
+
+	return e.Build
+}
+
+// buildStamp returns the VCS revision of the running binary, or its main module version
+func buildStamp() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+
+	return info.Main.Version
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func checksum(payload []byte) uint32 {
+	return crc32.Checksum(payload, castagnoli)
+}
+
+func schemaVersion(v any) int {
+	if versioned, ok := v.(SchemaVersioned); ok {
+		return versioned.SchemaVersion()
+	}
+
+	// the method may be declared on the pointer type while v is a value
+	val := reflect.ValueOf(v)
+	if val.IsValid() && val.Kind() != reflect.Ptr {
+		ptr := reflect.New(val.Type())
+		ptr.Elem().Set(val)
+
+		if versioned, ok := ptr.Interface().(SchemaVersioned); ok {
+			return versioned.SchemaVersion()
+		}
+	}
+
+	return 0
+}
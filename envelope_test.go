@@ -0,0 +1,308 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"testing"
+)
+
+type ProfileV1 struct {
+	ID   int
+	Name string
+}
+
+type Profile struct {
+	ID        int
+	FirstName string
+	LastName  string
+}
+
+func (p Profile) SchemaVersion() int {
+	return 2
+}
+
+func (p *Profile) MigrateSchema(fromVersion int, payload []byte, unmarshal func(data []byte, v any) error) error {
+	var v1 ProfileV1
+	if err := unmarshal(payload, &v1); err != nil {
+		return err
+	}
+
+	p.ID = v1.ID
+	p.FirstName = v1.Name
+
+	return nil
+}
+
+type Account struct {
+	ID int
+}
+
+func (a Account) SchemaVersion() int {
+	return 3
+}
+
+func TestEnvelopeMarshaler(t *testing.T) {
+	marshaler := &kvsync.EnvelopeMarshaler{Source: "instance-1"}
+
+	b, err := marshaler.Marshal(Profile{ID: 1, FirstName: "Ada", LastName: "Lovelace"})
+	assert.NoError(t, err)
+
+	envelope, err := marshaler.Decode(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "kvsync_test.Profile", envelope.Type)
+	assert.Equal(t, 2, envelope.SchemaVersion)
+	assert.Equal(t, "instance-1", envelope.Source)
+	assert.False(t, envelope.SyncedAt.IsZero())
+
+	var profile Profile
+	assert.NoError(t, marshaler.Unmarshal(b, &profile))
+	assert.Equal(t, Profile{ID: 1, FirstName: "Ada", LastName: "Lovelace"}, profile)
+}
+
+func TestEnvelopeMarshaler_Migration(t *testing.T) {
+	marshaler := &kvsync.EnvelopeMarshaler{}
+
+	old, err := marshaler.Marshal(ProfileV1{ID: 1, Name: "Ada"})
+	assert.NoError(t, err)
+
+	var profile Profile
+	assert.NoError(t, marshaler.Unmarshal(old, &profile))
+	assert.Equal(t, Profile{ID: 1, FirstName: "Ada"}, profile)
+
+	var account Account
+	assert.Error(t, marshaler.Unmarshal(old, &account), "no migrator")
+}
+
+func TestEnvelopeMarshaler_LegacyValue(t *testing.T) {
+	marshaler := &kvsync.EnvelopeMarshaler{}
+
+	legacy, err := bson.Marshal(User{ID: 1, Name: "Alice"})
+	assert.NoError(t, err)
+
+	var user User
+	assert.NoError(t, marshaler.Unmarshal(legacy, &user))
+	assert.Equal(t, "Alice", user.Name)
+}
+
+// tamper alters the payload of an envelope, keeping its checksum
+func tamper(t *testing.T, data []byte) []byte {
+	var envelope kvsync.Envelope
+	assert.NoError(t, bson.Unmarshal(data, &envelope))
+
+	payload, err := bson.Marshal(User{ID: 1, Name: "Mallory"})
+	assert.NoError(t, err)
+	envelope.Payload = payload
+
+	tampered, err := bson.Marshal(envelope)
+	assert.NoError(t, err)
+
+	return tampered
+}
+
+func TestEnvelopeMarshaler_Checksum(t *testing.T) {
+	marshaler := &kvsync.EnvelopeMarshaler{}
+
+	b, err := marshaler.Marshal(User{ID: 1, Name: "Alice"})
+	assert.NoError(t, err)
+
+	envelope, err := marshaler.Decode(b)
+	assert.NoError(t, err)
+	assert.NotZero(t, envelope.Checksum)
+
+	var user User
+	assert.ErrorIs(t, marshaler.Unmarshal(tamper(t, b), &user), kvsync.ErrCorrupted)
+
+	// written before checksums
+	envelope.Checksum = 0
+	unchecked, err := bson.Marshal(envelope)
+	assert.NoError(t, err)
+	assert.NoError(t, marshaler.Unmarshal(unchecked, &user))
+	assert.Equal(t, "Alice", user.Name)
+}
+
+func TestFetch_RepairsCorruptedValues(t *testing.T) {
+	store, s := setUpStore()
+	defer s.Close()
+	store.Marshaler = &kvsync.EnvelopeMarshaler{}
+
+	var loaded []string
+	kvSync, err := kvsync.New(context.Background(),
+		kvsync.WithStore(store),
+		kvsync.WithRepairLoader("price:id:", func(ctx context.Context, id string) (any, error) {
+			loaded = append(loaded, id)
+			if id == "2" {
+				// deleted from the database
+				return nil, nil
+			}
+
+			return &Price{ID: 1, Amount: 100}, nil
+		}),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kvSync.Sync(&Price{ID: 1, Amount: 100}))
+	assert.NoError(t, kvSync.Sync(&Price{ID: 2, Amount: 200}))
+
+	for _, key := range []string{"kvsync:price:id:1", "kvsync:price:id:2"} {
+		value, err := s.Get(key)
+		assert.NoError(t, err)
+		assert.NoError(t, s.Set(key, string(tamper(t, []byte(value)))))
+	}
+
+	var price Price
+	assert.ErrorIs(t, store.Fetch("price:id:1", &price), kvsync.ErrCorrupted)
+
+	price = Price{ID: 1}
+	assert.NoError(t, kvSync.Fetch(&price, "id"))
+	assert.Equal(t, 100, price.Amount)
+	assert.NoError(t, store.Fetch("price:id:1", &price), "repaired in the store")
+
+	assert.ErrorIs(t, kvSync.Fetch(&Price{ID: 2}, "id"), kvsync.ErrKeyNotFound)
+	assert.False(t, s.Exists("kvsync:price:id:2"))
+	assert.Equal(t, []string{"1", "2"}, loaded)
+}
+
+func TestRedisStore_FetchAny(t *testing.T) {
+	kvsync.RegisterModel[Profile]()
+
+	store, s := setUpStore()
+	defer s.Close()
+	store.Marshaler = &kvsync.EnvelopeMarshaler{}
+
+	assert.NoError(t, store.Put("profile:1", Profile{ID: 1, FirstName: "Ada"}))
+	assert.NoError(t, store.Put("account:1", Account{ID: 1}))
+
+	value, err := store.FetchAny("profile:1")
+	assert.NoError(t, err)
+	assert.Equal(t, Profile{ID: 1, FirstName: "Ada"}, value)
+
+	_, err = store.FetchAny("account:1")
+	assert.Error(t, err, "unregistered model")
+
+	_, err = store.FetchAny("missing")
+	assert.Error(t, err)
+}
+
+func TestKVSync_FetchWithInfo(t *testing.T) {
+	store, s := setUpStore()
+	defer s.Close()
+	store.Marshaler = &kvsync.EnvelopeMarshaler{Source: "instance-1", Build: "v1.2.3"}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+
+	assert.NoError(t, kvSync.Sync(&Price{ID: 1, Amount: 100}))
+
+	fetched := Price{ID: 1}
+	info, err := kvSync.FetchWithInfo(&fetched, "id")
+	assert.NoError(t, err)
+	assert.Equal(t, 100, fetched.Amount)
+	assert.Equal(t, "kvsync_test.Price", info.Type)
+	assert.Equal(t, "instance-1", info.Source)
+	assert.Equal(t, "v1.2.3", info.Build)
+	assert.Nil(t, info.Payload)
+
+	store.Marshaler = &kvsync.BSONMarshalingAdapter{}
+	_, err = kvSync.FetchWithInfo(&fetched, "id")
+	assert.Error(t, err, "values without envelopes have no info")
+}
+
+func TestKVSync_FetchAnyWithInfo(t *testing.T) {
+	kvsync.RegisterModel[Price]()
+
+	store, s := setUpStore()
+	defer s.Close()
+	store.Marshaler = &kvsync.EnvelopeMarshaler{Build: "v1.2.3"}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+	assert.NoError(t, kvSync.Sync(&Price{ID: 1, Amount: 100}))
+
+	value, info, err := kvSync.FetchAnyWithInfo("price:id:1")
+	assert.NoError(t, err)
+	assert.Equal(t, 100, value.(Price).Amount)
+	assert.Equal(t, "v1.2.3", info.Build)
+
+	_, _, err = kvSync.FetchAnyWithInfo("price:id:2")
+	assert.ErrorIs(t, err, kvsync.ErrKeyNotFound)
+
+	memory := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	kvSync = kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: memory,
+	})
+	assert.NoError(t, kvSync.Sync(&Price{ID: 1, Amount: 100}))
+
+	value, info, err = kvSync.FetchAnyWithInfo("price:id:1")
+	assert.NoError(t, err)
+	assert.Equal(t, 100, value.(Price).Amount)
+	assert.Equal(t, kvsync.Envelope{}, info, "stores not implementing InfoFetcher have no info")
+}
+
+func TestRedisStore_PurgeByProducerVersion(t *testing.T) {
+	store, s := setUpStore()
+	defer s.Close()
+	store.ChunkSize = 64
+
+	store.Marshaler = &kvsync.EnvelopeMarshaler{Build: "v1"}
+	assert.NoError(t, store.Put("profile:1", Profile{ID: 1, FirstName: "Ada"}))
+	assert.NoError(t, store.Put("profile:2", Profile{ID: 2, FirstName: "Grace", LastName: "Hopper, who wrote a long enough name to be chunked"}))
+	assert.NoError(t, store.Put("account:1", Account{ID: 1}))
+
+	store.Marshaler = &kvsync.EnvelopeMarshaler{Build: "v2"}
+	assert.NoError(t, store.Put("profile:3", Profile{ID: 3, FirstName: "Barbara"}))
+
+	store.Marshaler = &kvsync.BSONMarshalingAdapter{}
+	assert.NoError(t, store.Put("profile:4", Profile{ID: 4, FirstName: "Katherine"}))
+
+	_, err := store.PurgeByProducerVersion(context.Background(), "profile:", "v1")
+	assert.Error(t, err, "the marshaler must write envelopes")
+
+	store.Marshaler = &kvsync.EnvelopeMarshaler{}
+	purged, err := store.PurgeByProducerVersion(context.Background(), "profile:", "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, purged)
+
+	for _, key := range s.Keys() {
+		assert.NotContains(t, key, "profile:1")
+		assert.NotContains(t, key, "profile:2")
+	}
+
+	var profile Profile
+	assert.NoError(t, store.Fetch("profile:3", &profile))
+	assert.NoError(t, store.Fetch("profile:4", &profile))
+	assert.NoError(t, store.Fetch("account:1", &Account{}))
+}
+
+func TestRedisStore_PurgeByProducerVersionHashTag(t *testing.T) {
+	store, s := setUpStore()
+	defer s.Close()
+
+	store.ChunkSize = 64
+	store.HashTag = func(key string) string {
+		return strings.Split(key, ":")[1]
+	}
+
+	store.Marshaler = &kvsync.EnvelopeMarshaler{Build: "v1"}
+	assert.NoError(t, store.Put("profile:1", Profile{ID: 1, FirstName: "Ada"}))
+	assert.NoError(t, store.Put("profile:2", Profile{ID: 2, FirstName: "Grace", LastName: "Hopper, who wrote a long enough name to be chunked"}))
+	assert.NoError(t, store.Put("account:1", Account{ID: 1}))
+
+	store.Marshaler = &kvsync.EnvelopeMarshaler{Build: "v2"}
+	assert.NoError(t, store.Put("profile:3", Profile{ID: 3, FirstName: "Barbara"}))
+
+	purged, err := store.PurgeByProducerVersion(context.Background(), "profile:", "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, purged)
+
+	for _, key := range s.Keys() {
+		assert.NotContains(t, key, "profile:1")
+		assert.NotContains(t, key, "profile:2")
+	}
+	assert.NoError(t, store.Fetch("profile:3", &Profile{}))
+	assert.NoError(t, store.Fetch("account:1", &Account{}))
+}
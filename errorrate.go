@@ -0,0 +1,103 @@
+package kvsync
+
+import (
+	"sync"
+)
+
+// ErrorRateOptions configures automatic disabling of models whose sync error rate is too high.
+// The error rate is tracked per model type as an exponential moving average.
+type ErrorRateOptions struct {
+	// Threshold is the error rate (between 0 and 1) above which a model is disabled, 0 turns the feature off
+	Threshold float64
+	// Smoothing is the EMA smoothing factor (between 0 and 1), defaults to 0.1
+	Smoothing float64
+	// MinSamples is the number of syncs a model must see before it can be disabled, defaults to 10
+	MinSamples int
+	// DisabledCallback is invoked when a model gets disabled
+	DisabledCallback func(model string, errorRate float64)
+}
+
+// ModelEnabler is implemented by the KVSync returned by NewKVSync, re-enabling models disabled due to their error
+// rate. It is not part of KVSync so that other implementations of KVSync keep compiling.
+//
+//	kvSync.(kvsync.ModelEnabler).EnableModel(User{})
+type ModelEnabler interface {
+	EnableModel(model any)
+}
+
+type modelErrorRate struct {
+	rate     float64
+	samples  int
+	disabled bool
+}
+
+type errorRateTracker struct {
+	options ErrorRateOptions
+	models  map[string]*modelErrorRate
+	mutex   sync.Mutex
+}
+
+func newErrorRateTracker(options ErrorRateOptions) *errorRateTracker {
+	if options.Smoothing <= 0 || options.Smoothing > 1 {
+		options.Smoothing = 0.1
+	}
+
+	if options.MinSamples < 1 {
+		options.MinSamples = 10
+	}
+
+	return &errorRateTracker{
+		options: options,
+		models:  make(map[string]*modelErrorRate),
+	}
+}
+
+func (t *errorRateTracker) observe(model string, err error) {
+	if t.options.Threshold <= 0 {
+		return
+	}
+
+	var sample float64
+	if err != nil {
+		sample = 1
+	}
+
+	t.mutex.Lock()
+
+	m, ok := t.models[model]
+	if !ok {
+		m = &modelErrorRate{rate: sample}
+		t.models[model] = m
+	} else {
+		m.rate = t.options.Smoothing*sample + (1-t.options.Smoothing)*m.rate
+	}
+	m.samples++
+
+	disabled := !m.disabled && m.samples >= t.options.MinSamples && m.rate > t.options.Threshold
+	if disabled {
+		m.disabled = true
+	}
+	rate := m.rate
+
+	t.mutex.Unlock()
+
+	if disabled && t.options.DisabledCallback != nil {
+		t.options.DisabledCallback(model, rate)
+	}
+}
+
+func (t *errorRateTracker) isDisabled(model string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	m, ok := t.models[model]
+
+	return ok && m.disabled
+}
+
+func (t *errorRateTracker) enable(model string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.models, model)
+}
@@ -0,0 +1,128 @@
+package kvsync
+
+import (
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrKeyNotFound is returned by stores fetching a missing or expired key, telling a cache miss apart
+	// from a real failure
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrNotPointer is returned when fetching into a destination that is not a pointer to a struct
+	ErrNotPointer = errors.New("destination must be a pointer to a struct")
+	// ErrStoreUnavailable is returned when a store cannot be reached, e.g. on network errors and timeouts
+	ErrStoreUnavailable = errors.New("store is unavailable")
+	// ErrNotSyncable is returned and reported for models implementing neither Syncable nor KeySpecSyncable
+	// and declaring no key tags
+	ErrNotSyncable = errors.New("model is not syncable")
+	// ErrModelDisabled is returned and reported for models disabled by their error rate or by config
+	ErrModelDisabled = errors.New("model is disabled")
+	// ErrHalted is returned and reported while the kill switch is engaged
+	ErrHalted = errors.New("syncing is halted by the kill switch")
+	// ErrFiltered is reported for entities opted out by Options.Filter or SyncFilter
+	ErrFiltered = errors.New("entity is filtered out")
+	// ErrQueueFull is reported for entities dropped after waiting Options.EnqueueTimeout for the queue
+	ErrQueueFull = errors.New("sync queue is full")
+	// ErrPaused is returned and reported for entities dropped or not synced while KVSync is paused
+	ErrPaused = errors.New("syncing is paused")
+	// ErrLocked is returned when a job runs on another replica, see Locker
+	ErrLocked = errors.New("lock is held by another replica")
+	// ErrStopped is returned by HealthCheck once the context of KVSync is done
+	ErrStopped = errors.New("syncing is stopped")
+	// ErrInvalidOptions is returned by New and Options.Validate for configurations that cannot work
+	ErrInvalidOptions = errors.New("invalid options")
+	// ErrCorrupted is returned when fetching a value whose payload doesn't match its envelope checksum, or a
+	// chunked value missing chunks, see Options.RepairLoaders
+	ErrCorrupted = errors.New("value is corrupted")
+	// ErrDeleteUnsupported is returned and reported when deleting keys from a store not implementing Deleter
+	ErrDeleteUnsupported = errors.New("store does not support deleting keys")
+	// ErrQuotaExceeded is matched by the QuotaError of keys whose tenant exceeded its quota, see QuotaOptions
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+// MarshalError is returned when the value of a key cannot be serialized, or deserialized when Unmarshal is set
+type MarshalError struct {
+	Key       string
+	Unmarshal bool
+	Err       error
+}
+
+func (e *MarshalError) Error() string {
+	if e.Unmarshal {
+		return fmt.Sprintf("cannot unmarshal the value of key %s: %v", e.Key, e.Err)
+	}
+
+	return fmt.Sprintf("cannot marshal the value of key %s: %v", e.Key, e.Err)
+}
+
+func (e *MarshalError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is reported for each key of an entity whose sync panicked, e.g. in a marshaler or a model hook
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("sync panicked: %v", e.Value)
+}
+
+// keyNotFoundError is ErrKeyNotFound for a key, wrapping the store's own error such as redis.Nil
+type keyNotFoundError struct {
+	key   string
+	cause error
+}
+
+func (e *keyNotFoundError) Error() string {
+	return fmt.Sprintf("key %s not found", e.key)
+}
+
+func (e *keyNotFoundError) Is(target error) bool {
+	return target == ErrKeyNotFound
+}
+
+func (e *keyNotFoundError) Unwrap() error {
+	return e.cause
+}
+
+// unavailableError is ErrStoreUnavailable wrapping the client error
+type unavailableError struct {
+	cause error
+}
+
+func (e *unavailableError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrStoreUnavailable, e.cause)
+}
+
+func (e *unavailableError) Is(target error) bool {
+	return target == ErrStoreUnavailable
+}
+
+func (e *unavailableError) Unwrap() error {
+	return e.cause
+}
+
+// redisError maps the error of a command on a key: redis.Nil to ErrKeyNotFound, and errors other than
+// Redis replies (network errors, timeouts, closed clients) to ErrStoreUnavailable
+func redisError(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, redis.Nil) {
+		return &keyNotFoundError{key: key, cause: err}
+	}
+
+	var reply redis.Error
+	var marshalErr *MarshalError
+	if errors.As(err, &reply) || errors.As(err, &marshalErr) ||
+		errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrStoreUnavailable) || errors.Is(err, ErrCorrupted) {
+		return err
+	}
+
+	return &unavailableError{cause: err}
+}
@@ -0,0 +1,197 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// FailoverStore serves reads and writes from Primary, falling back to Secondary, e.g. an InMemoryStore or a
+// second Redis, once Primary fails with ErrStoreUnavailable. Primary is probed again every ProbeInterval, with
+// a ping when it is a Pinger, and used again once it answers. The keys written or deleted meanwhile are deleted
+// from Primary on recovery, so that it never serves values older than the ones written to Secondary.
+type FailoverStore struct {
+	Primary   KVStore
+	Secondary KVStore
+	// ProbeInterval is how long to wait between probes of a failed Primary, defaults to 5 seconds
+	ProbeInterval time.Duration
+	// StateCallback is optionally invoked when failing over, with the error of Primary, and when recovering
+	StateCallback func(failedOver bool, err error)
+
+	failedOver bool
+	probedAt   time.Time
+	dirty      map[string]struct{}
+	mutex      sync.Mutex
+}
+
+func (f *FailoverStore) Fetch(key string, dest any) error {
+	if f.usePrimary() {
+		err := f.Primary.Fetch(key, dest)
+		if !f.failOver(err) {
+			return err
+		}
+	}
+
+	return f.Secondary.Fetch(key, dest)
+}
+
+func (f *FailoverStore) Put(key string, value any) error {
+	return f.write(key, func(store KVStore) error {
+		return store.Put(key, value)
+	})
+}
+
+func (f *FailoverStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	return f.write(key, func(store KVStore) error {
+		return putWithTTL(store, key, value, ttl)
+	})
+}
+
+func (f *FailoverStore) Delete(key string) error {
+	return f.write(key, func(store KVStore) error {
+		return deleteKey(store, key)
+	})
+}
+
+func (f *FailoverStore) Exists(key string) (bool, error) {
+	if f.usePrimary() {
+		found, err := exists(f.Primary, key)
+		if !f.failOver(err) {
+			return found, err
+		}
+	}
+
+	return exists(f.Secondary, key)
+}
+
+func (f *FailoverStore) TTL(key string) (time.Duration, error) {
+	if f.usePrimary() {
+		ttl, err := keyTTL(f.Primary, key)
+		if !f.failOver(err) {
+			return ttl, err
+		}
+	}
+
+	return keyTTL(f.Secondary, key)
+}
+
+func (f *FailoverStore) Touch(key string, ttl time.Duration) error {
+	return f.write(key, func(store KVStore) error {
+		return touchKey(store, key, ttl)
+	})
+}
+
+// Keys scans the keys of the store in use, a scan started on Primary restarting on Secondary when failing over
+func (f *FailoverStore) Keys(prefix string, limit int, cursor string) ([]string, string, error) {
+	if f.usePrimary() {
+		keys, next, err := scan(f.Primary, prefix, limit, cursor)
+		if !f.failOver(err) {
+			return keys, next, err
+		}
+		cursor = ""
+	}
+
+	return scan(f.Secondary, prefix, limit, cursor)
+}
+
+// Ping succeeds when either store answers
+func (f *FailoverStore) Ping(ctx context.Context) error {
+	if err := ping(ctx, f.Primary); err == nil {
+		return nil
+	}
+
+	return ping(ctx, f.Secondary)
+}
+
+// FailedOver reports whether Secondary is in use
+func (f *FailoverStore) FailedOver() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.failedOver
+}
+
+func (f *FailoverStore) write(key string, op func(store KVStore) error) error {
+	if f.usePrimary() {
+		err := op(f.Primary)
+		if !f.failOver(err) {
+			return err
+		}
+	}
+
+	f.mutex.Lock()
+	f.dirty[key] = struct{}{}
+	f.mutex.Unlock()
+
+	return op(f.Secondary)
+}
+
+// failOver switches to Secondary when err tells Primary is unavailable, returning whether it did
+func (f *FailoverStore) failOver(err error) bool {
+	if !errors.Is(err, ErrStoreUnavailable) {
+		return false
+	}
+
+	f.mutex.Lock()
+	switched := !f.failedOver
+	if switched {
+		f.failedOver = true
+		f.dirty = make(map[string]struct{})
+	}
+	f.probedAt = time.Now()
+	f.mutex.Unlock()
+
+	if switched && f.StateCallback != nil {
+		f.StateCallback(true, err)
+	}
+
+	return true
+}
+
+// usePrimary reports whether Primary is in use, probing it when due
+func (f *FailoverStore) usePrimary() bool {
+	use, recovered := f.probe()
+	if recovered && f.StateCallback != nil {
+		f.StateCallback(false, nil)
+	}
+
+	return use
+}
+
+func (f *FailoverStore) probe() (use bool, recovered bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.failedOver {
+		return true, false
+	}
+
+	if time.Since(f.probedAt) < f.probeInterval() {
+		return false, false
+	}
+	f.probedAt = time.Now()
+
+	if err := ping(context.Background(), f.Primary); err != nil {
+		return false, false
+	}
+
+	// Primary missed the writes made while failed over
+	for key := range f.dirty {
+		if err := deleteKey(f.Primary, key); err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return false, false
+		}
+		delete(f.dirty, key)
+	}
+	f.failedOver = false
+
+	return true, true
+}
+
+func (f *FailoverStore) probeInterval() time.Duration {
+	if f.ProbeInterval <= 0 {
+		return 5 * time.Second
+	}
+
+	return f.ProbeInterval
+}
@@ -0,0 +1,113 @@
+package kvsync_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFailoverStore(t *testing.T) {
+	primary, s := setUpStore()
+	defer s.Close()
+
+	secondary := &kvsync.InMemoryStore{Store: make(map[string]any)}
+
+	var states []bool
+	store := &kvsync.FailoverStore{
+		Primary:       primary,
+		Secondary:     secondary,
+		ProbeInterval: 50 * time.Millisecond,
+		StateCallback: func(failedOver bool, err error) {
+			states = append(states, failedOver)
+		},
+	}
+
+	assert.NoError(t, store.Put("user:1", User{ID: 1, Name: "Alice"}))
+	assert.NoError(t, store.Put("user:2", User{ID: 2, Name: "Bob"}))
+	assert.Empty(t, secondary.Store)
+
+	s.Close()
+
+	var user User
+	assert.ErrorIs(t, store.Fetch("user:1", &user), kvsync.ErrKeyNotFound, "served by the secondary")
+	assert.True(t, store.FailedOver())
+
+	assert.NoError(t, store.Put("user:1", User{ID: 1, Name: "Alice Updated"}))
+	assert.NoError(t, store.Fetch("user:1", &user))
+	assert.Equal(t, "Alice Updated", user.Name)
+
+	assert.NoError(t, s.Restart())
+
+	// not probed yet
+	assert.NoError(t, store.Fetch("user:1", &user))
+	assert.True(t, store.FailedOver())
+
+	time.Sleep(60 * time.Millisecond)
+
+	// the value written while failed over is dropped from the primary
+	assert.ErrorIs(t, store.Fetch("user:1", &user), kvsync.ErrKeyNotFound)
+	assert.False(t, store.FailedOver())
+	assert.NoError(t, store.Fetch("user:2", &user))
+	assert.Equal(t, "Bob", user.Name)
+
+	assert.Equal(t, []bool{true, false}, states)
+}
+
+func TestFailoverStore_OptionalInterfaces(t *testing.T) {
+	primary, s := setUpStore()
+	defer s.Close()
+
+	assertOptionalInterfaces(t, &kvsync.FailoverStore{Primary: primary, Secondary: &kvsync.InMemoryStore{Store: make(map[string]any)}})
+
+	calls := map[string]func(store *kvsync.FailoverStore) error{
+		"put with ttl": func(store *kvsync.FailoverStore) error {
+			return store.PutWithTTL("user:1", User{ID: 1}, time.Minute)
+		},
+		"delete": func(store *kvsync.FailoverStore) error {
+			return store.Delete("user:1")
+		},
+		"exists": func(store *kvsync.FailoverStore) error {
+			_, err := store.Exists("user:1")
+			return err
+		},
+		"ttl": func(store *kvsync.FailoverStore) error {
+			_, err := store.TTL("user:1")
+			return err
+		},
+		"touch": func(store *kvsync.FailoverStore) error {
+			return store.Touch("user:1", time.Minute)
+		},
+		"keys": func(store *kvsync.FailoverStore) error {
+			keys, _, err := store.Keys("user:", 10, "primary-cursor")
+			if len(keys) != 1 {
+				return fmt.Errorf("unexpected keys %v", keys)
+			}
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			store := &kvsync.FailoverStore{
+				Primary:   &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{}, ErrorRate: 1},
+				Secondary: &kvsync.InMemoryStore{Store: map[string]any{"user:1": User{ID: 1}}},
+			}
+
+			assert.NoError(t, call(store), "served by the secondary")
+			assert.True(t, store.FailedOver())
+			assert.NoError(t, call(store), "the primary is not probed before the default interval")
+		})
+	}
+
+	store := &kvsync.FailoverStore{
+		Primary:   &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{}, ErrorRate: 1},
+		Secondary: &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{}, ErrorRate: 0},
+	}
+	assert.NoError(t, store.Ping(context.Background()), "either store answers")
+
+	store.Secondary.(*kvsync.ChaosStore).ErrorRate = 1
+	assert.ErrorIs(t, store.Ping(context.Background()), kvsync.ErrStoreUnavailable)
+}
@@ -0,0 +1,344 @@
+package kvsync
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// fieldTag is a parsed kvsync struct tag: `kvsync:"-"` excludes a field from serialization,
+// `kvsync:"name=..."` renames it and `kvsync:"key=...,keyname=...,ttl=..."` declares a sync key
+type fieldTag struct {
+	skip    bool
+	name    string
+	key     string
+	keyName string
+	ttl     string
+}
+
+func parseFieldTag(tag string) fieldTag {
+	var ft fieldTag
+	for _, option := range strings.Split(tag, ",") {
+		switch {
+		case option == "-":
+			ft.skip = true
+		case strings.HasPrefix(option, "name="):
+			ft.name = strings.TrimPrefix(option, "name=")
+		case strings.HasPrefix(option, "key="):
+			ft.key = strings.TrimPrefix(option, "key=")
+		case strings.HasPrefix(option, "keyname="):
+			ft.keyName = strings.TrimPrefix(option, "keyname=")
+		case strings.HasPrefix(option, "ttl="):
+			ft.ttl = strings.TrimPrefix(option, "ttl=")
+		}
+	}
+
+	return ft
+}
+
+// taggedType is the type actually serialized for a type whose structs, at any depth, have kvsync tags
+type taggedType struct {
+	serialized reflect.Type
+	// fields are the serialized fields of a struct type
+	fields []taggedField
+	// elem is the tagged type of the elements of a pointer, slice, array or map type
+	elem *taggedType
+}
+
+type taggedField struct {
+	// index is the index of the field in the original struct type
+	index int
+	// tagged is the tagged type of the field, nil when it is serialized as is
+	tagged *taggedType
+}
+
+var taggedTypes sync.Map
+
+var selfMarshalerTypes = []reflect.Type{
+	reflect.TypeOf((*json.Marshaler)(nil)).Elem(),
+	reflect.TypeOf((*json.Unmarshaler)(nil)).Elem(),
+	reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem(),
+	reflect.TypeOf((*bson.Marshaler)(nil)).Elem(),
+	reflect.TypeOf((*bson.Unmarshaler)(nil)).Elem(),
+	reflect.TypeOf((*bson.ValueMarshaler)(nil)).Elem(),
+}
+
+// taggedTypeOf returns the serialized type of a type, nil when no kvsync tag excludes or renames a field of its
+// structs, or when it marshals itself
+func taggedTypeOf(t reflect.Type) *taggedType {
+	if cached, ok := taggedTypes.Load(t); ok {
+		return cached.(*taggedType)
+	}
+
+	tt := newTaggedType(t, false, make(map[reflect.Type]bool))
+	taggedTypes.Store(t, tt)
+
+	return tt
+}
+
+// marshalsItself reports whether a type has its own marshaling methods, whose output kvsync tags must not alter
+func marshalsItself(t reflect.Type) bool {
+	for _, marshaler := range selfMarshalerTypes {
+		if t.Implements(marshaler) || reflect.PtrTo(t).Implements(marshaler) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newTaggedType builds the serialized type of a type. Structs are copied even without kvsync tags when embedded
+// is set, the copy having no methods so that reflect.StructOf can embed it. Recursive types are serialized as is
+// from their second occurrence.
+func newTaggedType(t reflect.Type, embedded bool, visiting map[reflect.Type]bool) *taggedType {
+	if marshalsItself(t) {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		elem := newTaggedType(t.Elem(), embedded && t.Kind() == reflect.Ptr, visiting)
+		if elem == nil {
+			return nil
+		}
+
+		tt := &taggedType{elem: elem}
+		switch t.Kind() {
+		case reflect.Ptr:
+			tt.serialized = reflect.PtrTo(elem.serialized)
+		case reflect.Slice:
+			tt.serialized = reflect.SliceOf(elem.serialized)
+		case reflect.Array:
+			tt.serialized = reflect.ArrayOf(t.Len(), elem.serialized)
+		default:
+			tt.serialized = reflect.MapOf(t.Key(), elem.serialized)
+		}
+
+		return tt
+	case reflect.Struct:
+		if visiting[t] {
+			return nil
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		return newTaggedStruct(t, embedded, visiting)
+	default:
+		return nil
+	}
+}
+
+func newTaggedStruct(t reflect.Type, embedded bool, visiting map[reflect.Type]bool) *taggedType {
+	changed := embedded
+	tags := make([]fieldTag, t.NumField())
+	fields := make([]taggedField, 0, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tags[i] = parseFieldTag(f.Tag.Get("kvsync"))
+		if !f.IsExported() || tags[i].skip {
+			changed = changed || tags[i].skip
+			continue
+		}
+
+		tagged := newTaggedType(f.Type, false, visiting)
+		changed = changed || tagged != nil || tags[i].name != ""
+		fields = append(fields, taggedField{index: i, tagged: tagged})
+	}
+
+	if !changed {
+		return nil
+	}
+
+	tt := &taggedType{fields: fields}
+	structFields := make([]reflect.StructField, 0, len(fields))
+
+	for i, field := range fields {
+		f := t.Field(field.index)
+
+		sf := reflect.StructField{Name: f.Name, Type: f.Type, Tag: f.Tag, Anonymous: f.Anonymous}
+		if f.Anonymous && hasMethods(f.Type) {
+			// reflect.StructOf cannot embed types with methods, they are replaced with a copy without them
+			if field.tagged == nil {
+				field.tagged = newTaggedType(f.Type, true, visiting)
+				tt.fields[i].tagged = field.tagged
+			}
+			sf.Anonymous = field.tagged != nil
+		}
+		if field.tagged != nil {
+			sf.Type = field.tagged.serialized
+		}
+		if name := tags[field.index].name; name != "" {
+			sf.Tag = reflect.StructTag(fmt.Sprintf(`json:"%s" bson:"%s"`, name, name))
+		}
+
+		structFields = append(structFields, sf)
+	}
+
+	tt.serialized = reflect.StructOf(structFields)
+
+	return tt
+}
+
+func hasMethods(t reflect.Type) bool {
+	return t.NumMethod() > 0 || reflect.PtrTo(t).NumMethod() > 0
+}
+
+// serialize copies a value of the original type into a value of the serialized type
+func (tt *taggedType) serialize(v reflect.Value) reflect.Value {
+	out := reflect.New(tt.serialized).Elem()
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			ptr := reflect.New(tt.elem.serialized)
+			ptr.Elem().Set(tt.elem.serialize(v.Elem()))
+			out.Set(ptr)
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			out.Set(reflect.MakeSlice(tt.serialized, v.Len(), v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				out.Index(i).Set(tt.elem.serialize(v.Index(i)))
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(tt.elem.serialize(v.Index(i)))
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			out.Set(reflect.MakeMapWithSize(tt.serialized, v.Len()))
+			iter := v.MapRange()
+			for iter.Next() {
+				out.SetMapIndex(iter.Key(), tt.elem.serialize(iter.Value()))
+			}
+		}
+	case reflect.Struct:
+		for i, field := range tt.fields {
+			if field.tagged == nil {
+				out.Field(i).Set(v.Field(field.index))
+			} else {
+				out.Field(i).Set(field.tagged.serialize(v.Field(field.index)))
+			}
+		}
+	}
+
+	return out
+}
+
+// deserialize copies a value of the serialized type into a value of the original type, leaving the excluded
+// fields of its structs untouched
+func (tt *taggedType) deserialize(s reflect.Value, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if s.IsNil() {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		tt.elem.deserialize(s.Elem(), v.Elem())
+	case reflect.Slice:
+		if s.IsNil() {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		out := reflect.MakeSlice(v.Type(), s.Len(), s.Len())
+		reflect.Copy(out, v)
+		for i := 0; i < s.Len(); i++ {
+			tt.elem.deserialize(s.Index(i), out.Index(i))
+		}
+		v.Set(out)
+	case reflect.Array:
+		for i := 0; i < s.Len(); i++ {
+			tt.elem.deserialize(s.Index(i), v.Index(i))
+		}
+	case reflect.Map:
+		if s.IsNil() {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		out := reflect.MakeMapWithSize(v.Type(), s.Len())
+		iter := s.MapRange()
+		for iter.Next() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if existing := v.MapIndex(iter.Key()); existing.IsValid() {
+				elem.Set(existing)
+			}
+			tt.elem.deserialize(iter.Value(), elem)
+			out.SetMapIndex(iter.Key(), elem)
+		}
+		v.Set(out)
+	case reflect.Struct:
+		for i, field := range tt.fields {
+			if field.tagged == nil {
+				v.Field(field.index).Set(s.Field(i))
+			} else {
+				field.tagged.deserialize(s.Field(i), v.Field(field.index))
+			}
+		}
+	}
+}
+
+// applyFieldTags returns the value to serialize for v, honoring the kvsync struct tags of its structs at any depth.
+// Types with their own marshaling methods, e.g. implementing json.Marshaler or bson.Marshaler, are left as is.
+func applyFieldTags(v any) any {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+
+	if !val.IsValid() || val.Kind() == reflect.Ptr {
+		return v
+	}
+
+	tt := taggedTypeOf(val.Type())
+	if tt == nil {
+		return v
+	}
+
+	return tt.serialize(val).Interface()
+}
+
+// unmarshalFieldTags unmarshals data into v, honoring its kvsync struct tags. Excluded fields are left untouched.
+func unmarshalFieldTags(data []byte, v any, unmarshal func(data []byte, v any) error) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return unmarshal(data, v)
+	}
+
+	tt := taggedTypeOf(val.Elem().Type())
+	if tt == nil {
+		return unmarshal(data, v)
+	}
+
+	serialized := reflect.New(tt.serialized)
+	if err := unmarshal(data, serialized.Interface()); err != nil {
+		return err
+	}
+
+	tt.deserialize(serialized.Elem(), val.Elem())
+
+	return nil
+}
+
+// FieldTagMarshalingAdapter makes any MarshalingAdapter honor kvsync struct tags, `kvsync:"-"` to exclude a field
+// and `kvsync:"name=..."` to rename it, without touching the json or bson tags of structs shared with other
+// persistence layers. The built-in adapters already honor them. Renames apply to marshalers reading json or bson tags.
+type FieldTagMarshalingAdapter struct {
+	Marshaler MarshalingAdapter
+}
+
+func (f *FieldTagMarshalingAdapter) Marshal(v any) ([]byte, error) {
+	return f.Marshaler.Marshal(applyFieldTags(v))
+}
+
+func (f *FieldTagMarshalingAdapter) Unmarshal(data []byte, v any) error {
+	return unmarshalFieldTags(data, v, f.Marshaler.Unmarshal)
+}
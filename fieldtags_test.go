@@ -0,0 +1,156 @@
+package kvsync_test
+
+import (
+	"encoding/json"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+type Member struct {
+	ID           int    `json:"id" bson:"id"`
+	Email        string `json:"email" bson:"email" kvsync:"name=contact"`
+	PasswordHash string `json:"password_hash" bson:"password_hash" kvsync:"-"`
+}
+
+func TestFieldTags_BSON(t *testing.T) {
+	store, s := setUpStore()
+	defer s.Close()
+
+	assert.NoError(t, store.Put("member:1", Member{ID: 1, Email: "ada@example.com", PasswordHash: "secret"}))
+
+	raw, err := s.Get("kvsync:member:1")
+	assert.NoError(t, err)
+
+	var doc bson.M
+	assert.NoError(t, bson.Unmarshal([]byte(raw), &doc))
+	assert.Equal(t, "ada@example.com", doc["contact"])
+	assert.NotContains(t, doc, "email")
+	assert.NotContains(t, doc, "password_hash")
+
+	fetched := Member{PasswordHash: "kept"}
+	assert.NoError(t, store.Fetch("member:1", &fetched))
+	assert.Equal(t, Member{ID: 1, Email: "ada@example.com", PasswordHash: "kept"}, fetched)
+}
+
+func TestFieldTags_JSON(t *testing.T) {
+	marshaler := &kvsync.CanonicalJSONMarshalingAdapter{}
+
+	b, err := marshaler.Marshal(&Member{ID: 1, Email: "ada@example.com", PasswordHash: "secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"contact":"ada@example.com","id":1}`, string(b))
+
+	var fetched Member
+	assert.NoError(t, marshaler.Unmarshal(b, &fetched))
+	assert.Equal(t, Member{ID: 1, Email: "ada@example.com"}, fetched)
+}
+
+type plainJSONMarshaler struct{}
+
+func (p plainJSONMarshaler) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (p plainJSONMarshaler) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func TestFieldTagMarshalingAdapter(t *testing.T) {
+	marshaler := &kvsync.FieldTagMarshalingAdapter{Marshaler: plainJSONMarshaler{}}
+
+	b, err := marshaler.Marshal(Member{ID: 1, Email: "ada@example.com", PasswordHash: "secret"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":1,"contact":"ada@example.com"}`, string(b))
+
+	var fetched Member
+	assert.NoError(t, marshaler.Unmarshal(b, &fetched))
+	assert.Equal(t, Member{ID: 1, Email: "ada@example.com"}, fetched)
+}
+
+type Team struct {
+	Lead    Member            `json:"lead" bson:"lead"`
+	Deputy  *Member           `json:"deputy" bson:"deputy"`
+	Members []Member          `json:"members" bson:"members"`
+	ByRole  map[string]Member `json:"by_role" bson:"by_role"`
+}
+
+func TestFieldTags_Nested(t *testing.T) {
+	marshaler := &kvsync.FieldTagMarshalingAdapter{Marshaler: plainJSONMarshaler{}}
+	member := Member{ID: 1, Email: "ada@example.com", PasswordHash: "secret"}
+
+	b, err := marshaler.Marshal(Team{Lead: member, Deputy: &member, Members: []Member{member}, ByRole: map[string]Member{"owner": member}})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "secret")
+	assert.JSONEq(t, `{
+		"lead":{"id":1,"contact":"ada@example.com"},
+		"deputy":{"id":1,"contact":"ada@example.com"},
+		"members":[{"id":1,"contact":"ada@example.com"}],
+		"by_role":{"owner":{"id":1,"contact":"ada@example.com"}}
+	}`, string(b))
+
+	var fetched Team
+	assert.NoError(t, marshaler.Unmarshal(b, &fetched))
+	expected := Member{ID: 1, Email: "ada@example.com"}
+	assert.Equal(t, Team{Lead: expected, Deputy: &expected, Members: []Member{expected}, ByRole: map[string]Member{"owner": expected}}, fetched)
+
+	b, err = marshaler.Marshal(Team{})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"lead":{"id":0,"contact":""},"deputy":null,"members":null,"by_role":null}`, string(b))
+
+	store, s := setUpStore()
+	defer s.Close()
+
+	assert.NoError(t, store.Put("team:1", Team{Lead: member, Members: []Member{member}}))
+
+	raw, err := s.Get("kvsync:team:1")
+	assert.NoError(t, err)
+	assert.NotContains(t, raw, "secret")
+
+	var stored Team
+	assert.NoError(t, store.Fetch("team:1", &stored))
+	assert.Equal(t, Team{Lead: expected, Members: []Member{expected}}, stored)
+}
+
+type RedactedMember struct {
+	ID    int
+	Email string `kvsync:"-"`
+}
+
+func (r RedactedMember) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{"id": r.ID, "redacted": true})
+}
+
+func TestFieldTags_SelfMarshaling(t *testing.T) {
+	marshaler := &kvsync.FieldTagMarshalingAdapter{Marshaler: plainJSONMarshaler{}}
+
+	b, err := marshaler.Marshal(RedactedMember{ID: 1, Email: "ada@example.com"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":1,"redacted":true}`, string(b))
+}
+
+type Timestamps struct {
+	CreatedAt int64 `json:"created_at" bson:"created_at"`
+}
+
+func (t Timestamps) Age(now int64) int64 {
+	return now - t.CreatedAt
+}
+
+type AuditedMember struct {
+	Timestamps
+	Member `json:"member" bson:"member"`
+}
+
+func TestFieldTags_EmbeddedWithMethods(t *testing.T) {
+	marshaler := &kvsync.FieldTagMarshalingAdapter{Marshaler: plainJSONMarshaler{}}
+	member := AuditedMember{Timestamps: Timestamps{CreatedAt: 42}, Member: Member{ID: 1, Email: "ada@example.com", PasswordHash: "secret"}}
+
+	b, err := marshaler.Marshal(member)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"created_at":42,"member":{"id":1,"contact":"ada@example.com"}}`, string(b))
+
+	var fetched AuditedMember
+	assert.NoError(t, marshaler.Unmarshal(b, &fetched))
+	assert.Equal(t, AuditedMember{Timestamps: Timestamps{CreatedAt: 42}, Member: Member{ID: 1, Email: "ada@example.com"}}, fetched)
+}
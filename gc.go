@@ -0,0 +1,161 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+// GCRule maps the keys starting with Prefix to the rows of Model they were synced from
+type GCRule struct {
+	// Prefix is the part of the keys before the embedded ID, e.g. "user:id:"
+	Prefix string
+	Model  any
+	// Column is the column the embedded IDs refer to, defaults to the primary key
+	Column string
+	// ParseID optionally extracts the ID from the rest of a key after Prefix, returning false for keys to keep.
+	// By default the rest is the ID, without any snapshot timestamp, and keys with more segments are kept.
+	ParseID func(rest string) (string, bool)
+}
+
+// GCResult counts the keys a collection went through
+type GCResult struct {
+	Scanned int
+	Deleted int
+}
+
+// GarbageCollector deletes orphaned keys, whose rows are gone from the database, e.g. because they were
+// hard deleted outside of Gorm. Rows soft deleted by Gorm count as gone.
+type GarbageCollector struct {
+	DB *gorm.DB
+	// Store must implement KeyScanner
+	Store KVStore
+	Rules []GCRule
+	// BatchSize is the number of keys checked per query, defaults to 500
+	BatchSize int
+	// DryRun counts the orphaned keys as deleted without deleting them
+	DryRun bool
+}
+
+// Collect scans the keys of every rule and deletes the orphaned ones
+func (g *GarbageCollector) Collect(ctx context.Context) (GCResult, error) {
+	var result GCResult
+
+	scanner, ok := g.Store.(KeyScanner)
+	if !ok {
+		return result, errors.New("store does not support scanning keys")
+	}
+
+	batchSize := g.BatchSize
+	if batchSize < 1 {
+		batchSize = 500
+	}
+
+	for _, rule := range g.Rules {
+		cursor := ""
+		for {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+
+			keys, next, err := scanner.Keys(rule.Prefix, batchSize, cursor)
+			if err != nil {
+				return result, err
+			}
+
+			deleted, err := g.collect(ctx, rule, keys)
+			result.Scanned += len(keys)
+			result.Deleted += deleted
+			if err != nil {
+				return result, err
+			}
+
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+	}
+
+	return result, nil
+}
+
+// Task returns Collect as a scheduled task
+func (g *GarbageCollector) Task() TaskFunc {
+	return func(ctx context.Context) error {
+		_, err := g.Collect(ctx)
+
+		return err
+	}
+}
+
+// collect deletes the keys of a page whose rows are gone, returning the number of keys deleted
+func (g *GarbageCollector) collect(ctx context.Context, rule GCRule, keys []string) (int, error) {
+	keysByID := make(map[string][]string, len(keys))
+	ids := make([]any, 0, len(keys))
+
+	for _, key := range keys {
+		id, ok := rule.parseID(strings.TrimPrefix(key, rule.Prefix))
+		if !ok {
+			continue
+		}
+
+		if _, seen := keysByID[id]; !seen {
+			ids = append(ids, id)
+		}
+		keysByID[id] = append(keysByID[id], key)
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	column := rule.Column
+	if column == "" {
+		pk, err := primaryField(g.DB, rule.Model)
+		if err != nil {
+			return 0, err
+		}
+		column = pk.DBName
+	}
+
+	var existing []string
+	err := g.DB.WithContext(ctx).Model(rule.Model).
+		Where(clause.IN{Column: clause.Column{Name: column}, Values: ids}).
+		Pluck(column, &existing).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range existing {
+		delete(keysByID, id)
+	}
+
+	deleted := 0
+	for _, orphans := range keysByID {
+		for _, key := range orphans {
+			if !g.DryRun {
+				if err := deleteKey(g.Store, key); err != nil && !errors.Is(err, ErrKeyNotFound) {
+					return deleted, err
+				}
+			}
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (r GCRule) parseID(rest string) (string, bool) {
+	if r.ParseID != nil {
+		return r.ParseID(rest)
+	}
+
+	if i := strings.Index(rest, "@"); i >= 0 {
+		rest = rest[:i]
+	}
+
+	return rest, rest != "" && !strings.Contains(rest, ":")
+}
@@ -0,0 +1,99 @@
+package kvsync_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestGarbageCollector(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	for i := 1; i <= 3; i++ {
+		user := &SyncedUser{UUID: fmt.Sprintf("gc-uuid-%d", i)}
+		assert.NoError(t, db.Create(user).Error)
+		assert.NoError(t, kvSync.Sync(user))
+	}
+
+	// hard deleted without Gorm, and soft deleted
+	assert.NoError(t, db.Exec("DELETE FROM synced_users WHERE id = 1").Error)
+	assert.NoError(t, db.Delete(&SyncedUser{}, 2).Error)
+	store.Store["user:id:1@2024-06-01T12:00:00Z"] = SyncedUser{}
+	store.Store["user:id:nested:1"] = SyncedUser{}
+
+	gc := &kvsync.GarbageCollector{
+		DB:        db,
+		Store:     store,
+		BatchSize: 2,
+		Rules: []kvsync.GCRule{
+			{Prefix: "user:id:", Model: &SyncedUser{}},
+			{Prefix: "user:uuid:", Model: &SyncedUser{}, Column: "uuid"},
+			{
+				Prefix: "user:composite:",
+				Model:  &SyncedUser{},
+				ParseID: func(rest string) (string, bool) {
+					id, _, ok := strings.Cut(rest, "_")
+					return id, ok
+				},
+			},
+		},
+	}
+
+	gc.DryRun = true
+	result, err := gc.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.GCResult{Scanned: 11, Deleted: 7}, result)
+	assert.Len(t, store.Store, 11)
+
+	gc.DryRun = false
+	result, err = gc.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 7, result.Deleted)
+
+	assert.ElementsMatch(t, []string{"user:id:3", "user:uuid:gc-uuid-3", "user:composite:3_gc-uuid-3", "user:id:nested:1"}, keys(store))
+}
+
+func keys(store *kvsync.InMemoryStore) []string {
+	var keys []string
+	for key := range store.Store {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestRedisStore_Keys(t *testing.T) {
+	store, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	for i := 0; i < 25; i++ {
+		assert.NoError(t, store.Put(fmt.Sprintf("user:id:%d", i), SyncedUser{}))
+	}
+	assert.NoError(t, store.Put("order:id:1", SyncedUser{}))
+
+	var scanned []string
+	cursor := ""
+	for {
+		keys, next, err := store.Keys("user:", 10, cursor)
+		assert.NoError(t, err)
+		scanned = append(scanned, keys...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	assert.Len(t, scanned, 25)
+	assert.Contains(t, scanned, "user:id:24")
+}
@@ -0,0 +1,177 @@
+package kvsync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelGeneration is the generation of a model kept in the KVStore, see Options.Generations
+type ModelGeneration struct {
+	Model      string
+	Generation int64
+}
+
+type cachedGeneration struct {
+	generation int64
+	fetched    time.Time
+}
+
+// generations reads and bumps the generations of models, caching them for refresh
+type generations struct {
+	store   KVStore
+	refresh time.Duration
+	cache   map[string]cachedGeneration
+	mutex   sync.Mutex
+}
+
+func newGenerations(store KVStore, refresh time.Duration) *generations {
+	if refresh == 0 {
+		refresh = time.Second
+	}
+
+	return &generations{store: store, refresh: refresh, cache: make(map[string]cachedGeneration)}
+}
+
+// get returns the generation of a model, 0 if it was never invalidated
+func (g *generations) get(model string) (int64, error) {
+	g.mutex.Lock()
+	cached, ok := g.cache[model]
+	g.mutex.Unlock()
+
+	if ok && time.Since(cached.fetched) < g.refresh {
+		return cached.generation, nil
+	}
+
+	var stored ModelGeneration
+	if err := g.store.Fetch(modelGenerationKey(model), &stored); err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return 0, err
+	}
+
+	g.remember(model, stored.Generation)
+
+	return stored.Generation, nil
+}
+
+// bump increments the generation of a model. Replicas bumping it concurrently may increment it once, which
+// still invalidates the keys written before.
+func (g *generations) bump(model string) (int64, error) {
+	var stored ModelGeneration
+	if err := g.store.Fetch(modelGenerationKey(model), &stored); err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return 0, err
+	}
+
+	next := ModelGeneration{Model: model, Generation: stored.Generation + 1}
+	if err := g.store.Put(modelGenerationKey(model), next); err != nil {
+		return 0, err
+	}
+
+	g.remember(model, next.Generation)
+
+	return next.Generation, nil
+}
+
+func (g *generations) remember(model string, generation int64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.cache[model] = cachedGeneration{generation: generation, fetched: time.Now()}
+}
+
+func modelGenerationKey(model string) string {
+	return "generation:" + model
+}
+
+// withGeneration prefixes a key with a generation, keys of generation 0 are left as is
+func withGeneration(key string, generation int64) string {
+	if generation == 0 {
+		return key
+	}
+
+	return fmt.Sprintf("g%d:%s", generation, key)
+}
+
+// withoutGeneration strips the generation prefix of a key added by withGeneration
+func withoutGeneration(key string, generation int64) string {
+	if generation == 0 {
+		return key
+	}
+
+	return strings.TrimPrefix(key, fmt.Sprintf("g%d:", generation))
+}
+
+// InvalidateModel bumps the generation of a model, so that all of its cached entries are missed at once
+// without scanning or deleting keys. Other replicas miss them after Options.GenerationRefresh. Entries of
+// older generations are left to expire.
+func (k *kvSync) InvalidateModel(model any) error {
+	if k.generations == nil {
+		return errors.New("generations are not enabled")
+	}
+
+	if k.dryRun {
+		return nil
+	}
+
+	_, err := k.generations.bump(ModelName(model))
+
+	return err
+}
+
+// generationSpecs prefixes the keys of an entity with the current generation of its model
+func (k *kvSync) generationSpecs(entity any, specs map[string]KeySpec) (map[string]KeySpec, error) {
+	if k.generations == nil {
+		return specs, nil
+	}
+
+	generation, err := k.generations.get(ModelName(entity))
+	if err != nil || generation == 0 {
+		return specs, err
+	}
+
+	prefixed := make(map[string]KeySpec, len(specs))
+	for keyName, spec := range specs {
+		spec.Key = withGeneration(spec.Key, generation)
+		prefixed[keyName] = spec
+	}
+
+	return prefixed, nil
+}
+
+// generationKey prefixes a key of an entity with the current generation of its model
+func (k *kvSync) generationKey(entity any, key string) (string, error) {
+	if k.generations == nil {
+		return key, nil
+	}
+
+	generation, err := k.generations.get(ModelName(entity))
+
+	return withGeneration(key, generation), err
+}
+
+// generationOf returns the current generation of the model of an entity, 0 when generations are not enabled
+// or cannot be read
+func (k *kvSync) generationOf(entity any) int64 {
+	if k.generations == nil {
+		return 0
+	}
+
+	generation, _ := k.generations.get(ModelName(entity))
+
+	return generation
+}
+
+// generationPrefixes prefixes key prefixes of a model with its current generation
+func (k *kvSync) generationPrefixes(model any, prefixes []string) ([]string, error) {
+	prefixed := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		key, err := k.generationKey(model, prefix)
+		if err != nil {
+			return nil, err
+		}
+		prefixed = append(prefixed, key)
+	}
+
+	return prefixed, nil
+}
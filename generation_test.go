@@ -0,0 +1,51 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestInvalidateModel(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+
+	kvSync, err := kvsync.New(context.Background(), kvsync.WithStore(store), kvsync.WithGenerations(time.Millisecond))
+	assert.NoError(t, err)
+	replica, err := kvsync.New(context.Background(), kvsync.WithStore(store), kvsync.WithGenerations(time.Hour))
+	assert.NoError(t, err)
+
+	user := SyncedUser{UUID: "generation-uuid", Username: "generation-username"}
+	user.ID = 1
+	assert.NoError(t, kvSync.Sync(&user))
+	assert.Contains(t, store.Store, "user:id:1", "keys of generation 0 are not prefixed")
+
+	fetched := SyncedUser{UUID: "generation-uuid"}
+	assert.NoError(t, replica.Fetch(&fetched, "uuid"))
+
+	assert.NoError(t, kvSync.InvalidateModel(&SyncedUser{}))
+
+	fetched = SyncedUser{UUID: "generation-uuid"}
+	assert.ErrorIs(t, kvSync.Fetch(&fetched, "uuid"), kvsync.ErrKeyNotFound)
+	found, err := kvSync.Exists(&user, "id")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, replica.Fetch(&fetched, "uuid"), "replicas see the new generation after their refresh")
+
+	assert.NoError(t, kvSync.Sync(&user))
+	assert.Contains(t, store.Store, "g1:user:id:1")
+	assert.NoError(t, kvSync.Fetch(&fetched, "uuid"))
+	assert.Equal(t, "generation-username", fetched.Username)
+
+	keys, err := kvSync.ListModelKeys(&SyncedUser{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"g1:user:id:1", "g1:user:uuid:generation-uuid", "g1:user:composite:1_generation-uuid"}, keys)
+
+	withoutGenerations := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store})
+	assert.Error(t, withoutGenerations.InvalidateModel(&SyncedUser{}))
+
+	_, err = kvsync.New(context.Background(), kvsync.WithStore(store), kvsync.WithGenerations(-time.Second))
+	assert.ErrorIs(t, err, kvsync.ErrInvalidOptions)
+}
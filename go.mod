@@ -1,6 +1,6 @@
 module github.com/ndthuan/kvsync
 
-go 1.18
+go 1.19
 
 require (
 	github.com/alicebob/miniredis/v2 v2.33.0
@@ -0,0 +1,27 @@
+module github.com/ndthuan/kvsync/gocache
+
+go 1.19
+
+require (
+	github.com/eko/gocache/lib/v4 v4.1.6
+	github.com/ndthuan/kvsync v0.0.0
+	github.com/stretchr/testify v1.9.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/golang/mock v1.6.0 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/redis/go-redis/v9 v9.5.3 // indirect
+	go.mongodb.org/mongo-driver v1.15.0 // indirect
+	golang.org/x/exp v0.0.0-20221126150942-6ab00d035af9 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gorm.io/gorm v1.25.10 // indirect
+)
+
+// the sources of the parent module are used until a kvsync release with the APIs used here is tagged
+replace github.com/ndthuan/kvsync => ../
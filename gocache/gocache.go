@@ -0,0 +1,215 @@
+// Package gocache adapts kvsync stores to eko/gocache stores and vice versa, so that application
+// caching code and kvsync can share backends and keyspaces.
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/eko/gocache/lib/v4/store"
+	"github.com/ndthuan/kvsync"
+	"reflect"
+	"time"
+)
+
+const storeType = "kvsync"
+
+// GocacheStore presents a kvsync.KVStore as a gocache store.StoreInterface
+type GocacheStore struct {
+	Store kvsync.KVStore
+	// NewValue returns a pointer to a new value that Get fetches into, e.g. func() any { return &User{} }
+	NewValue func() any
+	// Prefix is prepended to the keys of the cache, scoping Clear to them in a keyspace shared with KVSync
+	Prefix string
+}
+
+// FromKVStore returns a gocache store backed by a kvsync.KVStore
+func FromKVStore(kvStore kvsync.KVStore, newValue func() any) *GocacheStore {
+	return &GocacheStore{
+		Store:    kvStore,
+		NewValue: newValue,
+	}
+}
+
+func (g *GocacheStore) Get(_ context.Context, key any) (any, error) {
+	dest := g.NewValue()
+
+	if err := g.Store.Fetch(g.key(key), dest); err != nil {
+		if errors.Is(err, kvsync.ErrKeyNotFound) {
+			return nil, store.NotFoundWithCause(err)
+		}
+
+		return nil, err
+	}
+
+	return dest, nil
+}
+
+// GetWithTTL returns the value and its remaining time to live when the store implements kvsync.TouchStore.
+// The TTL is zero for keys without expiration and for other stores.
+func (g *GocacheStore) GetWithTTL(ctx context.Context, key any) (any, time.Duration, error) {
+	value, err := g.Get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	touchStore, ok := g.Store.(kvsync.TouchStore)
+	if !ok {
+		return value, 0, nil
+	}
+
+	ttl, err := touchStore.TTL(g.key(key))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return value, ttl, nil
+}
+
+func (g *GocacheStore) Set(_ context.Context, key any, value any, options ...store.Option) error {
+	opts := store.ApplyOptions(options...)
+
+	if ttlStore, ok := g.Store.(kvsync.TTLStore); ok && opts.Expiration > 0 {
+		return ttlStore.PutWithTTL(g.key(key), value, opts.Expiration)
+	}
+
+	return g.Store.Put(g.key(key), value)
+}
+
+// Delete fails with kvsync.ErrDeleteUnsupported when the store doesn't implement kvsync.Deleter
+func (g *GocacheStore) Delete(_ context.Context, key any) error {
+	deleter, ok := g.Store.(kvsync.Deleter)
+	if !ok {
+		return kvsync.ErrDeleteUnsupported
+	}
+
+	return deleter.Delete(g.key(key))
+}
+
+// Invalidate is not supported since KVStore has no notion of tags
+func (g *GocacheStore) Invalidate(_ context.Context, _ ...store.InvalidateOption) error {
+	return errors.New("invalidation by tags is not supported")
+}
+
+// Clear deletes the keys starting with Prefix when the underlying store implements kvsync.PrefixDeleter. It
+// fails without a Prefix rather than deleting every key of the store, synced ones included.
+func (g *GocacheStore) Clear(_ context.Context) error {
+	if g.Prefix == "" {
+		return errors.New("clearing requires a Prefix")
+	}
+
+	deleter, ok := g.Store.(kvsync.PrefixDeleter)
+	if !ok {
+		return errors.New("store does not support deleting by prefix")
+	}
+
+	return deleter.DeleteByPrefix(g.Prefix)
+}
+
+func (g *GocacheStore) GetType() string {
+	return storeType
+}
+
+func (g *GocacheStore) key(key any) string {
+	return g.Prefix + fmt.Sprint(key)
+}
+
+// KVStore presents a gocache store.StoreInterface as a kvsync.KVStore
+type KVStore struct {
+	Store store.StoreInterface
+	// Marshaler decodes values the gocache store returns as bytes or strings (e.g. its Redis store)
+	Marshaler kvsync.MarshalingAdapter
+}
+
+// ToKVStore returns a kvsync.KVStore backed by a gocache store
+func ToKVStore(gocacheStore store.StoreInterface) *KVStore {
+	return &KVStore{
+		Store: gocacheStore,
+	}
+}
+
+func (k *KVStore) Put(key string, value any) error {
+	if k.Marshaler != nil {
+		b, err := k.Marshaler.Marshal(value)
+		if err != nil {
+			return &kvsync.MarshalError{Key: key, Err: err}
+		}
+		value = b
+	}
+
+	return k.Store.Set(context.Background(), key, value)
+}
+
+func (k *KVStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	if k.Marshaler != nil {
+		b, err := k.Marshaler.Marshal(value)
+		if err != nil {
+			return &kvsync.MarshalError{Key: key, Err: err}
+		}
+		value = b
+	}
+
+	return k.Store.Set(context.Background(), key, value, store.WithExpiration(ttl))
+}
+
+func (k *KVStore) Fetch(key string, dest any) error {
+	destVal := reflect.ValueOf(dest)
+	if destVal.Kind() != reflect.Ptr || destVal.IsNil() {
+		return kvsync.ErrNotPointer
+	}
+
+	value, err := k.Store.Get(context.Background(), key)
+	if err != nil {
+		if errors.Is(err, &store.NotFound{}) {
+			return fmt.Errorf("key %s: %w: %v", key, kvsync.ErrKeyNotFound, err)
+		}
+
+		return err
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		if k.Marshaler != nil {
+			return k.unmarshal(key, v, dest)
+		}
+	case string:
+		if k.Marshaler != nil {
+			return k.unmarshal(key, []byte(v), dest)
+		}
+	}
+
+	val := reflect.ValueOf(value)
+	for val.Kind() == reflect.Ptr && !val.Type().AssignableTo(destVal.Elem().Type()) {
+		val = val.Elem()
+	}
+
+	if !val.Type().AssignableTo(destVal.Elem().Type()) {
+		return fmt.Errorf("cannot assign %s to %s", val.Type(), destVal.Elem().Type())
+	}
+
+	destVal.Elem().Set(val)
+
+	return nil
+}
+
+// Exists gets the raw value of a key without unmarshaling it
+func (k *KVStore) Exists(key string) (bool, error) {
+	_, err := k.Store.Get(context.Background(), key)
+	if errors.Is(err, &store.NotFound{}) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (k *KVStore) Delete(key string) error {
+	return k.Store.Delete(context.Background(), key)
+}
+
+func (k *KVStore) unmarshal(key string, data []byte, dest any) error {
+	if err := k.Marshaler.Unmarshal(data, dest); err != nil {
+		return &kvsync.MarshalError{Key: key, Unmarshal: true, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package gocache_test
+
+import (
+	"context"
+	"github.com/eko/gocache/lib/v4/store"
+	"github.com/ndthuan/kvsync"
+	"github.com/ndthuan/kvsync/gocache"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type User struct {
+	ID   int
+	Name string
+}
+
+func TestRoundTrip(t *testing.T) {
+	memory := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	gocacheStore := gocache.FromKVStore(memory, func() any {
+		return &User{}
+	})
+	kvStore := gocache.ToKVStore(gocacheStore)
+
+	assert.NoError(t, kvStore.Put("user:1", User{ID: 1, Name: "Alice"}))
+
+	value, err := gocacheStore.Get(context.Background(), "user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, &User{ID: 1, Name: "Alice"}, value)
+
+	var fetched User
+	assert.NoError(t, kvStore.Fetch("user:1", &fetched))
+	assert.Equal(t, "Alice", fetched.Name)
+
+	assert.NoError(t, kvStore.Delete("user:1"))
+	assert.Error(t, kvStore.Fetch("user:1", &fetched))
+
+	assert.NoError(t, kvStore.Put("user:2", User{ID: 2}))
+	assert.Error(t, gocacheStore.Clear(context.Background()), "clearing requires a prefix")
+	assert.Len(t, memory.Store, 1)
+}
+
+func TestGocacheStore_Prefix(t *testing.T) {
+	memory := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+	assert.NoError(t, memory.Put("user:1", User{ID: 1}))
+
+	gocacheStore := gocache.FromKVStore(memory, func() any {
+		return &User{}
+	})
+	gocacheStore.Prefix = "cache:"
+
+	ctx := context.Background()
+	assert.NoError(t, gocacheStore.Set(ctx, "user:2", User{ID: 2}, store.WithExpiration(time.Minute)))
+	assert.Contains(t, memory.Store, "cache:user:2")
+
+	value, ttl, err := gocacheStore.GetWithTTL(ctx, "user:2")
+	assert.NoError(t, err)
+	assert.Equal(t, &User{ID: 2}, value)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+
+	assert.NoError(t, gocacheStore.Set(ctx, "user:3", User{ID: 3}))
+	_, ttl, err = gocacheStore.GetWithTTL(ctx, "user:3")
+	assert.NoError(t, err)
+	assert.Zero(t, ttl, "keys without expiration")
+
+	_, _, err = gocacheStore.GetWithTTL(ctx, "user:4")
+	assert.Error(t, err)
+
+	assert.NoError(t, gocacheStore.Clear(ctx))
+	assert.Equal(t, []string{"user:1"}, keys(memory), "only the keys of the cache are cleared")
+}
+
+func keys(memory *kvsync.InMemoryStore) []string {
+	var keys []string
+	for key := range memory.Store {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
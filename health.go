@@ -0,0 +1,55 @@
+package kvsync
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pinger is implemented by stores able to check their connectivity, such as RedisStore
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthCheck returns an error when entities cannot be synced: the KVSync's context is done, stopping its
+// workers, or its store, when a Pinger, does not answer. Pausing and the kill switch are deliberate and
+// don't fail it. It is meant for readiness probes.
+func (k *kvSync) HealthCheck(ctx context.Context) error {
+	if err := k.ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrStopped, err)
+	}
+
+	return ping(ctx, k.store)
+}
+
+// ping pings a store when it is a Pinger
+func ping(ctx context.Context, store KVStore) error {
+	if pinger, ok := store.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+// Ping sends a PING to Redis, failing with ErrStoreUnavailable when it cannot be reached
+func (r *RedisStore) Ping(ctx context.Context) error {
+	return redisError("", r.Client.Ping(ctx).Err())
+}
+
+// Ping always succeeds, the store being in memory
+func (m *InMemoryStore) Ping(_ context.Context) error {
+	return nil
+}
+
+// Ping pings the local and remote stores
+func (t *TieredStore) Ping(ctx context.Context) error {
+	if err := ping(ctx, t.Local); err != nil {
+		return err
+	}
+
+	return ping(ctx, t.Remote)
+}
+
+// Ping pings the wrapped store
+func (c *CoalescingStore) Ping(ctx context.Context) error {
+	return ping(ctx, c.KVStore)
+}
@@ -0,0 +1,44 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKVSync_HealthCheck(t *testing.T) {
+	store, s := setUpStore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	kvSync := kvsync.NewKVSync(ctx, kvsync.Options{Store: store})
+
+	assert.NoError(t, kvSync.HealthCheck(context.Background()))
+
+	// deliberate halts are healthy
+	kvSync.Pause()
+	assert.NoError(t, kvSync.HealthCheck(context.Background()))
+	kvSync.Resume()
+
+	s.Close()
+	assert.ErrorIs(t, kvSync.HealthCheck(context.Background()), kvsync.ErrStoreUnavailable)
+
+	cancel()
+	assert.ErrorIs(t, kvSync.HealthCheck(context.Background()), kvsync.ErrStopped)
+}
+
+func TestStores_Ping(t *testing.T) {
+	store, s := setUpStore()
+	defer s.Close()
+
+	local := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	assert.NoError(t, local.Ping(context.Background()))
+
+	tiered := &kvsync.TieredStore{Local: local, Remote: store}
+	assert.NoError(t, tiered.Ping(context.Background()))
+	assert.NoError(t, kvsync.NewCoalescingStore(tiered).Ping(context.Background()))
+
+	s.Close()
+	assert.ErrorIs(t, tiered.Ping(context.Background()), kvsync.ErrStoreUnavailable)
+	assert.ErrorIs(t, kvsync.NewCoalescingStore(tiered).Ping(context.Background()), kvsync.ErrStoreUnavailable)
+}
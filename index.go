@@ -0,0 +1,218 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// IndexReportKeyName is the KeyName of the reports of failed index updates
+const IndexReportKeyName = "@index"
+
+// Indexed is implemented by models listed in secondary index sets, so that consumers can enumerate entities by
+// attribute without scanning keys, see Options.Indexer
+type Indexed interface {
+	// IndexKeys returns the sets listing the entity by index name, e.g. {"country": "users:by_country:VN"}
+	IndexKeys() map[string]string
+}
+
+// ScoredIndexed is implemented by Indexed models listed in sorted sets. Scores are by index name, indexes
+// without a score are plain sets.
+type ScoredIndexed interface {
+	IndexScores() map[string]float64
+}
+
+// IndexMember is implemented by Indexed models to name themselves in index sets, defaults to their ID field
+type IndexMember interface {
+	IndexMember() string
+}
+
+// Indexer maintains the index sets of entities
+type Indexer interface {
+	// Index adds an entity to its index sets and removes it from the ones it left
+	Index(entity any) error
+	// Unindex removes an entity from all of its index sets
+	Unindex(entity any) error
+}
+
+// RedisIndexer maintains index sets in Redis. The sets of each entity are recorded in a hash, so that an update
+// removes it from the sets it left without knowing its previous state.
+type RedisIndexer struct {
+	Client redis.Cmdable
+	// Prefix is prepended to index keys, defaults to "kvsync:"
+	Prefix string
+}
+
+func (r *RedisIndexer) Index(entity any) error {
+	entity = resolvePointer(entity)
+
+	indexed, ok := entity.(Indexed)
+	if !ok {
+		return nil
+	}
+
+	member, err := indexMember(entity)
+	if err != nil {
+		return err
+	}
+
+	var scores map[string]float64
+	if scored, ok := entity.(ScoredIndexed); ok {
+		scores = scored.IndexScores()
+	}
+
+	// the hash maps the key of every set listing the entity to its type
+	sets := make(map[string]string)
+	for name, key := range indexed.IndexKeys() {
+		if _, ok := scores[name]; ok {
+			sets[r.prefixedKey(key)] = "zset"
+		} else {
+			sets[r.prefixedKey(key)] = "set"
+		}
+	}
+
+	ctx := context.Background()
+	membershipKey := r.membershipKey(entity, member)
+
+	old, err := r.Client.HGetAll(ctx, membershipKey).Result()
+	if err != nil {
+		return redisError(membershipKey, err)
+	}
+
+	_, err = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, kind := range old {
+			if sets[key] != kind {
+				removeMember(ctx, pipe, key, kind, member)
+			}
+		}
+
+		for name, key := range indexed.IndexKeys() {
+			if score, ok := scores[name]; ok {
+				pipe.ZAdd(ctx, r.prefixedKey(key), redis.Z{Score: score, Member: member})
+			} else {
+				pipe.SAdd(ctx, r.prefixedKey(key), member)
+			}
+		}
+
+		pipe.Del(ctx, membershipKey)
+		if len(sets) > 0 {
+			pipe.HSet(ctx, membershipKey, sets)
+		}
+
+		return nil
+	})
+
+	return redisError(membershipKey, err)
+}
+
+func (r *RedisIndexer) Unindex(entity any) error {
+	entity = resolvePointer(entity)
+
+	if _, ok := entity.(Indexed); !ok {
+		return nil
+	}
+
+	member, err := indexMember(entity)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	membershipKey := r.membershipKey(entity, member)
+
+	old, err := r.Client.HGetAll(ctx, membershipKey).Result()
+	if err != nil {
+		return redisError(membershipKey, err)
+	}
+
+	_, err = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, kind := range old {
+			removeMember(ctx, pipe, key, kind, member)
+		}
+		pipe.Del(ctx, membershipKey)
+
+		return nil
+	})
+
+	return redisError(membershipKey, err)
+}
+
+// Members returns the members of a plain index set, in no particular order
+func (r *RedisIndexer) Members(key string) ([]string, error) {
+	members, err := r.Client.SMembers(context.Background(), r.prefixedKey(key)).Result()
+
+	return members, redisError(key, err)
+}
+
+// MembersByScore returns the members of a sorted index set with scores between min and max, lowest first
+func (r *RedisIndexer) MembersByScore(key string, min float64, max float64) ([]string, error) {
+	members, err := r.Client.ZRangeByScore(context.Background(), r.prefixedKey(key), &redis.ZRangeBy{
+		Min: strconv.FormatFloat(min, 'g', -1, 64),
+		Max: strconv.FormatFloat(max, 'g', -1, 64),
+	}).Result()
+
+	return members, redisError(key, err)
+}
+
+func (r *RedisIndexer) prefixedKey(key string) string {
+	if r.Prefix == "" {
+		r.Prefix = "kvsync:"
+	}
+
+	return r.Prefix + key
+}
+
+func (r *RedisIndexer) membershipKey(entity any, member string) string {
+	return r.prefixedKey("index:" + ModelName(entity) + ":" + member)
+}
+
+func removeMember(ctx context.Context, pipe redis.Pipeliner, key string, kind string, member string) {
+	if kind == "zset" {
+		pipe.ZRem(ctx, key, member)
+	} else {
+		pipe.SRem(ctx, key, member)
+	}
+}
+
+// indexMember names an entity in index sets
+func indexMember(entity any) (string, error) {
+	if m, ok := entity.(IndexMember); ok {
+		return m.IndexMember(), nil
+	}
+
+	v := reflect.ValueOf(entity)
+	if v.Kind() == reflect.Struct {
+		if field, ok := v.Type().FieldByName("ID"); ok {
+			if id, err := v.FieldByIndexErr(field.Index); err == nil {
+				return fmt.Sprint(id.Interface()), nil
+			}
+		}
+	}
+
+	return "", errors.New("model " + ModelName(entity) + " has no ID field, implement IndexMember")
+}
+
+// index updates the index sets of an entity when an Indexer is set
+func (k *kvSync) index(entity any) error {
+	if k.indexer == nil {
+		return nil
+	}
+
+	return k.indexer.Index(entity)
+}
+
+func (k *kvSync) reportIndexError(entity any, err error, traceID string, operation Operation, attempt int) {
+	k.reports <- Report{
+		Model:     entity,
+		KeyName:   IndexReportKeyName,
+		Err:       err,
+		TraceID:   traceID,
+		Operation: operation,
+		Attempt:   attempt,
+		Timestamp: time.Now(),
+	}
+}
@@ -0,0 +1,127 @@
+package kvsync_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ndthuan/kvsync"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type IndexedMember struct {
+	ID      uint
+	Country string
+	Karma   float64
+}
+
+func (m IndexedMember) SyncKeys() map[string]string {
+	return map[string]string{"id": fmt.Sprintf("indexed_member:%d", m.ID)}
+}
+
+func (m IndexedMember) IndexKeys() map[string]string {
+	return map[string]string{
+		"country": "members:by_country:" + m.Country,
+		"karma":   "members:by_karma",
+	}
+}
+
+func (m IndexedMember) IndexScores() map[string]float64 {
+	return map[string]float64{"karma": m.Karma}
+}
+
+func TestRedisIndexer(t *testing.T) {
+	s := miniredis.RunT(t)
+	indexer := &kvsync.RedisIndexer{Client: redis.NewClient(&redis.Options{Addr: s.Addr()})}
+
+	assert.NoError(t, indexer.Index(&IndexedMember{ID: 1, Country: "VN", Karma: 10}))
+	assert.NoError(t, indexer.Index(IndexedMember{ID: 2, Country: "VN", Karma: 5}))
+
+	members, err := indexer.Members("members:by_country:VN")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2"}, members)
+
+	// moving removes the member from the sets it left
+	assert.NoError(t, indexer.Index(IndexedMember{ID: 1, Country: "FR", Karma: 20}))
+
+	members, err = indexer.Members("members:by_country:VN")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, members)
+
+	members, err = indexer.MembersByScore("members:by_karma", 6, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, members)
+
+	assert.True(t, s.Exists("kvsync:index:kvsync_test.IndexedMember:1"))
+	assert.NoError(t, indexer.Unindex(IndexedMember{ID: 1}))
+	members, err = indexer.Members("members:by_country:FR")
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+	assert.False(t, s.Exists("kvsync:index:kvsync_test.IndexedMember:1"))
+
+	assert.NoError(t, indexer.Index(User{ID: 1}), "models without indexes are ignored")
+}
+
+type failingIndexer struct{}
+
+func (failingIndexer) Index(any) error {
+	return errors.New("index unavailable")
+}
+
+func (failingIndexer) Unindex(any) error {
+	return errors.New("index unavailable")
+}
+
+func TestSync_Indexer(t *testing.T) {
+	store, s := setUpStore()
+	defer s.Close()
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.AutoMigrate(&IndexedMember{}))
+	defer func() {
+		_ = db.Migrator().DropTable(&IndexedMember{})
+	}()
+
+	indexer := &kvsync.RedisIndexer{Client: store.Client}
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store, Indexer: indexer})
+	assert.NoError(t, db.Callback().Delete().After("gorm:delete").Register("kvsync:delete", kvSync.GormDeleteCallback()))
+
+	member := IndexedMember{Country: "VN", Karma: 1}
+	assert.NoError(t, db.Create(&member).Error)
+	assert.NoError(t, kvSync.SyncAndWait(context.Background(), &member))
+
+	members, err := indexer.Members("members:by_country:VN")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{fmt.Sprint(member.ID)}, members)
+
+	assert.NoError(t, db.Delete(&member).Error)
+	assert.Eventually(t, func() bool {
+		members, err = indexer.Members("members:by_country:VN")
+		return err == nil && len(members) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	reports := make(chan kvsync.Report, 10)
+	failing := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:   store,
+		Indexer: failingIndexer{},
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+	assert.EqualError(t, failing.SyncAndWait(context.Background(), &IndexedMember{ID: 2}), "index unavailable")
+
+	var indexReport kvsync.Report
+	assert.Eventually(t, func() bool {
+		select {
+		case r := <-reports:
+			indexReport = r
+		default:
+		}
+		return indexReport.KeyName == kvsync.IndexReportKeyName
+	}, time.Second, 5*time.Millisecond)
+	assert.EqualError(t, indexReport.Err, "index unavailable")
+}
@@ -0,0 +1,117 @@
+// Package integration provisions real backends for integration tests, either from addresses provided
+// through environment variables or by starting containers with dockertest.
+package integration
+
+import (
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// Backend describes a backend that can be provisioned for tests
+type Backend struct {
+	Name       string
+	Repository string
+	Tag        string
+	// Port is the container port to expose, e.g. "6379/tcp"
+	Port string
+	Env  []string
+	Cmd  []string
+	// EnvVar names the environment variable providing the address of an existing instance,
+	// in which case no container is started
+	EnvVar string
+}
+
+var (
+	Redis = Backend{
+		Name:       "redis",
+		Repository: "redis",
+		Tag:        "7-alpine",
+		Port:       "6379/tcp",
+		EnvVar:     "KVSYNC_REDIS_ADDR",
+	}
+	Memcached = Backend{
+		Name:       "memcached",
+		Repository: "memcached",
+		Tag:        "1.6-alpine",
+		Port:       "11211/tcp",
+		EnvVar:     "KVSYNC_MEMCACHED_ADDR",
+	}
+	Etcd = Backend{
+		Name:       "etcd",
+		Repository: "quay.io/coreos/etcd",
+		Tag:        "v3.5.13",
+		Port:       "2379/tcp",
+		Cmd: []string{
+			"etcd",
+			"--listen-client-urls=http://0.0.0.0:2379",
+			"--advertise-client-urls=http://0.0.0.0:2379",
+		},
+		EnvVar: "KVSYNC_ETCD_ADDR",
+	}
+)
+
+// Addr returns the host:port of a running backend. The address comes from the backend's environment
+// variable when set, otherwise a container is started and purged when the test ends.
+// The test is skipped when neither is available.
+func Addr(t testing.TB, backend Backend) string {
+	t.Helper()
+
+	if addr := os.Getenv(backend.EnvVar); addr != "" {
+		return addr
+	}
+
+	pool, err := dockertest.NewPool("")
+	if err == nil {
+		err = pool.Client.Ping()
+	}
+	if err != nil {
+		t.Skipf("%s: set %s or make docker available: %v", backend.Name, backend.EnvVar, err)
+	}
+
+	pool.MaxWait = time.Minute
+
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: backend.Repository,
+		Tag:        backend.Tag,
+		Env:        backend.Env,
+		Cmd:        backend.Cmd,
+	}, func(config *docker.HostConfig) {
+		config.AutoRemove = true
+		config.RestartPolicy = docker.RestartPolicy{Name: "no"}
+	})
+	if err != nil {
+		t.Fatalf("%s: failed to start container: %v", backend.Name, err)
+	}
+
+	t.Cleanup(func() {
+		_ = pool.Purge(resource)
+	})
+
+	addr := resource.GetHostPort(backend.Port)
+
+	err = pool.Retry(func() error {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+	})
+	if err != nil {
+		t.Fatalf("%s: not ready at %s: %v", backend.Name, addr, err)
+	}
+
+	return addr
+}
+
+// URL returns the address of a backend as an http URL, e.g. for etcd clients
+func URL(t testing.TB, backend Backend) string {
+	t.Helper()
+
+	return fmt.Sprintf("http://%s", Addr(t, backend))
+}
@@ -0,0 +1,23 @@
+package integration_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/ndthuan/kvsync/integration"
+	"github.com/ndthuan/kvsync/kvsynctest"
+	"github.com/redis/go-redis/v9"
+	"testing"
+)
+
+func TestRedisStore_Conformance(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: integration.Addr(t, integration.Redis)})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	if err := client.FlushDB(context.Background()).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	kvsynctest.RunStoreConformance(t, &kvsync.RedisStore{Client: client})
+}
@@ -0,0 +1,127 @@
+package kvsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CanonicalJSONMarshalingAdapter is a JSON implementation of MarshalingAdapter producing byte-stable output:
+// object keys are sorted, HTML characters are not escaped and numbers are formatted canonically
+// (integers verbatim, other numbers in their shortest ECMAScript form). Payload hashes computed from its
+// output are stable across processes and Go versions.
+type CanonicalJSONMarshalingAdapter struct{}
+
+func (c *CanonicalJSONMarshalingAdapter) Marshal(v any) ([]byte, error) {
+	b, err := json.Marshal(applyFieldTags(v))
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	var decoded any
+	if err = decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = writeCanonicalJSON(&buf, decoded); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c *CanonicalJSONMarshalingAdapter) Unmarshal(data []byte, v any) error {
+	return unmarshalFieldTags(data, v, json.Unmarshal)
+}
+
+func writeCanonicalJSON(buf *bytes.Buffer, v any) error {
+	switch t := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(t))
+	case json.Number:
+		n, err := canonicalNumber(t)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(n)
+	case string:
+		writeCanonicalString(buf, t)
+	case []any:
+		buf.WriteByte('[')
+		for i, item := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(t))
+		for key := range t {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, key)
+			buf.WriteByte(':')
+			if err := writeCanonicalJSON(buf, t[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected JSON value of type %T", v)
+	}
+
+	return nil
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+
+	// Encode always appends a newline
+	buf.Truncate(buf.Len() - 1)
+}
+
+func canonicalNumber(n json.Number) (string, error) {
+	s := n.String()
+
+	if !strings.ContainsAny(s, ".eE") {
+		if s == "-0" {
+			return "0", nil
+		}
+
+		return s, nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return "", err
+	}
+
+	// json.Marshal formats float64 values the way ECMAScript does
+	b, err := json.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,45 @@
+package kvsync_test
+
+import (
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCanonicalJSONMarshalingAdapter(t *testing.T) {
+	marshaler := &kvsync.CanonicalJSONMarshalingAdapter{}
+
+	testCases := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{
+			name:  "sorted keys",
+			value: map[string]any{"b": 1, "a": 2, "c": map[string]any{"z": true, "y": nil}},
+			want:  `{"a":2,"b":1,"c":{"y":null,"z":true}}`,
+		},
+		{
+			name:  "struct fields are sorted too",
+			value: struct{ Name, Email string }{Name: "<Alice>", Email: "alice@example.com"},
+			want:  `{"Email":"alice@example.com","Name":"<Alice>"}`,
+		},
+		{
+			name:  "numbers",
+			value: []any{1.0, 1.5, 1e21, 12345678901234567, -0.0},
+			want:  `[1,1.5,1e+21,12345678901234567,0]`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := marshaler.Marshal(tc.value)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, string(b))
+		})
+	}
+
+	var user User
+	assert.NoError(t, marshaler.Unmarshal([]byte(`{"ID":1,"Name":"Alice"}`), &user))
+	assert.Equal(t, User{ID: 1, Name: "Alice"}, user)
+}
@@ -0,0 +1,179 @@
+package kvsync
+
+import (
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// KeyPart formats an identifier canonically for use in a sync key. Besides the usual scalar types it
+// understands UUID and ULID types (anything implementing fmt.Stringer or encoding.TextMarshaler),
+// 16-byte arrays and slices (formatted as UUIDs) and other byte slices (formatted as hex).
+// Teams with non-integer primary keys can use it in SyncKeys without writing custom formatters.
+func KeyPart(v any) string {
+	if v == nil {
+		return ""
+	}
+
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return ""
+		}
+		val = val.Elem()
+	}
+	v = val.Interface()
+
+	switch t := v.(type) {
+	case fmt.Stringer:
+		return t.String()
+	case encoding.TextMarshaler:
+		if text, err := t.MarshalText(); err == nil {
+			return string(text)
+		}
+	case []byte:
+		return formatBytes(t)
+	}
+
+	if val.Kind() == reflect.Array && val.Type().Elem().Kind() == reflect.Uint8 {
+		b := make([]byte, val.Len())
+		reflect.Copy(reflect.ValueOf(b), val)
+
+		return formatBytes(b)
+	}
+
+	return fmt.Sprint(v)
+}
+
+func formatBytes(b []byte) string {
+	if len(b) != 16 {
+		return hex.EncodeToString(b)
+	}
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+type tagKey struct {
+	name string
+	tmpl *template.Template
+	ttl  time.Duration
+}
+
+// tagKeys are the sync keys declared with struct tags by a model type
+type tagKeys struct {
+	keys []tagKey
+	err  error
+}
+
+var tagKeyCache sync.Map
+
+// TagKeySpecs builds the key specs of a model declaring its keys with struct tags instead of implementing
+// Syncable, e.g. `kvsync:"key=user:uuid:{{.UUID}}"`. Keys are named after the lower-cased field name unless
+// set with keyname, e.g. `kvsync:"key=user:composite:{{.ID}}_{{.UUID}},keyname=composite,ttl=1h"`.
+// Values are formatted with KeyPart, so UUID, ULID and byte identifiers need no formatter. Models implementing Syncable or KeySpecSyncable
+// don't need it: their keys are used instead.
+func TagKeySpecs(entity any) (map[string]KeySpec, error) {
+	val := reflect.ValueOf(resolvePointer(entity))
+	if val.Kind() != reflect.Struct {
+		return nil, errors.New("model must be a struct")
+	}
+
+	tk := tagKeysOf(val.Type())
+	if tk.err != nil {
+		return nil, tk.err
+	}
+
+	specs := make(map[string]KeySpec, len(tk.keys))
+	for _, key := range tk.keys {
+		var b strings.Builder
+		if err := key.tmpl.Execute(&b, val.Interface()); err != nil {
+			return nil, err
+		}
+		specs[key.name] = KeySpec{Key: b.String(), TTL: key.ttl}
+	}
+
+	return specs, nil
+}
+
+// tagKeysOf parses and caches the key templates of a struct type
+func tagKeysOf(t reflect.Type) *tagKeys {
+	if cached, ok := tagKeyCache.Load(t); ok {
+		return cached.(*tagKeys)
+	}
+
+	tk := &tagKeys{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft := parseFieldTag(f.Tag.Get("kvsync"))
+		if ft.key == "" {
+			continue
+		}
+
+		name := ft.keyName
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		tmpl, err := template.New(name).Funcs(template.FuncMap{"part": KeyPart}).Parse(ft.key)
+		if err != nil {
+			tk.err = fmt.Errorf("%s.%s: %w", t, f.Name, err)
+			break
+		}
+		formatActions(tmpl.Tree, tmpl.Tree.Root)
+
+		key := tagKey{name: name, tmpl: tmpl}
+		if ft.ttl != "" {
+			if key.ttl, err = time.ParseDuration(ft.ttl); err != nil {
+				tk.err = fmt.Errorf("%s.%s: %w", t, f.Name, err)
+				break
+			}
+		}
+
+		tk.keys = append(tk.keys, key)
+	}
+
+	if tk.err == nil && len(tk.keys) == 0 {
+		tk.err = fmt.Errorf("%s declares no key tags", t)
+	}
+
+	tagKeyCache.Store(t, tk)
+
+	return tk
+}
+
+// formatActions pipes the values printed by the actions of a key template to KeyPart, {{.UUID}} running as
+// {{.UUID | part}}. Values already formatted with {{part .UUID}} are left as is by KeyPart.
+func formatActions(tree *parse.Tree, list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) > 0 {
+				continue
+			}
+
+			part := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos}
+			part.Args = []parse.Node{parse.NewIdentifier("part").SetTree(tree).SetPos(n.Pos)}
+			n.Pipe.Cmds = append(n.Pipe.Cmds, part)
+		case *parse.IfNode:
+			formatActions(tree, n.List)
+			formatActions(tree, n.ElseList)
+		case *parse.RangeNode:
+			formatActions(tree, n.List)
+			formatActions(tree, n.ElseList)
+		case *parse.WithNode:
+			formatActions(tree, n.List)
+			formatActions(tree, n.ElseList)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type stringerID [16]byte
+
+func (s stringerID) String() string {
+	return "01ARZ3NDEKTSV4RRFFQ69G5FAV"
+}
+
+func TestKeyPart(t *testing.T) {
+	uuid := [16]byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+	id := 42
+
+	testCases := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{name: "nil", v: nil, want: ""},
+		{name: "int", v: 42, want: "42"},
+		{name: "pointer to int", v: &id, want: "42"},
+		{name: "string", v: "abc", want: "abc"},
+		{name: "stringer (uuid.UUID, ulid.ULID)", v: stringerID{}, want: "01ARZ3NDEKTSV4RRFFQ69G5FAV"},
+		{name: "16-byte array", v: uuid, want: "123e4567-e89b-12d3-a456-426614174000"},
+		{name: "16-byte slice", v: uuid[:], want: "123e4567-e89b-12d3-a456-426614174000"},
+		{name: "other byte slice", v: []byte{0xde, 0xad, 0xbe, 0xef}, want: "deadbeef"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, kvsync.KeyPart(tc.v))
+		})
+	}
+}
+
+type TaggedUser struct {
+	ID   int      `kvsync:"key=tagged_user:id:{{.ID}}"`
+	UUID [16]byte `kvsync:"key=tagged_user:uuid:{{.UUID}}"`
+	Name string   `kvsync:"key=tagged_user:composite:{{.ID}}_{{.Name}},keyname=composite,ttl=1h"`
+}
+
+func TestTagKeySpecs(t *testing.T) {
+	uuid := [16]byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+
+	specs, err := kvsync.TagKeySpecs(&TaggedUser{ID: 1, UUID: uuid, Name: "ada"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]kvsync.KeySpec{
+		"id":        {Key: "tagged_user:id:1"},
+		"uuid":      {Key: "tagged_user:uuid:123e4567-e89b-12d3-a456-426614174000"},
+		"composite": {Key: "tagged_user:composite:1_ada", TTL: time.Hour},
+	}, specs)
+
+	_, err = kvsync.TagKeySpecs(UnsyncedUser{})
+	assert.Error(t, err)
+
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store})
+
+	assert.NoError(t, kvSync.Sync(&TaggedUser{ID: 1, UUID: uuid, Name: "ada"}))
+
+	fetched := TaggedUser{UUID: uuid}
+	assert.NoError(t, kvSync.Fetch(&fetched, "uuid"))
+	assert.Equal(t, "ada", fetched.Name)
+}
+
+type TaggedIdentifiers struct {
+	ULID  stringerID `kvsync:"key=tagged:ulid:{{.ULID}}"`
+	Token []byte     `kvsync:"key=tagged:token:{{if .Token}}{{.Token}}{{else}}none{{end}}"`
+	Ref   *int       `kvsync:"key=tagged:ref:{{part .Ref}}"`
+}
+
+func TestTagKeySpecs_Identifiers(t *testing.T) {
+	ref := 7
+
+	specs, err := kvsync.TagKeySpecs(TaggedIdentifiers{Token: []byte{0xde, 0xad, 0xbe, 0xef}, Ref: &ref})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]kvsync.KeySpec{
+		"ulid":  {Key: "tagged:ulid:01ARZ3NDEKTSV4RRFFQ69G5FAV"},
+		"token": {Key: "tagged:token:deadbeef"},
+		"ref":   {Key: "tagged:ref:7"},
+	}, specs)
+
+	specs, err = kvsync.TagKeySpecs(TaggedIdentifiers{})
+	assert.NoError(t, err)
+	assert.Equal(t, "tagged:token:none", specs["token"].Key)
+	assert.Equal(t, "tagged:ref:", specs["ref"].Key)
+}
@@ -0,0 +1,130 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// KillSwitch halts all enqueueing, draining and background jobs while engaged, for emergencies where the
+// cache layer itself is the incident. Engaging it writes a sentinel key to Store, which the KillSwitch of
+// every replica picks up within Interval while watching it, see Watch.
+type KillSwitch struct {
+	Store KVStore
+	// Key is the sentinel key, defaults to "kvsync:killswitch"
+	Key string
+	// Interval is how often Watch checks the sentinel key, defaults to 5 seconds
+	Interval time.Duration
+
+	engaged  bool
+	released chan struct{}
+	mutex    sync.Mutex
+}
+
+// KillSwitchSentinel is the value of the sentinel key
+type KillSwitchSentinel struct {
+	Reason    string
+	EngagedAt time.Time
+}
+
+// Engage halts syncing on this replica and writes the sentinel key for the others
+func (s *KillSwitch) Engage(reason string) error {
+	s.set(true)
+
+	return s.Store.Put(s.key(), KillSwitchSentinel{Reason: reason, EngagedAt: time.Now()})
+}
+
+// Release resumes syncing on this replica and deletes the sentinel key for the others
+func (s *KillSwitch) Release() error {
+	s.set(false)
+
+	return deleteKey(s.Store, s.key())
+}
+
+// Engaged reports whether syncing is halted, a nil KillSwitch is never engaged
+func (s *KillSwitch) Engaged() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.engaged
+}
+
+// Watch polls the sentinel key at Interval until the context is done, engaging or releasing this replica.
+// The switch is left as is when the store fails.
+func (s *KillSwitch) Watch(ctx context.Context) {
+	ticker := time.NewTicker(s.interval())
+	defer ticker.Stop()
+
+	for {
+		var sentinel KillSwitchSentinel
+		if err := s.Store.Fetch(s.key(), &sentinel); err == nil || errors.Is(err, ErrKeyNotFound) {
+			s.set(err == nil)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// wait blocks while the switch is engaged, returning false if the context got done meanwhile
+func (s *KillSwitch) wait(ctx context.Context) bool {
+	if s == nil {
+		return true
+	}
+
+	for {
+		s.mutex.Lock()
+		engaged, released := s.engaged, s.released
+		s.mutex.Unlock()
+
+		if !engaged {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-released:
+		}
+	}
+}
+
+func (s *KillSwitch) set(engaged bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if engaged == s.engaged {
+		return
+	}
+
+	s.engaged = engaged
+	if engaged {
+		s.released = make(chan struct{})
+	} else {
+		close(s.released)
+	}
+}
+
+func (s *KillSwitch) key() string {
+	if s.Key == "" {
+		return "kvsync:killswitch"
+	}
+
+	return s.Key
+}
+
+func (s *KillSwitch) interval() time.Duration {
+	if s.Interval <= 0 {
+		return 5 * time.Second
+	}
+
+	return s.Interval
+}
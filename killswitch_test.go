@@ -0,0 +1,74 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestKillSwitch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	operator := &kvsync.KillSwitch{Store: store}
+	replica := &kvsync.KillSwitch{Store: store, Interval: 10 * time.Millisecond}
+	go replica.Watch(ctx)
+
+	kvSync := kvsync.NewKVSync(ctx, kvsync.Options{Store: store, KillSwitch: replica})
+
+	assert.NoError(t, operator.Engage("cache cluster overloaded"))
+	assert.True(t, operator.Engaged())
+	assert.Eventually(t, replica.Engaged, time.Second, 5*time.Millisecond)
+
+	assert.Error(t, kvSync.Sync(&SyncedUser{UUID: "halted"}))
+	assert.NotContains(t, store.Store, "user:uuid:halted")
+
+	assert.NoError(t, operator.Release())
+	assert.False(t, operator.Engaged())
+	assert.Eventually(t, func() bool { return !replica.Engaged() }, time.Second, 5*time.Millisecond)
+
+	assert.NoError(t, kvSync.Sync(&SyncedUser{UUID: "resumed"}))
+	assert.Contains(t, store.Store, "user:uuid:resumed")
+}
+
+func TestKillSwitch_Callbacks(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	killSwitch := &kvsync.KillSwitch{Store: store}
+	kvSync := kvsync.NewKVSync(ctx, kvsync.Options{Store: store, KillSwitch: killSwitch})
+	assert.NoError(t, db.Callback().Create().After("gorm:create").Register("kvsync:create", kvSync.GormCallback()))
+
+	assert.NoError(t, killSwitch.Engage("incident"))
+	db.Create(&SyncedUser{UUID: "killswitch-uuid"})
+	assert.NoError(t, killSwitch.Release())
+
+	time.Sleep(50 * time.Millisecond)
+	assert.NotContains(t, store.Store, "user:uuid:killswitch-uuid", "entities are not enqueued while engaged")
+}
+
+func TestScheduler_KillSwitch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	killSwitch := &kvsync.KillSwitch{Store: &kvsync.InMemoryStore{Store: make(map[string]any)}}
+	assert.NoError(t, killSwitch.Engage("incident"))
+
+	scheduler := &kvsync.Scheduler{KillSwitch: killSwitch}
+	scheduler.Add("resync", kvsync.Every(10*time.Millisecond), func(ctx context.Context) error {
+		return nil
+	})
+	scheduler.Start(ctx)
+
+	assert.Eventually(t, func() bool {
+		return scheduler.Status()[0].Skipped > 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Zero(t, scheduler.Status()[0].Runs)
+}
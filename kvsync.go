@@ -3,8 +3,16 @@ package kvsync
 import (
 	"context"
 	"errors"
+	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
 	"reflect"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 // KVStore is the interface for a key-value store
@@ -13,26 +21,255 @@ type KVStore interface {
 	Fetch(key string, dest any) error
 }
 
+// Deleter is implemented by stores able to delete keys. Without it, the keys of deleted rows and the stale keys
+// of updated ones are left to expire, and reported with ErrDeleteUnsupported.
+type Deleter interface {
+	Delete(key string) error
+}
+
+// KeyScanner is implemented by stores able to enumerate their keys by prefix, a page at a time. The
+// returned cursor continues the scan, it is empty once all keys were returned.
+type KeyScanner interface {
+	Keys(prefix string, limit int, cursor string) ([]string, string, error)
+}
+
+// ExistenceChecker is implemented by stores able to tell whether a key is stored without reading its value
+type ExistenceChecker interface {
+	Exists(key string) (bool, error)
+}
+
+// TTLStore is implemented by stores that support per-key expiration
+type TTLStore interface {
+	PutWithTTL(key string, value any, ttl time.Duration) error
+}
+
+// TouchStore is implemented by stores able to inspect and extend the expiration of a key. TTL is zero for
+// keys without expiration, and Touch resets a key to the store's expiration when ttl is not positive.
+type TouchStore interface {
+	TTL(key string) (time.Duration, error)
+	Touch(key string, ttl time.Duration) error
+}
+
+// keyTTL returns the remaining time to live of a key in a store implementing TouchStore
+func keyTTL(store KVStore, key string) (time.Duration, error) {
+	touchStore, ok := store.(TouchStore)
+	if !ok {
+		return 0, errors.New("store does not support inspecting expirations")
+	}
+
+	return touchStore.TTL(key)
+}
+
+// touchKey extends the expiration of a key in a store implementing TouchStore
+func touchKey(store KVStore, key string, ttl time.Duration) error {
+	touchStore, ok := store.(TouchStore)
+	if !ok {
+		return errors.New("store does not support extending expirations")
+	}
+
+	return touchStore.Touch(key, ttl)
+}
+
+// deleteKey deletes a key from a store implementing Deleter
+func deleteKey(store KVStore, key string) error {
+	deleter, ok := store.(Deleter)
+	if !ok {
+		return ErrDeleteUnsupported
+	}
+
+	return deleter.Delete(key)
+}
+
+// putWithTTL writes a value expiring after ttl, without expiration if the store doesn't implement TTLStore
+func putWithTTL(store KVStore, key string, value any, ttl time.Duration) error {
+	if ttlStore, ok := store.(TTLStore); ok && ttl > 0 {
+		return ttlStore.PutWithTTL(key, value, ttl)
+	}
+
+	return store.Put(key, value)
+}
+
+// exists checks the presence of a key in a store implementing ExistenceChecker
+func exists(store KVStore, key string) (bool, error) {
+	checker, ok := store.(ExistenceChecker)
+	if !ok {
+		return false, errors.New("store does not support checking keys")
+	}
+
+	return checker.Exists(key)
+}
+
+// scan scans the keys of a store implementing KeyScanner
+func scan(store KVStore, prefix string, limit int, cursor string) ([]string, string, error) {
+	scanner, ok := store.(KeyScanner)
+	if !ok {
+		return nil, "", errors.New("store does not support scanning keys")
+	}
+
+	return scanner.Keys(prefix, limit, cursor)
+}
+
+// MarshalingStore is implemented by stores that can serialize a single write with another marshaler,
+// see WithMarshaler. A non-positive TTL uses the store's expiration.
+type MarshalingStore interface {
+	PutWithMarshaler(key string, value any, ttl time.Duration, marshaler MarshalingAdapter) error
+}
+
+// PrefixDeleter is implemented by stores that can delete all keys sharing a prefix
+type PrefixDeleter interface {
+	DeleteByPrefix(prefix string) error
+}
+
+// Streamer is implemented by stores that can stream a serialized value without materializing it in memory
+type Streamer interface {
+	FetchStream(key string) (io.ReadCloser, error)
+}
+
+// BatchEntry is a value to be written under a key by a BatchStore
+type BatchEntry struct {
+	Key   string
+	Value any
+	// TTL overrides the store's expiration when positive
+	TTL time.Duration
+}
+
+// BatchStore is implemented by stores that can write several keys in a single round trip
+type BatchStore interface {
+	// PutBatch writes the entries, returning one error (or nil) per entry in the same order
+	PutBatch(entries []BatchEntry) []error
+}
+
+// BatchFetcher is implemented by stores that can fetch several keys in a single round trip
+type BatchFetcher interface {
+	// FetchBatch fetches keys[i] into dests[i], returning one error (or nil) per key in the same order
+	FetchBatch(keys []string, dests []any) []error
+}
+
 // Syncable is the interface for a Gorm model that can be synced with a KVStore
 type Syncable interface {
 	SyncKeys() map[string]string
 }
 
+// KeySpec describes a sync key along with its per-key settings
+type KeySpec struct {
+	Key string
+	// TTL overrides the store's expiration for this key when the store implements TTLStore
+	TTL time.Duration
+	// SnapshotRetention additionally writes an immutable point-in-time copy of the value under
+	// SnapshotKey(Key, now) when positive, expiring after the retention on stores implementing TTLStore
+	SnapshotRetention time.Duration
+}
+
+// KeyPrefixer is an optional interface for models to declare the prefix shared by all their keys,
+// used by FlushModel and ListModelKeys. Without it the prefixes are derived from the keys up to their last colon.
+type KeyPrefixer interface {
+	SyncKeyPrefix() string
+}
+
+// AfterFetcher is an optional interface for models to post-process a fetched value, e.g. to rebuild
+// derived fields, decrypt secrets or validate invariants, mirroring Gorm's AfterFind.
+// It is invoked on the destination after a successful Fetch, and its error is returned by Fetch.
+type AfterFetcher interface {
+	AfterFetch(ctx context.Context) error
+}
+
+// BeforeSyncer is an optional interface for models to prepare themselves before being serialized,
+// e.g. to populate computed or denormalized fields destined only for the cached payload.
+// Its error cancels the sync of the entity and is reported for each of its keys.
+type BeforeSyncer interface {
+	BeforeSync(ctx context.Context) error
+}
+
+// Projector is an optional interface for models to store a reduced view of themselves instead of the
+// full Gorm struct, e.g. a DTO without password hashes, internal columns or gorm.Model fields.
+// Consumers fetch the view's type rather than the model's.
+type Projector interface {
+	SyncValue() any
+}
+
+// Viewer is an optional interface for models to store a different view under each key, by key name,
+// e.g. a slim view under "brief" and the complete struct under "full". Keys without a view store
+// the model, or its Projector value.
+type Viewer interface {
+	SyncViews() map[string]any
+}
+
+// SyncFilter is an optional interface for models to opt out of syncing dynamically, e.g. disabled users.
+// Keys written before an entity opted out are kept.
+type SyncFilter interface {
+	ShouldSync() bool
+}
+
+// KeySpecSyncable is an alternative to Syncable for models that need per-key settings
+type KeySpecSyncable interface {
+	SyncKeySpecs() map[string]KeySpec
+}
+
+// Operation is the kind of write that triggered a sync
+type Operation string
+
+const (
+	OperationCreate Operation = "create"
+	OperationUpdate Operation = "update"
+	OperationDelete Operation = "delete"
+	// OperationManual is a Sync call
+	OperationManual Operation = "manual"
+)
+
 // Report is a struct that represents a report of a sync operation
 type Report struct {
 	Model   any
 	KeyName string
 	Key     string
 	Err     error
+	// TraceID correlates the report with the statement or Sync call that triggered it, see WithTraceID
+	TraceID string
+	// Operation triggered the sync, keys left behind by an update are deleted as part of OperationUpdate
+	Operation Operation
+	// Duration is the time spent writing all keys of the entity, or deleting the key
+	Duration time.Duration
+	// Attempt is 1 for the first write, and incremented for every dead letter retry
+	Attempt int
+	// Timestamp is when the write completed
+	Timestamp time.Time
+	// DryRun is set when nothing was written or deleted, see Options.DryRun
+	DryRun bool
+	// Size is the serialized size of the value in bytes, only measured in dry-run mode, see SizingStore
+	Size int
 }
 
 type ReportCallback func(Report)
 
 // KVSync is the interface for a service that syncs Gorm models with a KVStore
 type KVSync interface {
-	Fetch(dest Syncable, keyName string) error
+	Fetch(dest any, keyName string) error
+	FetchWithInfo(dest any, keyName string) (Envelope, error)
+	FetchAny(key string) (any, error)
+	FetchAnyWithInfo(key string) (any, Envelope, error)
+	Exists(entity any, keyName string) (bool, error)
 	GormCallback() func(db *gorm.DB)
-	Sync(entity any) error
+	GormBeforeUpdateCallback() func(db *gorm.DB)
+	GormDeleteCallback() func(db *gorm.DB)
+	Sync(entity any, opts ...SyncOption) error
+	SyncAndWait(ctx context.Context, entity any, opts ...SyncOption) error
+	SyncAll(ctx context.Context, entities []any, opts BatchOptions) error
+	SyncAfterExec(ctx context.Context, loader EntityLoader, ids ...any) error
+	DeleteAfterExec(ctx context.Context, entities ...any) error
+	FlushModel(model any) error
+	InvalidateModel(model any) error
+	Refresh(entity any) error
+	ListModelKeys(model any) ([]string, error)
+	ReplayDeadLetters() int
+	MigrateLegacyKeys(entity any) error
+	Subscribe(callback ReportCallback)
+	Reports() <-chan Report
+	Pause()
+	Resume()
+	Paused() bool
+	Stats() Stats
+	HealthCheck(ctx context.Context) error
+	ResyncSince(ctx context.Context, db *gorm.DB, model any, since time.Time) (int, error)
+	ResyncWatermark(model any) (ResyncWatermark, error)
 }
 
 // Options is a struct that contains options for creating a KVSync instance
@@ -40,67 +277,245 @@ type Options struct {
 	Store          KVStore
 	Workers        int
 	ReportCallback ReportCallback
+	ErrorRate      ErrorRateOptions
+	// VersionByUpdatedAt uses the UpdatedAt field as the version of models not implementing Versioned
+	VersionByUpdatedAt bool
+	// Config optionally holds runtime model configuration that can be hot reloaded
+	Config *ConfigRegistry
+	// DeadLetters optionally keeps the entities that could not be written for replay
+	DeadLetters *DeadLetterQueue
+	// KillSwitch optionally halts enqueueing and draining while engaged
+	KillSwitch *KillSwitch
+	// QueueSize is the number of entities queued for the workers, defaults to Workers
+	QueueSize int
+	// Pools optionally dedicates workers and queues to models by ModelName, so that a flood of rows of one
+	// model does not delay the others. Models without a pool share Workers and QueueSize.
+	Pools map[string]PoolOptions
+	// EnqueueTimeout optionally bounds how long Gorm callbacks wait for room in the queue, entities still
+	// not queued after it are dropped and reported with ErrQueueFull. By default they wait indefinitely.
+	EnqueueTimeout time.Duration
+	// Filter optionally opts entities out of syncing when it returns false, e.g. rows of tenants
+	// without caching enabled, in addition to SyncFilter
+	Filter func(entity any) bool
+	// PausePolicy decides whether entities synced while paused are buffered or dropped, see Pause
+	PausePolicy PausePolicy
+	// DryRun computes keys and serialized sizes and reports them, including for Sync, but writes and deletes
+	// nothing, e.g. to validate SyncKeys implementations and estimate memory usage before going live
+	DryRun bool
+	// Outbox records the entities written by Gorm statements as OutboxJob rows within their transactions
+	// instead of queueing them, an OutboxDispatcher ships them to the store, see OutboxJob
+	Outbox bool
+	// Indexer optionally maintains the index sets of Indexed models once their keys are written, and removes
+	// deleted ones from them. Failures are reported with IndexReportKeyName.
+	Indexer Indexer
+	// RepairLoaders optionally load the entities of keys failing to be fetched with ErrCorrupted from the
+	// database, by key prefix as for Rewarmer.Loaders. Fetch re-syncs them and fetches them again.
+	RepairLoaders map[string]RewarmLoader
+	// AuditSink optionally records every key written or deleted, along with the actor of the statement or
+	// SyncAndWait context, see WithActor. Failures are reported with AuditReportKeyName.
+	AuditSink AuditSink
+	// Generations embeds the generation of each model, kept in the store, into its keys, so that InvalidateModel
+	// invalidates all of its entries at once, see InvalidateModel
+	Generations bool
+	// GenerationRefresh is how long replicas cache generations, defaults to a second
+	GenerationRefresh time.Duration
+	// Quotas optionally accounts the keys and bytes written by tenant and caps them, see Stats.Tenants
+	Quotas QuotaOptions
+	// Scheduler optionally runs the maintenance tasks of the KVSync, whose status is reported in Stats.Tasks
+	// and by the admin handler. It is started separately, see Scheduler.Start.
+	Scheduler *Scheduler
 }
 
-// NewKVSync creates a new KVSync instance
+// NewKVSync creates a new KVSync instance, see New for a constructor validating the options
 func NewKVSync(ctx context.Context, options Options) KVSync {
-	workers := options.Workers
-	if workers < 1 {
-		workers = 1
+	k := &kvSync{
+		store:              options.Store,
+		ctx:                ctx,
+		pool:               newWorkerPool(PoolOptions{Workers: options.Workers, QueueSize: options.QueueSize}),
+		pools:              make(map[string]*workerPool, len(options.Pools)),
+		reports:            make(chan Report),
+		errorRates:         newErrorRateTracker(options.ErrorRate),
+		versionByUpdatedAt: options.VersionByUpdatedAt,
+		config:             options.Config,
+		deadLetters:        options.DeadLetters,
+		killSwitch:         options.KillSwitch,
+		filter:             options.Filter,
+		enqueueTimeout:     options.EnqueueTimeout,
+		pausePolicy:        options.PausePolicy,
+		dryRun:             options.DryRun,
+		outbox:             options.Outbox,
+		indexer:            options.Indexer,
+		repairLoaders:      options.RepairLoaders,
+		auditSink:          options.AuditSink,
+		scheduler:          options.Scheduler,
 	}
 
-	k := &kvSync{
-		store:          options.Store,
-		ctx:            ctx,
-		queue:          make(chan queueItem, options.Workers),
-		workers:        workers,
-		reports:        make(chan Report),
-		reportCallback: options.ReportCallback,
+	if options.Quotas.Tenant != nil {
+		k.quotas = newQuotaTracker(options.Quotas)
 	}
 
-	k.launchWorkers()
+	if options.Generations {
+		k.generations = newGenerations(options.Store, options.GenerationRefresh)
+	}
 
-	go func() {
-		for {
-			select {
-			case <-k.ctx.Done():
-				return
-			case r := <-k.reports:
-				if k.reportCallback != nil {
-					k.reportCallback(r)
-				}
+	for model, poolOptions := range options.Pools {
+		k.pools[model] = newWorkerPool(poolOptions)
+	}
+
+	k.launchWorkers(k.pool)
+	for _, pool := range k.pools {
+		k.launchWorkers(pool)
+	}
+
+	if options.ReportCallback != nil {
+		k.Subscribe(options.ReportCallback)
+	}
+
+	go k.dispatchReports()
+
+	return k
+}
+
+// dispatchReports passes every report to the subscribers in registration order, closing the
+// channels returned by Reports once the context is done
+func (k *kvSync) dispatchReports() {
+	for {
+		select {
+		case <-k.ctx.Done():
+			k.subscribersMutex.Lock()
+			defer k.subscribersMutex.Unlock()
+
+			for _, ch := range k.reportChannels {
+				close(ch)
+			}
+			k.reportChannels = nil
+
+			return
+		case r := <-k.reports:
+			k.subscribersMutex.Lock()
+			subscribers := k.subscribers
+			k.subscribersMutex.Unlock()
+
+			for _, subscriber := range subscribers {
+				subscriber(r)
 			}
 		}
-	}()
+	}
+}
 
-	return k
+// Subscribe registers a callback receiving every subsequent report, e.g. one for metrics and one for auditing.
+// Callbacks run one at a time on a single goroutine, a slow callback delays the others.
+func (k *kvSync) Subscribe(callback ReportCallback) {
+	k.subscribersMutex.Lock()
+	defer k.subscribersMutex.Unlock()
+
+	// copied on write so that dispatching doesn't hold the lock
+	k.subscribers = append(k.subscribers[:len(k.subscribers):len(k.subscribers)], callback)
+}
+
+// Reports returns a channel receiving every subsequent report, closed when the KVSync's context is done.
+// The channel is buffered, but it must be drained: a full channel blocks all reporting.
+func (k *kvSync) Reports() <-chan Report {
+	ch := make(chan Report, 100)
+
+	k.subscribersMutex.Lock()
+	if k.ctx.Err() != nil {
+		k.subscribersMutex.Unlock()
+		close(ch)
+
+		return ch
+	}
+	k.reportChannels = append(k.reportChannels, ch)
+	k.subscribersMutex.Unlock()
+
+	k.Subscribe(func(r Report) {
+		select {
+		case ch <- r:
+		case <-k.ctx.Done():
+		}
+	})
+
+	return ch
 }
 
+// queueItem is the unit of work of the workers: an entity along with all of its keys,
+// written together in one round trip when the store implements BatchStore
 type queueItem struct {
-	entity  any
-	keyName string
-	key     string
+	entity    any
+	specs     map[string]KeySpec
+	traceID   string
+	actor     string
+	operation Operation
+	attempt   int
+	// done optionally receives the first error once the entity is synced, see SyncAndWait
+	done chan<- error
+	opts syncOptions
 }
 
 // kvSync is a struct that syncs a Gorm model with a KVStore
 type kvSync struct {
-	store          KVStore
-	queue          chan queueItem
-	reports        chan Report
-	ctx            context.Context
-	workers        int
-	reportCallback ReportCallback
+	store              KVStore
+	pool               *workerPool
+	pools              map[string]*workerPool
+	reports            chan Report
+	ctx                context.Context
+	subscribers        []ReportCallback
+	reportChannels     []chan Report
+	subscribersMutex   sync.Mutex
+	errorRates         *errorRateTracker
+	versionByUpdatedAt bool
+	config             *ConfigRegistry
+	deadLetters        *DeadLetterQueue
+	killSwitch         *KillSwitch
+	filter             func(entity any) bool
+	enqueueTimeout     time.Duration
+	pausePolicy        PausePolicy
+	dryRun             bool
+	outbox             bool
+	indexer            Indexer
+	repairLoaders      map[string]RewarmLoader
+	auditSink          AuditSink
+	generations        *generations
+	quotas             *quotaTracker
+	scheduler          *Scheduler
+	auditSourceOnce    sync.Once
+	auditSourceName    string
+	paused             bool
+	resumed            chan struct{}
+	pauseMutex         sync.Mutex
+	stats              statsTracker
 }
 
-func (k *kvSync) launchWorkers() {
-	for i := 0; i < k.workers; i++ {
+func (k *kvSync) launchWorkers(pool *workerPool) {
+	for i := 0; i < pool.workers; i++ {
 		go func() {
 			for {
+				if !k.ready() {
+					return
+				}
+
+				var item queueItem
 				select {
-				case <-k.ctx.Done():
+				case item = <-pool.priorityQueue:
+				default:
+					select {
+					case <-k.ctx.Done():
+						return
+					case item = <-pool.priorityQueue:
+					case item = <-pool.queue:
+					}
+				}
+
+				// the switch may have been engaged or syncing paused while waiting for the item
+				if !k.ready() {
 					return
-				case item := <-k.queue:
-					k.syncByKey(item.entity, item.key, true)
+				}
+
+				errs, err := k.syncEntitySafely(item)
+				k.deadLetter(item, errs, false)
+
+				if item.done != nil {
+					item.done <- firstError(errs, err)
 				}
 			}
 		}()
@@ -108,84 +523,1109 @@ func (k *kvSync) launchWorkers() {
 }
 
 // Fetch fetches a Syncable model from a KVStore and populates a new model with the data
-func (k *kvSync) Fetch(dest Syncable, keyName string) error {
+func (k *kvSync) Fetch(dest any, keyName string) error {
+	key, err := k.fetchKey(dest, keyName)
+	if err != nil {
+		return err
+	}
+
+	err = k.store.Fetch(key, dest)
+	if err != nil && k.deadLetters != nil && !k.Paused() {
+		// the entity is being requested, retry it ahead of the rest of the dead letters
+		if item, ok := k.deadLetters.take(key); ok {
+			item.attempt++
+			errs, _ := k.syncEntity(item, true)
+			if !k.deadLetter(item, errs, true) {
+				err = k.store.Fetch(key, dest)
+			}
+		}
+	}
+
+	if errors.Is(err, ErrCorrupted) && k.repair(key) == nil {
+		err = k.store.Fetch(key, dest)
+	}
+
+	if err != nil {
+		// the entity may not have been migrated to a new key naming scheme yet
+		if legacy, ok := legacyKey(dest, keyName); ok && k.store.Fetch(legacy, dest) == nil {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return k.afterFetch(dest)
+}
+
+// FetchWithInfo fetches a model like Fetch, along with the Envelope metadata it was stored with
+func (k *kvSync) FetchWithInfo(dest any, keyName string) (Envelope, error) {
+	fetcher, ok := k.store.(InfoFetcher)
+	if !ok {
+		return Envelope{}, errors.New("store does not support fetching envelopes")
+	}
+
+	key, err := k.fetchKey(dest, keyName)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	info, err := fetcher.FetchWithInfo(key, dest)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return info, k.afterFetch(dest)
+}
+
+// Exists reports whether an entity is stored under a key name, or its legacy key, without fetching it. The
+// store must implement ExistenceChecker.
+func (k *kvSync) Exists(entity any, keyName string) (bool, error) {
+	specs, ok := syncKeySpecs(entity)
+	if !ok {
+		return false, ErrNotSyncable
+	}
+
+	key, err := k.generationKey(entity, specs[keyName].Key)
+	if err != nil {
+		return false, err
+	}
+
+	found, err := exists(k.store, key)
+	if err != nil || found {
+		return found, err
+	}
+
+	if legacy, ok := legacyKey(entity, keyName); ok {
+		return exists(k.store, legacy)
+	}
+
+	return false, nil
+}
+
+// fetchKey returns the key of a destination model by key name
+func (k *kvSync) fetchKey(dest any, keyName string) (string, error) {
 	if reflect.TypeOf(dest).Kind() != reflect.Ptr {
-		return errors.New("destination must be a pointer")
+		return "", ErrNotPointer
+	}
+
+	specs, ok := syncKeySpecs(dest)
+	if !ok {
+		return "", ErrNotSyncable
+	}
+
+	return k.generationKey(dest, specs[keyName].Key)
+}
+
+func (k *kvSync) afterFetch(dest any) error {
+	if afterFetcher, ok := dest.(AfterFetcher); ok {
+		return afterFetcher.AfterFetch(k.ctx)
+	}
+
+	return nil
+}
+
+// FetchAny fetches the value of a registered model (see RegisterModel) by its key
+func (k *kvSync) FetchAny(key string) (any, error) {
+	fetcher, ok := k.store.(AnyFetcher)
+	if !ok {
+		return nil, errors.New("store does not support fetching untyped values")
+	}
+
+	return fetcher.FetchAny(key)
+}
+
+// FetchAnyWithInfo fetches the value of a registered model by its key like FetchAny, along with the Envelope
+// it was stored with when the store implements InfoFetcher, a zero Envelope otherwise
+func (k *kvSync) FetchAnyWithInfo(key string) (any, Envelope, error) {
+	value, err := k.FetchAny(key)
+	if err != nil {
+		return nil, Envelope{}, err
+	}
+
+	fetcher, ok := k.store.(InfoFetcher)
+	if !ok {
+		return value, Envelope{}, nil
 	}
 
-	return k.store.Fetch(dest.SyncKeys()[keyName], dest)
+	// fetched again into the type FetchAny found, so that the value and its envelope are read together
+	dest := reflect.New(reflect.TypeOf(value))
+	info, err := fetcher.FetchWithInfo(key, dest.Interface())
+	if err != nil {
+		return nil, Envelope{}, err
+	}
+
+	return dest.Elem().Interface(), info, nil
 }
 
 // GormCallback returns a Gorm callback that syncs a model with a KVStore
 func (k *kvSync) GormCallback() func(db *gorm.DB) {
 	return func(db *gorm.DB) {
+		// statements affecting no rows, e.g. the update Save attempts before inserting a new row, change nothing
+		if db.Error != nil || db.RowsAffected == 0 || k.killSwitch.Engaged() || isOutboxStatement(db) {
+			return
+		}
+
 		model := resolvePointer(db.Statement.Dest)
+		traceID := traceIDFrom(db.Statement.Context)
+		operation := OperationUpdate
+		if _, ok := db.Statement.Clauses[clause.Insert{}.Name()]; ok {
+			operation = OperationCreate
+		}
+
+		if reflect.TypeOf(model).Kind() == reflect.Map {
+			// Updates(map[string]any{...}) only carries the changed columns, the row is reloaded
+			row, ok := loadRow(db, statementModel(db))
+			if !ok {
+				return
+			}
+			model = row
+		}
+
+		onConflict, upsert := upsertClause(db)
 
 		if reflect.TypeOf(model).Kind() == reflect.Slice {
 			val := reflect.ValueOf(model)
 
 			for i := 0; i < val.Len(); i++ {
 				item := val.Index(i).Interface()
-				go k.enqueue(item)
+				if upsert {
+					row, ok := loadUpserted(db, onConflict, item)
+					if !ok {
+						continue
+					}
+					item = row
+				}
+				k.syncWritten(db, item, nil, traceID, operation)
 			}
 			return
-		} else {
-			go k.enqueue(model)
 		}
+
+		if upsert {
+			row, ok := loadUpserted(db, onConflict, model)
+			if !ok {
+				return
+			}
+			model = row
+		}
+
+		var stale map[string]KeySpec
+		if oldSpecs, ok := db.InstanceGet(staleKeysSetting); ok {
+			stale = staleKeySpecs(oldSpecs.(map[string]KeySpec), model)
+		}
+
+		k.syncWritten(db, model, stale, traceID, operation)
 	}
 }
 
-// Sync syncs a model with a KVStore synchronously
-func (k *kvSync) Sync(entity any) error {
-	entity = resolvePointer(entity)
+// syncWritten queues an entity written by a statement and deletes the keys it left behind, or records
+// both in the outbox within the statement's transaction
+func (k *kvSync) syncWritten(db *gorm.DB, entity any, stale map[string]KeySpec, traceID string, operation Operation) {
+	if k.outbox {
+		k.record(db, entity, true, stale, traceID, operation)
+		return
+	}
 
-	syncable, ok := entity.(Syncable)
+	actor := Actor(db.Statement.Context)
+	go k.enqueue(entity, traceID, actor, operation)
 
-	if !ok {
-		return errors.New("model is not syncable")
+	if len(stale) > 0 {
+		go k.deleteKeys(entity, stale, traceID, actor, OperationUpdate)
 	}
+}
 
-	for _, key := range syncable.SyncKeys() {
-		k.syncByKey(entity, key, false)
+// deleteDeleted deletes the keys of an entity deleted by a statement, or records them in the outbox
+// within the statement's transaction
+func (k *kvSync) deleteDeleted(db *gorm.DB, entity any, specs map[string]KeySpec, traceID string) {
+	if k.outbox {
+		k.record(db, entity, false, specs, traceID, OperationDelete)
+		return
 	}
 
-	return nil
+	go k.deleteKeys(entity, specs, traceID, Actor(db.Statement.Context), OperationDelete)
 }
 
-func (k *kvSync) syncByKey(entity any, key string, report bool) {
-	entity = resolvePointer(entity)
+// GormBeforeUpdateCallback returns a Gorm callback that captures the keys of the row being updated,
+// so that keys no longer produced by the updated model are deleted by GormCallback. Registered before
+// deletes, it captures the keys of the row being deleted for GormDeleteCallback.
+func (k *kvSync) GormBeforeUpdateCallback() func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		model := statementModel(db)
+		if _, ok := syncKeySpecs(model); !ok {
+			return
+		}
+
+		old, ok := loadRow(db, model)
+		if !ok {
+			return
+		}
 
-	err := k.store.Put(key, entity)
+		oldSpecs, _ := syncKeySpecs(old)
+		db.InstanceSet(staleKeysSetting, oldSpecs)
+	}
+}
 
-	if !report {
-		return
+// statementModel returns the model a statement writes: its destination, or its Model when the
+// destination is a map of changed columns
+func statementModel(db *gorm.DB) any {
+	if db.Statement.Dest == nil {
+		return nil
 	}
 
-	k.reports <- Report{
-		Model: entity,
-		Key:   key,
-		Err:   err,
+	model := resolvePointer(db.Statement.Dest)
+	if reflect.TypeOf(model).Kind() == reflect.Map && db.Statement.Model != nil {
+		return resolvePointer(db.Statement.Model)
 	}
+
+	return model
 }
 
-func (k *kvSync) enqueue(entity any) {
-	entity = resolvePointer(entity)
+// loadRow loads the current row of a single model by its primary key
+func loadRow(db *gorm.DB, model any) (any, bool) {
+	if model == nil || db.Statement.Schema == nil || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return nil, false
+	}
 
-	syncable, ok := entity.(Syncable)
+	val := reflect.ValueOf(model)
+	if val.Kind() != reflect.Struct {
+		return nil, false
+	}
 
-	if !ok {
-		return
+	pk := db.Statement.Schema.PrioritizedPrimaryField
+	pkValue, zero := pk.ValueOf(db.Statement.Context, val)
+	if zero {
+		return nil, false
+	}
+
+	return findRow(db, val.Type(), clause.Eq{Column: clause.Column{Name: pk.DBName}, Value: pkValue})
+}
+
+// findRow loads the single row of a model type matching the conditions, a missing row is not logged as an error
+func findRow(db *gorm.DB, modelType reflect.Type, conds ...clause.Expression) (any, bool) {
+	row := reflect.New(modelType)
+	result := db.Session(&gorm.Session{NewDB: true}).Where(clause.And(conds...)).Limit(1).Find(row.Interface())
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, false
 	}
 
-	for keyName, key := range syncable.SyncKeys() {
-		k.queue <- queueItem{
-			entity:  entity,
-			keyName: keyName,
-			key:     key,
+	return row.Elem().Interface(), true
+}
+
+// GormDeleteCallback returns a Gorm callback that deletes the keys of deleted models, including soft deletes
+func (k *kvSync) GormDeleteCallback() func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil || db.Statement.Dest == nil || isOutboxStatement(db) {
+			return
+		}
+
+		model := resolvePointer(db.Statement.Dest)
+		traceID := traceIDFrom(db.Statement.Context)
+
+		if oldSpecs, ok := db.InstanceGet(staleKeysSetting); ok {
+			k.deleteDeleted(db, model, oldSpecs.(map[string]KeySpec), traceID)
+			return
+		}
+
+		val := reflect.ValueOf(model)
+		if val.Kind() == reflect.Slice {
+			for i := 0; i < val.Len(); i++ {
+				item := resolvePointer(val.Index(i).Interface())
+				if specs, ok := deletedKeySpecs(db, item); ok {
+					k.deleteDeleted(db, item, specs, traceID)
+				}
+			}
+			return
+		}
+
+		if specs, ok := deletedKeySpecs(db, model); ok {
+			k.deleteDeleted(db, model, specs, traceID)
 		}
 	}
 }
 
+// deletedKeySpecs returns the key specs of a deleted model whose row could not be loaded beforehand,
+// provided its primary key is set so that its keys are meaningful
+func deletedKeySpecs(db *gorm.DB, model any) (map[string]KeySpec, bool) {
+	if db.Statement.Schema == nil || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return nil, false
+	}
+
+	val := reflect.ValueOf(model)
+	if val.Kind() != reflect.Struct || val.Type() != db.Statement.Schema.ModelType {
+		return nil, false
+	}
+
+	if _, zero := db.Statement.Schema.PrioritizedPrimaryField.ValueOf(db.Statement.Context, val); zero {
+		return nil, false
+	}
+
+	return syncKeySpecs(model)
+}
+
+// deleteKeys deletes and reports keys of an entity, returning the first failure other than a missing key
+func (k *kvSync) deleteKeys(entity any, specs map[string]KeySpec, traceID string, actor string, operation Operation) error {
+	if k.killSwitch.Engaged() {
+		return ErrHalted
+	}
+
+	if k.dropping() {
+		k.skipKeys(entity, specs, ErrPaused, traceID, operation)
+
+		return ErrPaused
+	}
+
+	// keys are left to expire, e.g. the stale keys of updated rows
+	if _, ok := k.store.(Deleter); !ok {
+		k.skipKeys(entity, specs, ErrDeleteUnsupported, traceID, operation)
+
+		return ErrDeleteUnsupported
+	}
+
+	if !k.waitResumed() {
+		return k.ctx.Err()
+	}
+
+	specs, err := k.generationSpecs(entity, specs)
+	if err != nil {
+		k.skipKeys(entity, specs, err, traceID, operation)
+
+		return err
+	}
+
+	errs := make(map[string]error, len(specs))
+	for keyName, spec := range specs {
+		started := time.Now()
+
+		var err error
+		if !k.dryRun {
+			err = deleteKey(k.store, spec.Key)
+		}
+		errs[spec.Key] = err
+
+		k.reports <- Report{
+			Model:     entity,
+			KeyName:   keyName,
+			Key:       spec.Key,
+			Err:       err,
+			TraceID:   traceID,
+			Operation: operation,
+			Duration:  time.Since(started),
+			Attempt:   1,
+			Timestamp: time.Now(),
+			DryRun:    k.dryRun,
+		}
+	}
+
+	k.audit(entity, AuditDelete, specs, nil, errs, queueItem{traceID: traceID, actor: actor, operation: operation, attempt: 1}, true)
+
+	if operation == OperationDelete && !k.dryRun && k.indexer != nil {
+		if err := k.indexer.Unindex(entity); err != nil {
+			k.reportIndexError(entity, err, traceID, operation, 1)
+		}
+	}
+
+	for key, err := range errs {
+		// keys may have expired or never been written
+		if errors.Is(err, ErrKeyNotFound) {
+			delete(errs, key)
+		}
+	}
+
+	return firstError(errs, nil)
+}
+
+// skipKeys reports keys of an entity left undeleted because of err
+func (k *kvSync) skipKeys(entity any, specs map[string]KeySpec, err error, traceID string, operation Operation) {
+	for keyName, spec := range specs {
+		k.reports <- Report{
+			Model:     entity,
+			KeyName:   keyName,
+			Key:       spec.Key,
+			Err:       err,
+			TraceID:   traceID,
+			Operation: operation,
+			Timestamp: time.Now(),
+		}
+	}
+}
+
+// Sync syncs a model with a KVStore synchronously, it fails with ErrPaused while paused
+func (k *kvSync) Sync(entity any, opts ...SyncOption) error {
+	if k.Paused() {
+		return ErrPaused
+	}
+
+	entity = resolvePointer(entity)
+
+	specs, err := k.specsToSync(entity)
+	if err == ErrFiltered {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	o := newSyncOptions(opts)
+	item := queueItem{
+		entity:    entity,
+		specs:     o.withTTL(specs),
+		traceID:   newTraceID(),
+		operation: OperationManual,
+		attempt:   1,
+		opts:      o,
+	}
+	errs, err := k.syncEntity(item, false)
+	k.deadLetter(item, errs, false)
+
+	return err
+}
+
+// SyncAndWait queues an entity for the workers and waits until all of its keys are written, returning the
+// first error, or until the context is done. Unlike Sync, the writes are reported, and while paused the
+// entity is buffered or dropped according to the PausePolicy.
+func (k *kvSync) SyncAndWait(ctx context.Context, entity any, opts ...SyncOption) error {
+	if k.dropping() {
+		return ErrPaused
+	}
+
+	entity = resolvePointer(entity)
+
+	specs, err := k.specsToSync(entity)
+	if err == ErrFiltered {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	o := newSyncOptions(opts)
+	done := make(chan error, 1)
+	item := queueItem{
+		entity:    entity,
+		specs:     o.withTTL(specs),
+		traceID:   traceIDFrom(ctx),
+		actor:     Actor(ctx),
+		operation: OperationManual,
+		attempt:   1,
+		done:      done,
+		opts:      o,
+	}
+
+	pool := k.poolFor(entity)
+	queue := pool.queue
+	if o.priority >= PriorityHigh {
+		queue = pool.priorityQueue
+	}
+
+	select {
+	case queue <- item:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-k.ctx.Done():
+		return k.ctx.Err()
+	}
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// specsToSync returns the key specs of an entity about to be synced, or the reason it must not be
+func (k *kvSync) specsToSync(entity any) (map[string]KeySpec, error) {
+	specs, ok := syncKeySpecs(entity)
+	if !ok {
+		return nil, ErrNotSyncable
+	}
+
+	if k.killSwitch.Engaged() {
+		return nil, ErrHalted
+	}
+
+	if !k.shouldSync(entity) {
+		return nil, ErrFiltered
+	}
+
+	if k.errorRates.isDisabled(ModelName(entity)) {
+		return nil, ErrModelDisabled
+	}
+
+	specs, ok = k.configure(entity, specs)
+	if !ok {
+		return nil, fmt.Errorf("%w by config", ErrModelDisabled)
+	}
+
+	return k.generationSpecs(entity, specs)
+}
+
+// ReplayDeadLetters retries the dead-lettered entities in failure order, returning the number synced.
+// Entities failing again are dead-lettered again.
+func (k *kvSync) ReplayDeadLetters() int {
+	if k.deadLetters == nil || k.killSwitch.Engaged() || k.Paused() {
+		return 0
+	}
+
+	synced := 0
+	for n := k.deadLetters.Len(); n > 0; n-- {
+		item, ok := k.deadLetters.pop()
+		if !ok {
+			break
+		}
+
+		item.attempt++
+		errs, err := k.syncEntity(item, true)
+		if err == nil && !k.deadLetter(item, errs, false) {
+			synced++
+		}
+	}
+
+	return synced
+}
+
+// deadLetter queues an entity for replay when one of its keys could not be written, returning whether it was
+func (k *kvSync) deadLetter(item queueItem, errs map[string]error, front bool) bool {
+	if k.deadLetters == nil || k.dryRun {
+		return false
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			k.deadLetters.push(item, err, front)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// EnableModel re-enables syncing of a model that was disabled due to its error rate
+func (k *kvSync) EnableModel(model any) {
+	k.errorRates.enable(ModelName(model))
+}
+
+// Refresh extends the expiration of an entity's keys in a store implementing TouchStore, e.g. when it is
+// accessed for a sliding expiration. Keys expire after their TTL, the entity's SyncExpiration or the store's
+// expiration, in that order. Keys that are not stored are skipped.
+func (k *kvSync) Refresh(entity any) error {
+	if k.dryRun {
+		return nil
+	}
+
+	specs, ok := syncKeySpecs(entity)
+	if !ok {
+		return ErrNotSyncable
+	}
+
+	if configured, ok := k.configure(entity, specs); ok {
+		specs = configured
+	}
+
+	specs, err := k.generationSpecs(entity, specs)
+	if err != nil {
+		return err
+	}
+
+	var expiration time.Duration
+	if e, ok := entity.(Expirable); ok {
+		expiration = e.SyncExpiration()
+	}
+
+	errs := make(map[string]error, len(specs))
+	for _, spec := range specs {
+		ttl := spec.TTL
+		if ttl <= 0 {
+			ttl = expiration
+		}
+
+		if err := touchKey(k.store, spec.Key, ttl); !errors.Is(err, ErrKeyNotFound) {
+			errs[spec.Key] = err
+		}
+	}
+
+	return firstError(errs, nil)
+}
+
+// FlushModel deletes all keys of a model type from a store implementing PrefixDeleter
+func (k *kvSync) FlushModel(model any) error {
+	if k.dryRun {
+		return nil
+	}
+
+	deleter, ok := k.store.(PrefixDeleter)
+	if !ok {
+		return errors.New("store does not support deleting by prefix")
+	}
+
+	prefixes, err := keyPrefixes(resolvePointer(model))
+	if err != nil {
+		return err
+	}
+
+	prefixes, err = k.generationPrefixes(model, prefixes)
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range prefixes {
+		if err = deleter.DeleteByPrefix(prefix); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListModelKeys returns the keys of a model type found in a store implementing KeyScanner, in the order
+// they were scanned
+func (k *kvSync) ListModelKeys(model any) ([]string, error) {
+	prefixes, err := keyPrefixes(resolvePointer(model))
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes, err = k.generationPrefixes(model, prefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, prefix := range prefixes {
+		cursor := ""
+		for {
+			page, next, err := scan(k.store, prefix, 1000, cursor)
+			if err != nil {
+				return nil, err
+			}
+
+			// a prefix may be a prefix of another one
+			for _, key := range page {
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+	}
+
+	return keys, nil
+}
+
+// keyPrefixes returns the distinct prefixes of a model's keys
+func keyPrefixes(model any) ([]string, error) {
+	if prefixer, ok := model.(KeyPrefixer); ok {
+		return []string{prefixer.SyncKeyPrefix()}, nil
+	}
+
+	specs, ok := syncKeySpecs(model)
+	if !ok {
+		return nil, ErrNotSyncable
+	}
+
+	seen := make(map[string]bool, len(specs))
+	prefixes := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		i := strings.LastIndex(spec.Key, ":")
+		if i < 0 {
+			return nil, errors.New("cannot derive a prefix from key " + spec.Key + ", implement KeyPrefixer")
+		}
+
+		prefix := spec.Key[:i+1]
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return prefixes, nil
+}
+
+// syncEntitySafely is syncEntity for the workers, recovering from panics so that a single unexpected
+// entity doesn't stop a worker for good. The panic is reported for each key of the entity.
+func (k *kvSync) syncEntitySafely(item queueItem) (errs map[string]error, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+			errs = nil
+
+			for keyName, spec := range item.specs {
+				k.errorRates.observe(ModelName(item.entity), err)
+				k.stats.observe(ModelName(item.entity), err)
+
+				k.reports <- Report{
+					Model:     item.entity,
+					KeyName:   keyName,
+					Key:       spec.Key,
+					Err:       err,
+					TraceID:   item.traceID,
+					Operation: item.operation,
+					Attempt:   item.attempt,
+					Timestamp: time.Now(),
+				}
+			}
+		}
+	}()
+
+	return k.syncEntity(item, true)
+}
+
+// firstError returns the BeforeSync error, or else the write error of the first key in key order
+func firstError(errs map[string]error, err error) error {
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(errs))
+	for key, keyErr := range errs {
+		if keyErr != nil {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	sort.Strings(keys)
+
+	return errs[keys[0]]
+}
+
+// syncEntity writes all keys of an entity, returning the write errors by key and the BeforeSync error
+func (k *kvSync) syncEntity(item queueItem, report bool) (map[string]error, error) {
+	started := time.Now()
+	specs := item.specs
+	entity, err := k.beforeSync(WithTraceID(k.ctx, item.traceID), resolvePointer(item.entity))
+
+	var errs map[string]error
+	var sizes map[string]int
+	if err == nil {
+		var values map[string]any
+		specs, values = withSnapshots(specs, views(entity, specs), time.Now())
+		if k.dryRun {
+			errs, sizes = k.measure(values, specs, item.opts.marshaler)
+		} else {
+			errs = k.putWithinQuotas(entity, values, specs, item.opts.marshaler)
+			k.audit(entity, AuditWrite, specs, values, errs, item, report)
+		}
+	}
+
+	var indexErr error
+	if err == nil && !k.dryRun && firstError(errs, nil) == nil {
+		if indexErr = k.index(entity); indexErr != nil {
+			// the entity is dead lettered and retried like a failed write
+			errs[IndexReportKeyName] = indexErr
+		}
+	}
+
+	duration := time.Since(started)
+
+	for keyName, spec := range specs {
+		keyErr := err
+		if keyErr == nil {
+			keyErr = errs[spec.Key]
+		}
+		k.errorRates.observe(ModelName(entity), keyErr)
+		if !k.dryRun {
+			k.stats.observe(ModelName(entity), keyErr)
+		}
+
+		if !report && !k.dryRun {
+			continue
+		}
+
+		k.reports <- Report{
+			Model:     entity,
+			KeyName:   keyName,
+			Key:       spec.Key,
+			Err:       keyErr,
+			TraceID:   item.traceID,
+			Operation: item.operation,
+			Duration:  duration,
+			Attempt:   item.attempt,
+			Timestamp: started.Add(duration),
+			DryRun:    k.dryRun,
+			Size:      sizes[spec.Key],
+		}
+	}
+
+	if indexErr != nil && report {
+		k.reportIndexError(entity, indexErr, item.traceID, item.operation, item.attempt)
+	}
+
+	return errs, err
+}
+
+// beforeSync invokes the BeforeSync hook on an addressable copy of the entity and returns the copy
+func (k *kvSync) beforeSync(ctx context.Context, entity any) (any, error) {
+	ptr := addressableCopy(entity)
+
+	beforeSyncer, ok := ptr.Interface().(BeforeSyncer)
+	if !ok {
+		return entity, nil
+	}
+
+	if err := beforeSyncer.BeforeSync(ctx); err != nil {
+		return entity, err
+	}
+
+	return ptr.Elem().Interface(), nil
+}
+
+// addressableCopy returns a pointer to a copy of the entity, so that methods with pointer receivers can be called
+func addressableCopy(entity any) reflect.Value {
+	ptr := reflect.New(reflect.TypeOf(entity))
+	ptr.Elem().Set(reflect.ValueOf(entity))
+
+	return ptr
+}
+
+// project returns the value to store for an entity, its SyncValue when it implements Projector
+func project(entity any) any {
+	if projector, ok := addressableCopy(entity).Interface().(Projector); ok {
+		return resolvePointer(projector.SyncValue())
+	}
+
+	return entity
+}
+
+// views returns the values to store for an entity by key name, see Viewer and Projector
+func views(entity any, specs map[string]KeySpec) map[string]any {
+	value := project(entity)
+
+	var entityViews map[string]any
+	if viewer, ok := addressableCopy(entity).Interface().(Viewer); ok {
+		entityViews = viewer.SyncViews()
+	}
+
+	values := make(map[string]any, len(specs))
+	for keyName := range specs {
+		if view, ok := entityViews[keyName]; ok {
+			values[keyName] = resolvePointer(view)
+		} else {
+			values[keyName] = value
+		}
+	}
+
+	return values
+}
+
+// put writes the values of an entity under their keys, returning the errors by key
+func (k *kvSync) put(entity any, values map[string]any, specs map[string]KeySpec, marshaler MarshalingAdapter) map[string]error {
+	errs := make(map[string]error, len(specs))
+
+	if marshaler != nil {
+		marshalingStore, ok := k.store.(MarshalingStore)
+		for keyName, spec := range specs {
+			if !ok {
+				errs[spec.Key] = errors.New("store does not support per-operation marshalers")
+				continue
+			}
+			errs[spec.Key] = marshalingStore.PutWithMarshaler(spec.Key, values[keyName], spec.TTL, marshaler)
+		}
+
+		return errs
+	}
+
+	entries := make([]BatchEntry, 0, len(specs))
+	for keyName, spec := range specs {
+		entries = append(entries, BatchEntry{Key: spec.Key, Value: values[keyName], TTL: spec.TTL})
+	}
+
+	if version, ok := entityVersion(entity, k.versionByUpdatedAt); ok {
+		// the keys of a versioned entity are written in one round trip too, atomically when the store is
+		if batchStore, ok := k.store.(VersionedBatchStore); ok {
+			for i, err := range batchStore.PutBatchIfNewer(entries, version) {
+				errs[entries[i].Key] = err
+			}
+
+			return errs
+		}
+
+		if versionedStore, ok := k.store.(VersionedStore); ok {
+			for _, entry := range entries {
+				// a stale version is not a failure, the newer value is already stored
+				_, errs[entry.Key] = versionedStore.PutIfNewer(entry.Key, entry.Value, version, entry.TTL)
+			}
+
+			return errs
+		}
+	}
+
+	if batchStore, ok := k.store.(BatchStore); ok {
+		for i, err := range batchStore.PutBatch(entries) {
+			errs[entries[i].Key] = err
+		}
+
+		return errs
+	}
+
+	for keyName, spec := range specs {
+		if ttlStore, ok := k.store.(TTLStore); ok && spec.TTL > 0 {
+			errs[spec.Key] = ttlStore.PutWithTTL(spec.Key, values[keyName], spec.TTL)
+		} else {
+			errs[spec.Key] = k.store.Put(spec.Key, values[keyName])
+		}
+	}
+
+	return errs
+}
+
+const staleKeysSetting = "kvsync:stale_keys"
+
+// staleKeySpecs returns the key specs of an entity before its update that it no longer produces
+func staleKeySpecs(oldSpecs map[string]KeySpec, entity any) map[string]KeySpec {
+	newSpecs, ok := syncKeySpecs(resolvePointer(entity))
+	if !ok {
+		return nil
+	}
+
+	current := make(map[string]bool, len(newSpecs))
+	for _, spec := range newSpecs {
+		current[spec.Key] = true
+	}
+
+	stale := make(map[string]KeySpec)
+	for keyName, spec := range oldSpecs {
+		if !current[spec.Key] {
+			stale[keyName] = spec
+		}
+	}
+
+	return stale
+}
+
+func (k *kvSync) enqueue(entity any, traceID string, actor string, operation Operation) {
+	entity = resolvePointer(entity)
+
+	skip := func(err error) {
+		k.reports <- Report{
+			Model:     entity,
+			Err:       err,
+			TraceID:   traceID,
+			Operation: operation,
+			Timestamp: time.Now(),
+		}
+	}
+
+	specs, err := k.specsToSync(entity)
+	if err != nil {
+		skip(err)
+		return
+	}
+
+	if k.dropping() {
+		skip(ErrPaused)
+		return
+	}
+
+	var timeout <-chan time.Time
+	if k.enqueueTimeout > 0 {
+		timer := time.NewTimer(k.enqueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case k.poolFor(entity).queue <- queueItem{
+		entity:    entity,
+		specs:     specs,
+		traceID:   traceID,
+		actor:     actor,
+		operation: operation,
+		attempt:   1,
+	}:
+	case <-timeout:
+		skip(ErrQueueFull)
+	case <-k.ctx.Done():
+	}
+}
+
+// shouldSync reports whether an entity passes the Filter option, the exclusions of its model config and its own
+// SyncFilter
+func (k *kvSync) shouldSync(entity any) bool {
+	if k.filter != nil && !k.filter(entity) {
+		return false
+	}
+
+	if k.config != nil && k.config.Load().model(ModelName(entity)).excludes(entity) {
+		return false
+	}
+
+	if filter, ok := entity.(SyncFilter); ok {
+		return filter.ShouldSync()
+	}
+
+	return true
+}
+
+// configure applies the runtime configuration of the entity's model to its key specs, dropping the keys it is not
+// routed to, and returns false when the model is disabled
+func (k *kvSync) configure(entity any, specs map[string]KeySpec) (map[string]KeySpec, bool) {
+	if k.config == nil {
+		return specs, true
+	}
+
+	mc := k.config.Load().model(ModelName(entity))
+	if mc.Disabled {
+		return nil, false
+	}
+
+	if mc.TTL <= 0 && len(mc.KeyTTLs) == 0 && len(mc.Keys) == 0 {
+		return specs, true
+	}
+
+	configured := make(map[string]KeySpec, len(specs))
+	for keyName, spec := range specs {
+		if !mc.routes(keyName) {
+			continue
+		}
+
+		if ttl, ok := mc.KeyTTLs[keyName]; ok && ttl > 0 {
+			spec.TTL = ttl
+		} else if mc.TTL > 0 {
+			spec.TTL = mc.TTL
+		}
+		configured[keyName] = spec
+	}
+
+	return configured, true
+}
+
+// syncKeySpecs returns the key specs of an entity implementing either KeySpecSyncable or Syncable,
+// or declaring its keys with struct tags
+func syncKeySpecs(entity any) (map[string]KeySpec, bool) {
+	switch e := entity.(type) {
+	case KeySpecSyncable:
+		return e.SyncKeySpecs(), true
+	case Syncable:
+		keys := e.SyncKeys()
+		specs := make(map[string]KeySpec, len(keys))
+		for keyName, key := range keys {
+			specs[keyName] = KeySpec{Key: key}
+		}
+
+		return specs, true
+	default:
+		specs, err := TagKeySpecs(entity)
+
+		return specs, err == nil
+	}
+}
+
+// ModelName returns the name identifying a model type, e.g. "models.User"
+func ModelName(entity any) string {
+	return reflect.TypeOf(resolvePointer(entity)).String()
+}
+
 func resolvePointer(item interface{}) interface{} {
 	for {
 		val := reflect.ValueOf(item)
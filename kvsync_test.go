@@ -2,12 +2,16 @@ package kvsync_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/ndthuan/kvsync"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type SyncedUser struct {
@@ -151,23 +155,26 @@ func TestFetch_Errors(t *testing.T) {
 		name    string
 		dest    kvsync.Syncable
 		keyName string
+		err     error
 	}{
 		{
 			name:    "invalid dest (non-pointer)",
 			dest:    SyncedUser{},
 			keyName: "uuid",
+			err:     kvsync.ErrNotPointer,
 		},
 		{
 			name:    "key not found",
 			dest:    &SyncedUser{},
 			keyName: "uuid",
+			err:     kvsync.ErrKeyNotFound,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			err := kvSync.Fetch(tc.dest, tc.keyName)
-			assert.Error(t, err)
+			assert.ErrorIs(t, err, tc.err)
 		})
 	}
 }
@@ -181,7 +188,501 @@ func TestFetch_KeyNotFound(t *testing.T) {
 	})
 
 	err := kvSync.Fetch(&SyncedUser{}, "uuid")
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, kvsync.ErrKeyNotFound)
+	assert.NotErrorIs(t, err, kvsync.ErrStoreUnavailable)
+
+	assert.ErrorIs(t, kvSync.Sync(&UnsyncedUser{}), kvsync.ErrNotSyncable)
+}
+
+func TestStaleKeyCleanup(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kvSync := kvsync.NewKVSync(ctx, kvsync.Options{
+		Store: store,
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	if err := db.Callback().Update().Before("gorm:update").Register("kvsync:before_update", kvSync.GormBeforeUpdateCallback()); err != nil {
+		t.Fatal("failed to register gorm:update before callback", err)
+	}
+
+	if err := db.Callback().Update().After("gorm:update").Register("kvsync:update", kvSync.GormCallback()); err != nil {
+		t.Fatal("failed to register gorm:update callback", err)
+	}
+
+	user := SyncedUser{
+		UUID:     "stale-uuid",
+		Username: "stale-username",
+	}
+	db.Create(&user)
+	assert.NoError(t, kvSync.Sync(&user))
+
+	user.UUID = "fresh-uuid"
+	db.Save(&user)
+
+	assert.Eventually(t, func() bool {
+		return kvSync.Fetch(&SyncedUser{UUID: "stale-uuid"}, "uuid") != nil
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		return kvSync.Fetch(&SyncedUser{UUID: "fresh-uuid"}, "uuid") == nil
+	}, time.Second, 5*time.Millisecond)
+
+	assert.NoError(t, kvSync.Fetch(&SyncedUser{Model: gorm.Model{ID: user.ID}}, "id"))
+	assert.Error(t, kvSync.Fetch(&SyncedUser{Model: gorm.Model{ID: user.ID}, UUID: "stale-uuid"}, "composite"))
+}
+
+// undeletableStore implements KVStore alone, like third-party stores unable to delete keys
+type undeletableStore struct {
+	memory *kvsync.InMemoryStore
+}
+
+func (u undeletableStore) Put(key string, value any) error {
+	return u.memory.Put(key, value)
+}
+
+func (u undeletableStore) Fetch(key string, dest any) error {
+	return u.memory.Fetch(key, dest)
+}
+
+func TestStaleKeyCleanup_WithoutDeleter(t *testing.T) {
+	memory := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	skipped := make(chan kvsync.Report, 10)
+	kvSync := kvsync.NewKVSync(ctx, kvsync.Options{
+		Store: undeletableStore{memory: memory},
+		ReportCallback: func(r kvsync.Report) {
+			if errors.Is(r.Err, kvsync.ErrDeleteUnsupported) {
+				skipped <- r
+			}
+		},
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+
+	user := SyncedUser{
+		UUID:     "undeletable-uuid",
+		Username: "undeletable-username",
+	}
+	db.Create(&user)
+	assert.NoError(t, kvSync.Sync(&user))
+
+	user.UUID = "renamed-uuid"
+	db.Save(&user)
+
+	var keys []string
+	for len(keys) < 2 {
+		select {
+		case r := <-skipped:
+			assert.Equal(t, kvsync.OperationUpdate, r.Operation)
+			keys = append(keys, r.Key)
+		case <-time.After(time.Second):
+			t.Fatal("stale keys not reported")
+		}
+	}
+	assert.ElementsMatch(t, []string{"user:uuid:undeletable-uuid", fmt.Sprintf("user:composite:%d_undeletable-uuid", user.ID)}, keys)
+
+	assert.Eventually(t, func() bool {
+		return kvSync.Fetch(&SyncedUser{UUID: "renamed-uuid"}, "uuid") == nil
+	}, time.Second, 5*time.Millisecond)
+	assert.Contains(t, memory.Store, "user:uuid:undeletable-uuid", "left to expire")
+}
+
+func TestFlushModel(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+
+	assert.NoError(t, kvSync.Sync(&SyncedUser{UUID: "flush-uuid"}))
+	assert.NoError(t, store.Put("order:id:1", SyncedUser{}))
+
+	assert.NoError(t, kvSync.FlushModel(SyncedUser{}))
+
+	assert.Len(t, store.Store, 1)
+	assert.Contains(t, store.Store, "order:id:1")
+
+	assert.Error(t, kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: erroneousStore{},
+	}).FlushModel(SyncedUser{}), "store without prefix deletion")
+}
+
+func TestExists(t *testing.T) {
+	store, s := setUpStore()
+	defer s.Close()
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+
+	user := &SyncedUser{Model: gorm.Model{ID: 1}, UUID: "exists-uuid"}
+	assert.NoError(t, kvSync.Sync(user))
+
+	found, err := kvSync.Exists(user, "uuid")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = kvSync.Exists(SyncedUser{Model: gorm.Model{ID: 2}}, "id")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, err = kvSync.Exists(User{ID: 1}, "id")
+	assert.ErrorIs(t, err, kvsync.ErrNotSyncable)
+
+	s.Close()
+	_, err = kvSync.Exists(user, "uuid")
+	assert.ErrorIs(t, err, kvsync.ErrStoreUnavailable)
+
+	_, err = kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: erroneousStore{},
+	}).Exists(user, "id")
+	assert.Error(t, err, "store without existence checks")
+}
+
+func TestListModelKeys(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+
+	assert.NoError(t, kvSync.Sync(&SyncedUser{Model: gorm.Model{ID: 1}, UUID: "list-uuid"}))
+	assert.NoError(t, store.Put("order:id:1", Order{ID: 1}))
+
+	keys, err := kvSync.ListModelKeys(&SyncedUser{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"user:id:1", "user:uuid:list-uuid", "user:composite:1_list-uuid"}, keys)
+
+	_, err = kvSync.ListModelKeys(User{})
+	assert.ErrorIs(t, err, kvsync.ErrNotSyncable)
+
+	_, err = kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: erroneousStore{},
+	}).ListModelKeys(SyncedUser{})
+	assert.Error(t, err, "store without key scanning")
+}
+
+type FetchHookUser struct {
+	ID          int
+	FirstName   string
+	LastName    string
+	DisplayName string
+}
+
+func (u FetchHookUser) SyncKeys() map[string]string {
+	return map[string]string{
+		"id": fmt.Sprintf("hook_user:id:%d", u.ID),
+	}
+}
+
+func (u *FetchHookUser) AfterFetch(ctx context.Context) error {
+	if u.FirstName == "" {
+		return errors.New("first name is required")
+	}
+
+	u.DisplayName = u.FirstName + " " + u.LastName
+
+	return nil
+}
+
+func TestFetch_AfterFetch(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+
+	assert.NoError(t, kvSync.Sync(FetchHookUser{ID: 1, FirstName: "Ada", LastName: "Lovelace"}))
+	assert.NoError(t, kvSync.Sync(FetchHookUser{ID: 2}))
+
+	fetched := FetchHookUser{ID: 1}
+	assert.NoError(t, kvSync.Fetch(&fetched, "id"))
+	assert.Equal(t, "Ada Lovelace", fetched.DisplayName)
+
+	assert.Error(t, kvSync.Fetch(&FetchHookUser{ID: 2}, "id"))
+}
+
+type BeforeSyncUser struct {
+	ID        int
+	FirstName string
+	LastName  string
+	FullName  string
+}
+
+func (u BeforeSyncUser) SyncKeys() map[string]string {
+	return map[string]string{
+		"id": fmt.Sprintf("before_sync_user:id:%d", u.ID),
+	}
+}
+
+func (u *BeforeSyncUser) BeforeSync(ctx context.Context) error {
+	if u.FirstName == "" {
+		return errors.New("first name is required")
+	}
+
+	u.FullName = u.FirstName + " " + u.LastName
+
+	return nil
+}
+
+func TestSync_BeforeSync(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	reports := make(chan kvsync.Report, 1)
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+
+	user := &BeforeSyncUser{ID: 1, FirstName: "Ada", LastName: "Lovelace"}
+	assert.NoError(t, kvSync.Sync(user))
+	assert.Empty(t, user.FullName, "the caller's entity is left untouched")
+
+	fetched := BeforeSyncUser{ID: 1}
+	assert.NoError(t, kvSync.Fetch(&fetched, "id"))
+	assert.Equal(t, "Ada Lovelace", fetched.FullName)
+
+	assert.Error(t, kvSync.Sync(&BeforeSyncUser{ID: 2}))
+	assert.Error(t, kvSync.Fetch(&BeforeSyncUser{ID: 2}, "id"))
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.AutoMigrate(&BeforeSyncUser{}))
+	defer func() {
+		_ = db.Migrator().DropTable(&BeforeSyncUser{})
+	}()
+
+	if err := db.Callback().Create().After("gorm:create").Register("kvsync:create", kvSync.GormCallback()); err != nil {
+		t.Fatal("failed to register gorm:create callback", err)
+	}
+
+	db.Create(&BeforeSyncUser{ID: 3})
+
+	select {
+	case r := <-reports:
+		assert.Error(t, r.Err)
+		assert.Equal(t, "before_sync_user:id:3", r.Key)
+	case <-time.After(time.Second):
+		t.Fatal("no report received")
+	}
+}
+
+type ProjectedUser struct {
+	ID           int
+	Name         string
+	PasswordHash string
+}
+
+type PublicUser struct {
+	ID   int
+	Name string
+}
+
+func (u ProjectedUser) SyncKeys() map[string]string {
+	return map[string]string{
+		"id": fmt.Sprintf("projected_user:id:%d", u.ID),
+	}
+}
+
+func (u ProjectedUser) SyncValue() any {
+	return &PublicUser{ID: u.ID, Name: u.Name}
+}
+
+func TestSync_Projection(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+
+	assert.NoError(t, kvSync.Sync(&ProjectedUser{ID: 1, Name: "Ada", PasswordHash: "secret"}))
+	assert.Equal(t, PublicUser{ID: 1, Name: "Ada"}, store.Store["projected_user:id:1"])
+
+	var fetched PublicUser
+	assert.NoError(t, store.Fetch("projected_user:id:1", &fetched))
+	assert.Equal(t, "Ada", fetched.Name)
+}
+
+type ViewedUser struct {
+	ID    int
+	Name  string
+	Email string
+}
+
+func (u ViewedUser) SyncKeys() map[string]string {
+	return map[string]string{
+		"brief": fmt.Sprintf("viewed_user:brief:%d", u.ID),
+		"full":  fmt.Sprintf("viewed_user:full:%d", u.ID),
+	}
+}
+
+func (u ViewedUser) SyncViews() map[string]any {
+	return map[string]any{
+		"brief": PublicUser{ID: u.ID, Name: u.Name},
+	}
+}
+
+func TestSync_Views(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+
+	user := ViewedUser{ID: 1, Name: "Ada", Email: "ada@example.com"}
+	assert.NoError(t, kvSync.Sync(user))
+	assert.Equal(t, PublicUser{ID: 1, Name: "Ada"}, store.Store["viewed_user:brief:1"])
+	assert.Equal(t, user, store.Store["viewed_user:full:1"])
+}
+
+type FilteredUser struct {
+	ID       int
+	TenantID int
+	Disabled bool
+}
+
+func (u FilteredUser) SyncKeys() map[string]string {
+	return map[string]string{
+		"id": fmt.Sprintf("filtered_user:id:%d", u.ID),
+	}
+}
+
+func (u FilteredUser) ShouldSync() bool {
+	return !u.Disabled
+}
+
+func TestSync_Filter(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+		Filter: func(entity any) bool {
+			user, ok := entity.(FilteredUser)
+			return !ok || user.TenantID != 2
+		},
+	})
+
+	assert.NoError(t, kvSync.Sync(FilteredUser{ID: 1, TenantID: 1}))
+	assert.NoError(t, kvSync.Sync(&FilteredUser{ID: 2, TenantID: 1, Disabled: true}))
+	assert.NoError(t, kvSync.Sync(FilteredUser{ID: 3, TenantID: 2}))
+
+	assert.Contains(t, store.Store, "filtered_user:id:1")
+	assert.NotContains(t, store.Store, "filtered_user:id:2", "models opt out with ShouldSync")
+	assert.NotContains(t, store.Store, "filtered_user:id:3", "entities are opted out by the Filter option")
+}
+
+type VersionedUser struct {
+	ID      int
+	Name    string
+	Version int64
+}
+
+func (u VersionedUser) SyncKeys() map[string]string {
+	return map[string]string{
+		"id": fmt.Sprintf("versioned_user:id:%d", u.ID),
+	}
+}
+
+func (u VersionedUser) SyncVersion() int64 {
+	return u.Version
+}
+
+func TestSync_Versioning(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:              store,
+		VersionByUpdatedAt: true,
+	})
+
+	assert.NoError(t, kvSync.Sync(VersionedUser{ID: 1, Name: "v2", Version: 2}))
+	assert.NoError(t, kvSync.Sync(VersionedUser{ID: 1, Name: "v1", Version: 1}))
+
+	fetched := VersionedUser{ID: 1}
+	assert.NoError(t, kvSync.Fetch(&fetched, "id"))
+	assert.Equal(t, "v2", fetched.Name)
+
+	now := time.Now()
+	newer := SyncedUser{Model: gorm.Model{ID: 1, UpdatedAt: now}, Username: "newer"}
+	older := SyncedUser{Model: gorm.Model{ID: 1, UpdatedAt: now.Add(-time.Second)}, Username: "older"}
+	assert.NoError(t, kvSync.Sync(newer))
+	assert.NoError(t, kvSync.Sync(older))
+
+	fetchedUser := SyncedUser{Model: gorm.Model{ID: 1}}
+	assert.NoError(t, kvSync.Fetch(&fetchedUser, "id"))
+	assert.Equal(t, "newer", fetchedUser.Username)
+}
+
+type erroneousStore struct{}
+
+func (e erroneousStore) Put(key string, value any) error {
+	return errors.New("put error")
+}
+
+func (e erroneousStore) Fetch(key string, dest any) error {
+	return errors.New("fetch error")
+}
+
+func (e erroneousStore) Delete(key string) error {
+	return errors.New("delete error")
+}
+
+func TestErrorRate_AutoDisable(t *testing.T) {
+	var disabledModel string
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: erroneousStore{},
+		ErrorRate: kvsync.ErrorRateOptions{
+			Threshold:  0.5,
+			MinSamples: 3,
+			DisabledCallback: func(model string, errorRate float64) {
+				disabledModel = model
+			},
+		},
+	})
+
+	assert.NoError(t, kvSync.Sync(&SyncedUser{UUID: "test-uuid"}))
+	assert.Equal(t, "kvsync_test.SyncedUser", disabledModel)
+	assert.Error(t, kvSync.Sync(&SyncedUser{UUID: "test-uuid"}))
+
+	enabler, ok := kvSync.(kvsync.ModelEnabler)
+	assert.True(t, ok)
+	enabler.EnableModel(SyncedUser{})
+	assert.NoError(t, kvSync.Sync(&SyncedUser{UUID: "test-uuid"}))
 }
 
 func setUpDB() *gorm.DB {
@@ -204,3 +705,255 @@ func tearDownDB(db *gorm.DB) {
 		_ = conn.Close()
 	}
 }
+
+func TestGormCallback_TraceID(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	reports := make(chan kvsync.Report, 6)
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	if err := db.Callback().Create().After("gorm:create").Register("kvsync:create", kvSync.GormCallback()); err != nil {
+		t.Fatal("failed to register gorm:create callback", err)
+	}
+
+	ctx := kvsync.WithTraceID(context.Background(), "trace-1")
+	db.WithContext(ctx).Create(&SyncedUser{UUID: "trace-uuid-1", Username: "trace-username-1"})
+
+	for i := 0; i < 3; i++ {
+		select {
+		case r := <-reports:
+			assert.Equal(t, "trace-1", r.TraceID)
+		case <-time.After(time.Second):
+			t.Fatal("no report received")
+		}
+	}
+
+	db.Create(&SyncedUser{UUID: "trace-uuid-2", Username: "trace-username-2"})
+
+	traceIDs := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		select {
+		case r := <-reports:
+			traceIDs[r.TraceID] = true
+		case <-time.After(time.Second):
+			t.Fatal("no report received")
+		}
+	}
+
+	assert.Len(t, traceIDs, 1, "the keys of one statement share a generated trace ID")
+	assert.NotContains(t, traceIDs, "")
+	assert.NotContains(t, traceIDs, "trace-1")
+}
+
+func TestReports_Subscribers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var mutex sync.Mutex
+	var metrics, audit []string
+
+	kvSync := kvsync.NewKVSync(ctx, kvsync.Options{
+		Store: &kvsync.InMemoryStore{
+			Store: make(map[string]any),
+		},
+		ReportCallback: func(r kvsync.Report) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			metrics = append(metrics, r.Key)
+		},
+	})
+	kvSync.Subscribe(func(r kvsync.Report) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		audit = append(audit, r.Key)
+	})
+	reports := kvSync.Reports()
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+	assert.NoError(t, db.Create(&SyncedUser{UUID: "subscribed-uuid"}).Error)
+
+	var keys []string
+	for len(keys) < 3 {
+		select {
+		case r := <-reports:
+			keys = append(keys, r.Key)
+		case <-time.After(time.Second):
+			t.Fatal("no report received")
+		}
+	}
+
+	mutex.Lock()
+	assert.ElementsMatch(t, keys, metrics)
+	assert.ElementsMatch(t, keys, audit)
+	mutex.Unlock()
+
+	cancel()
+	select {
+	case _, ok := <-reports:
+		assert.False(t, ok, "the channel is closed once the context is done")
+	case <-time.After(time.Second):
+		t.Fatal("the channel was not closed")
+	}
+}
+
+type blockingPutStore struct {
+	kvsync.InMemoryStore
+	release chan struct{}
+}
+
+func (b *blockingPutStore) Put(key string, value any) error {
+	<-b.release
+	return b.InMemoryStore.Put(key, value)
+}
+
+func TestGormCallback_SkippedReports(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &blockingPutStore{InMemoryStore: kvsync.InMemoryStore{Store: make(map[string]any)}, release: make(chan struct{})}
+	reports := make(chan kvsync.Report, 10)
+	kvSync := kvsync.NewKVSync(ctx, kvsync.Options{
+		Store:          store,
+		Workers:        1,
+		QueueSize:      1,
+		EnqueueTimeout: 50 * time.Millisecond,
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+
+	receive := func() kvsync.Report {
+		select {
+		case r := <-reports:
+			return r
+		case <-time.After(time.Second):
+			t.Fatal("no report received")
+		}
+		return kvsync.Report{}
+	}
+
+	assert.NoError(t, db.Create(&UnsyncedUser{}).Error)
+	r := receive()
+	assert.ErrorIs(t, r.Err, kvsync.ErrNotSyncable)
+	assert.Equal(t, kvsync.OperationCreate, r.Operation)
+
+	// the worker blocks on the first user and the second one fills the queue
+	assert.NoError(t, db.Create(&SyncedUser{UUID: "queued-1"}).Error)
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, db.Create(&SyncedUser{UUID: "queued-2"}).Error)
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, db.Create(&SyncedUser{UUID: "dropped"}).Error)
+
+	r = receive()
+	assert.ErrorIs(t, r.Err, kvsync.ErrQueueFull)
+	assert.Equal(t, "dropped", r.Model.(SyncedUser).UUID)
+
+	close(store.release)
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, receive().Err)
+	}
+}
+
+type panickingStore struct {
+	kvsync.InMemoryStore
+}
+
+func (p *panickingStore) Put(key string, value any) error {
+	if strings.Contains(key, "panic") {
+		panic("unexpected value")
+	}
+	return p.InMemoryStore.Put(key, value)
+}
+
+func TestWorkers_PanicRecovery(t *testing.T) {
+	reports := make(chan kvsync.Report, 10)
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:   &panickingStore{InMemoryStore: kvsync.InMemoryStore{Store: make(map[string]any)}},
+		Workers: 1,
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+
+	receive := func() kvsync.Report {
+		select {
+		case r := <-reports:
+			return r
+		case <-time.After(time.Second):
+			t.Fatal("no report received")
+		}
+		return kvsync.Report{}
+	}
+
+	assert.NoError(t, db.Create(&SyncedUser{UUID: "panic"}).Error)
+	for i := 0; i < 3; i++ {
+		var panicErr *kvsync.PanicError
+		assert.ErrorAs(t, receive().Err, &panicErr)
+		assert.Equal(t, "unexpected value", panicErr.Value)
+		assert.EqualError(t, panicErr, "sync panicked: unexpected value")
+		assert.NotEmpty(t, panicErr.Stack)
+	}
+
+	assert.NoError(t, db.Create(&SyncedUser{UUID: "calm"}).Error)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, receive().Err, "the worker is still running")
+	}
+}
+
+func TestSyncAndWait(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+	reports := make(chan kvsync.Report, 10)
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+
+	ctx := kvsync.WithTraceID(context.Background(), "wait-trace")
+	assert.NoError(t, kvSync.SyncAndWait(ctx, &SyncedUser{UUID: "awaited", Username: "fresh"}))
+
+	fetched := SyncedUser{UUID: "awaited"}
+	assert.NoError(t, kvSync.Fetch(&fetched, "uuid"))
+	assert.Equal(t, "fresh", fetched.Username)
+
+	for i := 0; i < 3; i++ {
+		r := <-reports
+		assert.Equal(t, "wait-trace", r.TraceID)
+		assert.Equal(t, kvsync.OperationManual, r.Operation)
+	}
+
+	assert.ErrorIs(t, kvSync.SyncAndWait(ctx, &UnsyncedUser{}), kvsync.ErrNotSyncable)
+
+	failing := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: &erroneousStore{},
+	})
+	assert.Error(t, failing.SyncAndWait(context.Background(), &SyncedUser{UUID: "failed"}))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: &blockingPutStore{InMemoryStore: kvsync.InMemoryStore{Store: make(map[string]any)}},
+	}).SyncAndWait(canceled, &SyncedUser{UUID: "canceled"}), context.Canceled)
+}
@@ -0,0 +1,311 @@
+// Package kvsynctest provides helpers for testing code built on kvsync
+package kvsynctest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Record is the value type used by the conformance suite
+type Record struct {
+	ID   int
+	Name string
+	Tags []string
+}
+
+// ConformanceOptions tune the conformance suite to the store under test
+type ConformanceOptions struct {
+	// Advance lets TTLs elapse, defaults to time.Sleep. Stores backed by a fake clock, such as
+	// miniredis, should fast-forward it instead.
+	Advance func(d time.Duration)
+}
+
+// RunStoreConformance verifies that a KVStore behaves like the built-in stores, including failing with
+// kvsync.ErrKeyNotFound on misses and kvsync.ErrNotPointer on invalid destinations. Every subtest writes
+// under its own "conformance:" keys, so the store may be shared. Optional capabilities
+// (kvsync.Deleter, kvsync.TTLStore, kvsync.PrefixDeleter, kvsync.BatchStore, kvsync.BatchFetcher) are
+// tested when implemented.
+func RunStoreConformance(t *testing.T, store kvsync.KVStore) {
+	RunStoreConformanceWithOptions(t, store, ConformanceOptions{})
+}
+
+// RunStoreConformanceWithOptions is RunStoreConformance with options
+func RunStoreConformanceWithOptions(t *testing.T, store kvsync.KVStore, opts ConformanceOptions) {
+	runConformance(t, func() kvsync.KVStore {
+		return store
+	}, opts)
+}
+
+// RunConformanceTests is RunStoreConformance with a new store for every subtest, for stores that can't be
+// shared or must start empty
+func RunConformanceTests(t *testing.T, newStore func() kvsync.KVStore) {
+	RunConformanceTestsWithOptions(t, newStore, ConformanceOptions{})
+}
+
+// RunConformanceTestsWithOptions is RunConformanceTests with options
+func RunConformanceTestsWithOptions(t *testing.T, newStore func() kvsync.KVStore, opts ConformanceOptions) {
+	runConformance(t, newStore, opts)
+}
+
+func runConformance(t *testing.T, newStore func() kvsync.KVStore, opts ConformanceOptions) {
+	if opts.Advance == nil {
+		opts.Advance = time.Sleep
+	}
+
+	t.Run("put and fetch", func(t *testing.T) {
+		store := newStore()
+
+		want := Record{ID: 1, Name: "Alice", Tags: []string{"a", "b"}}
+
+		mustPut(t, store, "conformance:put:1", want)
+
+		var got Record
+		if err := store.Fetch("conformance:put:1", &got); err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		assertRecord(t, want, got)
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		store := newStore()
+
+		mustPut(t, store, "conformance:overwrite:1", Record{ID: 1, Name: "Alice"})
+		mustPut(t, store, "conformance:overwrite:1", Record{ID: 1, Name: "Bob"})
+
+		var got Record
+		if err := store.Fetch("conformance:overwrite:1", &got); err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		assertRecord(t, Record{ID: 1, Name: "Bob"}, got)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		store := newStore()
+
+		var got Record
+		if err := store.Fetch("conformance:missing:1", &got); !errors.Is(err, kvsync.ErrKeyNotFound) {
+			t.Fatalf("Fetch of a missing key must fail with kvsync.ErrKeyNotFound, got %v", err)
+		}
+	})
+
+	t.Run("non-pointer destination", func(t *testing.T) {
+		store := newStore()
+
+		mustPut(t, store, "conformance:dest:1", Record{ID: 1})
+
+		if err := store.Fetch("conformance:dest:1", Record{}); !errors.Is(err, kvsync.ErrNotPointer) {
+			t.Fatalf("Fetch into a non-pointer must fail with kvsync.ErrNotPointer, got %v", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		store := newStore()
+
+		deleter, ok := store.(kvsync.Deleter)
+		if !ok {
+			t.Skip("store does not implement kvsync.Deleter")
+		}
+
+		mustPut(t, store, "conformance:delete:1", Record{ID: 1})
+		if err := deleter.Delete("conformance:delete:1"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		var got Record
+		if err := store.Fetch("conformance:delete:1", &got); !errors.Is(err, kvsync.ErrKeyNotFound) {
+			t.Fatalf("Fetch of a deleted key must fail with kvsync.ErrKeyNotFound, got %v", err)
+		}
+
+		if err := deleter.Delete("conformance:delete:missing"); err != nil {
+			t.Fatalf("Delete of a missing key must succeed: %v", err)
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		store := newStore()
+
+		ttlStore, ok := store.(kvsync.TTLStore)
+		if !ok {
+			t.Skip("store does not implement kvsync.TTLStore")
+		}
+
+		if err := ttlStore.PutWithTTL("conformance:ttl:1", Record{ID: 1}, time.Second); err != nil {
+			t.Fatalf("PutWithTTL: %v", err)
+		}
+
+		var got Record
+		if err := store.Fetch("conformance:ttl:1", &got); err != nil {
+			t.Fatalf("Fetch before expiration: %v", err)
+		}
+
+		opts.Advance(1500 * time.Millisecond)
+
+		if err := store.Fetch("conformance:ttl:1", &got); !errors.Is(err, kvsync.ErrKeyNotFound) {
+			t.Fatalf("Fetch of an expired key must fail with kvsync.ErrKeyNotFound, got %v", err)
+		}
+	})
+
+	t.Run("delete by prefix", func(t *testing.T) {
+		store := newStore()
+
+		deleter, ok := store.(kvsync.PrefixDeleter)
+		if !ok {
+			t.Skip("store does not implement kvsync.PrefixDeleter")
+		}
+
+		mustPut(t, store, "conformance:prefix:a:1", Record{ID: 1})
+		mustPut(t, store, "conformance:prefix:a:2", Record{ID: 2})
+		mustPut(t, store, "conformance:prefix:b:1", Record{ID: 3})
+
+		if err := deleter.DeleteByPrefix("conformance:prefix:a:"); err != nil {
+			t.Fatalf("DeleteByPrefix: %v", err)
+		}
+
+		var got Record
+		if err := store.Fetch("conformance:prefix:a:1", &got); err == nil {
+			t.Fatal("keys with the prefix must be deleted")
+		}
+		if err := store.Fetch("conformance:prefix:a:2", &got); err == nil {
+			t.Fatal("keys with the prefix must be deleted")
+		}
+		if err := store.Fetch("conformance:prefix:b:1", &got); err != nil {
+			t.Fatalf("keys without the prefix must be kept: %v", err)
+		}
+	})
+
+	t.Run("put batch", func(t *testing.T) {
+		store := newStore()
+
+		batchStore, ok := store.(kvsync.BatchStore)
+		if !ok {
+			t.Skip("store does not implement kvsync.BatchStore")
+		}
+
+		errs := batchStore.PutBatch([]kvsync.BatchEntry{
+			{Key: "conformance:batch:1", Value: Record{ID: 1}},
+			{Key: "conformance:batch:2", Value: Record{ID: 2}},
+		})
+		if len(errs) != 2 {
+			t.Fatalf("PutBatch must return one error per entry, got %d", len(errs))
+		}
+		for _, err := range errs {
+			if err != nil {
+				t.Fatalf("PutBatch: %v", err)
+			}
+		}
+
+		var got Record
+		if err := store.Fetch("conformance:batch:2", &got); err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		assertRecord(t, Record{ID: 2}, got)
+	})
+
+	t.Run("fetch batch", func(t *testing.T) {
+		store := newStore()
+
+		fetcher, ok := store.(kvsync.BatchFetcher)
+		if !ok {
+			t.Skip("store does not implement kvsync.BatchFetcher")
+		}
+
+		mustPut(t, store, "conformance:fetchbatch:1", Record{ID: 1})
+		mustPut(t, store, "conformance:fetchbatch:2", Record{ID: 2})
+
+		var first, second, missing Record
+		errs := fetcher.FetchBatch(
+			[]string{"conformance:fetchbatch:1", "conformance:fetchbatch:missing", "conformance:fetchbatch:2"},
+			[]any{&first, &missing, &second},
+		)
+		if len(errs) != 3 {
+			t.Fatalf("FetchBatch must return one error per key, got %d", len(errs))
+		}
+		if errs[0] != nil || errs[2] != nil {
+			t.Fatalf("FetchBatch: %v, %v", errs[0], errs[2])
+		}
+		if !errors.Is(errs[1], kvsync.ErrKeyNotFound) {
+			t.Fatalf("FetchBatch of a missing key must fail with kvsync.ErrKeyNotFound for that key only, got %v", errs[1])
+		}
+		assertRecord(t, Record{ID: 1}, first)
+		assertRecord(t, Record{ID: 2}, second)
+
+		errs = fetcher.FetchBatch([]string{"conformance:fetchbatch:1"}, nil)
+		if len(errs) != 1 || errs[0] == nil {
+			t.Fatal("FetchBatch with mismatched keys and destinations must fail")
+		}
+	})
+	t.Run("concurrent access", func(t *testing.T) {
+		store := newStore()
+
+		const writers, rounds, keys = 8, 50, 4
+
+		var wg sync.WaitGroup
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+
+				for i := 0; i < rounds; i++ {
+					id := i % keys
+					key := fmt.Sprintf("conformance:concurrent:%d", id)
+					name := fmt.Sprintf("writer-%d", w)
+
+					if err := store.Put(key, Record{ID: id, Name: name, Tags: []string{name, name}}); err != nil {
+						t.Errorf("concurrent Put: %v", err)
+						return
+					}
+
+					var got Record
+					err := store.Fetch(key, &got)
+					if errors.Is(err, kvsync.ErrKeyNotFound) {
+						continue
+					}
+					if err != nil {
+						t.Errorf("concurrent Fetch: %v", err)
+						return
+					}
+
+					// a value is written whole, never mixing the fields of concurrent writes
+					if got.ID != id || len(got.Tags) != 2 || got.Tags[0] != got.Name || got.Tags[1] != got.Name {
+						t.Errorf("concurrent Fetch returned a torn value %+v", got)
+						return
+					}
+
+					if deleter, ok := store.(kvsync.Deleter); ok && i%10 == 9 {
+						if err = deleter.Delete(key); err != nil {
+							t.Errorf("concurrent Delete: %v", err)
+							return
+						}
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+	})
+}
+
+func mustPut(t *testing.T, store kvsync.KVStore, key string, value any) {
+	t.Helper()
+
+	if err := store.Put(key, value); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+}
+
+func assertRecord(t *testing.T, want, got Record) {
+	t.Helper()
+
+	if want.ID != got.ID || want.Name != got.Name || len(want.Tags) != len(got.Tags) {
+		t.Fatalf("want %+v, got %+v", want, got)
+	}
+
+	for i := range want.Tags {
+		if want.Tags[i] != got.Tags[i] {
+			t.Fatalf("want %+v, got %+v", want, got)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package kvsynctest_test
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ndthuan/kvsync"
+	"github.com/ndthuan/kvsync/kvsynctest"
+	"github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+func TestRedisStore_Conformance(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	kvsynctest.RunStoreConformanceWithOptions(t, &kvsync.RedisStore{
+		Client: redis.NewClient(&redis.Options{Addr: s.Addr()}),
+	}, kvsynctest.ConformanceOptions{
+		Advance: s.FastForward,
+	})
+}
+
+func TestInMemoryStore_Conformance(t *testing.T) {
+	now := time.Now()
+
+	kvsynctest.RunConformanceTestsWithOptions(t, func() kvsync.KVStore {
+		return &kvsync.InMemoryStore{
+			Store: make(map[string]any),
+			Now: func() time.Time {
+				return now
+			},
+		}
+	}, kvsynctest.ConformanceOptions{
+		Advance: func(d time.Duration) {
+			now = now.Add(d)
+		},
+	})
+}
+
+func TestFakeStore_Conformance(t *testing.T) {
+	kvsynctest.RunConformanceTests(t, func() kvsync.KVStore {
+		return kvsynctest.NewFakeStore()
+	})
+}
@@ -0,0 +1,202 @@
+package kvsynctest
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"sync"
+	"time"
+)
+
+// Call is a call recorded by a FakeStore, Op being one of kvsync.OpFetch, kvsync.OpPut, kvsync.OpDelete,
+// kvsync.OpPing, kvsync.OpExists, kvsync.OpTTL, kvsync.OpTouch and kvsync.OpKeys, whose Key is the scanned
+// prefix
+type Call struct {
+	Op    string
+	Key   string
+	Value any
+	TTL   time.Duration
+	Err   error
+}
+
+// FakeStore is a KVStore keeping values in Memory and recording every call. Errors can be injected for
+// operations or keys, and Latency slows every call down. It is safe for concurrent use.
+type FakeStore struct {
+	Memory *kvsync.InMemoryStore
+	// Latency is waited before every call
+	Latency time.Duration
+
+	calls     []Call
+	nextErrs  map[string][]error
+	keyErrs   map[string]error
+	mutex     sync.Mutex
+	setUpOnce sync.Once
+}
+
+// NewFakeStore returns an empty FakeStore
+func NewFakeStore() *FakeStore {
+	return &FakeStore{Memory: &kvsync.InMemoryStore{Store: make(map[string]any)}}
+}
+
+func (f *FakeStore) Fetch(key string, dest any) error {
+	return f.call(Call{Op: kvsync.OpFetch, Key: key}, func() error {
+		return f.Memory.Fetch(key, dest)
+	})
+}
+
+func (f *FakeStore) Put(key string, value any) error {
+	return f.call(Call{Op: kvsync.OpPut, Key: key, Value: value}, func() error {
+		return f.Memory.Put(key, value)
+	})
+}
+
+func (f *FakeStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	return f.call(Call{Op: kvsync.OpPut, Key: key, Value: value, TTL: ttl}, func() error {
+		return f.Memory.PutWithTTL(key, value, ttl)
+	})
+}
+
+func (f *FakeStore) Delete(key string) error {
+	return f.call(Call{Op: kvsync.OpDelete, Key: key}, func() error {
+		return f.Memory.Delete(key)
+	})
+}
+
+func (f *FakeStore) Exists(key string) (found bool, err error) {
+	err = f.call(Call{Op: kvsync.OpExists, Key: key}, func() error {
+		found, err = f.Memory.Exists(key)
+		return err
+	})
+
+	return found, err
+}
+
+func (f *FakeStore) TTL(key string) (ttl time.Duration, err error) {
+	err = f.call(Call{Op: kvsync.OpTTL, Key: key}, func() error {
+		ttl, err = f.Memory.TTL(key)
+		return err
+	})
+
+	return ttl, err
+}
+
+func (f *FakeStore) Touch(key string, ttl time.Duration) error {
+	return f.call(Call{Op: kvsync.OpTouch, Key: key, TTL: ttl}, func() error {
+		return f.Memory.Touch(key, ttl)
+	})
+}
+
+func (f *FakeStore) Keys(prefix string, limit int, cursor string) (keys []string, next string, err error) {
+	err = f.call(Call{Op: kvsync.OpKeys, Key: prefix}, func() error {
+		keys, next, err = f.Memory.Keys(prefix, limit, cursor)
+		return err
+	})
+
+	return keys, next, err
+}
+
+func (f *FakeStore) Ping(ctx context.Context) error {
+	return f.call(Call{Op: kvsync.OpPing}, func() error {
+		return f.Memory.Ping(ctx)
+	})
+}
+
+// FailNext makes the next calls of an operation fail with errs, one call per error
+func (f *FakeStore) FailNext(op string, errs ...error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.nextErrs == nil {
+		f.nextErrs = make(map[string][]error)
+	}
+	f.nextErrs[op] = append(f.nextErrs[op], errs...)
+}
+
+// FailKey makes every call on a key fail with err, until FailKey is called again with a nil error
+func (f *FakeStore) FailKey(key string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.keyErrs == nil {
+		f.keyErrs = make(map[string]error)
+	}
+
+	if err == nil {
+		delete(f.keyErrs, key)
+	} else {
+		f.keyErrs[key] = err
+	}
+}
+
+// Calls returns the calls recorded so far, optionally only those of the given operations
+func (f *FakeStore) Calls(ops ...string) []Call {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	calls := make([]Call, 0, len(f.calls))
+	for _, c := range f.calls {
+		if len(ops) == 0 || containsOp(ops, c.Op) {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+// Reset forgets the recorded calls and injected errors, keeping the values
+func (f *FakeStore) Reset() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.calls = nil
+	f.nextErrs = nil
+	f.keyErrs = nil
+}
+
+func (f *FakeStore) call(c Call, op func() error) error {
+	f.setUpOnce.Do(func() {
+		if f.Memory == nil {
+			f.Memory = &kvsync.InMemoryStore{Store: make(map[string]any)}
+		}
+	})
+
+	if f.Latency > 0 {
+		time.Sleep(f.Latency)
+	}
+
+	c.Err = f.injectedErr(c)
+	if c.Err == nil {
+		c.Err = op()
+	}
+
+	f.mutex.Lock()
+	f.calls = append(f.calls, c)
+	f.mutex.Unlock()
+
+	return c.Err
+}
+
+func (f *FakeStore) injectedErr(c Call) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err, ok := f.keyErrs[c.Key]; ok && c.Key != "" {
+		return err
+	}
+
+	if errs := f.nextErrs[c.Op]; len(errs) > 0 {
+		f.nextErrs[c.Op] = errs[1:]
+		return errs[0]
+	}
+
+	return nil
+}
+
+func containsOp(ops []string, op string) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,50 @@
+package kvsynctest_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ndthuan/kvsync"
+	"github.com/ndthuan/kvsync/kvsynctest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFakeStore(t *testing.T) {
+	store := kvsynctest.NewFakeStore()
+	errDown := errors.New("down")
+
+	assert.NoError(t, store.Put("record:1", kvsynctest.Record{ID: 1}))
+	assert.NoError(t, store.PutWithTTL("record:2", kvsynctest.Record{ID: 2}, time.Minute))
+
+	store.FailNext(kvsync.OpFetch, errDown)
+	var record kvsynctest.Record
+	assert.ErrorIs(t, store.Fetch("record:1", &record), errDown)
+	assert.NoError(t, store.Fetch("record:1", &record))
+	assert.Equal(t, kvsynctest.Record{ID: 1}, record)
+
+	store.FailKey("record:2", errDown)
+	assert.ErrorIs(t, store.Delete("record:2"), errDown)
+	assert.ErrorIs(t, store.Fetch("record:2", &record), errDown)
+	store.FailKey("record:2", nil)
+	assert.NoError(t, store.Delete("record:2"))
+	assert.NoError(t, store.Ping(context.Background()))
+
+	assert.Equal(t, []kvsynctest.Call{
+		{Op: kvsync.OpPut, Key: "record:1", Value: kvsynctest.Record{ID: 1}},
+		{Op: kvsync.OpPut, Key: "record:2", Value: kvsynctest.Record{ID: 2}, TTL: time.Minute},
+	}, store.Calls(kvsync.OpPut))
+	assert.Len(t, store.Calls(), 8)
+	assert.Equal(t, errDown, store.Calls(kvsync.OpDelete)[0].Err)
+
+	store.Reset()
+	assert.Empty(t, store.Calls())
+}
+
+func TestFakeStore_Latency(t *testing.T) {
+	store := &kvsynctest.FakeStore{Latency: 20 * time.Millisecond}
+
+	started := time.Now()
+	assert.NoError(t, store.Put("record:1", kvsynctest.Record{ID: 1}))
+	assert.GreaterOrEqual(t, time.Since(started), 20*time.Millisecond)
+}
@@ -0,0 +1,49 @@
+package kvsynctest
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"os"
+	"testing"
+)
+
+// LoadFixtures puts values into a store by key, failing the test on errors
+func LoadFixtures(t testing.TB, store kvsync.KVStore, fixtures map[string]any) {
+	t.Helper()
+
+	for key, value := range fixtures {
+		if err := store.Put(key, value); err != nil {
+			t.Fatalf("cannot load fixture %s: %v", key, err)
+		}
+	}
+}
+
+// LoadSnapshotFile returns an InMemoryStore loaded from a file written by InMemoryStore.SaveSnapshot, failing
+// the test on errors. The models of its values must be registered with kvsync.RegisterModel.
+func LoadSnapshotFile(t testing.TB, path string) *kvsync.InMemoryStore {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("cannot open snapshot: %v", err)
+	}
+	defer f.Close()
+
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	if err = store.LoadSnapshot(f); err != nil {
+		t.Fatalf("cannot load snapshot %s: %v", path, err)
+	}
+
+	return store
+}
+
+// SyncFixtures syncs entities one by one with SyncAndWait, failing the test on errors
+func SyncFixtures(t testing.TB, kvSync kvsync.KVSync, entities ...any) {
+	t.Helper()
+
+	for _, entity := range entities {
+		if err := kvSync.SyncAndWait(context.Background(), entity); err != nil {
+			t.Fatalf("cannot sync %s fixture: %v", kvsync.ModelName(entity), err)
+		}
+	}
+}
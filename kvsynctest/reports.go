@@ -0,0 +1,132 @@
+package kvsynctest
+
+import (
+	"github.com/ndthuan/kvsync"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ReportCollector collects the reports of a KVSync, to wait for syncs in tests
+type ReportCollector struct {
+	// Timeout is how long Wait and WaitFor wait before failing the test, defaults to 5 seconds
+	Timeout time.Duration
+
+	reports []kvsync.Report
+	changed chan struct{}
+	mutex   sync.Mutex
+}
+
+// CollectReports subscribes a new ReportCollector to a KVSync
+func CollectReports(kvSync kvsync.KVSync) *ReportCollector {
+	c := &ReportCollector{}
+	kvSync.Subscribe(c.Collect)
+
+	return c
+}
+
+// Collect records a report, it can be passed as kvsync.Options.ReportCallback
+func (c *ReportCollector) Collect(r kvsync.Report) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.reports = append(c.reports, r)
+	if c.changed != nil {
+		close(c.changed)
+		c.changed = nil
+	}
+}
+
+// Reports returns the reports collected so far
+func (c *ReportCollector) Reports() []kvsync.Report {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]kvsync.Report(nil), c.reports...)
+}
+
+// Errors returns the reports collected so far that have an error
+func (c *ReportCollector) Errors() []kvsync.Report {
+	var failed []kvsync.Report
+	for _, r := range c.Reports() {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+
+	return failed
+}
+
+// Wait waits until at least n reports are collected and returns them, failing the test on timeout
+func (c *ReportCollector) Wait(t testing.TB, n int) []kvsync.Report {
+	t.Helper()
+
+	reports, ok := c.waitUntil(func(reports []kvsync.Report) bool {
+		return len(reports) >= n
+	})
+	if !ok {
+		t.Fatalf("timed out waiting for %d reports, got %d", n, len(reports))
+	}
+
+	return reports
+}
+
+// WaitFor waits until a report matches and returns it, failing the test on timeout
+func (c *ReportCollector) WaitFor(t testing.TB, match func(kvsync.Report) bool) kvsync.Report {
+	t.Helper()
+
+	var matched kvsync.Report
+	reports, ok := c.waitUntil(func(reports []kvsync.Report) bool {
+		for _, r := range reports {
+			if match(r) {
+				matched = r
+				return true
+			}
+		}
+
+		return false
+	})
+	if !ok {
+		t.Fatalf("timed out waiting for a matching report among %d", len(reports))
+	}
+
+	return matched
+}
+
+// Reset forgets the reports collected so far
+func (c *ReportCollector) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.reports = nil
+}
+
+func (c *ReportCollector) waitUntil(done func([]kvsync.Report) bool) ([]kvsync.Report, bool) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		c.mutex.Lock()
+		reports := append([]kvsync.Report(nil), c.reports...)
+		if done(reports) {
+			c.mutex.Unlock()
+			return reports, true
+		}
+
+		if c.changed == nil {
+			c.changed = make(chan struct{})
+		}
+		changed := c.changed
+		c.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return reports, false
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package kvsynctest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/ndthuan/kvsync/kvsynctest"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type Article struct {
+	ID    int
+	Title string
+}
+
+func (a Article) SyncKeys() map[string]string {
+	return map[string]string{
+		"id":    fmt.Sprintf("article:%d", a.ID),
+		"title": fmt.Sprintf("article:title:%s", a.Title),
+	}
+}
+
+func TestReportCollector(t *testing.T) {
+	store := kvsynctest.NewFakeStore()
+	store.FailKey("article:title:broken", errors.New("down"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kvSync := kvsync.NewKVSync(ctx, kvsync.Options{Store: store})
+	reports := kvsynctest.CollectReports(kvSync)
+
+	assert.NoError(t, kvSync.SyncAndWait(ctx, &Article{ID: 1, Title: "hello"}))
+	assert.Len(t, reports.Wait(t, 2), 2)
+
+	assert.Error(t, kvSync.SyncAndWait(ctx, &Article{ID: 2, Title: "broken"}))
+	failed := reports.WaitFor(t, func(r kvsync.Report) bool {
+		return r.Err != nil
+	})
+	assert.Equal(t, "article:title:broken", failed.Key)
+
+	reports.Wait(t, 4)
+	assert.Len(t, reports.Errors(), 1)
+
+	reports.Reset()
+	assert.Empty(t, reports.Reports())
+}
+
+func TestFixtures(t *testing.T) {
+	kvsync.RegisterModel[kvsynctest.Record]()
+
+	source := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	kvsynctest.LoadFixtures(t, source, map[string]any{
+		"record:1": kvsynctest.Record{ID: 1, Name: "one"},
+		"record:2": kvsynctest.Record{ID: 2, Tags: []string{"a"}},
+	})
+
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, source.SaveSnapshot(f))
+	assert.NoError(t, f.Close())
+
+	store := kvsynctest.LoadSnapshotFile(t, path)
+	assert.Equal(t, source.Store, store.Store)
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store})
+	kvsynctest.SyncFixtures(t, kvSync, &Article{ID: 3, Title: "fixture"})
+
+	var article Article
+	assert.NoError(t, store.Fetch("article:3", &article))
+	assert.Equal(t, Article{ID: 3, Title: "fixture"}, article)
+}
@@ -0,0 +1,51 @@
+package kvsync
+
+// LegacyKeyer is an optional interface for models migrating to a new key naming scheme, e.g. from
+// "user:uuid:<uuid>" to "usr:u:<uuid>". SyncKeys returns the new keys, which all writes go to, and
+// SyncLegacyKeys the old keys by the same key names, which Fetch falls back to on a miss until
+// MigrateLegacyKeys, typically run by a Backfiller, has rewritten every entity.
+type LegacyKeyer interface {
+	SyncLegacyKeys() map[string]string
+}
+
+// legacyKey returns the legacy key of a model by key name
+func legacyKey(model any, keyName string) (string, bool) {
+	legacyKeyer, ok := model.(LegacyKeyer)
+	if !ok {
+		return "", false
+	}
+
+	key, ok := legacyKeyer.SyncLegacyKeys()[keyName]
+
+	return key, ok && key != ""
+}
+
+// MigrateLegacyKeys syncs an entity under its new keys, then deletes its legacy keys
+func (k *kvSync) MigrateLegacyKeys(entity any) error {
+	if err := k.Sync(entity); err != nil {
+		return err
+	}
+
+	legacyKeyer, ok := resolvePointer(entity).(LegacyKeyer)
+	if !ok || k.dryRun {
+		return nil
+	}
+
+	specs, _ := syncKeySpecs(resolvePointer(entity))
+	current := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		current[spec.Key] = true
+	}
+
+	for _, key := range legacyKeyer.SyncLegacyKeys() {
+		if key == "" || current[key] {
+			continue
+		}
+
+		if err := deleteKey(k.store, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package kvsync_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type RenamedKeyUser struct {
+	ID       uint
+	UUID     string
+	Username string
+}
+
+func (u RenamedKeyUser) SyncKeys() map[string]string {
+	return map[string]string{
+		"uuid": fmt.Sprintf("usr:u:%s", u.UUID),
+	}
+}
+
+func (u RenamedKeyUser) SyncLegacyKeys() map[string]string {
+	return map[string]string{
+		"uuid": fmt.Sprintf("user:uuid:%s", u.UUID),
+	}
+}
+
+func TestFetch_LegacyKeys(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store})
+
+	// written before the key naming scheme changed
+	assert.NoError(t, store.Put("user:uuid:legacy", RenamedKeyUser{ID: 1, UUID: "legacy", Username: "old"}))
+
+	fetched := RenamedKeyUser{UUID: "legacy"}
+	assert.NoError(t, kvSync.Fetch(&fetched, "uuid"))
+	assert.Equal(t, "old", fetched.Username)
+
+	assert.NoError(t, kvSync.Sync(&RenamedKeyUser{ID: 1, UUID: "legacy", Username: "new"}))
+	assert.Contains(t, store.Store, "usr:u:legacy")
+
+	fetched = RenamedKeyUser{UUID: "legacy"}
+	assert.NoError(t, kvSync.Fetch(&fetched, "uuid"))
+	assert.Equal(t, "new", fetched.Username, "new keys are read first")
+
+	assert.Error(t, kvSync.Fetch(&RenamedKeyUser{UUID: "missing"}, "uuid"))
+}
+
+func TestExists_LegacyKeys(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store})
+
+	assert.NoError(t, store.Put("user:uuid:legacy", RenamedKeyUser{ID: 1, UUID: "legacy"}))
+
+	found, err := kvSync.Exists(RenamedKeyUser{UUID: "legacy"}, "uuid")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = kvSync.Exists(RenamedKeyUser{UUID: "missing"}, "uuid")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store})
+
+	assert.NoError(t, store.Put("user:uuid:legacy", RenamedKeyUser{ID: 1, UUID: "legacy", Username: "old"}))
+
+	assert.NoError(t, kvSync.MigrateLegacyKeys(&RenamedKeyUser{ID: 1, UUID: "legacy", Username: "old"}))
+	assert.Contains(t, store.Store, "usr:u:legacy")
+	assert.NotContains(t, store.Store, "user:uuid:legacy")
+
+	fetched := RenamedKeyUser{UUID: "legacy"}
+	assert.NoError(t, kvSync.Fetch(&fetched, "uuid"))
+	assert.Equal(t, "old", fetched.Username)
+}
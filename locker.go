@@ -0,0 +1,70 @@
+package kvsync
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// tryLockScript acquires a lock, or extends it when already held by the same owner
+var tryLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// unlockScript releases a lock only when held by the same owner
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLocker is a Locker leasing locks with SET NX PX, so that locks of crashed replicas expire after their TTL.
+// Locks are owned by the RedisLocker that acquired them, which extends them when acquiring them again.
+type RedisLocker struct {
+	Client redis.Cmdable
+	// Prefix is prepended to lock names, defaults to "kvsync:lock:"
+	Prefix string
+	// Owner identifies this replica as the lock holder, defaults to a random ID
+	Owner string
+
+	once sync.Once
+}
+
+func (l *RedisLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	locked, err := tryLockScript.Run(ctx, l.Client, []string{l.key(name)}, l.owner(), ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, redisError(l.key(name), err)
+	}
+
+	return locked == 1, nil
+}
+
+func (l *RedisLocker) Unlock(ctx context.Context, name string) error {
+	return redisError(l.key(name), unlockScript.Run(ctx, l.Client, []string{l.key(name)}, l.owner()).Err())
+}
+
+func (l *RedisLocker) key(name string) string {
+	if l.Prefix == "" {
+		return "kvsync:lock:" + name
+	}
+
+	return l.Prefix + name
+}
+
+func (l *RedisLocker) owner() string {
+	l.once.Do(func() {
+		if l.Owner == "" {
+			l.Owner = newTraceID()
+		}
+	})
+
+	return l.Owner
+}
@@ -0,0 +1,86 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRedisLocker(t *testing.T) {
+	store, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	ctx := context.Background()
+	replica1 := &kvsync.RedisLocker{Client: store.Client, Owner: "replica-1"}
+	replica2 := &kvsync.RedisLocker{Client: redis.NewClient(&redis.Options{Addr: miniRedis.Addr()})}
+
+	locked, err := replica1.TryLock(ctx, "resync", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, locked)
+
+	locked, err = replica2.TryLock(ctx, "resync", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, locked)
+
+	// the holder renews its lease
+	miniRedis.FastForward(30 * time.Second)
+	locked, err = replica1.TryLock(ctx, "resync", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, locked)
+	assert.Equal(t, time.Minute, miniRedis.TTL("kvsync:lock:resync"))
+
+	// only the holder releases the lock
+	assert.NoError(t, replica2.Unlock(ctx, "resync"))
+	assert.True(t, miniRedis.Exists("kvsync:lock:resync"))
+	assert.NoError(t, replica1.Unlock(ctx, "resync"))
+
+	locked, err = replica2.TryLock(ctx, "resync", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, locked)
+
+	// leases of crashed replicas expire
+	miniRedis.FastForward(time.Minute)
+	locked, err = replica1.TryLock(ctx, "resync", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, locked)
+}
+
+func TestBackfiller_Locker(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Create(&SyncedUser{UUID: "locked-uuid"}).Error)
+
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	backfiller := &kvsync.Backfiller{
+		DB: db,
+		KVSync: kvsync.NewKVSync(context.Background(), kvsync.Options{
+			Store: store,
+		}),
+		Store:  store,
+		Locker: &kvsync.RedisLocker{Client: redisStore.Client, Owner: "replica-1"},
+	}
+
+	other := &kvsync.RedisLocker{Client: redisStore.Client, Owner: "replica-2"}
+	locked, err := other.TryLock(context.Background(), "backfill:lock:job:locked-job", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, locked)
+
+	_, err = backfiller.Start(context.Background(), "locked-job", &SyncedUser{})
+	assert.ErrorIs(t, err, kvsync.ErrLocked)
+
+	assert.NoError(t, other.Unlock(context.Background(), "backfill:lock:job:locked-job"))
+
+	checkpoint, err := backfiller.Start(context.Background(), "locked-job", &SyncedUser{})
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.BackfillCompleted, checkpoint.Status)
+	assert.False(t, miniRedis.Exists("kvsync:lock:backfill:lock:job:locked-job"), "the lock is released")
+}
@@ -1,47 +1,349 @@
 package kvsync
 
 import (
-	"fmt"
+	"container/list"
+	"context"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
-// InMemoryStore is an in-memory implementation of KVStore
+// InMemoryStore is an in-memory implementation of KVStore. Entries expire like in RedisStore: expired entries
+// are never served and RunJanitor evicts them from Store. Values are copied in and out, so that callers mutating
+// them can't corrupt the stored ones. With MaxEntries or MaxBytes, the least recently used
+// entries are evicted to stay within bounds.
 type InMemoryStore struct {
 	Store map[string]any
-	mutex sync.Mutex
+	// Expiration is the default TTL of entries, zero for none. Values implementing Expirable override it.
+	Expiration time.Duration
+	// Now returns the current time, defaults to time.Now
+	Now func() time.Time
+	// MaxEntries is the maximum number of entries, zero for no limit
+	MaxEntries int
+	// MaxBytes is the maximum estimated size of the keys and values, zero for no limit
+	MaxBytes int64
+	// Marshaler optionally serializes values as RedisStore does, so that tests catch serialization issues.
+	// Store then holds the serialized values.
+	Marshaler MarshalingAdapter
+
+	versions    map[string]int64
+	expirations map[string]time.Time
+	recency     *list.List
+	elements    map[string]*list.Element
+	sizes       map[string]int64
+	bytes       int64
+	mutex       sync.RWMutex
 }
 
-func copyFields(val interface{}, dest interface{}) error {
-	vVal := reflect.ValueOf(val)
-	vDest := reflect.ValueOf(dest)
+func (m *InMemoryStore) Fetch(key string, dest any) error {
+	if dest == nil || reflect.TypeOf(dest).Kind() != reflect.Ptr || reflect.ValueOf(dest).IsNil() {
+		return ErrNotPointer
+	}
+
+	val, ok := m.load(key)
+	if !ok {
+		return &keyNotFoundError{key: key}
+	}
 
-	vDest = vDest.Elem()
+	if data, ok := val.([]byte); ok && m.Marshaler != nil {
+		if err := decodeValue(data, dest, m.Marshaler); err != nil {
+			return &MarshalError{Key: key, Unmarshal: true, Err: err}
+		}
 
-	for i := 0; i < vDest.NumField(); i++ {
-		vDest.Field(i).Set(vVal.Field(i))
+		return nil
 	}
 
-	return nil
+	return assign(deepCopy(val), dest)
 }
 
-func (m *InMemoryStore) Fetch(key string, dest any) error {
+// FetchAny returns a copy of the stored value, decoding it when the Marshaler writes envelopes
+func (m *InMemoryStore) FetchAny(key string) (any, error) {
+	val, ok := m.load(key)
+	if !ok {
+		return nil, &keyNotFoundError{key: key}
+	}
+
+	if data, ok := val.([]byte); ok && m.Marshaler != nil {
+		return decodeAny(data, m.Marshaler)
+	}
+
+	return deepCopy(val), nil
+}
+
+// Exists checks the presence of an unexpired key, without counting as a use of it for eviction
+func (m *InMemoryStore) Exists(key string) (bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, ok := m.Store[key]
+
+	return ok && !m.expired(key, m.now()), nil
+}
+
+// TTL returns the time left before a key expires, zero if it doesn't
+func (m *InMemoryStore) TTL(key string) (time.Duration, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	now := m.now()
+	if _, ok := m.Store[key]; !ok || m.expired(key, now) {
+		return 0, &keyNotFoundError{key: key}
+	}
+
+	if expiresAt, ok := m.expirations[key]; ok {
+		return expiresAt.Sub(now), nil
+	}
+
+	return 0, nil
+}
+
+// Touch makes a key expire after ttl, or InMemoryStore.Expiration when ttl is not positive
+func (m *InMemoryStore) Touch(key string, ttl time.Duration) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	val, ok := m.Store[key]
-	if !ok {
-		return fmt.Errorf("key %s not found", key)
+	if _, ok := m.get(key); !ok {
+		return &keyNotFoundError{key: key}
+	}
+
+	if ttl <= 0 {
+		ttl = m.Expiration
+	}
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = m.now().Add(ttl)
 	}
+	m.expireAt(key, expiresAt)
 
-	return copyFields(val, dest)
+	return nil
 }
 
 func (m *InMemoryStore) Put(key string, value any) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	m.Store[key] = value
+	return m.put(key, value, m.expiration(value))
+}
+
+// PutWithTTL stores a value with an expiration overriding both InMemoryStore.Expiration and Expirable
+func (m *InMemoryStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.put(key, value, ttl)
+}
+
+func (m *InMemoryStore) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.remove(key)
+
+	return nil
+}
+
+// PutIfNewer stores a value unless the stored version is higher, expiring after ttl or the default expiration
+func (m *InMemoryStore) PutIfNewer(key string, value any, version int64, ttl time.Duration) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.get(key); ok && m.versions[key] > version {
+		return false, nil
+	}
+
+	if m.versions == nil {
+		m.versions = make(map[string]int64)
+	}
+
+	if ttl <= 0 {
+		ttl = m.expiration(value)
+	}
+
+	if err := m.put(key, value, ttl); err != nil {
+		return false, err
+	}
+	m.versions[key] = version
+
+	return true, nil
+}
+
+func (m *InMemoryStore) DeleteByPrefix(prefix string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key := range m.Store {
+		if strings.HasPrefix(key, prefix) {
+			m.remove(key)
+		}
+	}
+
+	return nil
+}
+
+// Keys returns up to limit keys starting with prefix in lexical order, the cursor being the last key returned
+func (m *InMemoryStore) Keys(prefix string, limit int, cursor string) ([]string, string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if limit < 1 {
+		limit = 100
+	}
+
+	keys := make([]string, 0)
+	now := m.now()
+	for key := range m.Store {
+		if strings.HasPrefix(key, prefix) && key > cursor && !m.expired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	if len(keys) <= limit {
+		return keys, "", nil
+	}
+
+	return keys[:limit], keys[limit-1], nil
+}
+
+// RunJanitor evicts expired entries every interval until ctx is done, expired entries being otherwise kept
+// in Store until read
+func (m *InMemoryStore) RunJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.EvictExpired()
+		}
+	}
+}
+
+// EvictExpired deletes the expired entries, returning how many were
+func (m *InMemoryStore) EvictExpired() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	evicted := 0
+	now := m.now()
+	for key := range m.expirations {
+		if m.expired(key, now) {
+			m.remove(key)
+			evicted++
+		}
+	}
+
+	return evicted
+}
+
+// load returns the value of a key unless it expired. Stored values are never mutated, so callers may copy them
+// without holding the lock. Concurrent loads only block each other when reads reorder the LRU list.
+func (m *InMemoryStore) load(key string) (any, bool) {
+	if m.MaxEntries > 0 || m.MaxBytes > 0 {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		return m.get(key)
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.expired(key, m.now()) {
+		return nil, false
+	}
+
+	val, ok := m.Store[key]
+
+	return val, ok
+}
+
+// get returns the value of a key unless it expired, evicting it then
+func (m *InMemoryStore) get(key string) (any, bool) {
+	if m.expired(key, m.now()) {
+		m.remove(key)
+		return nil, false
+	}
+
+	val, ok := m.Store[key]
+	if ok {
+		m.touch(key)
+	}
+
+	return val, ok
+}
+
+func (m *InMemoryStore) put(key string, value any, ttl time.Duration) error {
+	stored := deepCopy(value)
+	if m.Marshaler != nil {
+		data, err := encodeValue(value, m.Marshaler)
+		if err != nil {
+			return &MarshalError{Key: key, Err: err}
+		}
+		stored = data
+	}
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = m.now().Add(ttl)
+	}
+	m.set(key, stored, expiresAt)
 
 	return nil
 }
+
+// set stores a value as is, expiring at expiresAt unless it is zero
+func (m *InMemoryStore) set(key string, stored any, expiresAt time.Time) {
+	m.Store[key] = stored
+	m.touch(key)
+	m.resize(key, stored)
+	m.expireAt(key, expiresAt)
+	m.evict()
+}
+
+// expireAt sets the expiration of a key, removing it when expiresAt is zero
+func (m *InMemoryStore) expireAt(key string, expiresAt time.Time) {
+	if expiresAt.IsZero() {
+		delete(m.expirations, key)
+		return
+	}
+
+	if m.expirations == nil {
+		m.expirations = make(map[string]time.Time)
+	}
+	m.expirations[key] = expiresAt
+}
+
+func (m *InMemoryStore) remove(key string) {
+	delete(m.Store, key)
+	delete(m.versions, key)
+	delete(m.expirations, key)
+	m.forget(key)
+}
+
+func (m *InMemoryStore) expired(key string, now time.Time) bool {
+	expiresAt, ok := m.expirations[key]
+
+	return ok && !now.Before(expiresAt)
+}
+
+func (m *InMemoryStore) expiration(value any) time.Duration {
+	if e, ok := value.(Expirable); ok {
+		return e.SyncExpiration()
+	}
+
+	return m.Expiration
+}
+
+func (m *InMemoryStore) now() time.Time {
+	if m.Now == nil {
+		return time.Now()
+	}
+
+	return m.Now()
+}
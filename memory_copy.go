@@ -0,0 +1,155 @@
+package kvsync
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// deepCopy copies a value along with the pointers, slices, maps and interfaces it holds. Unexported fields,
+// channels and functions are copied shallowly.
+func deepCopy(value any) any {
+	if value == nil {
+		return nil
+	}
+
+	return copyValue(reflect.ValueOf(value), make(map[uintptr]reflect.Value)).Interface()
+}
+
+// copyValue deep copies v, copies maps the pointers already copied to their copies so that cycles terminate
+func copyValue(v reflect.Value, copies map[uintptr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+
+		if c, ok := copies[v.Pointer()]; ok {
+			return c
+		}
+
+		c := reflect.New(v.Type().Elem())
+		copies[v.Pointer()] = c
+		c.Elem().Set(copyValue(v.Elem(), copies))
+
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem(), copies))
+
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i), copies))
+		}
+
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i), copies))
+		}
+
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(copyValue(iter.Key(), copies), copyValue(iter.Value(), copies))
+		}
+
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i), copies))
+			}
+		}
+
+		return c
+	default:
+		return v
+	}
+}
+
+// assign sets the value dest points to. When their types differ, structs are copied field by field by name
+// like stores unmarshaling values do, following embedded structs.
+func assign(value any, dest any) error {
+	target := reflect.ValueOf(dest).Elem()
+
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr && !v.IsNil() && !v.Type().AssignableTo(target.Type()) {
+		v = v.Elem()
+	}
+
+	if v.Type().AssignableTo(target.Type()) {
+		target.Set(v)
+		return nil
+	}
+
+	if v.Kind() != reflect.Struct || target.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot fetch a %s into a %s", v.Type(), target.Type())
+	}
+
+	c := reflect.New(target.Type()).Elem()
+	if err := assignFields(v, c); err != nil {
+		return fmt.Errorf("cannot fetch a %s into a %s: %w", v.Type(), target.Type(), err)
+	}
+	target.Set(c)
+
+	return nil
+}
+
+func assignFields(src reflect.Value, dst reflect.Value) error {
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		srcField, ok := src.Type().FieldByName(field.Name)
+		if !ok {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				if err := assignFields(src, dst.Field(i)); err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		// fields promoted through nil embedded pointers or unexported embedded structs are left unset
+		value, err := src.FieldByIndexErr(srcField.Index)
+		if err != nil || !value.CanInterface() {
+			continue
+		}
+
+		if !value.Type().AssignableTo(field.Type) {
+			return fmt.Errorf("field %s is a %s, not a %s", field.Name, value.Type(), field.Type)
+		}
+
+		dst.Field(i).Set(value)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package kvsync
+
+import (
+	"container/list"
+	"reflect"
+)
+
+// touch marks a key as the most recently used
+func (m *InMemoryStore) touch(key string) {
+	if m.recency == nil {
+		m.recency = list.New()
+		m.elements = make(map[string]*list.Element)
+	}
+
+	if e, ok := m.elements[key]; ok {
+		m.recency.MoveToFront(e)
+		return
+	}
+
+	m.elements[key] = m.recency.PushFront(key)
+}
+
+// resize records the estimated size of an entry, only when MaxBytes is set
+func (m *InMemoryStore) resize(key string, value any) {
+	if m.MaxBytes <= 0 {
+		return
+	}
+
+	if m.sizes == nil {
+		m.sizes = make(map[string]int64)
+	}
+
+	size := int64(len(key)) + sizeOf(value)
+	m.bytes += size - m.sizes[key]
+	m.sizes[key] = size
+}
+
+func (m *InMemoryStore) forget(key string) {
+	if e, ok := m.elements[key]; ok {
+		m.recency.Remove(e)
+		delete(m.elements, key)
+	}
+
+	m.bytes -= m.sizes[key]
+	delete(m.sizes, key)
+}
+
+// evict removes the least recently used entries until the store is within MaxEntries and MaxBytes
+func (m *InMemoryStore) evict() {
+	for m.overflows() {
+		e := m.recency.Back()
+		if e == nil {
+			return
+		}
+
+		m.remove(e.Value.(string))
+	}
+}
+
+func (m *InMemoryStore) overflows() bool {
+	return m.MaxEntries > 0 && len(m.Store) > m.MaxEntries || m.MaxBytes > 0 && m.bytes > m.MaxBytes
+}
+
+// sizeOf estimates the memory held by a value, following pointers, slices, maps and interfaces
+func sizeOf(value any) int64 {
+	if value == nil {
+		return 0
+	}
+
+	v := reflect.ValueOf(value)
+
+	return int64(v.Type().Size()) + referencedSize(v, make(map[uintptr]struct{}))
+}
+
+// referencedSize is the size of the memory referenced by v, excluding v itself
+func referencedSize(v reflect.Value, seen map[uintptr]struct{}) int64 {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+
+		if v.Kind() == reflect.Ptr {
+			if _, ok := seen[v.Pointer()]; ok {
+				return 0
+			}
+			seen[v.Pointer()] = struct{}{}
+		}
+
+		elem := v.Elem()
+
+		return int64(elem.Type().Size()) + referencedSize(elem, seen)
+	case reflect.Slice:
+		size := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += referencedSize(v.Index(i), seen)
+		}
+
+		return size
+	case reflect.Array:
+		size := int64(0)
+		for i := 0; i < v.Len(); i++ {
+			size += referencedSize(v.Index(i), seen)
+		}
+
+		return size
+	case reflect.Struct:
+		size := int64(0)
+		for i := 0; i < v.NumField(); i++ {
+			size += referencedSize(v.Field(i), seen)
+		}
+
+		return size
+	case reflect.Map:
+		size := int64(0)
+		iter := v.MapRange()
+		for iter.Next() {
+			size += int64(iter.Key().Type().Size()) + referencedSize(iter.Key(), seen)
+			size += int64(iter.Value().Type().Size()) + referencedSize(iter.Value(), seen)
+		}
+
+		return size
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,145 @@
+package kvsync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// snapshotEntry is a line of an InMemoryStore snapshot. Value holds the JSON of a model registered with
+// RegisterModel, Data the serialized value of a store with a Marshaler.
+type snapshotEntry struct {
+	Key       string
+	Model     string          `json:",omitempty"`
+	Value     json.RawMessage `json:",omitempty"`
+	Data      []byte          `json:",omitempty"`
+	Version   int64           `json:",omitempty"`
+	ExpiresAt *time.Time      `json:",omitempty"`
+}
+
+// SaveSnapshot writes the entries that have not expired as JSON lines ordered by key. Values are encoded as
+// JSON along with their ModelName, their models must be registered with RegisterModel to be loaded back.
+func (m *InMemoryStore) SaveSnapshot(w io.Writer) error {
+	m.mutex.RLock()
+	now := m.now()
+	entries := make([]snapshotEntry, 0, len(m.Store))
+	values := make(map[string]any, len(m.Store))
+	for key, value := range m.Store {
+		if m.expired(key, now) {
+			continue
+		}
+
+		entry := snapshotEntry{Key: key, Version: m.versions[key]}
+		if expiresAt, ok := m.expirations[key]; ok {
+			entry.ExpiresAt = &expiresAt
+		}
+		entries = append(entries, entry)
+		values[key] = value
+	}
+	m.mutex.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	// stored values are never mutated, they can be encoded without the lock
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if data, ok := values[entry.Key].([]byte); ok && m.Marshaler != nil {
+			entry.Data = data
+		} else {
+			value, err := json.Marshal(values[entry.Key])
+			if err != nil {
+				return &MarshalError{Key: entry.Key, Err: err}
+			}
+			entry.Model = ModelName(values[entry.Key])
+			entry.Value = value
+		}
+
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadSnapshot adds the entries of a snapshot written by SaveSnapshot, replacing the existing values of their
+// keys. Entries that expired since are skipped.
+func (m *InMemoryStore) LoadSnapshot(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.Store == nil {
+		m.Store = make(map[string]any)
+	}
+
+	now := m.now()
+	for {
+		var entry snapshotEntry
+		if err := decoder.Decode(&entry); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("cannot read snapshot: %w", err)
+		}
+
+		var expiresAt time.Time
+		if entry.ExpiresAt != nil {
+			if !now.Before(*entry.ExpiresAt) {
+				continue
+			}
+			expiresAt = *entry.ExpiresAt
+		}
+
+		value, err := m.snapshotValue(entry)
+		if err != nil {
+			return err
+		}
+
+		m.set(entry.Key, value, expiresAt)
+		if entry.Version != 0 {
+			if m.versions == nil {
+				m.versions = make(map[string]int64)
+			}
+			m.versions[entry.Key] = entry.Version
+		}
+	}
+}
+
+// snapshotValue decodes the value of an entry as it is to be stored
+func (m *InMemoryStore) snapshotValue(entry snapshotEntry) (any, error) {
+	if entry.Model == "" {
+		if m.Marshaler == nil {
+			return nil, fmt.Errorf("key %s was saved serialized, loading it requires a Marshaler", entry.Key)
+		}
+
+		return entry.Data, nil
+	}
+
+	dest, err := registeredModel(entry.Model)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load key %s: %w", entry.Key, err)
+	}
+
+	if err = json.Unmarshal(entry.Value, dest); err != nil {
+		return nil, &MarshalError{Key: entry.Key, Unmarshal: true, Err: err}
+	}
+
+	value := reflect.ValueOf(dest).Elem().Interface()
+	if m.Marshaler == nil {
+		return value, nil
+	}
+
+	data, err := encodeValue(value, m.Marshaler)
+	if err != nil {
+		return nil, &MarshalError{Key: entry.Key, Err: err}
+	}
+
+	return data, nil
+}
@@ -0,0 +1,369 @@
+package kvsync_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInMemoryStore_Expiration(t *testing.T) {
+	now := time.Now()
+	store := &kvsync.InMemoryStore{
+		Store:      make(map[string]any),
+		Expiration: time.Minute,
+		Now: func() time.Time {
+			return now
+		},
+	}
+
+	assert.NoError(t, store.Put("user:1", User{ID: 1}))
+	assert.NoError(t, store.PutWithTTL("user:2", User{ID: 2}, time.Hour))
+	assert.NoError(t, store.Put("session:1", Session{ID: 1}))
+
+	now = now.Add(2 * time.Minute)
+
+	var user User
+	assert.ErrorIs(t, store.Fetch("user:1", &user), kvsync.ErrKeyNotFound)
+	assert.NoError(t, store.Fetch("user:2", &user))
+	assert.Equal(t, User{ID: 2}, user)
+
+	keys, _, err := store.Keys("", 10, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"session:1", "user:2"}, keys)
+
+	found, err := store.Exists("user:1")
+	assert.NoError(t, err)
+	assert.False(t, found, "expired keys do not exist")
+
+	now = now.Add(time.Hour)
+
+	_, err = store.FetchAny("session:1")
+	assert.ErrorIs(t, err, kvsync.ErrKeyNotFound)
+	assert.Equal(t, 3, store.EvictExpired())
+	assert.Empty(t, store.Store)
+}
+
+func TestInMemoryStore_TTLAndTouch(t *testing.T) {
+	now := time.Now()
+	store := &kvsync.InMemoryStore{
+		Store:      make(map[string]any),
+		Expiration: time.Hour,
+		Now: func() time.Time {
+			return now
+		},
+	}
+
+	assert.NoError(t, store.PutWithTTL("user:1", User{ID: 1}, time.Minute))
+	now = now.Add(30 * time.Second)
+
+	ttl, err := store.TTL("user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, ttl)
+
+	assert.NoError(t, store.Touch("user:1", 2*time.Minute))
+	now = now.Add(time.Minute)
+
+	var user User
+	assert.NoError(t, store.Fetch("user:1", &user), "touched keys live longer")
+
+	assert.NoError(t, store.Touch("user:1", 0))
+	ttl, err = store.TTL("user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, ttl)
+
+	now = now.Add(2 * time.Hour)
+	_, err = store.TTL("user:1")
+	assert.ErrorIs(t, err, kvsync.ErrKeyNotFound)
+	assert.ErrorIs(t, store.Touch("user:1", time.Hour), kvsync.ErrKeyNotFound)
+}
+
+func TestInMemoryStore_PutIfNewer_Expired(t *testing.T) {
+	now := time.Now()
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+		Now: func() time.Time {
+			return now
+		},
+	}
+
+	ok, err := store.PutIfNewer("user:1", User{ID: 1, Name: "v2"}, 2, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	now = now.Add(2 * time.Minute)
+
+	// the version expired along with the value
+	ok, err = store.PutIfNewer("user:1", User{ID: 1, Name: "v1"}, 1, 0)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestInMemoryStore_RunJanitor(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	assert.NoError(t, store.PutWithTTL("user:1", User{ID: 1}, 20*time.Millisecond))
+	assert.NoError(t, store.Put("user:2", User{ID: 2}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		store.RunJanitor(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, map[string]any{"user:2": User{ID: 2}}, store.Store)
+}
+
+func TestInMemoryStore_MaxEntries(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any), MaxEntries: 2}
+
+	assert.NoError(t, store.Put("user:1", User{ID: 1}))
+	assert.NoError(t, store.Put("user:2", User{ID: 2}))
+
+	var user User
+	assert.NoError(t, store.Fetch("user:1", &user))
+
+	assert.NoError(t, store.Put("user:3", User{ID: 3}))
+
+	assert.ErrorIs(t, store.Fetch("user:2", &user), kvsync.ErrKeyNotFound)
+	assert.Equal(t, map[string]any{"user:1": User{ID: 1}, "user:3": User{ID: 3}}, store.Store)
+}
+
+func TestInMemoryStore_MaxBytes(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any), MaxBytes: 200}
+
+	assert.NoError(t, store.Put("user:1", User{ID: 1, Name: strings.Repeat("a", 50)}))
+	assert.NoError(t, store.Put("user:2", User{ID: 2, Name: strings.Repeat("b", 50)}))
+	assert.Len(t, store.Store, 2)
+
+	assert.NoError(t, store.Put("user:3", User{ID: 3, Name: strings.Repeat("c", 100)}))
+	assert.Equal(t, []string{"user:3"}, mapKeys(store.Store))
+
+	// overwriting a key replaces its size
+	assert.NoError(t, store.Put("user:3", User{ID: 3}))
+	assert.NoError(t, store.Put("user:4", User{ID: 4}))
+	assert.Equal(t, []string{"user:3", "user:4"}, mapKeys(store.Store))
+}
+
+func mapKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func TestInMemoryStore_DeepCopies(t *testing.T) {
+	type Tagged struct {
+		ID     int
+		Tags   []string
+		Labels map[string]string
+		Owner  *User
+	}
+
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+
+	value := Tagged{ID: 1, Tags: []string{"a"}, Labels: map[string]string{"k": "v"}, Owner: &User{ID: 1}}
+	assert.NoError(t, store.Put("tagged:1", value))
+
+	value.Tags[0] = "mutated"
+	value.Labels["k"] = "mutated"
+	value.Owner.Name = "mutated"
+
+	var fetched Tagged
+	assert.NoError(t, store.Fetch("tagged:1", &fetched))
+	assert.Equal(t, Tagged{ID: 1, Tags: []string{"a"}, Labels: map[string]string{"k": "v"}, Owner: &User{ID: 1}}, fetched)
+
+	fetched.Tags[0] = "mutated"
+	fetched.Owner.Name = "mutated"
+
+	stored, err := store.FetchAny("tagged:1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, stored.(Tagged).Tags)
+	assert.Equal(t, "", stored.(Tagged).Owner.Name)
+}
+
+type embeddedAccount struct {
+	gorm.Model
+	Email  string
+	secret string
+}
+
+func TestInMemoryStore_EmbeddedAndUnexportedFields(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+
+	account := embeddedAccount{Model: gorm.Model{ID: 1}, Email: "ada@example.com", secret: "s3cret"}
+	assert.NoError(t, store.Put("account:1", account))
+	assert.NoError(t, store.Put("account:2", &account))
+
+	var fetched embeddedAccount
+	assert.NoError(t, store.Fetch("account:1", &fetched))
+	assert.Equal(t, account, fetched)
+
+	fetched = embeddedAccount{}
+	assert.NoError(t, store.Fetch("account:2", &fetched))
+	assert.Equal(t, account, fetched)
+
+	// other types are filled by field name, like stores unmarshaling values
+	var summary struct {
+		ID    uint
+		Email string
+	}
+	assert.NoError(t, store.Fetch("account:1", &summary))
+	assert.Equal(t, uint(1), summary.ID)
+	assert.Equal(t, "ada@example.com", summary.Email)
+
+	var mismatched struct {
+		Email int
+	}
+	assert.EqualError(t, store.Fetch("account:1", &mismatched),
+		"cannot fetch a kvsync_test.embeddedAccount into a struct { Email int }: field Email is a string, not a int")
+
+	var name string
+	assert.Error(t, store.Fetch("account:1", &name))
+	assert.ErrorIs(t, store.Fetch("account:1", fetched), kvsync.ErrNotPointer)
+	assert.ErrorIs(t, store.Fetch("account:1", (*embeddedAccount)(nil)), kvsync.ErrNotPointer)
+}
+
+func TestInMemoryStore_Marshaler(t *testing.T) {
+	type Credentials struct {
+		ID       int
+		Password string `bson:"-"`
+		LoggedAt time.Time
+	}
+
+	store := &kvsync.InMemoryStore{Store: make(map[string]any), Marshaler: &kvsync.BSONMarshalingAdapter{}}
+
+	loggedAt := time.Date(2024, 1, 2, 3, 4, 5, 6789, time.UTC)
+	assert.NoError(t, store.Put("credentials:1", Credentials{ID: 1, Password: "s3cret", LoggedAt: loggedAt}))
+	assert.IsType(t, []byte{}, store.Store["credentials:1"])
+
+	// fields and precision lost in serialization are lost as with RedisStore
+	var fetched Credentials
+	assert.NoError(t, store.Fetch("credentials:1", &fetched))
+	assert.Equal(t, 1, fetched.ID)
+	assert.Empty(t, fetched.Password)
+	assert.Equal(t, loggedAt.Truncate(time.Millisecond), fetched.LoggedAt.UTC())
+
+	var mismatched struct {
+		ID string
+	}
+	var marshalErr *kvsync.MarshalError
+	assert.ErrorAs(t, store.Fetch("credentials:1", &mismatched), &marshalErr)
+	assert.True(t, marshalErr.Unmarshal)
+
+	assert.ErrorAs(t, store.Put("invalid:1", make(chan int)), &marshalErr)
+	assert.False(t, marshalErr.Unmarshal)
+}
+
+func TestInMemoryStore_Marshaler_FetchAny(t *testing.T) {
+	kvsync.RegisterModel[Profile]()
+
+	store := &kvsync.InMemoryStore{Store: make(map[string]any), Marshaler: &kvsync.EnvelopeMarshaler{}}
+	assert.NoError(t, store.Put("profile:1", Profile{ID: 1, FirstName: "Ada"}))
+
+	value, err := store.FetchAny("profile:1")
+	assert.NoError(t, err)
+	assert.Equal(t, Profile{ID: 1, FirstName: "Ada"}, value)
+}
+
+func BenchmarkInMemoryStore_Fetch(b *testing.B) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	for i := 0; i < 1000; i++ {
+		_ = store.Put(fmt.Sprintf("user:%d", i), User{ID: i})
+	}
+
+	b.SetParallelism(32)
+	b.RunParallel(func(pb *testing.PB) {
+		var user User
+		for i := 0; pb.Next(); i++ {
+			_ = store.Fetch(fmt.Sprintf("user:%d", i%1000), &user)
+		}
+	})
+}
+
+func TestInMemoryStore_Snapshot(t *testing.T) {
+	kvsync.RegisterModel[Profile]()
+	kvsync.RegisterModel[User]()
+
+	now := time.Now()
+	clock := func() time.Time {
+		return now
+	}
+
+	store := &kvsync.InMemoryStore{Store: make(map[string]any), Now: clock}
+	assert.NoError(t, store.Put("profile:1", Profile{ID: 1, FirstName: "Ada"}))
+	assert.NoError(t, store.PutWithTTL("user:1", User{ID: 1, Name: "ada"}, time.Minute))
+	assert.NoError(t, store.PutWithTTL("user:2", User{ID: 2}, time.Second))
+	_, err := store.PutIfNewer("user:3", User{ID: 3}, 7, 0)
+	assert.NoError(t, err)
+
+	var snapshot bytes.Buffer
+	assert.NoError(t, store.SaveSnapshot(&snapshot))
+	assert.Equal(t, 4, strings.Count(snapshot.String(), "\n"))
+	assert.True(t, strings.HasPrefix(snapshot.String(), `{"Key":"profile:1","Model":"kvsync_test.Profile","Value":{"ID":1,`))
+
+	now = now.Add(2 * time.Second)
+
+	loaded := &kvsync.InMemoryStore{Now: clock}
+	assert.NoError(t, loaded.LoadSnapshot(&snapshot))
+	assert.Equal(t, map[string]any{
+		"profile:1": Profile{ID: 1, FirstName: "Ada"},
+		"user:1":    User{ID: 1, Name: "ada"},
+		"user:3":    User{ID: 3},
+	}, loaded.Store)
+
+	// versions and expirations are restored
+	ok, err := loaded.PutIfNewer("user:3", User{ID: 3, Name: "stale"}, 6, 0)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	now = now.Add(time.Minute)
+
+	var user User
+	assert.ErrorIs(t, loaded.Fetch("user:1", &user), kvsync.ErrKeyNotFound)
+}
+
+func TestInMemoryStore_Snapshot_Marshaler(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any), Marshaler: &kvsync.BSONMarshalingAdapter{}}
+	assert.NoError(t, store.Put("session:1", Session{ID: 1, Token: "t"}))
+
+	var snapshot bytes.Buffer
+	assert.NoError(t, store.SaveSnapshot(&snapshot))
+
+	loaded := &kvsync.InMemoryStore{Marshaler: &kvsync.BSONMarshalingAdapter{}}
+	assert.NoError(t, loaded.LoadSnapshot(bytes.NewReader(snapshot.Bytes())))
+
+	var session Session
+	assert.NoError(t, loaded.Fetch("session:1", &session))
+	assert.Equal(t, Session{ID: 1, Token: "t"}, session)
+
+	assert.EqualError(t, (&kvsync.InMemoryStore{}).LoadSnapshot(bytes.NewReader(snapshot.Bytes())),
+		"key session:1 was saved serialized, loading it requires a Marshaler")
+}
+
+func TestInMemoryStore_Snapshot_UnregisteredModel(t *testing.T) {
+	type Unregistered struct {
+		ID int
+	}
+
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	assert.NoError(t, store.Put("unregistered:1", Unregistered{ID: 1}))
+
+	var snapshot bytes.Buffer
+	assert.NoError(t, store.SaveSnapshot(&snapshot))
+	assert.EqualError(t, (&kvsync.InMemoryStore{}).LoadSnapshot(&snapshot),
+		"cannot load key unregistered:1: model kvsync_test.Unregistered is not registered")
+}
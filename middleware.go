@@ -0,0 +1,57 @@
+package kvsync
+
+// StoreMiddleware wraps a store, e.g. to add metrics, logging or retries
+type StoreMiddleware func(KVStore) KVStore
+
+// Chain stacks middlewares in the declared order: the first one is outermost, seeing every call first, and
+// the last one wraps the store itself.
+//
+//	store := kvsync.Chain(kvsync.Logging(logger), kvsync.Tracing(tracer))(redisStore)
+func Chain(middlewares ...StoreMiddleware) StoreMiddleware {
+	return func(store KVStore) KVStore {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			store = middlewares[i](store)
+		}
+
+		return store
+	}
+}
+
+// Logging is WithLogging as a StoreMiddleware
+func Logging(logger Logger) StoreMiddleware {
+	return func(store KVStore) KVStore {
+		return WithLogging(store, logger)
+	}
+}
+
+// Tracing is WithTracing as a StoreMiddleware
+func Tracing(tracer Tracer) StoreMiddleware {
+	return func(store KVStore) KVStore {
+		return WithTracing(store, tracer)
+	}
+}
+
+// Metrics is WithMetrics as a StoreMiddleware, storing the MetricsStore in metrics to read its Stats
+func Metrics(metrics **MetricsStore) StoreMiddleware {
+	return func(store KVStore) KVStore {
+		*metrics = WithMetrics(store)
+
+		return *metrics
+	}
+}
+
+// Retry is a RetryStore as a StoreMiddleware, nil policies retrying ErrStoreUnavailable
+func Retry(policies map[error]RetryPolicy) StoreMiddleware {
+	return func(store KVStore) KVStore {
+		return &RetryStore{Store: store, Policies: policies}
+	}
+}
+
+// Chaos is a ChaosStore as a StoreMiddleware, wrapping the store with the faults configured in chaos
+func Chaos(chaos *ChaosStore) StoreMiddleware {
+	return func(store KVStore) KVStore {
+		chaos.Store = store
+
+		return chaos
+	}
+}
@@ -0,0 +1,33 @@
+package kvsync_test
+
+import (
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	named := func(name string) kvsync.StoreMiddleware {
+		return kvsync.Tracing(tracerFunc(func(op string, key string) func(err error) {
+			calls = append(calls, name+" "+op)
+
+			return func(err error) {}
+		}))
+	}
+
+	var metrics *kvsync.MetricsStore
+	store := kvsync.Chain(named("outer"), kvsync.Metrics(&metrics), named("inner"))(&kvsync.InMemoryStore{Store: make(map[string]any)})
+
+	assert.NoError(t, store.Put("user:1", User{ID: 1}))
+	assert.Equal(t, []string{"outer put", "inner put"}, calls)
+	assert.Equal(t, int64(1), metrics.Stats()[kvsync.OpPut].Calls)
+
+	assert.NoError(t, kvsync.Chain()(store).Put("user:2", User{ID: 2}))
+}
+
+type tracerFunc func(op string, key string) func(err error)
+
+func (f tracerFunc) StartSpan(op string, key string) func(err error) {
+	return f(op, key)
+}
@@ -0,0 +1,236 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// MigrationStore moves from an Old store to a New one without downtime, e.g. from Memcached to Redis. Writes and
+// deletes go to both stores, reads go to New and fall back to Old on a miss or an error. Once all keys were
+// rewritten or expired, MigrationStats.Fallbacks stays at zero and Old can be dropped.
+type MigrationStore struct {
+	Old KVStore
+	New KVStore
+	// CopyOnFallback writes the values read from Old to New, migrating hot keys first
+	CopyOnFallback bool
+
+	reads     int64
+	fallbacks int64
+	misses    int64
+}
+
+// MigrationStats counts the reads of a MigrationStore
+type MigrationStats struct {
+	Reads int64
+	// Fallbacks is the number of reads served by Old
+	Fallbacks int64
+	// Misses is the number of reads served by neither store
+	Misses int64
+}
+
+func (m *MigrationStore) Fetch(key string, dest any) error {
+	atomic.AddInt64(&m.reads, 1)
+
+	if err := m.New.Fetch(key, dest); err == nil {
+		return nil
+	}
+
+	if err := m.Old.Fetch(key, dest); err != nil {
+		atomic.AddInt64(&m.misses, 1)
+
+		return err
+	}
+
+	atomic.AddInt64(&m.fallbacks, 1)
+
+	if m.CopyOnFallback {
+		_ = m.New.Put(key, reflect.ValueOf(dest).Elem().Interface())
+	}
+
+	return nil
+}
+
+// Exists checks New, then Old, without counting as a read
+func (m *MigrationStore) Exists(key string) (bool, error) {
+	if found, err := exists(m.New, key); err == nil && found {
+		return true, nil
+	}
+
+	return exists(m.Old, key)
+}
+
+func (m *MigrationStore) Put(key string, value any) error {
+	return m.both(func(store KVStore) error {
+		return store.Put(key, value)
+	})
+}
+
+func (m *MigrationStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	return m.both(func(store KVStore) error {
+		return putWithTTL(store, key, value, ttl)
+	})
+}
+
+// Delete deletes a key from both stores, returning ErrKeyNotFound only when neither had it
+func (m *MigrationStore) Delete(key string) error {
+	newErr, oldErr := deleteKey(m.New, key), deleteKey(m.Old, key)
+
+	if errors.Is(newErr, ErrKeyNotFound) && oldErr == nil || errors.Is(oldErr, ErrKeyNotFound) && newErr == nil {
+		return nil
+	}
+
+	if newErr != nil {
+		return newErr
+	}
+
+	return oldErr
+}
+
+// TTL inspects New, then Old when New doesn't have the key
+func (m *MigrationStore) TTL(key string) (time.Duration, error) {
+	ttl, err := keyTTL(m.New, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return keyTTL(m.Old, key)
+	}
+
+	return ttl, err
+}
+
+// Touch extends the expiration of a key in both stores, returning ErrKeyNotFound only when neither had it
+func (m *MigrationStore) Touch(key string, ttl time.Duration) error {
+	newErr, oldErr := touchKey(m.New, key, ttl), touchKey(m.Old, key, ttl)
+
+	if errors.Is(newErr, ErrKeyNotFound) && oldErr == nil || errors.Is(oldErr, ErrKeyNotFound) && newErr == nil {
+		return nil
+	}
+
+	if newErr != nil {
+		return newErr
+	}
+
+	return oldErr
+}
+
+// Ping pings both stores
+func (m *MigrationStore) Ping(ctx context.Context) error {
+	if err := ping(ctx, m.New); err != nil {
+		return err
+	}
+
+	return ping(ctx, m.Old)
+}
+
+// Stats returns the read counters
+func (m *MigrationStore) Stats() MigrationStats {
+	return MigrationStats{
+		Reads:     atomic.LoadInt64(&m.reads),
+		Fallbacks: atomic.LoadInt64(&m.fallbacks),
+		Misses:    atomic.LoadInt64(&m.misses),
+	}
+}
+
+// both writes to New then Old, returning the first error
+func (m *MigrationStore) both(op func(store KVStore) error) error {
+	newErr, oldErr := op(m.New), op(m.Old)
+	if newErr != nil {
+		return newErr
+	}
+
+	return oldErr
+}
+
+// MigrateKeysResult counts the keys MigrateKeys went through
+type MigrateKeysResult struct {
+	Scanned int
+	Copied  int
+	// Skipped counts the keys transformed to "" and those expiring during the migration
+	Skipped int
+}
+
+// MigrateKeys copies every key of from to to, under the name returned by transform, without reading the
+// database. Keys transformed to "" are skipped and a nil transform keeps the names. from must implement
+// KeyScanner and AnyFetcher, which requires its values to be registered models in envelopes (see RegisterModel).
+// Expirations are kept when from implements TouchStore. Keys are copied, not moved, and copying again is harmless.
+func MigrateKeys(ctx context.Context, from, to KVStore, transform func(key string) string) (MigrateKeysResult, error) {
+	var result MigrateKeysResult
+
+	fetcher, ok := from.(AnyFetcher)
+	if !ok {
+		return result, errors.New("store does not support fetching untyped values")
+	}
+
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		page, next, err := scan(from, "", 1000, cursor)
+		if err != nil {
+			return result, err
+		}
+
+		for _, key := range page {
+			result.Scanned++
+
+			newKey := key
+			if transform != nil {
+				newKey = transform(key)
+			}
+
+			copied, err := migrateKey(from, fetcher, to, key, newKey)
+			if err != nil {
+				return result, err
+			}
+
+			if copied {
+				result.Copied++
+			} else {
+				result.Skipped++
+			}
+		}
+
+		if next == "" {
+			return result, nil
+		}
+		cursor = next
+	}
+}
+
+// migrateKey copies a key under newKey, returning false when skipped
+func migrateKey(from KVStore, fetcher AnyFetcher, to KVStore, key, newKey string) (bool, error) {
+	if newKey == "" {
+		return false, nil
+	}
+
+	value, err := fetcher.FetchAny(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// a missing expiration is the store's default
+	ttl, err := keyTTL(from, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+
+	return true, putWithTTL(to, newKey, value, ttl)
+}
+
+// RenamePrefix returns a MigrateKeys transform replacing oldPrefix with newPrefix, skipping other keys
+func RenamePrefix(oldPrefix, newPrefix string) func(key string) string {
+	return func(key string) string {
+		if !strings.HasPrefix(key, oldPrefix) {
+			return ""
+		}
+
+		return newPrefix + strings.TrimPrefix(key, oldPrefix)
+	}
+}
@@ -0,0 +1,106 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMigrationStore(t *testing.T) {
+	oldStore := &kvsync.InMemoryStore{Store: map[string]any{
+		"user:1": User{ID: 1, Name: "Alice"},
+		"user:2": User{ID: 2, Name: "Bob"},
+	}}
+	newStore, s := setUpStore()
+	defer s.Close()
+
+	store := &kvsync.MigrationStore{Old: oldStore, New: newStore}
+
+	assert.NoError(t, store.Put("user:3", User{ID: 3, Name: "Carol"}))
+	assert.Len(t, oldStore.Store, 3)
+
+	var user User
+	assert.NoError(t, store.Fetch("user:3", &user))
+	assert.Equal(t, "Carol", user.Name)
+
+	assert.NoError(t, store.Fetch("user:1", &user))
+	assert.Equal(t, "Alice", user.Name)
+	assert.ErrorIs(t, newStore.Fetch("user:1", &user), kvsync.ErrKeyNotFound)
+
+	store.CopyOnFallback = true
+	assert.NoError(t, store.Fetch("user:2", &user))
+	assert.NoError(t, newStore.Fetch("user:2", &user))
+	assert.Equal(t, "Bob", user.Name)
+
+	assert.ErrorIs(t, store.Fetch("user:4", &user), kvsync.ErrKeyNotFound)
+
+	assert.Equal(t, kvsync.MigrationStats{Reads: 4, Fallbacks: 2, Misses: 1}, store.Stats())
+
+	// only in the old store
+	assert.NoError(t, store.Delete("user:1"))
+	assert.NotContains(t, oldStore.Store, "user:1")
+}
+
+func TestMigrateKeys(t *testing.T) {
+	from := &kvsync.InMemoryStore{Store: map[string]any{}}
+	assert.NoError(t, from.Put("user:1", User{ID: 1, Name: "Alice"}))
+	assert.NoError(t, from.PutWithTTL("user:2", User{ID: 2, Name: "Bob"}, time.Hour))
+	assert.NoError(t, from.Put("session:1", User{ID: 1, Name: "Alice"}))
+
+	to, s := setUpStore()
+	defer s.Close()
+
+	result, err := kvsync.MigrateKeys(context.Background(), from, to, kvsync.RenamePrefix("user:", "user:v2:"))
+	assert.NoError(t, err)
+	assert.Equal(t, kvsync.MigrateKeysResult{Scanned: 3, Copied: 2, Skipped: 1}, result)
+
+	var user User
+	assert.NoError(t, to.Fetch("user:v2:2", &user))
+	assert.Equal(t, "Bob", user.Name)
+	assert.ErrorIs(t, to.Fetch("user:1", &user), kvsync.ErrKeyNotFound)
+	assert.ErrorIs(t, to.Fetch("session:1", &user), kvsync.ErrKeyNotFound)
+
+	ttl, err := to.TTL("user:v2:2")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Minute))
+
+	ttl, err = to.TTL("user:v2:1")
+	assert.NoError(t, err)
+	assert.Zero(t, ttl)
+
+	_, err = kvsync.MigrateKeys(context.Background(), erroneousStore{}, to, nil)
+	assert.Error(t, err)
+}
+
+func TestMigrationStore_OptionalInterfaces(t *testing.T) {
+	oldStore := &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{Store: make(map[string]any)}}
+	newStore := &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{Store: make(map[string]any)}}
+	store := &kvsync.MigrationStore{Old: oldStore, New: newStore}
+
+	assertOptionalInterfaces(t, store)
+
+	// only in the old store
+	assert.NoError(t, oldStore.PutWithTTL("user:1", User{ID: 1}, time.Minute))
+
+	found, err := store.Exists("user:1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	ttl, err := store.TTL("user:1")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+
+	assert.NoError(t, store.Touch("user:1", time.Hour))
+	assert.NoError(t, store.Delete("user:1"))
+
+	oldStore.ErrorRate = 1
+	assert.ErrorIs(t, store.Put("user:1", User{ID: 1}), kvsync.ErrStoreUnavailable)
+	assert.ErrorIs(t, store.Touch("user:1", time.Hour), kvsync.ErrStoreUnavailable)
+	assert.ErrorIs(t, store.Delete("user:1"), kvsync.ErrStoreUnavailable)
+	assert.ErrorIs(t, store.Ping(context.Background()), kvsync.ErrStoreUnavailable)
+
+	newStore.ErrorRate = 1
+	assertOptionalInterfacesFail(t, store, kvsync.ErrStoreUnavailable)
+}
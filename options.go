@@ -0,0 +1,255 @@
+package kvsync
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Option configures a KVSync created with New, see Options for what each setting does
+type Option func(*Options) error
+
+// New creates a new KVSync instance from functional options, e.g. New(ctx, WithStore(store), WithWorkers(8)).
+// Unlike NewKVSync, it returns an error wrapping ErrInvalidOptions for configurations that would otherwise
+// misbehave at runtime, such as a nil context or store.
+func New(ctx context.Context, opts ...Option) (KVSync, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: nil context", ErrInvalidOptions)
+	}
+
+	var options Options
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	return NewKVSync(ctx, options), nil
+}
+
+// Validate returns an error wrapping ErrInvalidOptions if the options cannot work, zero values taking
+// their defaults are valid
+func (o Options) Validate() error {
+	switch {
+	case o.Store == nil:
+		return fmt.Errorf("%w: nil store", ErrInvalidOptions)
+	case o.Workers < 0:
+		return fmt.Errorf("%w: negative workers %d", ErrInvalidOptions, o.Workers)
+	case o.QueueSize < 0:
+		return fmt.Errorf("%w: negative queue size %d", ErrInvalidOptions, o.QueueSize)
+	case o.EnqueueTimeout < 0:
+		return fmt.Errorf("%w: negative enqueue timeout %s", ErrInvalidOptions, o.EnqueueTimeout)
+	case o.Quotas.MaxKeys < 0 || o.Quotas.MaxBytes < 0:
+		return fmt.Errorf("%w: negative quota", ErrInvalidOptions)
+	case o.GenerationRefresh < 0:
+		return fmt.Errorf("%w: negative generation refresh %s", ErrInvalidOptions, o.GenerationRefresh)
+	case o.ErrorRate.Threshold < 0 || o.ErrorRate.Threshold > 1:
+		return fmt.Errorf("%w: error rate threshold %g is not between 0 and 1", ErrInvalidOptions, o.ErrorRate.Threshold)
+	}
+
+	for model, pool := range o.Pools {
+		if pool.Workers < 0 || pool.QueueSize < 0 {
+			return fmt.Errorf("%w: negative workers or queue size in the pool of %s", ErrInvalidOptions, model)
+		}
+	}
+
+	return nil
+}
+
+// WithStore sets the store entities are synced to, it is required
+func WithStore(store KVStore) Option {
+	return func(o *Options) error {
+		if store == nil {
+			return fmt.Errorf("%w: nil store", ErrInvalidOptions)
+		}
+		o.Store = store
+
+		return nil
+	}
+}
+
+// WithWorkers sets the number of workers writing to the store, it must be at least 1
+func WithWorkers(workers int) Option {
+	return func(o *Options) error {
+		if workers < 1 {
+			return fmt.Errorf("%w: workers must be at least 1, got %d", ErrInvalidOptions, workers)
+		}
+		o.Workers = workers
+
+		return nil
+	}
+}
+
+// WithQueueSize sets the number of entities queued for the workers, it must be at least 1
+func WithQueueSize(size int) Option {
+	return func(o *Options) error {
+		if size < 1 {
+			return fmt.Errorf("%w: queue size must be at least 1, got %d", ErrInvalidOptions, size)
+		}
+		o.QueueSize = size
+
+		return nil
+	}
+}
+
+// WithEnqueueTimeout bounds how long Gorm callbacks wait for room in the queue, it must be positive
+func WithEnqueueTimeout(timeout time.Duration) Option {
+	return func(o *Options) error {
+		if timeout <= 0 {
+			return fmt.Errorf("%w: enqueue timeout must be positive, got %s", ErrInvalidOptions, timeout)
+		}
+		o.EnqueueTimeout = timeout
+
+		return nil
+	}
+}
+
+// WithReportCallback subscribes a callback to the reports, see KVSync.Subscribe
+func WithReportCallback(callback ReportCallback) Option {
+	return func(o *Options) error {
+		o.ReportCallback = callback
+
+		return nil
+	}
+}
+
+// WithErrorRate disables models whose sync error rate is too high
+func WithErrorRate(errorRate ErrorRateOptions) Option {
+	return func(o *Options) error {
+		o.ErrorRate = errorRate
+
+		return nil
+	}
+}
+
+// WithVersionByUpdatedAt uses the UpdatedAt field as the version of models not implementing Versioned
+func WithVersionByUpdatedAt() Option {
+	return func(o *Options) error {
+		o.VersionByUpdatedAt = true
+
+		return nil
+	}
+}
+
+// WithConfig sets the runtime model configuration
+func WithConfig(config *ConfigRegistry) Option {
+	return func(o *Options) error {
+		o.Config = config
+
+		return nil
+	}
+}
+
+// WithDeadLetters keeps the entities that could not be written for replay
+func WithDeadLetters(deadLetters *DeadLetterQueue) Option {
+	return func(o *Options) error {
+		o.DeadLetters = deadLetters
+
+		return nil
+	}
+}
+
+// WithKillSwitch halts enqueueing and draining while the kill switch is engaged
+func WithKillSwitch(killSwitch *KillSwitch) Option {
+	return func(o *Options) error {
+		o.KillSwitch = killSwitch
+
+		return nil
+	}
+}
+
+// WithFilter opts entities out of syncing when filter returns false
+func WithFilter(filter func(entity any) bool) Option {
+	return func(o *Options) error {
+		o.Filter = filter
+
+		return nil
+	}
+}
+
+// WithPausePolicy decides whether entities synced while paused are buffered or dropped
+func WithPausePolicy(policy PausePolicy) Option {
+	return func(o *Options) error {
+		o.PausePolicy = policy
+
+		return nil
+	}
+}
+
+// WithIndexer maintains the index sets of Indexed models, see Options.Indexer
+func WithIndexer(indexer Indexer) Option {
+	return func(o *Options) error {
+		o.Indexer = indexer
+
+		return nil
+	}
+}
+
+// WithScheduler reports the status of the tasks of a scheduler, see Options.Scheduler
+func WithScheduler(scheduler *Scheduler) Option {
+	return func(o *Options) error {
+		o.Scheduler = scheduler
+
+		return nil
+	}
+}
+
+// WithAuditSink records every key written or deleted, see Options.AuditSink
+func WithAuditSink(sink AuditSink) Option {
+	return func(o *Options) error {
+		o.AuditSink = sink
+
+		return nil
+	}
+}
+
+// WithGenerations embeds model generations into keys, cached for refresh, see Options.Generations
+func WithGenerations(refresh time.Duration) Option {
+	return func(o *Options) error {
+		o.Generations = true
+		o.GenerationRefresh = refresh
+
+		return nil
+	}
+}
+
+// WithQuotas accounts the keys and bytes written by tenant and caps them, see Options.Quotas
+func WithQuotas(quotas QuotaOptions) Option {
+	return func(o *Options) error {
+		o.Quotas = quotas
+
+		return nil
+	}
+}
+
+// WithRepairLoader reloads corrupted values of the keys starting with prefix, see Options.RepairLoaders
+func WithRepairLoader(prefix string, loader RewarmLoader) Option {
+	return func(o *Options) error {
+		if o.RepairLoaders == nil {
+			o.RepairLoaders = make(map[string]RewarmLoader)
+		}
+		o.RepairLoaders[prefix] = loader
+
+		return nil
+	}
+}
+
+// WithModelPool dedicates workers and a queue to a model, see Options.Pools
+func WithModelPool(model any, pool PoolOptions) Option {
+	return func(o *Options) error {
+		if pool.Workers < 1 {
+			return fmt.Errorf("%w: pool of %s needs at least one worker", ErrInvalidOptions, ModelName(model))
+		}
+
+		if o.Pools == nil {
+			o.Pools = make(map[string]PoolOptions)
+		}
+		o.Pools[ModelName(model)] = pool
+
+		return nil
+	}
+}
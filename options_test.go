@@ -0,0 +1,132 @@
+package kvsync_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	reports := make(chan kvsync.Report, 10)
+	kvSync, err := kvsync.New(context.Background(),
+		kvsync.WithStore(store),
+		kvsync.WithWorkers(2),
+		kvsync.WithQueueSize(4),
+		kvsync.WithEnqueueTimeout(time.Second),
+		kvsync.WithReportCallback(func(r kvsync.Report) {
+			reports <- r
+		}),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kvSync.SyncAndWait(context.Background(), &SyncedUser{UUID: "new-uuid"}))
+	assert.Contains(t, store.Store, "user:uuid:new-uuid")
+
+	select {
+	case r := <-reports:
+		assert.NoError(t, r.Err)
+	case <-time.After(time.Second):
+		t.Fatal("no report received")
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	tests := map[string]struct {
+		ctx  context.Context
+		opts []kvsync.Option
+	}{
+		"nil context":       {nil, []kvsync.Option{kvsync.WithStore(store)}},
+		"missing store":     {context.Background(), nil},
+		"nil store":         {context.Background(), []kvsync.Option{kvsync.WithStore(nil)}},
+		"zero workers":      {context.Background(), []kvsync.Option{kvsync.WithStore(store), kvsync.WithWorkers(0)}},
+		"zero queue size":   {context.Background(), []kvsync.Option{kvsync.WithStore(store), kvsync.WithQueueSize(0)}},
+		"negative timeout":  {context.Background(), []kvsync.Option{kvsync.WithStore(store), kvsync.WithEnqueueTimeout(-time.Second)}},
+		"invalid threshold": {context.Background(), []kvsync.Option{kvsync.WithStore(store), kvsync.WithErrorRate(kvsync.ErrorRateOptions{Threshold: 2})}},
+		"empty model pool":  {context.Background(), []kvsync.Option{kvsync.WithStore(store), kvsync.WithModelPool(SyncedUser{}, kvsync.PoolOptions{})}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			kvSync, err := kvsync.New(test.ctx, test.opts...)
+			assert.Nil(t, kvSync)
+			assert.True(t, errors.Is(err, kvsync.ErrInvalidOptions), err)
+		})
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	assert.NoError(t, kvsync.Options{Store: &kvsync.InMemoryStore{}}.Validate())
+	assert.ErrorIs(t, kvsync.Options{}.Validate(), kvsync.ErrInvalidOptions)
+	assert.ErrorIs(t, kvsync.Options{Store: &kvsync.InMemoryStore{}, QueueSize: -1}.Validate(), kvsync.ErrInvalidOptions)
+	assert.ErrorIs(t, kvsync.Options{Store: &kvsync.InMemoryStore{}, Workers: -1}.Validate(), kvsync.ErrInvalidOptions)
+	assert.ErrorIs(t, kvsync.Options{Store: &kvsync.InMemoryStore{}, EnqueueTimeout: -time.Second}.Validate(), kvsync.ErrInvalidOptions)
+	assert.ErrorIs(t, kvsync.Options{Store: &kvsync.InMemoryStore{}, GenerationRefresh: -time.Second}.Validate(), kvsync.ErrInvalidOptions)
+	assert.ErrorIs(t, kvsync.Options{
+		Store:  &kvsync.InMemoryStore{},
+		Quotas: kvsync.QuotaOptions{MaxBytes: -1},
+	}.Validate(), kvsync.ErrInvalidOptions)
+	assert.ErrorIs(t, kvsync.Options{
+		Store: &kvsync.InMemoryStore{},
+		Pools: map[string]kvsync.PoolOptions{"models.Event": {QueueSize: -1}},
+	}.Validate(), kvsync.ErrInvalidOptions)
+}
+
+func TestOptions_With(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	config, err := kvsync.NewConfigRegistry(kvsync.Config{})
+	assert.NoError(t, err)
+	deadLetters := &kvsync.DeadLetterQueue{}
+	killSwitch := &kvsync.KillSwitch{}
+	scheduler := &kvsync.Scheduler{}
+	indexer := &kvsync.RedisIndexer{}
+	loader := func(ctx context.Context, id string) (any, error) {
+		return nil, nil
+	}
+
+	var options kvsync.Options
+	for _, opt := range []kvsync.Option{
+		kvsync.WithStore(store),
+		kvsync.WithVersionByUpdatedAt(),
+		kvsync.WithConfig(config),
+		kvsync.WithDeadLetters(deadLetters),
+		kvsync.WithKillSwitch(killSwitch),
+		kvsync.WithFilter(func(entity any) bool {
+			return true
+		}),
+		kvsync.WithPausePolicy(kvsync.PauseDrop),
+		kvsync.WithIndexer(indexer),
+		kvsync.WithGenerations(time.Minute),
+		kvsync.WithQuotas(kvsync.QuotaOptions{MaxKeys: 10}),
+		kvsync.WithRepairLoader("user:", loader),
+		kvsync.WithModelPool(SyncedUser{}, kvsync.PoolOptions{Workers: 2}),
+		kvsync.WithScheduler(scheduler),
+	} {
+		assert.NoError(t, opt(&options))
+	}
+
+	assert.NoError(t, options.Validate())
+	assert.True(t, options.VersionByUpdatedAt)
+	assert.Same(t, config, options.Config)
+	assert.Same(t, deadLetters, options.DeadLetters)
+	assert.Same(t, killSwitch, options.KillSwitch)
+	assert.True(t, options.Filter(SyncedUser{}))
+	assert.Equal(t, kvsync.PauseDrop, options.PausePolicy)
+	assert.Same(t, indexer, options.Indexer)
+	assert.True(t, options.Generations)
+	assert.Equal(t, time.Minute, options.GenerationRefresh)
+	assert.Equal(t, int64(10), options.Quotas.MaxKeys)
+	assert.Contains(t, options.RepairLoaders, "user:")
+	assert.Len(t, options.Pools, 1)
+	assert.Same(t, scheduler, options.Scheduler)
+}
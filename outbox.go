@@ -0,0 +1,213 @@
+package kvsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// OutboxTable is the table of OutboxJob, create it with AutoMigrate(&OutboxJob{})
+const OutboxTable = "kvsync_outbox"
+
+// OutboxJob is a sync recorded by the Gorm callbacks in outbox mode, in the same transaction as the statement
+// that triggered it, so that a sync cannot be lost when the process dies between the commit and the write.
+// Statements run without a transaction, e.g. with SkipDefaultTransaction, lose this guarantee.
+type OutboxJob struct {
+	ID uint64 `gorm:"primaryKey;autoIncrement"`
+	// Model is the name of the synced model, see ModelName
+	Model string `gorm:"size:255"`
+	// PrimaryKey identifies the row to sync, it is empty for jobs only deleting keys
+	PrimaryKey string    `gorm:"size:255"`
+	Operation  Operation `gorm:"size:16"`
+	// DeletedKeys is the JSON array of the keys to delete, those of a deleted row or left behind by an update
+	DeletedKeys string
+	TraceID     string `gorm:"size:64"`
+	Attempts    int
+	LastError   string
+	CreatedAt   time.Time
+}
+
+func (OutboxJob) TableName() string {
+	return OutboxTable
+}
+
+// isOutboxStatement reports whether a statement writes outbox jobs, which are not synced themselves
+func isOutboxStatement(db *gorm.DB) bool {
+	return db.Statement.Table == OutboxTable
+}
+
+// record records an entity to sync and/or keys to delete as an outbox job, failing the statement and thus
+// rolling back its transaction when the job cannot be written
+func (k *kvSync) record(db *gorm.DB, entity any, sync bool, deleted map[string]KeySpec, traceID string, operation Operation) {
+	job := OutboxJob{
+		Model:     ModelName(entity),
+		Operation: operation,
+		TraceID:   traceID,
+	}
+
+	if sync {
+		if _, ok := syncKeySpecs(entity); ok && db.Statement.Schema != nil && db.Statement.Schema.PrioritizedPrimaryField != nil {
+			pk, zero := db.Statement.Schema.PrioritizedPrimaryField.ValueOf(db.Statement.Context, reflect.ValueOf(entity))
+			if !zero {
+				job.PrimaryKey = fmt.Sprint(pk)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(deleted))
+	for _, spec := range deleted {
+		keys = append(keys, spec.Key)
+	}
+	sort.Strings(keys)
+
+	if len(keys) > 0 {
+		b, err := json.Marshal(keys)
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		job.DeletedKeys = string(b)
+	}
+
+	if job.PrimaryKey == "" && job.DeletedKeys == "" {
+		return
+	}
+
+	if err := db.Session(&gorm.Session{NewDB: true}).Create(&job).Error; err != nil {
+		_ = db.AddError(fmt.Errorf("cannot record outbox job: %w", err))
+	}
+}
+
+// OutboxDispatcher ships the outbox jobs to the store in insertion order with at-least-once semantics: jobs
+// are deleted once shipped, and kept with their error for a retry on the next poll otherwise. Several replicas
+// may dispatch concurrently, jobs are then possibly shipped more than once.
+type OutboxDispatcher struct {
+	DB     *gorm.DB
+	KVSync KVSync
+	// Store is where the keys of deleted rows are deleted, the one KVSync syncs to
+	Store KVStore
+	// Models are the synced models, rows are reloaded by primary key into their types
+	Models []any
+	// BatchSize is the number of jobs loaded per poll, defaults to 100
+	BatchSize int
+	// Interval is how often the outbox is polled when it is drained, defaults to 1 second
+	Interval time.Duration
+}
+
+// Run dispatches jobs until the context is done
+func (d *OutboxDispatcher) Run(ctx context.Context) {
+	for {
+		n, err := d.Dispatch(ctx)
+		if err == nil && n == d.batchSize() {
+			continue
+		}
+
+		timer := time.NewTimer(d.interval())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Dispatch ships the oldest batch of jobs, returning the number of jobs loaded. Jobs failing to ship are
+// retried by later calls, their error being recorded.
+func (d *OutboxDispatcher) Dispatch(ctx context.Context) (int, error) {
+	var jobs []OutboxJob
+	if err := d.DB.WithContext(ctx).Order("id").Limit(d.batchSize()).Find(&jobs).Error; err != nil {
+		return 0, err
+	}
+
+	for _, job := range jobs {
+		if err := d.ship(ctx, job); err != nil {
+			if err := d.DB.WithContext(ctx).Model(&job).Updates(map[string]any{
+				"attempts":   gorm.Expr("attempts + 1"),
+				"last_error": err.Error(),
+			}).Error; err != nil {
+				return len(jobs), err
+			}
+
+			continue
+		}
+
+		if err := d.DB.WithContext(ctx).Delete(&job).Error; err != nil {
+			return len(jobs), err
+		}
+	}
+
+	return len(jobs), nil
+}
+
+func (d *OutboxDispatcher) ship(ctx context.Context, job OutboxJob) error {
+	if job.PrimaryKey != "" {
+		model, ok := d.model(job.Model)
+		if !ok {
+			return fmt.Errorf("model %s is not registered", job.Model)
+		}
+
+		pk, err := primaryField(d.DB, model)
+		if err != nil {
+			return err
+		}
+
+		// a missing row got deleted since, its keys are deleted by a later job
+		row, ok := findRow(d.DB.WithContext(ctx), reflect.TypeOf(model), clause.Eq{Column: clause.Column{Name: pk.DBName}, Value: job.PrimaryKey})
+		if ok {
+			if err := d.KVSync.SyncAndWait(WithTraceID(ctx, job.TraceID), row); err != nil {
+				return err
+			}
+		}
+	}
+
+	if job.DeletedKeys == "" {
+		return nil
+	}
+
+	var keys []string
+	if err := json.Unmarshal([]byte(job.DeletedKeys), &keys); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := deleteKey(d.Store, key); err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// model returns the registered model of a name
+func (d *OutboxDispatcher) model(name string) (any, bool) {
+	for _, model := range d.Models {
+		if ModelName(model) == name {
+			return resolvePointer(model), true
+		}
+	}
+
+	return nil, false
+}
+
+func (d *OutboxDispatcher) batchSize() int {
+	if d.BatchSize < 1 {
+		return 100
+	}
+
+	return d.BatchSize
+}
+
+func (d *OutboxDispatcher) interval() time.Duration {
+	if d.Interval <= 0 {
+		return time.Second
+	}
+
+	return d.Interval
+}
@@ -0,0 +1,120 @@
+package kvsync_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestOutbox(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:  store,
+		Outbox: true,
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.AutoMigrate(&kvsync.OutboxJob{}))
+	defer func() {
+		_ = db.Migrator().DropTable(&kvsync.OutboxJob{})
+	}()
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+
+	dispatcher := &kvsync.OutboxDispatcher{
+		DB:     db,
+		KVSync: kvSync,
+		Store:  store,
+		Models: []any{&SyncedUser{}},
+	}
+
+	jobs := func() []kvsync.OutboxJob {
+		var jobs []kvsync.OutboxJob
+		assert.NoError(t, db.Order("id").Find(&jobs).Error)
+		return jobs
+	}
+
+	user := &SyncedUser{UUID: "outbox-uuid"}
+	assert.NoError(t, db.Create(user).Error)
+	assert.Empty(t, store.Store)
+
+	recorded := jobs()
+	if assert.Len(t, recorded, 1) {
+		assert.Equal(t, "1", recorded[0].PrimaryKey)
+		assert.Equal(t, kvsync.OperationCreate, recorded[0].Operation)
+	}
+
+	// jobs are rolled back with the statements recording them
+	assert.Error(t, db.Transaction(func(tx *gorm.DB) error {
+		assert.NoError(t, tx.Create(&SyncedUser{UUID: "rolled-back-uuid"}).Error)
+		return errors.New("rollback")
+	}))
+	assert.Len(t, jobs(), 1)
+
+	n, err := dispatcher.Dispatch(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Contains(t, store.Store, "user:uuid:outbox-uuid")
+	assert.Empty(t, jobs())
+
+	user.UUID = "outbox-uuid-2"
+	assert.NoError(t, db.Save(user).Error)
+	recorded = jobs()
+	if assert.Len(t, recorded, 1) {
+		assert.Equal(t, `["user:composite:1_outbox-uuid","user:uuid:outbox-uuid"]`, recorded[0].DeletedKeys)
+	}
+
+	_, err = dispatcher.Dispatch(context.Background())
+	assert.NoError(t, err)
+	assert.Contains(t, store.Store, "user:uuid:outbox-uuid-2")
+	assert.NotContains(t, store.Store, "user:uuid:outbox-uuid")
+
+	assert.NoError(t, db.Delete(user).Error)
+	_, err = dispatcher.Dispatch(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, store.Store)
+	assert.Empty(t, jobs())
+}
+
+func TestOutboxDispatcher_Retries(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:  store,
+		Outbox: true,
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.AutoMigrate(&kvsync.OutboxJob{}))
+	defer func() {
+		_ = db.Migrator().DropTable(&kvsync.OutboxJob{})
+	}()
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+
+	assert.NoError(t, db.Create(&SyncedUser{UUID: "retried-uuid"}).Error)
+
+	// the model is not registered yet
+	dispatcher := &kvsync.OutboxDispatcher{DB: db, KVSync: kvSync, Store: store}
+	_, err := dispatcher.Dispatch(context.Background())
+	assert.NoError(t, err)
+
+	var job kvsync.OutboxJob
+	assert.NoError(t, db.First(&job).Error)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Contains(t, job.LastError, "is not registered")
+	assert.Empty(t, store.Store)
+
+	dispatcher.Models = []any{SyncedUser{}}
+	_, err = dispatcher.Dispatch(context.Background())
+	assert.NoError(t, err)
+	assert.Contains(t, store.Store, "user:uuid:retried-uuid")
+}
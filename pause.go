@@ -0,0 +1,81 @@
+package kvsync
+
+// PausePolicy decides what happens to the entities synced while KVSync is paused
+type PausePolicy int
+
+const (
+	// PauseBuffer keeps queueing entities and key deletions, they are written once resumed. Gorm callbacks
+	// wait for room in the queue as usual, see Options.EnqueueTimeout.
+	PauseBuffer PausePolicy = iota
+	// PauseDrop drops entities and key deletions, reporting them with ErrPaused
+	PauseDrop
+)
+
+// Pause stops all writes to the store, e.g. during a Redis failover, until Resume is called.
+// Unlike the kill switch, it only affects this instance.
+func (k *kvSync) Pause() {
+	k.pauseMutex.Lock()
+	defer k.pauseMutex.Unlock()
+
+	if !k.paused {
+		k.paused = true
+		k.resumed = make(chan struct{})
+	}
+}
+
+// Resume resumes writing to the store, draining what got buffered meanwhile
+func (k *kvSync) Resume() {
+	k.pauseMutex.Lock()
+	defer k.pauseMutex.Unlock()
+
+	if k.paused {
+		k.paused = false
+		close(k.resumed)
+	}
+}
+
+// Paused reports whether writes to the store are paused
+func (k *kvSync) Paused() bool {
+	k.pauseMutex.Lock()
+	defer k.pauseMutex.Unlock()
+
+	return k.paused
+}
+
+// dropping reports whether entities must be dropped rather than buffered
+func (k *kvSync) dropping() bool {
+	return k.pausePolicy == PauseDrop && k.Paused()
+}
+
+// waitResumed blocks while paused, returning false if the context got done meanwhile
+func (k *kvSync) waitResumed() bool {
+	for {
+		k.pauseMutex.Lock()
+		paused, resumed := k.paused, k.resumed
+		k.pauseMutex.Unlock()
+
+		if !paused {
+			return true
+		}
+
+		select {
+		case <-k.ctx.Done():
+			return false
+		case <-resumed:
+		}
+	}
+}
+
+// ready blocks until neither the kill switch nor Pause stop the workers, returning false if the
+// context got done meanwhile
+func (k *kvSync) ready() bool {
+	for {
+		if !k.killSwitch.wait(k.ctx) || !k.waitResumed() {
+			return false
+		}
+
+		if !k.killSwitch.Engaged() && !k.Paused() {
+			return true
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPause_Buffer(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	reports := make(chan kvsync.Report, 10)
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:     store,
+		QueueSize: 10,
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+
+	kvSync.Pause()
+	assert.True(t, kvSync.Paused())
+	assert.ErrorIs(t, kvSync.Sync(&SyncedUser{UUID: "paused-uuid"}), kvsync.ErrPaused)
+
+	user := &SyncedUser{UUID: "buffered-uuid"}
+	assert.NoError(t, db.Create(user).Error)
+
+	select {
+	case r := <-reports:
+		t.Fatalf("nothing must be written while paused, got %+v", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Empty(t, store.Store)
+
+	kvSync.Resume()
+	assert.False(t, kvSync.Paused())
+
+	for i := 0; i < 3; i++ {
+		select {
+		case r := <-reports:
+			assert.NoError(t, r.Err)
+		case <-time.After(time.Second):
+			t.Fatal("no report received")
+		}
+	}
+	assert.Contains(t, store.Store, "user:uuid:buffered-uuid")
+}
+
+func TestPause_Drop(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	reports := make(chan kvsync.Report, 10)
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:       store,
+		PausePolicy: kvsync.PauseDrop,
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+
+	kvSync.Pause()
+
+	assert.ErrorIs(t, kvSync.SyncAndWait(context.Background(), &SyncedUser{UUID: "dropped-uuid"}), kvsync.ErrPaused)
+
+	user := &SyncedUser{UUID: "dropped-uuid"}
+	assert.NoError(t, db.Create(user).Error)
+
+	select {
+	case r := <-reports:
+		assert.ErrorIs(t, r.Err, kvsync.ErrPaused)
+		assert.Equal(t, kvsync.OperationCreate, r.Operation)
+	case <-time.After(time.Second):
+		t.Fatal("no report received")
+	}
+
+	kvSync.Resume()
+
+	select {
+	case r := <-reports:
+		t.Fatalf("dropped entities must not be written, got %+v", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Empty(t, store.Store)
+
+	assert.NoError(t, kvSync.SyncAndWait(context.Background(), user))
+	assert.Contains(t, store.Store, "user:uuid:dropped-uuid")
+}
@@ -0,0 +1,47 @@
+package kvsync
+
+import (
+	"gorm.io/gorm"
+)
+
+type plugin struct {
+	kvSync KVSync
+}
+
+// Plugin returns a gorm.Plugin registering all KVSync callbacks in one db.Use call: models are synced
+// after creates and updates, keys left behind by updates are deleted, and keys of deleted models
+// are deleted. Writes are synced once their transaction is committed.
+func Plugin(kvSync KVSync) gorm.Plugin {
+	return plugin{kvSync: kvSync}
+}
+
+func (p plugin) Name() string {
+	return "kvsync"
+}
+
+func (p plugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+
+	if err := callback.Create().After("gorm:commit_or_rollback_transaction").
+		Register("kvsync:create", p.kvSync.GormCallback()); err != nil {
+		return err
+	}
+
+	if err := callback.Update().Before("gorm:update").
+		Register("kvsync:before_update", p.kvSync.GormBeforeUpdateCallback()); err != nil {
+		return err
+	}
+
+	if err := callback.Update().After("gorm:commit_or_rollback_transaction").
+		Register("kvsync:update", p.kvSync.GormCallback()); err != nil {
+		return err
+	}
+
+	if err := callback.Delete().Before("gorm:delete").
+		Register("kvsync:before_delete", p.kvSync.GormBeforeUpdateCallback()); err != nil {
+		return err
+	}
+
+	return callback.Delete().After("gorm:commit_or_rollback_transaction").
+		Register("kvsync:delete", p.kvSync.GormDeleteCallback())
+}
@@ -0,0 +1,120 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPlugin(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	reports := make(chan kvsync.Report, 10)
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+
+	waitReports := func(n int) {
+		for i := 0; i < n; i++ {
+			select {
+			case r := <-reports:
+				assert.NoError(t, r.Err)
+			case <-time.After(time.Second):
+				t.Fatal("no report received")
+			}
+		}
+	}
+
+	user := &SyncedUser{UUID: "plugin-uuid", Username: "plugin-username"}
+	assert.NoError(t, db.Create(user).Error)
+	waitReports(3)
+
+	user.UUID = "plugin-uuid-2"
+	assert.NoError(t, db.Save(user).Error)
+	waitReports(5) // 3 writes and 2 stale keys
+
+	assert.Contains(t, store.Store, "user:uuid:plugin-uuid-2")
+	assert.NotContains(t, store.Store, "user:uuid:plugin-uuid")
+
+	assert.NoError(t, db.Model(&SyncedUser{Model: user.Model}).Updates(map[string]any{"username": "renamed"}).Error)
+	waitReports(3)
+
+	fetched := SyncedUser{UUID: "plugin-uuid-2"}
+	assert.NoError(t, kvSync.Fetch(&fetched, "uuid"))
+	assert.Equal(t, "renamed", fetched.Username)
+
+	assert.NoError(t, db.Model(&SyncedUser{Model: user.Model}).Updates(map[string]any{"uuid": "plugin-uuid-3"}).Error)
+	waitReports(5)
+	assert.NotContains(t, store.Store, "user:uuid:plugin-uuid-2")
+
+	user.UUID = "plugin-uuid-3"
+	assert.NoError(t, db.Delete(user).Error)
+	waitReports(3)
+
+	assert.Empty(t, store.Store)
+
+	assert.Error(t, db.Create(&SyncedUser{Model: user.Model, UUID: "duplicate"}).Error)
+	select {
+	case r := <-reports:
+		t.Fatalf("failed statements must not be synced, got %+v", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPlugin_Reports(t *testing.T) {
+	reports := make(chan kvsync.Report, 10)
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: &kvsync.InMemoryStore{
+			Store: make(map[string]any),
+		},
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+
+	receive := func(n int) map[string]kvsync.Report {
+		byKeyName := make(map[string]kvsync.Report, n)
+		for i := 0; i < n; i++ {
+			select {
+			case r := <-reports:
+				assert.NoError(t, r.Err)
+				assert.Equal(t, 1, r.Attempt)
+				assert.False(t, r.Timestamp.IsZero())
+				byKeyName[r.KeyName] = r
+			case <-time.After(time.Second):
+				t.Fatal("no report received")
+			}
+		}
+		return byKeyName
+	}
+
+	user := &SyncedUser{UUID: "report-uuid"}
+	assert.NoError(t, db.Create(user).Error)
+	created := receive(3)
+	assert.Equal(t, "user:uuid:report-uuid", created["uuid"].Key)
+	assert.Equal(t, kvsync.OperationCreate, created["uuid"].Operation)
+
+	user.Username = "renamed"
+	assert.NoError(t, db.Save(user).Error)
+	assert.Equal(t, kvsync.OperationUpdate, receive(3)["id"].Operation)
+
+	assert.NoError(t, db.Delete(user).Error)
+	deleted := receive(3)
+	assert.Equal(t, "user:composite:1_report-uuid", deleted["composite"].Key)
+	assert.Equal(t, kvsync.OperationDelete, deleted["composite"].Operation)
+}
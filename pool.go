@@ -0,0 +1,58 @@
+package kvsync
+
+// PoolOptions configures the workers and queue dedicated to a model, see Options.Pools
+type PoolOptions struct {
+	// Workers defaults to 1
+	Workers int
+	// QueueSize defaults to Workers
+	QueueSize int
+}
+
+// PoolStats is the state of a worker pool
+type PoolStats struct {
+	Workers       int
+	Queued        int
+	QueueCapacity int
+}
+
+// workerPool is a set of workers draining their own queues
+type workerPool struct {
+	queue         chan queueItem
+	priorityQueue chan queueItem
+	workers       int
+}
+
+func newWorkerPool(options PoolOptions) *workerPool {
+	workers := options.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	queueSize := options.QueueSize
+	if queueSize < 1 {
+		queueSize = workers
+	}
+
+	return &workerPool{
+		queue:         make(chan queueItem, queueSize),
+		priorityQueue: make(chan queueItem, queueSize),
+		workers:       workers,
+	}
+}
+
+func (p *workerPool) stats() PoolStats {
+	return PoolStats{
+		Workers:       p.workers,
+		Queued:        len(p.queue) + len(p.priorityQueue),
+		QueueCapacity: cap(p.queue),
+	}
+}
+
+// poolFor returns the pool dedicated to the model of an entity, or the shared one
+func (k *kvSync) poolFor(entity any) *workerPool {
+	if pool, ok := k.pools[ModelName(entity)]; ok {
+		return pool
+	}
+
+	return k.pool
+}
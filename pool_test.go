@@ -0,0 +1,72 @@
+package kvsync_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Event struct {
+	ID int
+}
+
+func (e Event) SyncKeys() map[string]string {
+	return map[string]string{"id": fmt.Sprintf("event:%d", e.ID)}
+}
+
+// slowEventStore blocks writes of events until released
+type slowEventStore struct {
+	*kvsync.InMemoryStore
+	release chan struct{}
+}
+
+func (s slowEventStore) Put(key string, value any) error {
+	if strings.HasPrefix(key, "event:") {
+		<-s.release
+	}
+
+	return s.InMemoryStore.Put(key, value)
+}
+
+func TestKVSync_ModelPools(t *testing.T) {
+	store := slowEventStore{
+		InMemoryStore: &kvsync.InMemoryStore{Store: make(map[string]any)},
+		release:       make(chan struct{}),
+	}
+
+	kvSync, err := kvsync.New(context.Background(),
+		kvsync.WithStore(store),
+		kvsync.WithWorkers(2),
+		kvsync.WithQueueSize(10),
+		kvsync.WithModelPool(SyncedUser{}, kvsync.PoolOptions{Workers: 1}),
+	)
+	assert.NoError(t, err)
+
+	for i := 1; i <= 5; i++ {
+		go func(i int) {
+			_ = kvSync.SyncAndWait(context.Background(), Event{ID: i})
+		}(i)
+	}
+
+	assert.Eventually(t, func() bool {
+		return kvSync.Stats().Queued == 3
+	}, time.Second, time.Millisecond, "both shared workers are stuck on events")
+
+	// users have their own worker
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, kvSync.SyncAndWait(ctx, &SyncedUser{UUID: "pool-uuid"}))
+
+	stats := kvSync.Stats()
+	assert.Equal(t, 3, stats.Workers)
+	assert.Equal(t, kvsync.PoolStats{Workers: 1, QueueCapacity: 1}, stats.Pools["kvsync_test.SyncedUser"])
+
+	close(store.release)
+	assert.Eventually(t, func() bool {
+		return kvSync.Stats().Models["kvsync_test.Event"].Synced == 5
+	}, time.Second, time.Millisecond)
+}
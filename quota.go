@@ -0,0 +1,214 @@
+package kvsync
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuotaOptions accounts the keys and bytes written by tenant, optionally capping them
+type QuotaOptions struct {
+	// Tenant returns the tenant a key is accounted to, "" for keys not accounted. Nil turns the feature off.
+	Tenant func(key string) string
+	// Window is the period quotas apply to, defaults to an hour
+	Window time.Duration
+	// MaxKeys and MaxBytes cap the keys and bytes each tenant writes per window, 0 means no cap
+	MaxKeys  int64
+	MaxBytes int64
+	// Limits optionally override MaxKeys and MaxBytes by tenant
+	Limits map[string]QuotaLimit
+	// Observe is optionally invoked after every accounted write with the tenant's usage, e.g. to feed
+	// Prometheus counters
+	Observe func(tenant string, usage TenantStats)
+}
+
+// QuotaLimit caps the keys and bytes a tenant writes per window, 0 means no cap
+type QuotaLimit struct {
+	MaxKeys  int64
+	MaxBytes int64
+}
+
+// TenantStats counts the keys and bytes written for a tenant. Bytes are only measured with a per-operation
+// marshaler or by stores implementing SizingStore.
+type TenantStats struct {
+	Keys  int64
+	Bytes int64
+	// WindowKeys and WindowBytes are written in the current window, see QuotaOptions.Window
+	WindowKeys  int64
+	WindowBytes int64
+	// Rejected counts the writes rejected with a QuotaError
+	Rejected int64
+}
+
+// QuotaError is returned and reported for keys whose write would exceed the quota of their tenant,
+// it matches ErrQuotaExceeded
+type QuotaError struct {
+	Tenant string
+	// Resource is "keys" or "bytes"
+	Resource string
+	Used     int64
+	Max      int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("tenant %s exceeded its quota of %d %s, %d used", e.Tenant, e.Max, e.Resource, e.Used)
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// TenantByFirstSegment accounts keys to the segment before their first colon, e.g. "acme" for "acme:user:1"
+func TenantByFirstSegment(key string) string {
+	tenant, _, _ := strings.Cut(key, ":")
+
+	return tenant
+}
+
+type quotaTracker struct {
+	options     QuotaOptions
+	tenants     map[string]*TenantStats
+	windowStart time.Time
+	mutex       sync.Mutex
+}
+
+func newQuotaTracker(options QuotaOptions) *quotaTracker {
+	if options.Window <= 0 {
+		options.Window = time.Hour
+	}
+
+	return &quotaTracker{options: options, tenants: make(map[string]*TenantStats)}
+}
+
+// reserve accounts the write of a key of size bytes, failing with a QuotaError when it exceeds the quota of
+// its tenant. Reservations are settled once the write is done.
+func (t *quotaTracker) reserve(key string, size int64) error {
+	if t == nil {
+		return nil
+	}
+
+	tenant := t.options.Tenant(key)
+	if tenant == "" {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if now := time.Now(); now.Sub(t.windowStart) >= t.options.Window {
+		t.windowStart = now
+		for _, usage := range t.tenants {
+			usage.WindowKeys, usage.WindowBytes = 0, 0
+		}
+	}
+
+	usage, ok := t.tenants[tenant]
+	if !ok {
+		usage = &TenantStats{}
+		t.tenants[tenant] = usage
+	}
+
+	limit := QuotaLimit{MaxKeys: t.options.MaxKeys, MaxBytes: t.options.MaxBytes}
+	if l, ok := t.options.Limits[tenant]; ok {
+		limit = l
+	}
+
+	if limit.MaxKeys > 0 && usage.WindowKeys+1 > limit.MaxKeys {
+		usage.Rejected++
+		return &QuotaError{Tenant: tenant, Resource: "keys", Used: usage.WindowKeys, Max: limit.MaxKeys}
+	}
+
+	if limit.MaxBytes > 0 && usage.WindowBytes+size > limit.MaxBytes {
+		usage.Rejected++
+		return &QuotaError{Tenant: tenant, Resource: "bytes", Used: usage.WindowBytes, Max: limit.MaxBytes}
+	}
+
+	usage.Keys++
+	usage.Bytes += size
+	usage.WindowKeys++
+	usage.WindowBytes += size
+
+	return nil
+}
+
+// settle gives back the reservation of a failed write, or reports the tenant's usage to Observe
+func (t *quotaTracker) settle(key string, size int64, err error) {
+	if t == nil {
+		return
+	}
+
+	tenant := t.options.Tenant(key)
+	if tenant == "" {
+		return
+	}
+
+	t.mutex.Lock()
+	usage := t.tenants[tenant]
+	if err != nil {
+		usage.Keys--
+		usage.Bytes -= size
+		// the window may have been reset since the reservation
+		if usage.WindowKeys > 0 {
+			usage.WindowKeys--
+			usage.WindowBytes -= size
+		}
+	}
+	snapshot := *usage
+	t.mutex.Unlock()
+
+	if err == nil && t.options.Observe != nil {
+		t.options.Observe(tenant, snapshot)
+	}
+}
+
+func (t *quotaTracker) stats() map[string]TenantStats {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	stats := make(map[string]TenantStats, len(t.tenants))
+	for tenant, usage := range t.tenants {
+		stats[tenant] = *usage
+	}
+
+	return stats
+}
+
+// putWithinQuotas writes the values of an entity whose tenants are within their quotas, failing the others
+// with a QuotaError. Tenants are resolved from the keys without their generation prefix.
+func (k *kvSync) putWithinQuotas(entity any, values map[string]any, specs map[string]KeySpec, marshaler MarshalingAdapter) map[string]error {
+	if k.quotas == nil {
+		return k.put(entity, values, specs, marshaler)
+	}
+
+	_, sizes := k.measure(values, specs, marshaler)
+	generation := k.generationOf(entity)
+
+	allowed := make(map[string]KeySpec, len(specs))
+	rejected := make(map[string]error)
+	for keyName, spec := range specs {
+		if err := k.quotas.reserve(withoutGeneration(spec.Key, generation), int64(sizes[spec.Key])); err != nil {
+			rejected[spec.Key] = err
+			continue
+		}
+		allowed[keyName] = spec
+	}
+
+	errs := make(map[string]error, len(specs))
+	if len(allowed) > 0 {
+		errs = k.put(entity, values, allowed, marshaler)
+	}
+	for _, spec := range allowed {
+		k.quotas.settle(withoutGeneration(spec.Key, generation), int64(sizes[spec.Key]), errs[spec.Key])
+	}
+
+	for key, err := range rejected {
+		errs[key] = err
+	}
+
+	return errs
+}
@@ -0,0 +1,78 @@
+package kvsync_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestSync_Quotas(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	var mutex sync.Mutex
+	observed := make(map[string]kvsync.TenantStats)
+	kvSync, err := kvsync.New(context.Background(), kvsync.WithStore(redisStore), kvsync.WithQuotas(kvsync.QuotaOptions{
+		Tenant: kvsync.TenantByFirstSegment,
+		Limits: map[string]kvsync.QuotaLimit{"product": {MaxKeys: 3}},
+		Observe: func(tenant string, usage kvsync.TenantStats) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			observed[tenant] = usage
+		},
+	}))
+	assert.NoError(t, err)
+
+	assert.NoError(t, kvSync.Sync(&Product{ID: 1, SKU: "sku-1"}))
+
+	err = kvSync.SyncAndWait(context.Background(), &Product{ID: 2, SKU: "sku-2"})
+	assert.ErrorIs(t, err, kvsync.ErrQuotaExceeded)
+	var quotaErr *kvsync.QuotaError
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, "product", quotaErr.Tenant)
+	assert.Equal(t, "keys", quotaErr.Resource)
+	assert.Equal(t, int64(3), quotaErr.Max)
+	assert.Contains(t, quotaErr.Error(), "tenant product exceeded its quota of 3 keys")
+
+	user := SyncedUser{UUID: "quota-uuid"}
+	user.ID = 1
+	assert.NoError(t, kvSync.Sync(&user), "other tenants have no quota")
+
+	stats := kvSync.Stats().Tenants
+	assert.Equal(t, int64(3), stats["product"].Keys)
+	assert.Equal(t, int64(3), stats["product"].WindowKeys)
+	assert.Equal(t, int64(1), stats["product"].Rejected)
+	assert.Greater(t, stats["product"].Bytes, int64(0), "RedisStore measures sizes")
+	assert.Equal(t, int64(3), stats["user"].Keys)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, int64(3), observed["product"].Keys)
+
+	withoutQuotas := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: redisStore})
+	assert.Nil(t, withoutQuotas.Stats().Tenants)
+}
+
+func TestSync_QuotasWithGenerations(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+
+	kvSync, err := kvsync.New(context.Background(), kvsync.WithStore(store), kvsync.WithGenerations(0), kvsync.WithQuotas(kvsync.QuotaOptions{
+		Tenant: kvsync.TenantByFirstSegment,
+		Limits: map[string]kvsync.QuotaLimit{"product": {MaxKeys: 3}},
+	}))
+	assert.NoError(t, err)
+
+	assert.NoError(t, kvSync.SyncAndWait(context.Background(), &Product{ID: 1, SKU: "sku-1"}))
+	assert.NoError(t, kvSync.InvalidateModel(&Product{}))
+
+	err = kvSync.SyncAndWait(context.Background(), &Product{ID: 2, SKU: "sku-2"})
+	assert.ErrorIs(t, err, kvsync.ErrQuotaExceeded, "keys of new generations are accounted to the same tenant")
+
+	stats := kvSync.Stats().Tenants
+	assert.Equal(t, int64(3), stats["product"].Keys)
+	assert.Equal(t, int64(1), stats["product"].Rejected)
+	assert.NotContains(t, stats, "g1")
+}
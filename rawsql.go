@@ -0,0 +1,54 @@
+package kvsync
+
+import (
+	"context"
+	"fmt"
+)
+
+// EntityLoader loads the rows of primary keys written without Gorm, e.g. with database/sql or sqlx. Rows
+// that no longer exist are left out.
+type EntityLoader func(ctx context.Context, ids []any) ([]any, error)
+
+// SyncAfterExec loads the rows written by a raw SQL statement by primary key and syncs them, waiting for their
+// keys to be written like SyncAll. The trace ID and actor of the context are kept, see WithTraceID and WithActor.
+func (k *kvSync) SyncAfterExec(ctx context.Context, loader EntityLoader, ids ...any) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	entities, err := loader(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("cannot load the rows written: %w", err)
+	}
+
+	return k.SyncAll(ctx, entities, BatchOptions{})
+}
+
+// DeleteAfterExec deletes the keys of rows deleted by a raw SQL statement, which must be loaded before it runs
+// or returned by it, e.g. with DELETE ... RETURNING. Keys that are not stored are skipped. Like SyncAll, it goes
+// through all entities and returns a *BatchError when any fails.
+func (k *kvSync) DeleteAfterExec(ctx context.Context, entities ...any) error {
+	traceID := traceIDFrom(ctx)
+	errs := make([]error, len(entities))
+	failed := false
+
+	for i, entity := range entities {
+		entity = resolvePointer(entity)
+
+		specs, ok := syncKeySpecs(entity)
+		if !ok {
+			errs[i], failed = ErrNotSyncable, true
+			continue
+		}
+
+		if err := k.deleteKeys(entity, specs, traceID, Actor(ctx), OperationDelete); err != nil {
+			errs[i], failed = err, true
+		}
+	}
+
+	if failed {
+		return &BatchError{Errs: errs}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package kvsync_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSyncAfterExec(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	conn, err := db.DB()
+	assert.NoError(t, err)
+
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store})
+
+	loader := func(ctx context.Context, ids []any) ([]any, error) {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+		rows, err := conn.QueryContext(ctx, "SELECT id, uuid, username FROM synced_users WHERE deleted_at IS NULL AND id IN ("+placeholders+")", ids...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var users []any
+		for rows.Next() {
+			var user SyncedUser
+			if err := rows.Scan(&user.ID, &user.UUID, &user.Username); err != nil {
+				return nil, err
+			}
+			users = append(users, user)
+		}
+
+		return users, rows.Err()
+	}
+
+	for i := 1; i <= 2; i++ {
+		_, err = conn.Exec("INSERT INTO synced_users (id, uuid, username) VALUES (?, ?, ?)", i, fmt.Sprintf("raw-uuid-%d", i), fmt.Sprintf("raw-username-%d", i))
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, kvSync.SyncAfterExec(context.Background(), loader, 1, 2, 3))
+
+	fetched := SyncedUser{UUID: "raw-uuid-2"}
+	assert.NoError(t, kvSync.Fetch(&fetched, "uuid"))
+	assert.Equal(t, "raw-username-2", fetched.Username)
+
+	deleted, err := loader(context.Background(), []any{1})
+	assert.NoError(t, err)
+	_, err = conn.Exec("DELETE FROM synced_users WHERE id = ?", 1)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kvSync.DeleteAfterExec(context.Background(), deleted...))
+	assert.NotContains(t, store.Store, "user:uuid:raw-uuid-1")
+	assert.Contains(t, store.Store, "user:uuid:raw-uuid-2")
+
+	assert.NoError(t, kvSync.DeleteAfterExec(context.Background(), deleted...), "keys already deleted are skipped")
+
+	assert.Error(t, kvSync.SyncAfterExec(context.Background(), func(ctx context.Context, ids []any) ([]any, error) {
+		return nil, fmt.Errorf("connection refused")
+	}, 1))
+}
+
+func TestDeleteAfterExec_Errors(t *testing.T) {
+	store := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store})
+
+	users := []any{SyncedUser{UUID: "batch-uuid-1"}, UnsyncedUser{}, &SyncedUser{UUID: "batch-uuid-2"}}
+	assert.NoError(t, kvSync.SyncAll(context.Background(), []any{users[0], users[2]}, kvsync.BatchOptions{}))
+
+	err := kvSync.DeleteAfterExec(context.Background(), users...)
+
+	var batchErr *kvsync.BatchError
+	assert.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, []error{nil, kvsync.ErrNotSyncable, nil}, batchErr.Errs)
+	assert.ErrorIs(t, err, kvsync.ErrNotSyncable)
+	assert.NotContains(t, store.Store, "user:uuid:batch-uuid-1")
+	assert.NotContains(t, store.Store, "user:uuid:batch-uuid-2", "entities after a failed one are deleted")
+}
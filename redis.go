@@ -2,13 +2,21 @@ package kvsync
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson"
+	"math/rand"
 	"reflect"
+	"strings"
 	"time"
 )
 
+// Expirable is an optional interface for models that control their own expiration,
+// overriding RedisStore.Expiration
+type Expirable interface {
+	SyncExpiration() time.Duration
+}
+
 // MarshalingAdapter is an interface for marshaling and unmarshaling data
 type MarshalingAdapter interface {
 	Marshal(v any) ([]byte, error)
@@ -19,19 +27,35 @@ type MarshalingAdapter interface {
 type BSONMarshalingAdapter struct{}
 
 func (b *BSONMarshalingAdapter) Marshal(v any) ([]byte, error) {
-	return bson.Marshal(v)
+	return bson.Marshal(applyFieldTags(v))
 }
 
 func (b *BSONMarshalingAdapter) Unmarshal(data []byte, v any) error {
-	return bson.Unmarshal(data, v)
+	return unmarshalFieldTags(data, v, bson.Unmarshal)
 }
 
 // RedisStore is a Redis implementation of KVStore
 type RedisStore struct {
-	Client     *redis.ClusterClient
+	// Client can be a standalone, Sentinel (failover) or cluster client, or any wrapped redis.Cmdable
+	Client     redis.Cmdable
 	Prefix     string
 	Expiration time.Duration
-	Marshaler  MarshalingAdapter
+	// TTLJitter randomizes expirations within a fraction of the TTL (0.1 means ±10%)
+	// so keys written together don't all expire at the same time
+	TTLJitter float64
+	Marshaler MarshalingAdapter
+	// HashTag optionally returns a Redis Cluster hash tag for a key, injected as "{tag}" between the prefix
+	// and the key so that related keys (e.g. all keys of one entity) share a hash slot
+	HashTag func(key string) string
+	// Atomic writes all keys of an entity in a single MULTI/EXEC transaction. On Redis Cluster the keys
+	// of an entity must share a hash slot, see HashTag.
+	Atomic bool
+	// ChunkSize splits serialized values larger than this many bytes into chunks stored under separate keys,
+	// 0 disables chunking
+	ChunkSize int
+	// NativeLists stores slices as Redis lists of serialized values rather than as JSON arrays, so that
+	// AppendList is atomic. FetchBatch does not read them.
+	NativeLists bool
 }
 
 func (r *RedisStore) Fetch(key string, dest any) error {
@@ -39,34 +63,380 @@ func (r *RedisStore) Fetch(key string, dest any) error {
 		r.Marshaler = &BSONMarshalingAdapter{}
 	}
 
-	if reflect.TypeOf(dest).Kind() != reflect.Ptr || !isStruct(dest) {
-		return errors.New("destination must be a pointer to a struct")
+	if !isPointer(dest) {
+		return ErrNotPointer
 	}
 
-	val, err := r.Client.Get(context.Background(), r.prefixedKey(key)).Result()
+	if r.NativeLists && isList(dest) {
+		return r.fetchList(key, dest)
+	}
 
+	val, err := r.fetchBytes(context.Background(), key)
 	if err != nil {
 		return err
 	}
 
-	return r.Marshaler.Unmarshal([]byte(val), dest)
+	if err = decodeValue(val, dest, r.Marshaler); err != nil {
+		return &MarshalError{Key: key, Unmarshal: true, Err: err}
+	}
+
+	return nil
+}
+
+// fetchBytes fetches the serialized value of a key, reassembling chunked values
+func (r *RedisStore) fetchBytes(ctx context.Context, key string) ([]byte, error) {
+	if r.Marshaler == nil {
+		r.Marshaler = &BSONMarshalingAdapter{}
+	}
+
+	val, err := r.Client.Get(ctx, r.prefixedKey(key)).Bytes()
+	if err != nil {
+		return nil, redisError(key, err)
+	}
+
+	if m, ok := parseChunkManifest(val); ok {
+		val, err = r.fetchChunks(ctx, key, m)
+
+		return val, redisError(key, err)
+	}
+
+	return val, nil
+}
+
+// FetchAny fetches a value of a registered model, the Marshaler must write envelopes (see EnvelopeMarshaler)
+func (r *RedisStore) FetchAny(key string) (any, error) {
+	val, err := r.fetchBytes(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeAny(val, r.Marshaler)
+}
+
+// FetchWithInfo fetches a value along with its envelope, the Marshaler must write envelopes (see EnvelopeMarshaler)
+func (r *RedisStore) FetchWithInfo(key string, dest any) (Envelope, error) {
+	if reflect.TypeOf(dest).Kind() != reflect.Ptr || !isStruct(dest) {
+		return Envelope{}, ErrNotPointer
+	}
+
+	val, err := r.fetchBytes(context.Background(), key)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	decoder, ok := r.Marshaler.(EnvelopeDecoder)
+	if !ok {
+		return Envelope{}, fmt.Errorf("marshaler %T does not write envelopes", r.Marshaler)
+	}
+
+	envelope, err := decoder.Decode(val)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	if err = r.Marshaler.Unmarshal(val, dest); err != nil {
+		return Envelope{}, &MarshalError{Key: key, Unmarshal: true, Err: err}
+	}
+
+	envelope.Payload = nil
+
+	return envelope, nil
+}
+
+// Exists checks the presence of a key with EXISTS
+func (r *RedisStore) Exists(key string) (bool, error) {
+	n, err := r.Client.Exists(context.Background(), r.prefixedKey(key)).Result()
+	if err != nil {
+		return false, redisError(key, err)
+	}
+
+	return n > 0, nil
 }
 
 func (r *RedisStore) Put(key string, value any) error {
+	return r.put(key, value, jitter(r.expiration(value), r.TTLJitter))
+}
+
+// PutWithTTL stores a value with an expiration overriding both RedisStore.Expiration and Expirable
+func (r *RedisStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	return r.put(key, value, jitter(ttl, r.TTLJitter))
+}
+
+// PutWithMarshaler stores a value serialized with another marshaler than RedisStore.Marshaler, reading it
+// back requires the same marshaler
+func (r *RedisStore) PutWithMarshaler(key string, value any, ttl time.Duration, marshaler MarshalingAdapter) error {
+	if ttl <= 0 {
+		ttl = r.expiration(value)
+	}
+
+	return r.putWith(key, value, jitter(ttl, r.TTLJitter), marshaler)
+}
+
+func (r *RedisStore) put(key string, value any, ttl time.Duration) error {
 	if r.Marshaler == nil {
 		r.Marshaler = &BSONMarshalingAdapter{}
 	}
 
-	if !isStruct(value) {
-		return errors.New("value must be a struct")
+	return r.putWith(key, value, ttl, r.Marshaler)
+}
+
+func (r *RedisStore) putWith(key string, value any, ttl time.Duration, marshaler MarshalingAdapter) error {
+	if r.NativeLists && isList(value) {
+		return r.putList(key, value, ttl, marshaler)
 	}
 
-	b, err := r.Marshaler.Marshal(value)
+	b, err := encodeValue(value, marshaler)
 	if err != nil {
-		return err
+		return &MarshalError{Key: key, Err: err}
+	}
+
+	ctx := context.Background()
+	previous := r.chunkManifests(ctx, []string{key})
+
+	if r.ChunkSize > 0 && len(b) > r.ChunkSize {
+		err = r.putChunks(ctx, key, b, ttl)
+	} else {
+		err = r.Client.Set(ctx, r.prefixedKey(key), b, ttl).Err()
+	}
+
+	if err == nil {
+		r.expireChunks(ctx, previous, key)
+	}
+
+	return redisError(key, err)
+}
+
+func (r *RedisStore) expiration(value any) time.Duration {
+	if e, ok := value.(Expirable); ok {
+		return e.SyncExpiration()
+	}
+
+	return r.Expiration
+}
+
+// PutBatch writes the entries in a single pipeline, or in a single MULTI/EXEC transaction when Atomic is set
+func (r *RedisStore) PutBatch(entries []BatchEntry) []error {
+	if r.Marshaler == nil {
+		r.Marshaler = &BSONMarshalingAdapter{}
+	}
+
+	ctx := context.Background()
+	payloads, lists, ttls, errs := r.encodeBatch(entries)
+
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.Key
+	}
+	previous := r.chunkManifests(ctx, keys)
+
+	if r.Atomic {
+		errs = r.putBatchAtomic(ctx, entries, payloads, lists, ttls, errs)
+		if len(errs) > 0 && errs[0] == nil {
+			r.expireChunks(ctx, previous, keys...)
+		}
+
+		return errs
+	}
+
+	cmds := make([]*redis.StatusCmd, len(entries))
+
+	_, _ = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, entry := range entries {
+			if errs[i] != nil {
+				continue
+			}
+
+			if lists[i] != nil {
+				errs[i] = r.writeList(ctx, entry.Key, lists[i], ttls[i])
+				continue
+			}
+
+			if r.ChunkSize > 0 && len(payloads[i]) > r.ChunkSize {
+				errs[i] = redisError(entry.Key, r.putChunks(ctx, entry.Key, payloads[i], ttls[i]))
+				continue
+			}
+
+			cmds[i] = pipe.Set(ctx, r.prefixedKey(entry.Key), payloads[i], ttls[i])
+		}
+
+		return nil
+	})
+
+	written := make([]string, 0, len(entries))
+	for i, cmd := range cmds {
+		if cmd != nil {
+			errs[i] = redisError(entries[i].Key, cmd.Err())
+		}
+
+		if errs[i] == nil {
+			written = append(written, keys[i])
+		}
+	}
+	r.expireChunks(ctx, previous, written...)
+
+	return errs
+}
+
+// encodeBatch serializes the entries of a batch, native lists element by element, and resolves their expirations
+func (r *RedisStore) encodeBatch(entries []BatchEntry) ([][]byte, [][]any, []time.Duration, []error) {
+	errs := make([]error, len(entries))
+	payloads := make([][]byte, len(entries))
+	lists := make([][]any, len(entries))
+	ttls := make([]time.Duration, len(entries))
+
+	for i, entry := range entries {
+		var err error
+		if r.NativeLists && isList(entry.Value) {
+			lists[i], errs[i] = encodeElements(entry.Key, reflect.Indirect(reflect.ValueOf(entry.Value)), r.Marshaler)
+		} else if payloads[i], err = encodeValue(entry.Value, r.Marshaler); err != nil {
+			errs[i] = &MarshalError{Key: entry.Key, Err: err}
+		}
+
+		ttls[i] = entry.TTL
+		if ttls[i] <= 0 {
+			ttls[i] = r.expiration(entry.Value)
+		}
+		ttls[i] = jitter(ttls[i], r.TTLJitter)
+	}
+
+	return payloads, lists, ttls, errs
+}
+
+// putBatchAtomic writes either all entries or none of them, so readers never observe a partially synced entity
+func (r *RedisStore) putBatchAtomic(ctx context.Context, entries []BatchEntry, payloads [][]byte, lists [][]any, ttls []time.Duration, errs []error) []error {
+	for _, err := range errs {
+		if err != nil {
+			return batchErrors(len(entries), fmt.Errorf("atomic batch aborted: %w", err))
+		}
+	}
+
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, entry := range entries {
+			if lists[i] != nil {
+				r.queueList(ctx, pipe, entry.Key, lists[i], ttls[i])
+				continue
+			}
+
+			if r.ChunkSize > 0 && len(payloads[i]) > r.ChunkSize {
+				r.queueChunks(ctx, pipe, entry.Key, payloads[i], ttls[i])
+				continue
+			}
+
+			pipe.Set(ctx, r.prefixedKey(entry.Key), payloads[i], ttls[i])
+		}
+
+		return nil
+	})
+
+	return batchErrors(len(entries), redisError("", err))
+}
+
+// batchErrors returns a slice of n times the same error
+func batchErrors(n int, err error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
 	}
 
-	return r.Client.Set(context.Background(), r.prefixedKey(key), b, r.Expiration).Err()
+	return errs
+}
+
+func (r *RedisStore) Delete(key string) error {
+	ctx := context.Background()
+
+	if val, err := r.Client.Get(ctx, r.prefixedKey(key)).Bytes(); err == nil {
+		if m, ok := parseChunkManifest(val); ok {
+			for i := 0; i < m.chunks; i++ {
+				if err = r.Client.Del(ctx, r.chunkKey(key, m, i)).Err(); err != nil {
+					return redisError(key, err)
+				}
+			}
+		}
+	}
+
+	return redisError(key, r.Client.Del(ctx, r.prefixedKey(key), versionKey(r.prefixedKey(key))).Err())
+}
+
+// DeleteByPrefix deletes all keys starting with prefix, along with their chunks and versions, by scanning every master
+// node
+func (r *RedisStore) DeleteByPrefix(prefix string) error {
+	pattern := r.scanPattern(prefix)
+
+	err := r.forEachNode(context.Background(), func(ctx context.Context, client redis.Cmdable) error {
+		// keys are collected before deleting since deleting while scanning may skip keys
+		keys, err := r.scanPrefix(ctx, client, pattern, prefix)
+		if err != nil {
+			return err
+		}
+
+		for len(keys) > 0 {
+			n := len(keys)
+			if n > 100 {
+				n = 100
+			}
+
+			_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, key := range keys[:n] {
+					if chunkKeyPattern.MatchString(key) {
+						pipe.Unlink(ctx, key)
+					} else {
+						// the version of a value is in its hash slot, outside of the scanned keys unless hash-tagged
+						pipe.Unlink(ctx, key, versionKey(key))
+					}
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			keys = keys[n:]
+		}
+
+		return nil
+	})
+
+	return redisError(prefix, err)
+}
+
+func scanKeys(ctx context.Context, client redis.Cmdable, pattern string) ([]string, error) {
+	var keys []string
+
+	iter := client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+
+	return keys, iter.Err()
+}
+
+// scanPrefix scans the Redis keys of a node starting with prefix, including the chunks of values
+func (r *RedisStore) scanPrefix(ctx context.Context, client redis.Cmdable, pattern string, prefix string) ([]string, error) {
+	keys, err := scanKeys(ctx, client, pattern)
+	if err != nil || r.HashTag == nil {
+		return keys, err
+	}
+
+	matching := keys[:0]
+	for _, key := range keys {
+		if r.hasPrefix(key, prefix) {
+			matching = append(matching, key)
+		}
+	}
+
+	return matching, nil
+}
+
+// forEachNode runs fn against every master of a cluster, or against the client itself otherwise
+func (r *RedisStore) forEachNode(ctx context.Context, fn func(ctx context.Context, client redis.Cmdable) error) error {
+	if cluster, ok := r.Client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return fn(ctx, client)
+		})
+	}
+
+	return fn(ctx, r.Client)
 }
 
 func (r *RedisStore) prefixedKey(key string) string {
@@ -74,6 +444,12 @@ func (r *RedisStore) prefixedKey(key string) string {
 		r.Prefix = "kvsync:"
 	}
 
+	if r.HashTag != nil {
+		if tag := r.HashTag(key); tag != "" {
+			return r.Prefix + "{" + tag + "}" + key
+		}
+	}
+
 	return r.Prefix + key
 }
 
@@ -83,3 +459,22 @@ func isStruct(value any) bool {
 
 	return kind == reflect.Struct || (kind == reflect.Ptr && val.Elem().Kind() == reflect.Struct)
 }
+
+// jitter randomizes a TTL within ±fraction of its value, non-positive TTLs are returned as is
+func jitter(ttl time.Duration, fraction float64) time.Duration {
+	if ttl <= 0 || fraction <= 0 {
+		return ttl
+	}
+
+	delta := time.Duration((rand.Float64()*2 - 1) * fraction * float64(ttl))
+	if ttl+delta <= 0 {
+		return ttl
+	}
+
+	return ttl + delta
+}
+
+// escapePattern escapes the glob characters of a SCAN pattern
+func escapePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`).Replace(s)
+}
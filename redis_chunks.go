@@ -0,0 +1,244 @@
+package kvsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chunkManifestPrefix marks a value holding the nonce and number of chunks of a chunked value rather than the
+// value itself. It starts with a NUL byte, which neither BSON (little-endian length) nor JSON payloads start with.
+const chunkManifestPrefix = "\x00kvsync:chunks:"
+
+// chunkGracePeriod is how long the chunks of a replaced value are kept for the readers still streaming them
+const chunkGracePeriod = 10 * time.Second
+
+// chunkKeyPattern matches the Redis keys of chunks
+var chunkKeyPattern = regexp.MustCompile(`:chunk:([0-9a-f]+:)?\d+$`)
+
+// chunkManifest describes the chunks of a value. Every write names its chunks after a new nonce, so that a read
+// overlapping a rewrite never joins the chunks of two values. Manifests written before nonces have none.
+type chunkManifest struct {
+	nonce  string
+	chunks int
+}
+
+func newChunkManifest(chunks int) chunkManifest {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return chunkManifest{nonce: hex.EncodeToString(b), chunks: chunks}
+}
+
+func (m chunkManifest) String() string {
+	if m.nonce == "" {
+		return chunkManifestPrefix + strconv.Itoa(m.chunks)
+	}
+
+	return chunkManifestPrefix + m.nonce + ":" + strconv.Itoa(m.chunks)
+}
+
+func parseChunkManifest(val []byte) (chunkManifest, bool) {
+	if !bytes.HasPrefix(val, []byte(chunkManifestPrefix)) {
+		return chunkManifest{}, false
+	}
+
+	var m chunkManifest
+	count := string(val[len(chunkManifestPrefix):])
+	if i := strings.IndexByte(count, ':'); i >= 0 {
+		m.nonce, count = count[:i], count[i+1:]
+	}
+
+	var err error
+	if m.chunks, err = strconv.Atoi(count); err != nil {
+		return chunkManifest{}, false
+	}
+
+	return m, true
+}
+
+func (r *RedisStore) chunkKey(key string, m chunkManifest, i int) string {
+	return prefixedChunkKey(r.prefixedKey(key), m, i)
+}
+
+func prefixedChunkKey(prefixedKey string, m chunkManifest, i int) string {
+	if m.nonce == "" {
+		return fmt.Sprintf("%s:chunk:%d", prefixedKey, i)
+	}
+
+	return fmt.Sprintf("%s:chunk:%s:%d", prefixedKey, m.nonce, i)
+}
+
+// chunkManifests returns the manifests of the chunked values currently stored under keys, whose chunks are
+// left behind once the values are replaced. Nothing is read unless chunking is enabled.
+func (r *RedisStore) chunkManifests(ctx context.Context, keys []string) map[string]chunkManifest {
+	if r.ChunkSize <= 0 {
+		return nil
+	}
+
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, _ = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			// only manifests of chunked values are read, native lists fail with WRONGTYPE
+			cmds[i] = pipe.GetRange(ctx, r.prefixedKey(key), 0, chunkManifestLength)
+		}
+
+		return nil
+	})
+
+	manifests := make(map[string]chunkManifest)
+	for i, cmd := range cmds {
+		if m, ok := parseChunkManifest([]byte(cmd.Val())); ok {
+			manifests[keys[i]] = m
+		}
+	}
+
+	return manifests
+}
+
+// chunkManifestLength bounds the length of manifests, for reading them without reading whole values
+const chunkManifestLength = int64(len(chunkManifestPrefix) + 40)
+
+// expireChunks makes the chunks of the replaced values of keys expire after chunkGracePeriod
+func (r *RedisStore) expireChunks(ctx context.Context, manifests map[string]chunkManifest, keys ...string) {
+	if len(manifests) == 0 {
+		return
+	}
+
+	_, _ = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			m, ok := manifests[key]
+			for i := 0; ok && i < m.chunks; i++ {
+				pipe.PExpire(ctx, r.chunkKey(key, m, i), chunkGracePeriod)
+			}
+		}
+
+		return nil
+	})
+}
+
+// putChunks writes the chunks before the manifest so that readers never see a manifest without its chunks
+func (r *RedisStore) putChunks(ctx context.Context, key string, b []byte, ttl time.Duration) error {
+	var m chunkManifest
+
+	_, err := r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		m = r.queueChunkValues(ctx, pipe, key, b, ttl)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.Client.Set(ctx, r.prefixedKey(key), m.String(), ttl).Err()
+}
+
+// queueChunks queues the chunks of a value followed by its manifest, for use in transactions
+func (r *RedisStore) queueChunks(ctx context.Context, pipe redis.Pipeliner, key string, b []byte, ttl time.Duration) {
+	m := r.queueChunkValues(ctx, pipe, key, b, ttl)
+	pipe.Set(ctx, r.prefixedKey(key), m.String(), ttl)
+}
+
+func (r *RedisStore) queueChunkValues(ctx context.Context, pipe redis.Pipeliner, key string, b []byte, ttl time.Duration) chunkManifest {
+	m := newChunkManifest((len(b) + r.ChunkSize - 1) / r.ChunkSize)
+
+	for i := 0; i < m.chunks; i++ {
+		end := (i + 1) * r.ChunkSize
+		if end > len(b) {
+			end = len(b)
+		}
+
+		pipe.Set(ctx, r.chunkKey(key, m, i), b[i*r.ChunkSize:end], ttl)
+	}
+
+	return m
+}
+
+func (r *RedisStore) fetchChunk(ctx context.Context, key string, m chunkManifest, i int) ([]byte, error) {
+	chunk, err := r.Client.Get(ctx, r.chunkKey(key, m, i)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("%w: chunk %d of %s is missing", ErrCorrupted, i, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("chunk %d of %s: %w", i, key, err)
+	}
+
+	return chunk, nil
+}
+
+func (r *RedisStore) fetchChunks(ctx context.Context, key string, m chunkManifest) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for i := 0; i < m.chunks; i++ {
+		chunk, err := r.fetchChunk(ctx, key, m, i)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(chunk)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// FetchStream streams the serialized value of a key, fetching chunked values one chunk at a time
+func (r *RedisStore) FetchStream(key string) (io.ReadCloser, error) {
+	ctx := context.Background()
+
+	val, err := r.Client.Get(ctx, r.prefixedKey(key)).Bytes()
+	if err != nil {
+		return nil, redisError(key, err)
+	}
+
+	m, ok := parseChunkManifest(val)
+	if !ok {
+		return io.NopCloser(bytes.NewReader(val)), nil
+	}
+
+	return &chunkReader{ctx: ctx, store: r, key: key, manifest: m}, nil
+}
+
+type chunkReader struct {
+	ctx      context.Context
+	store    *RedisStore
+	key      string
+	manifest chunkManifest
+	next     int
+	current  []byte
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.current) == 0 {
+		if c.next >= c.manifest.chunks {
+			return 0, io.EOF
+		}
+
+		chunk, err := c.store.fetchChunk(c.ctx, c.key, c.manifest, c.next)
+		if err != nil {
+			return 0, redisError(c.key, err)
+		}
+
+		c.current = chunk
+		c.next++
+	}
+
+	n := copy(p, c.current)
+	c.current = c.current[n:]
+
+	return n, nil
+}
+
+func (c *chunkReader) Close() error {
+	c.current = nil
+	c.next = c.manifest.chunks
+
+	return nil
+}
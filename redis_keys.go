@@ -0,0 +1,153 @@
+package kvsync
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Keys returns about limit keys starting with prefix from a SCAN cursor, and the cursor to continue from,
+// empty once all keys were returned. Keys of Redis Cluster deployments are collected from all masters at
+// once and paged in memory, the cursor being the last key returned.
+func (r *RedisStore) Keys(prefix string, limit int, cursor string) ([]string, string, error) {
+	ctx := context.Background()
+	if limit < 1 {
+		limit = 100
+	}
+
+	pattern := r.scanPattern(prefix)
+
+	if _, ok := r.Client.(*redis.ClusterClient); ok {
+		return r.clusterKeys(ctx, prefix, pattern, limit, cursor)
+	}
+
+	var position uint64
+	if cursor != "" {
+		var err error
+		if position, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var keys []string
+	for {
+		redisKeys, next, err := r.Client.Scan(ctx, position, pattern, int64(limit)).Result()
+		if err != nil {
+			return nil, "", redisError(prefix, err)
+		}
+
+		keys = append(keys, r.filterKeys(redisKeys, prefix)...)
+		position = next
+
+		if position == 0 {
+			return keys, "", nil
+		}
+
+		if len(keys) >= limit {
+			return keys, strconv.FormatUint(position, 10), nil
+		}
+	}
+}
+
+func (r *RedisStore) clusterKeys(ctx context.Context, prefix string, pattern string, limit int, cursor string) ([]string, string, error) {
+	var redisKeys []string
+	var mutex sync.Mutex
+
+	err := r.forEachNode(ctx, func(ctx context.Context, client redis.Cmdable) error {
+		keys, err := scanKeys(ctx, client, pattern)
+		if err != nil {
+			return err
+		}
+
+		mutex.Lock()
+		redisKeys = append(redisKeys, keys...)
+		mutex.Unlock()
+
+		return nil
+	})
+	if err != nil {
+		return nil, "", redisError(prefix, err)
+	}
+
+	keys := r.filterKeys(redisKeys, prefix)
+	sort.Strings(keys)
+
+	start := sort.SearchStrings(keys, cursor)
+	if start < len(keys) && keys[start] == cursor {
+		start++
+	}
+
+	end := start + limit
+	if end >= len(keys) {
+		return keys[start:], "", nil
+	}
+
+	return keys[start:end], keys[end-1], nil
+}
+
+// filterKeys unprefixes Redis keys, dropping chunks and keys not starting with prefix
+func (r *RedisStore) filterKeys(redisKeys []string, prefix string) []string {
+	keys := make([]string, 0, len(redisKeys))
+	for _, redisKey := range redisKeys {
+		if key, ok := r.unprefixedKey(redisKey); ok && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// scanPattern returns the SCAN pattern of the Redis keys starting with prefix. Hash tags come before the key,
+// so with HashTag all keys are scanned and must be filtered once unprefixed, see hasPrefix.
+func (r *RedisStore) scanPattern(prefix string) string {
+	if r.HashTag != nil {
+		return escapePattern(r.basePrefix()) + "*"
+	}
+
+	return escapePattern(r.prefixedKey(prefix)) + "*"
+}
+
+// hasPrefix reports whether a scanned Redis key, including the chunk of a value, belongs to a key starting with prefix
+func (r *RedisStore) hasPrefix(redisKey string, prefix string) bool {
+	key, ok := r.strippedKey(redisKey)
+
+	return ok && strings.HasPrefix(key, prefix)
+}
+
+// unprefixedKey strips the prefix and hash tag of a Redis key, chunks of values are not keys of their own
+func (r *RedisStore) unprefixedKey(redisKey string) (string, bool) {
+	if chunkKeyPattern.MatchString(redisKey) {
+		return "", false
+	}
+
+	return r.strippedKey(redisKey)
+}
+
+// strippedKey strips the prefix and hash tag of a Redis key
+func (r *RedisStore) strippedKey(redisKey string) (string, bool) {
+	prefix := r.basePrefix()
+	if !strings.HasPrefix(redisKey, prefix) {
+		return "", false
+	}
+
+	key := strings.TrimPrefix(redisKey, prefix)
+	if r.HashTag != nil && strings.HasPrefix(key, "{") {
+		if end := strings.Index(key, "}"); end >= 0 {
+			key = key[end+1:]
+		}
+	}
+
+	return key, true
+}
+
+// basePrefix returns the prefix of all keys, before any hash tag
+func (r *RedisStore) basePrefix() string {
+	if r.Prefix == "" {
+		r.Prefix = "kvsync:"
+	}
+
+	return r.Prefix
+}
@@ -0,0 +1,174 @@
+package kvsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"reflect"
+	"time"
+)
+
+// ListStore is implemented by stores able to append to the lists stored under keys, e.g. the recent orders of
+// a user, without the caller rewriting them
+type ListStore interface {
+	// AppendList appends values to the list of a key, creating it if needed, then keeps its last maxLen values
+	// unless maxLen is zero
+	AppendList(key string, maxLen int64, values ...any) error
+	// TrimList keeps the last maxLen values of the list of a key
+	TrimList(key string, maxLen int64) error
+}
+
+// AppendList appends values to a list. With NativeLists the values are pushed to a Redis list atomically,
+// otherwise the JSON array is read and written back, and concurrent appends to the same key may be lost.
+func (r *RedisStore) AppendList(key string, maxLen int64, values ...any) error {
+	if r.NativeLists {
+		return r.pushList(key, maxLen, values)
+	}
+
+	var list []json.RawMessage
+	if err := r.Fetch(key, &list); err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+
+	for _, value := range values {
+		element, err := json.Marshal(value)
+		if err != nil {
+			return &MarshalError{Key: key, Err: err}
+		}
+		list = append(list, element)
+	}
+
+	return r.Put(key, trimmed(list, maxLen))
+}
+
+// TrimList keeps the last maxLen values of a list
+func (r *RedisStore) TrimList(key string, maxLen int64) error {
+	if r.NativeLists {
+		return redisError(key, r.Client.LTrim(context.Background(), r.prefixedKey(key), -maxLen, -1).Err())
+	}
+
+	var list []json.RawMessage
+	if err := r.Fetch(key, &list); err != nil {
+		return err
+	}
+
+	return r.Put(key, trimmed(list, maxLen))
+}
+
+// putList replaces the Redis list of a key with the values of a slice
+func (r *RedisStore) putList(key string, value any, ttl time.Duration, marshaler MarshalingAdapter) error {
+	elements, err := encodeElements(key, reflect.Indirect(reflect.ValueOf(value)), marshaler)
+	if err != nil {
+		return err
+	}
+
+	return r.writeList(context.Background(), key, elements, ttl)
+}
+
+func (r *RedisStore) writeList(ctx context.Context, key string, elements []any, ttl time.Duration) error {
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		r.queueList(ctx, pipe, key, elements, ttl)
+
+		return nil
+	})
+
+	return redisError(key, err)
+}
+
+// queueList queues the replacement of the Redis list of a key, for use in transactions
+func (r *RedisStore) queueList(ctx context.Context, pipe redis.Pipeliner, key string, elements []any, ttl time.Duration) {
+	prefixedKey := r.prefixedKey(key)
+
+	pipe.Del(ctx, prefixedKey)
+	if len(elements) > 0 {
+		pipe.RPush(ctx, prefixedKey, elements...)
+		if ttl > 0 {
+			pipe.PExpire(ctx, prefixedKey, ttl)
+		}
+	}
+}
+
+func (r *RedisStore) pushList(key string, maxLen int64, values []any) error {
+	if r.Marshaler == nil {
+		r.Marshaler = &BSONMarshalingAdapter{}
+	}
+
+	elements, err := encodeElements(key, reflect.ValueOf(values), r.Marshaler)
+	if err != nil || len(elements) == 0 {
+		return err
+	}
+
+	ctx := context.Background()
+	prefixedKey := r.prefixedKey(key)
+
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, prefixedKey, elements...)
+		if maxLen > 0 {
+			pipe.LTrim(ctx, prefixedKey, -maxLen, -1)
+		}
+		if r.Expiration > 0 {
+			pipe.PExpire(ctx, prefixedKey, jitter(r.Expiration, r.TTLJitter))
+		}
+
+		return nil
+	})
+
+	return redisError(key, err)
+}
+
+// fetchList decodes the Redis list of a key into the slice dest points to
+func (r *RedisStore) fetchList(key string, dest any) error {
+	elements, err := r.Client.LRange(context.Background(), r.prefixedKey(key), 0, -1).Result()
+	if err != nil {
+		return redisError(key, err)
+	}
+
+	// Redis deletes empty lists
+	if len(elements) == 0 {
+		return &keyNotFoundError{key: key}
+	}
+
+	list := reflect.ValueOf(dest).Elem()
+	decoded := reflect.MakeSlice(list.Type(), len(elements), len(elements))
+	for i, element := range elements {
+		if err = decodeValue([]byte(element), decoded.Index(i).Addr().Interface(), r.Marshaler); err != nil {
+			return &MarshalError{Key: key, Unmarshal: true, Err: err}
+		}
+	}
+	list.Set(decoded)
+
+	return nil
+}
+
+func encodeElements(key string, list reflect.Value, marshaler MarshalingAdapter) ([]any, error) {
+	elements := make([]any, list.Len())
+	for i := range elements {
+		b, err := encodeValue(list.Index(i).Interface(), marshaler)
+		if err != nil {
+			return nil, &MarshalError{Key: key, Err: err}
+		}
+		elements[i] = b
+	}
+
+	return elements, nil
+}
+
+// isList reports whether a value, or the value dest points to, is stored as a list: a slice other than bytes
+func isList(value any) bool {
+	t := reflect.TypeOf(value)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t != nil && t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8
+}
+
+// trimmed returns the last maxLen values of a list, or all of them when maxLen is zero
+func trimmed(list []json.RawMessage, maxLen int64) []json.RawMessage {
+	if maxLen <= 0 || int64(len(list)) <= maxLen {
+		return list
+	}
+
+	return list[int64(len(list))-maxLen:]
+}
@@ -0,0 +1,127 @@
+package kvsync
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"sync/atomic"
+)
+
+// PurgeByProducerVersion deletes the values under a prefix whose envelope was written by a given build,
+// e.g. a buggy release identified through FetchWithInfo, returning the number of values deleted.
+// The Marshaler must write envelopes (see EnvelopeMarshaler.Build).
+func (r *RedisStore) PurgeByProducerVersion(ctx context.Context, prefix string, version string) (int, error) {
+	decoder, ok := r.Marshaler.(EnvelopeDecoder)
+	if !ok {
+		return 0, fmt.Errorf("marshaler %T does not write envelopes", r.Marshaler)
+	}
+
+	pattern := r.scanPattern(prefix)
+	var purged int64
+
+	err := r.forEachNode(ctx, func(ctx context.Context, client redis.Cmdable) error {
+		keys, err := r.scanPrefix(ctx, client, pattern, prefix)
+		if err != nil {
+			return err
+		}
+
+		for len(keys) > 0 {
+			n := len(keys)
+			if n > 100 {
+				n = 100
+			}
+
+			stale, err := r.producedBy(ctx, client, decoder, keys[:n], version)
+			if err != nil {
+				return err
+			}
+
+			if err = r.unlinkValues(ctx, stale); err != nil {
+				return err
+			}
+
+			atomic.AddInt64(&purged, int64(len(stale)))
+			keys = keys[n:]
+		}
+
+		return nil
+	})
+
+	return int(purged), err
+}
+
+// producedBy returns the prefixed keys among keys whose envelope was written by a build, along with their chunk manifests
+func (r *RedisStore) producedBy(ctx context.Context, client redis.Cmdable, decoder EnvelopeDecoder, keys []string, build string) (map[string]chunkManifest, error) {
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	stale := make(map[string]chunkManifest)
+	for i, cmd := range cmds {
+		val, err := cmd.Bytes()
+		if err != nil {
+			// deleted since the scan, or not a string such as a secondary structure
+			continue
+		}
+
+		m, chunked := parseChunkManifest(val)
+		if chunked {
+			// chunks may live on other nodes of a cluster, r.Client routes them
+			if val, err = r.fetchRawChunks(ctx, keys[i], m); err != nil {
+				return nil, err
+			}
+		}
+
+		// chunks and values written without envelopes don't decode
+		envelope, err := decoder.Decode(val)
+		if err != nil || envelope.Payload == nil || envelope.Build != build {
+			continue
+		}
+
+		stale[keys[i]] = m
+	}
+
+	return stale, nil
+}
+
+func (r *RedisStore) fetchRawChunks(ctx context.Context, prefixedKey string, m chunkManifest) ([]byte, error) {
+	var val []byte
+	for i := 0; i < m.chunks; i++ {
+		chunk, err := r.Client.Get(ctx, prefixedChunkKey(prefixedKey, m, i)).Bytes()
+		if err != nil {
+			return nil, err
+		}
+		val = append(val, chunk...)
+	}
+
+	return val, nil
+}
+
+// unlinkValues deletes values by prefixed key along with their chunks and versions
+func (r *RedisStore) unlinkValues(ctx context.Context, values map[string]chunkManifest) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	_, err := r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, m := range values {
+			for i := 0; i < m.chunks; i++ {
+				pipe.Unlink(ctx, prefixedChunkKey(key, m, i))
+			}
+			pipe.Unlink(ctx, key)
+			pipe.Unlink(ctx, versionKey(key))
+		}
+
+		return nil
+	})
+
+	return err
+}
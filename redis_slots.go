@@ -0,0 +1,154 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strings"
+)
+
+const clusterSlots = 16384
+
+// hashSlot returns the Redis Cluster hash slot of a key, honoring {tag} hash tags
+func hashSlot(key string) int {
+	if tag, ok := hashTag(key); ok {
+		key = tag
+	}
+
+	return int(crc16(key) % clusterSlots)
+}
+
+// hashTag returns the non-empty content between the first "{" of a key and the following "}"
+func hashTag(key string) (string, bool) {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return "", false
+	}
+
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return "", false
+	}
+
+	return key[start+1 : start+1+end], true
+}
+
+// crc16 implements CRC16-CCITT (XMODEM), the checksum used by Redis Cluster
+func crc16(s string) uint16 {
+	var crc uint16
+
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// groupBySlot groups the indexes of prefixed keys by hash slot, preserving their order within a group
+func groupBySlot(prefixedKeys []string) [][]int {
+	var groups [][]int
+	groupOf := make(map[int]int)
+
+	for i, key := range prefixedKeys {
+		slot := hashSlot(key)
+
+		g, ok := groupOf[slot]
+		if !ok {
+			g = len(groups)
+			groupOf[slot] = g
+			groups = append(groups, nil)
+		}
+
+		groups[g] = append(groups[g], i)
+	}
+
+	return groups
+}
+
+// FetchBatch fetches several keys with one MGET per hash slot, all sent in a single pipeline,
+// so that it never fails with CROSSSLOT errors on Redis Cluster
+func (r *RedisStore) FetchBatch(keys []string, dests []any) []error {
+	if r.Marshaler == nil {
+		r.Marshaler = &BSONMarshalingAdapter{}
+	}
+
+	errs := make([]error, len(keys))
+	if len(keys) != len(dests) {
+		for i := range errs {
+			errs[i] = errors.New("keys and destinations must have the same length")
+		}
+
+		return errs
+	}
+
+	ctx := context.Background()
+
+	prefixedKeys := make([]string, len(keys))
+	for i, key := range keys {
+		prefixedKeys[i] = r.prefixedKey(key)
+	}
+
+	groups := groupBySlot(prefixedKeys)
+	cmds := make([]*redis.SliceCmd, len(groups))
+
+	_, _ = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for g, group := range groups {
+			groupKeys := make([]string, len(group))
+			for j, i := range group {
+				groupKeys[j] = prefixedKeys[i]
+			}
+
+			cmds[g] = pipe.MGet(ctx, groupKeys...)
+		}
+
+		return nil
+	})
+
+	for g, group := range groups {
+		values, err := cmds[g].Result()
+
+		for j, i := range group {
+			if err != nil {
+				errs[i] = redisError(keys[i], err)
+				continue
+			}
+
+			errs[i] = r.decodeBatchValue(ctx, keys[i], values[j], dests[i])
+		}
+	}
+
+	return errs
+}
+
+func (r *RedisStore) decodeBatchValue(ctx context.Context, key string, value any, dest any) error {
+	if !isPointer(dest) {
+		return ErrNotPointer
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return &keyNotFoundError{key: key, cause: redis.Nil}
+	}
+
+	val := []byte(s)
+
+	if m, ok := parseChunkManifest(val); ok {
+		var err error
+		if val, err = r.fetchChunks(ctx, key, m); err != nil {
+			return redisError(key, err)
+		}
+	}
+
+	if err := decodeValue(val, dest, r.Marshaler); err != nil {
+		return &MarshalError{Key: key, Unmarshal: true, Err: err}
+	}
+
+	return nil
+}
@@ -1,13 +1,20 @@
 package kvsync_test
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/alicebob/miniredis/v2"
 	"github.com/ndthuan/kvsync"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"gorm.io/gorm"
+	"io"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type erroneousMarshaler struct{}
@@ -53,9 +60,9 @@ func TestRedisStore_Set(t *testing.T) {
 			wantErr:   true,
 		},
 		{
-			name:    "set a non-struct",
+			name:    "set a channel",
 			key:     "user:2",
-			value:   "Alice",
+			value:   make(chan int),
 			wantErr: true,
 		},
 	}
@@ -73,6 +80,574 @@ func TestRedisStore_Set(t *testing.T) {
 	}
 }
 
+type Session struct {
+	ID    int
+	Token string
+}
+
+func (s Session) SyncExpiration() time.Duration {
+	return 30 * time.Minute
+}
+
+func TestRedisStore_SetExpiration(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.Expiration = 24 * time.Hour
+
+	assert.NoError(t, redisStore.Put("user:1", &User{ID: 1, Name: "Alice"}))
+	assert.NoError(t, redisStore.Put("session:1", &Session{ID: 1, Token: "token"}))
+
+	assert.Equal(t, 24*time.Hour, miniRedis.TTL("kvsync:user:1"))
+	assert.Equal(t, 30*time.Minute, miniRedis.TTL("kvsync:session:1"))
+}
+
+type Product struct {
+	ID  int
+	SKU string
+}
+
+func (p Product) SyncKeySpecs() map[string]kvsync.KeySpec {
+	return map[string]kvsync.KeySpec{
+		"id":  {Key: fmt.Sprintf("product:id:%d", p.ID)},
+		"sku": {Key: fmt.Sprintf("product:sku:%s", p.SKU), TTL: time.Hour},
+	}
+}
+
+func TestRedisStore_PerKeyExpiration(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.Expiration = 24 * time.Hour
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: redisStore,
+	})
+
+	assert.NoError(t, kvSync.Sync(&Product{ID: 1, SKU: "sku-1"}))
+
+	assert.Equal(t, 24*time.Hour, miniRedis.TTL("kvsync:product:id:1"))
+	assert.Equal(t, time.Hour, miniRedis.TTL("kvsync:product:sku:sku-1"))
+
+	fetched := Product{SKU: "sku-1"}
+	assert.NoError(t, kvSync.Fetch(&fetched, "sku"))
+	assert.Equal(t, 1, fetched.ID)
+}
+
+func TestRedisStore_TTLAndTouch(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.Expiration = 24 * time.Hour
+	redisStore.ChunkSize = 16
+
+	assert.NoError(t, redisStore.PutWithTTL("user:1", User{ID: 1, Name: "a name longer than a chunk"}, time.Minute))
+	chunks := chunkKeys(miniRedis)
+	assert.NotEmpty(t, chunks)
+
+	ttl, err := redisStore.TTL("user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, ttl)
+
+	assert.NoError(t, redisStore.Touch("user:1", time.Hour))
+	assert.Equal(t, time.Hour, miniRedis.TTL("kvsync:user:1"))
+	assert.Equal(t, time.Hour, miniRedis.TTL(chunks[1]), "chunks expire with their value")
+
+	assert.NoError(t, redisStore.Touch("user:1", 0))
+	assert.Equal(t, 24*time.Hour, miniRedis.TTL("kvsync:user:1"))
+
+	redisStore.Expiration = 0
+	assert.NoError(t, redisStore.Touch("user:1", 0))
+	ttl, err = redisStore.TTL("user:1")
+	assert.NoError(t, err)
+	assert.Zero(t, ttl, "keys without expiration")
+
+	_, err = redisStore.TTL("user:2")
+	assert.ErrorIs(t, err, kvsync.ErrKeyNotFound)
+	assert.ErrorIs(t, redisStore.Touch("user:2", time.Hour), kvsync.ErrKeyNotFound)
+}
+
+// chunkKeys returns the sorted keys of the chunks stored in Redis
+func chunkKeys(miniRedis *miniredis.Miniredis) []string {
+	var chunks []string
+	for _, key := range miniRedis.Keys() {
+		if strings.Contains(key, ":chunk:") {
+			chunks = append(chunks, key)
+		}
+	}
+
+	return chunks
+}
+
+func TestRedisStore_MissingChunk(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.ChunkSize = 16
+
+	assert.NoError(t, redisStore.Put("user:1", User{ID: 1, Name: "a name longer than a chunk"}))
+	miniRedis.Del(chunkKeys(miniRedis)[1])
+
+	var user User
+	err := redisStore.Fetch("user:1", &user)
+	assert.ErrorIs(t, err, kvsync.ErrCorrupted)
+	assert.NotErrorIs(t, err, kvsync.ErrKeyNotFound)
+}
+
+func TestRefresh(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.Expiration = 24 * time.Hour
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: redisStore,
+	})
+
+	assert.NoError(t, kvSync.Sync(&Product{ID: 1, SKU: "sku-1"}))
+	miniRedis.FastForward(30 * time.Minute)
+
+	assert.NoError(t, kvSync.Refresh(&Product{ID: 1, SKU: "sku-1"}))
+	assert.Equal(t, 24*time.Hour, miniRedis.TTL("kvsync:product:id:1"))
+	assert.Equal(t, time.Hour, miniRedis.TTL("kvsync:product:sku:sku-1"))
+
+	assert.NoError(t, kvSync.Refresh(Product{ID: 2, SKU: "sku-2"}), "missing keys are skipped")
+	assert.ErrorIs(t, kvSync.Refresh(User{ID: 1}), kvsync.ErrNotSyncable)
+}
+
+type Price struct {
+	ID     int
+	Amount int
+}
+
+func (p Price) SyncKeySpecs() map[string]kvsync.KeySpec {
+	return map[string]kvsync.KeySpec{
+		"id": {Key: fmt.Sprintf("price:id:%d", p.ID), SnapshotRetention: 7 * 24 * time.Hour},
+	}
+}
+
+func TestRedisStore_Snapshots(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: redisStore,
+	})
+
+	before := time.Now()
+	assert.NoError(t, kvSync.Sync(&Price{ID: 1, Amount: 100}))
+
+	var snapshotKey string
+	for _, key := range miniRedis.Keys() {
+		if strings.HasPrefix(key, "kvsync:price:id:1@") {
+			snapshotKey = strings.TrimPrefix(key, "kvsync:")
+		}
+	}
+	assert.NotEmpty(t, snapshotKey)
+	assert.Equal(t, time.Duration(0), miniRedis.TTL("kvsync:price:id:1"))
+	assert.Equal(t, 7*24*time.Hour, miniRedis.TTL("kvsync:"+snapshotKey))
+
+	at, err := time.Parse(kvsync.SnapshotTimeFormat, strings.TrimPrefix(snapshotKey, "price:id:1@"))
+	assert.NoError(t, err)
+	assert.WithinDuration(t, before, at, 2*time.Second)
+
+	var snapshot Price
+	assert.NoError(t, redisStore.Fetch(snapshotKey, &snapshot))
+	assert.Equal(t, 100, snapshot.Amount)
+}
+
+func TestRedisStore_TTLJitter(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.Expiration = time.Hour
+	redisStore.TTLJitter = 0.1
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		assert.NoError(t, redisStore.Put(key, &User{ID: i, Name: "Alice"}))
+
+		ttl := miniRedis.TTL("kvsync:" + key)
+		assert.GreaterOrEqual(t, ttl, 54*time.Minute)
+		assert.LessOrEqual(t, ttl, 66*time.Minute)
+	}
+}
+
+func TestRedisStore_DeleteByPrefix(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	for i := 0; i < 250; i++ {
+		assert.NoError(t, redisStore.Put(fmt.Sprintf("user:id:%d", i), &User{ID: i}))
+	}
+	assert.NoError(t, redisStore.Put("user:name:Alice", &User{ID: 1, Name: "Alice"}))
+	assert.NoError(t, redisStore.Put("user:id*", &User{ID: 1}))
+	_, err := redisStore.PutIfNewer("user:id:1", &User{ID: 1}, 2, time.Minute)
+	assert.NoError(t, err)
+
+	assert.NoError(t, redisStore.DeleteByPrefix("user:id*"))
+	assert.Len(t, miniRedis.Keys(), 252, "glob characters in the prefix are literal")
+
+	assert.NoError(t, redisStore.DeleteByPrefix("user:id:"))
+	assert.Equal(t, []string{"kvsync:user:name:Alice"}, miniRedis.Keys(), "versions are deleted along with values")
+
+	written, err := redisStore.PutIfNewer("user:id:1", &User{ID: 1}, 1, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, written, "deleted versions no longer reject writes")
+}
+
+func TestRedisStore_DeleteByPrefixHashTag(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.ChunkSize = 16
+	redisStore.HashTag = func(key string) string {
+		return strings.Split(key, ":")[2]
+	}
+
+	assert.NoError(t, redisStore.Put("user:id:1", &User{ID: 1, Name: "Alice, chunked"}))
+	assert.NoError(t, redisStore.Put("user:id:2", &User{ID: 2}))
+	assert.NoError(t, redisStore.Put("account:id:1", &User{ID: 1}))
+	_, err := redisStore.PutIfNewer("user:id:3", &User{ID: 3}, 2, time.Minute)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, chunkKeys(miniRedis))
+
+	assert.NoError(t, redisStore.DeleteByPrefix("user:"))
+	for _, key := range miniRedis.Keys() {
+		assert.NotContains(t, key, "user:")
+	}
+	assert.NoError(t, redisStore.Fetch("account:id:1", &User{}))
+}
+
+func TestRedisStore_ClusterClient(t *testing.T) {
+	miniRedis := miniredis.RunT(t)
+
+	redisStore := &kvsync.RedisStore{
+		Client: redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs: []string{miniRedis.Addr()},
+		}),
+	}
+
+	assert.NoError(t, redisStore.Put("user:1", &User{ID: 1, Name: "Alice"}))
+
+	var fetched User
+	assert.NoError(t, redisStore.Fetch("user:1", &fetched))
+	assert.Equal(t, "Alice", fetched.Name)
+
+	assert.NoError(t, redisStore.DeleteByPrefix("user:"))
+	assert.Empty(t, miniRedis.Keys())
+}
+
+func TestRedisStore_Chunking(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.ChunkSize = 16
+
+	user := &User{ID: 1, Name: strings.Repeat("Alice", 10)}
+	assert.NoError(t, redisStore.Put("user:1", user))
+	assert.Len(t, miniRedis.Keys(), 6, "1 manifest and 5 chunks")
+
+	var fetched User
+	assert.NoError(t, redisStore.Fetch("user:1", &fetched))
+	assert.Equal(t, *user, fetched)
+
+	stream, err := redisStore.FetchStream("user:1")
+	assert.NoError(t, err)
+	streamed, err := io.ReadAll(stream)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Close())
+
+	expected, err := bson.Marshal(user)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, streamed)
+
+	assert.NoError(t, redisStore.Delete("user:1"))
+	assert.Empty(t, miniRedis.Keys())
+}
+
+func TestRedisStore_ChunkRewrites(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.ChunkSize = 32
+
+	assert.NoError(t, redisStore.Put("user:1", &User{ID: 1, Name: strings.Repeat("Alice", 10)}))
+	stream, err := redisStore.FetchStream("user:1")
+	assert.NoError(t, err)
+
+	// the stream started before the rewrite reads the chunks of the first value only
+	assert.NoError(t, redisStore.Put("user:1", &User{ID: 1, Name: strings.Repeat("Bob", 4)}))
+	streamed, err := io.ReadAll(stream)
+	assert.NoError(t, err)
+	var streamedUser User
+	assert.NoError(t, bson.Unmarshal(streamed, &streamedUser))
+	assert.Equal(t, strings.Repeat("Alice", 10), streamedUser.Name)
+
+	var fetched User
+	assert.NoError(t, redisStore.Fetch("user:1", &fetched))
+	assert.Equal(t, strings.Repeat("Bob", 4), fetched.Name)
+
+	assert.NoError(t, redisStore.PutBatch([]kvsync.BatchEntry{{Key: "user:1", Value: &User{ID: 1}}})[0])
+	miniRedis.FastForward(time.Minute)
+	assert.Equal(t, []string{"kvsync:user:1"}, miniRedis.Keys(), "the chunks of replaced values expire")
+
+	// values chunked before chunks were named after nonces
+	legacy, err := bson.Marshal(&User{ID: 2, Name: "Alice"})
+	assert.NoError(t, err)
+	assert.NoError(t, miniRedis.Set("kvsync:user:2", "\x00kvsync:chunks:2"))
+	assert.NoError(t, miniRedis.Set("kvsync:user:2:chunk:0", string(legacy[:16])))
+	assert.NoError(t, miniRedis.Set("kvsync:user:2:chunk:1", string(legacy[16:])))
+	assert.NoError(t, redisStore.Fetch("user:2", &fetched))
+	assert.Equal(t, "Alice", fetched.Name)
+
+	_, err = redisStore.FetchStream("user:3")
+	assert.ErrorIs(t, err, kvsync.ErrKeyNotFound)
+
+	miniRedis.Del("kvsync:user:2:chunk:1")
+	stream, err = redisStore.FetchStream("user:2")
+	assert.NoError(t, err)
+	_, err = io.ReadAll(stream)
+	assert.ErrorIs(t, err, kvsync.ErrCorrupted)
+}
+
+func TestRedisStore_PutBatch(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	errs := redisStore.PutBatch([]kvsync.BatchEntry{
+		{Key: "user:1", Value: &User{ID: 1, Name: "Alice"}},
+		{Key: "user:alice", Value: &User{ID: 1, Name: "Alice"}, TTL: time.Minute},
+		{Key: "user:2", Value: make(chan int)},
+	})
+
+	assert.Len(t, errs, 3)
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.Error(t, errs[2])
+
+	var fetched User
+	assert.NoError(t, redisStore.Fetch("user:alice", &fetched))
+	assert.Equal(t, "Alice", fetched.Name)
+	assert.Equal(t, time.Minute, miniRedis.TTL("kvsync:user:alice"))
+	assert.False(t, miniRedis.Exists("kvsync:user:2"))
+}
+
+func TestRedisStore_PutBatchAtomic(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.Atomic = true
+	redisStore.ChunkSize = 16
+
+	errs := redisStore.PutBatch([]kvsync.BatchEntry{
+		{Key: "user:1", Value: &User{ID: 1, Name: "Alice"}},
+		{Key: "user:2", Value: make(chan int)},
+	})
+	assert.Error(t, errs[0], "the whole batch is aborted")
+	assert.Error(t, errs[1])
+	assert.Empty(t, miniRedis.Keys())
+
+	errs = redisStore.PutBatch([]kvsync.BatchEntry{
+		{Key: "user:1", Value: &User{ID: 1, Name: "Alice"}},
+		{Key: "user:alice", Value: &User{ID: 1, Name: "Alice"}},
+	})
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+
+	var fetched User
+	assert.NoError(t, redisStore.Fetch("user:alice", &fetched))
+	assert.Equal(t, "Alice", fetched.Name)
+}
+
+func TestRedisStore_FetchBatch(t *testing.T) {
+	miniRedis := miniredis.RunT(t)
+
+	redisStore := &kvsync.RedisStore{
+		Client: redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs: []string{miniRedis.Addr()},
+		}),
+		HashTag: func(key string) string {
+			return strings.Split(key, ":")[1]
+		},
+	}
+
+	assert.NoError(t, redisStore.Put("user:1", &User{ID: 1, Name: "Alice"}))
+	assert.NoError(t, redisStore.Put("user:2", &User{ID: 2, Name: "Bob"}))
+	assert.True(t, miniRedis.Exists("kvsync:{1}user:1"))
+
+	users := make([]User, 3)
+	errs := redisStore.FetchBatch(
+		[]string{"user:1", "user:2", "user:3"},
+		[]any{&users[0], &users[1], &users[2]},
+	)
+
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.ErrorIs(t, errs[2], redis.Nil)
+	assert.Equal(t, "Alice", users[0].Name)
+	assert.Equal(t, "Bob", users[1].Name)
+}
+
+func TestRedisStore_PutIfNewer(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	written, err := redisStore.PutIfNewer("user:1", &User{ID: 1, Name: "Alice v2"}, 2, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, written)
+
+	written, err = redisStore.PutIfNewer("user:1", &User{ID: 1, Name: "Alice v1"}, 1, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, written)
+
+	var fetched User
+	assert.NoError(t, redisStore.Fetch("user:1", &fetched))
+	assert.Equal(t, "Alice v2", fetched.Name)
+	assert.Equal(t, time.Minute, miniRedis.TTL("{kvsync:user:1}:version"))
+
+	assert.NoError(t, redisStore.Delete("user:1"))
+	assert.Empty(t, miniRedis.Keys())
+}
+
+func TestRedisStore_PutBatchIfNewer(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.NativeLists = true
+
+	errs := redisStore.PutBatchIfNewer([]kvsync.BatchEntry{
+		{Key: "user:1", Value: &User{ID: 1, Name: "Alice v2"}, TTL: time.Minute},
+		{Key: "user:1:tags", Value: []string{"a", "b"}},
+		{Key: "user:2", Value: make(chan int)},
+	}, 2)
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.Error(t, errs[2])
+	assert.Equal(t, time.Minute, miniRedis.TTL("{kvsync:user:1}:version"))
+
+	errs = redisStore.PutBatchIfNewer([]kvsync.BatchEntry{
+		{Key: "user:1", Value: &User{ID: 1, Name: "Alice v1"}},
+		{Key: "user:1:tags", Value: []string{"c"}},
+	}, 1)
+	assert.NoError(t, errs[0], "a stale version is not an error")
+	assert.NoError(t, errs[1])
+
+	var fetched User
+	assert.NoError(t, redisStore.Fetch("user:1", &fetched))
+	assert.Equal(t, "Alice v2", fetched.Name)
+
+	var tags []string
+	assert.NoError(t, redisStore.Fetch("user:1:tags", &tags))
+	assert.Equal(t, []string{"a", "b"}, tags)
+}
+
+func TestRedisStore_PutBatchIfNewerAtomic(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.Atomic = true
+	redisStore.NativeLists = true
+
+	errs := redisStore.PutBatchIfNewer([]kvsync.BatchEntry{
+		{Key: "user:1", Value: &User{ID: 1, Name: "Alice"}},
+		{Key: "user:2", Value: make(chan int)},
+	}, 1)
+	assert.Error(t, errs[0], "the whole batch is aborted")
+	assert.Error(t, errs[1])
+	assert.Empty(t, miniRedis.Keys())
+
+	_, err := redisStore.PutIfNewer("user:alice", &User{ID: 1, Name: "Alice v3"}, 3, 0)
+	assert.NoError(t, err)
+
+	errs = redisStore.PutBatchIfNewer([]kvsync.BatchEntry{
+		{Key: "user:1", Value: &User{ID: 1, Name: "Alice v2"}},
+		{Key: "user:alice", Value: &User{ID: 1, Name: "Alice v2"}},
+	}, 2)
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.False(t, miniRedis.Exists("kvsync:user:1"), "no key is written when one of them is newer")
+
+	errs = redisStore.PutBatchIfNewer([]kvsync.BatchEntry{
+		{Key: "user:1", Value: &User{ID: 1, Name: "Alice v4"}, TTL: time.Minute},
+		{Key: "user:alice", Value: &User{ID: 1, Name: "Alice v4"}},
+		{Key: "user:1:tags", Value: []string{"a", "b"}},
+	}, 4)
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.NoError(t, errs[2])
+	assert.Equal(t, time.Minute, miniRedis.TTL("kvsync:user:1"))
+
+	var fetched User
+	assert.NoError(t, redisStore.Fetch("user:alice", &fetched))
+	assert.Equal(t, "Alice v4", fetched.Name)
+
+	var tags []string
+	assert.NoError(t, redisStore.Fetch("user:1:tags", &tags))
+	assert.Equal(t, []string{"a", "b"}, tags)
+}
+
+// commandRecorder is a go-redis hook recording the names of the commands sent
+type commandRecorder struct {
+	commands []string
+	mutex    sync.Mutex
+}
+
+func (c *commandRecorder) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (c *commandRecorder) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		c.record(cmd)
+		return next(ctx, cmd)
+	}
+}
+
+func (c *commandRecorder) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			c.record(cmd)
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func (c *commandRecorder) record(cmd redis.Cmder) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.commands = append(c.commands, cmd.Name())
+}
+
+func TestSync_AtomicVersioning(t *testing.T) {
+	miniRedis := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: miniRedis.Addr()})
+	recorder := &commandRecorder{}
+	client.AddHook(recorder)
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:              &kvsync.RedisStore{Client: client, Atomic: true},
+		VersionByUpdatedAt: true,
+	})
+
+	now := time.Now()
+	newer := SyncedUser{Model: gorm.Model{ID: 1, UpdatedAt: now}, UUID: "uuid1", Username: "newer"}
+	older := SyncedUser{Model: gorm.Model{ID: 1, UpdatedAt: now.Add(-time.Second)}, UUID: "uuid1", Username: "older"}
+
+	assert.NoError(t, kvSync.Sync(newer))
+	// the script is loaded by the first EVAL once EVALSHA fails
+	assert.Equal(t, []string{"evalsha", "eval"}, recorder.commands, "all keys are written by a single script")
+
+	assert.NoError(t, kvSync.Sync(older))
+
+	for _, keyName := range []string{"id", "uuid", "composite"} {
+		fetched := SyncedUser{Model: gorm.Model{ID: 1}, UUID: "uuid1"}
+		assert.NoError(t, kvSync.Fetch(&fetched, keyName))
+		assert.Equal(t, "newer", fetched.Username)
+	}
+}
+
 func TestRedisStore_FetchInto(t *testing.T) {
 	redisStore, miniRedis := setUpStore()
 	defer miniRedis.Close()
@@ -144,15 +719,142 @@ func setUpStore() (*kvsync.RedisStore, *miniredis.Miniredis) {
 		panic(err)
 	}
 
-	clusterClient := redis.NewClusterClient(&redis.ClusterOptions{
-		Addrs: []string{s.Addr()},
-	})
-
 	// Create a new RedisStore
 	store := &kvsync.RedisStore{
-		Client:     clusterClient,
+		Client:     redis.NewClient(&redis.Options{Addr: s.Addr()}),
 		Expiration: 0,
 	}
 
 	return store, s
 }
+
+func TestRedisStore_TypedErrors(t *testing.T) {
+	miniRedis := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: miniRedis.Addr(), MaxRetries: -1})
+	store := &kvsync.RedisStore{Client: client}
+
+	var user User
+	err := store.Fetch("typed:missing", &user)
+	assert.ErrorIs(t, err, kvsync.ErrKeyNotFound)
+	assert.ErrorIs(t, err, redis.Nil, "the client error is kept")
+
+	var marshalErr *kvsync.MarshalError
+	err = (&kvsync.RedisStore{Client: client, Marshaler: erroneousMarshaler{}}).Put("typed:user", User{ID: 1})
+	assert.ErrorAs(t, err, &marshalErr)
+	assert.Equal(t, "typed:user", marshalErr.Key)
+	assert.False(t, marshalErr.Unmarshal)
+
+	assert.NoError(t, store.Put("typed:user", User{ID: 1}))
+	err = (&kvsync.RedisStore{Client: client, Marshaler: erroneousMarshaler{}}).Fetch("typed:user", &user)
+	assert.ErrorAs(t, err, &marshalErr)
+	assert.True(t, marshalErr.Unmarshal)
+
+	miniRedis.Close()
+
+	err = store.Fetch("typed:user", &user)
+	assert.ErrorIs(t, err, kvsync.ErrStoreUnavailable)
+	assert.NotErrorIs(t, err, kvsync.ErrKeyNotFound)
+	assert.ErrorIs(t, store.Put("typed:user", User{ID: 1}), kvsync.ErrStoreUnavailable)
+}
+
+func TestRedisStore_NonStructValues(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	assert.NoError(t, redisStore.Put("counter:visits", 41))
+	assert.NoError(t, redisStore.Put("flag:beta", true))
+	assert.NoError(t, redisStore.Put("name:1", "Alice"))
+	assert.NoError(t, redisStore.Put("ratio:1", 0.25))
+	assert.NoError(t, redisStore.Put("raw:1", []byte{0, 1, 2}))
+	assert.NoError(t, redisStore.Put("countries:1", map[string]int{"VN": 2, "FR": 1}))
+	assert.NoError(t, redisStore.Put("tags:1", []string{"a", "b"}))
+
+	// scalars are stored as text, so that Redis commands work on them
+	visits, err := miniRedis.Incr("kvsync:counter:visits", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, visits)
+
+	var count int64
+	assert.NoError(t, redisStore.Fetch("counter:visits", &count))
+	assert.Equal(t, int64(42), count)
+
+	var flag bool
+	assert.NoError(t, redisStore.Fetch("flag:beta", &flag))
+	assert.True(t, flag)
+
+	var name string
+	assert.NoError(t, redisStore.Fetch("name:1", &name))
+	assert.Equal(t, "Alice", name)
+
+	var ratio float32
+	assert.NoError(t, redisStore.Fetch("ratio:1", &ratio))
+	assert.Equal(t, float32(0.25), ratio)
+
+	var raw []byte
+	assert.NoError(t, redisStore.Fetch("raw:1", &raw))
+	assert.Equal(t, []byte{0, 1, 2}, raw)
+
+	var countries map[string]int
+	assert.NoError(t, redisStore.Fetch("countries:1", &countries))
+	assert.Equal(t, map[string]int{"VN": 2, "FR": 1}, countries)
+
+	var tags []string
+	assert.NoError(t, redisStore.Fetch("tags:1", &tags))
+	assert.Equal(t, []string{"a", "b"}, tags)
+
+	var marshalErr *kvsync.MarshalError
+	assert.ErrorAs(t, redisStore.Fetch("name:1", &count), &marshalErr)
+	assert.ErrorIs(t, redisStore.Fetch("name:1", name), kvsync.ErrNotPointer)
+}
+
+type Order struct {
+	ID    int
+	Total float64
+}
+
+func TestRedisStore_Lists(t *testing.T) {
+	for _, native := range []bool{false, true} {
+		t.Run(fmt.Sprintf("native %v", native), func(t *testing.T) {
+			redisStore, miniRedis := setUpStore()
+			defer miniRedis.Close()
+
+			redisStore.NativeLists = native
+			redisStore.Expiration = time.Hour
+
+			assert.NoError(t, redisStore.Put("user:recent_orders:1", []Order{{ID: 1, Total: 10}, {ID: 2, Total: 20}}))
+			assert.NoError(t, redisStore.AppendList("user:recent_orders:1", 3, Order{ID: 3, Total: 30}, Order{ID: 4, Total: 40}))
+
+			var orders []Order
+			assert.NoError(t, redisStore.Fetch("user:recent_orders:1", &orders))
+			assert.Equal(t, []Order{{ID: 2, Total: 20}, {ID: 3, Total: 30}, {ID: 4, Total: 40}}, orders)
+
+			assert.NoError(t, redisStore.TrimList("user:recent_orders:1", 1))
+			assert.NoError(t, redisStore.Fetch("user:recent_orders:1", &orders))
+			assert.Equal(t, []Order{{ID: 4, Total: 40}}, orders)
+			assert.Equal(t, time.Hour, miniRedis.TTL("kvsync:user:recent_orders:1"))
+
+			assert.NoError(t, redisStore.AppendList("user:recent_orders:2", 0, Order{ID: 5}))
+			assert.NoError(t, redisStore.Fetch("user:recent_orders:2", &orders))
+			assert.Equal(t, []Order{{ID: 5}}, orders)
+
+			errs := redisStore.PutBatch([]kvsync.BatchEntry{
+				{Key: "user:recent_orders:3", Value: []Order{{ID: 6}}},
+				{Key: "user:3", Value: User{ID: 3}},
+			})
+			assert.Equal(t, []error{nil, nil}, errs)
+			assert.NoError(t, redisStore.Fetch("user:recent_orders:3", &orders))
+			assert.Equal(t, []Order{{ID: 6}}, orders)
+
+			assert.NoError(t, redisStore.Delete("user:recent_orders:1"))
+			assert.ErrorIs(t, redisStore.Fetch("user:recent_orders:1", &orders), kvsync.ErrKeyNotFound)
+
+			if native {
+				assert.Equal(t, "list", miniRedis.Type("kvsync:user:recent_orders:2"))
+			} else {
+				value, err := miniRedis.Get("kvsync:user:recent_orders:2")
+				assert.NoError(t, err)
+				assert.Equal(t, `[{"ID":5,"Total":0}]`, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package kvsync
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// TTL returns the time left before a key expires with PTTL, zero if it doesn't
+func (r *RedisStore) TTL(key string) (time.Duration, error) {
+	return redisTTL(r.Client, key, r.prefixedKey(key))
+}
+
+func redisTTL(client redis.Cmdable, key string, prefixedKey string) (time.Duration, error) {
+	ttl, err := client.PTTL(context.Background(), prefixedKey).Result()
+	if err != nil {
+		return 0, redisError(key, err)
+	}
+
+	switch ttl {
+	case -2:
+		return 0, &keyNotFoundError{key: key}
+	case -1:
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+// Touch makes a key and its chunks expire after ttl, or RedisStore.Expiration when ttl is not positive,
+// jittered like writes. Keys are persisted when the resulting ttl is not positive.
+func (r *RedisStore) Touch(key string, ttl time.Duration) error {
+	ctx := context.Background()
+	if ttl <= 0 {
+		ttl = r.Expiration
+	}
+	ttl = jitter(ttl, r.TTLJitter)
+
+	prefixedKey := r.prefixedKey(key)
+
+	var found *redis.IntCmd
+	var head *redis.StringCmd
+	_, _ = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		found = pipe.Exists(ctx, prefixedKey)
+		expire(ctx, pipe, prefixedKey, ttl)
+		// only manifests of chunked values are read, native lists fail with WRONGTYPE
+		head = pipe.GetRange(ctx, prefixedKey, 0, chunkManifestLength)
+
+		return nil
+	})
+
+	if err := found.Err(); err != nil {
+		return redisError(key, err)
+	}
+
+	if found.Val() == 0 {
+		return &keyNotFoundError{key: key}
+	}
+
+	m, ok := parseChunkManifest([]byte(head.Val()))
+	if !ok {
+		return nil
+	}
+
+	_, err := r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := 0; i < m.chunks; i++ {
+			expire(ctx, pipe, r.chunkKey(key, m, i), ttl)
+		}
+
+		return nil
+	})
+
+	return redisError(key, err)
+}
+
+// expire queues a PEXPIRE of a key, or a PERSIST when ttl is not positive
+func expire(ctx context.Context, pipe redis.Pipeliner, key string, ttl time.Duration) {
+	if ttl > 0 {
+		pipe.PExpire(ctx, key, ttl)
+	} else {
+		pipe.Persist(ctx, key)
+	}
+}
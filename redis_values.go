@@ -0,0 +1,99 @@
+package kvsync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// encodeValue serializes a value by type: structs with the marshaler, strings, numbers and booleans as text so
+// that Redis commands such as INCR work on them, byte slices as is, and other maps and slices as JSON
+func encodeValue(value any, marshaler MarshalingAdapter) ([]byte, error) {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid, reflect.Ptr:
+		return nil, errors.New("value must not be nil")
+	case reflect.Struct:
+		return marshaler.Marshal(value)
+	case reflect.String:
+		return []byte(v.String()), nil
+	case reflect.Bool:
+		return strconv.AppendBool(nil, v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(nil, v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.AppendUint(nil, v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat(nil, v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Bytes(), nil
+		}
+
+		return json.Marshal(value)
+	case reflect.Map, reflect.Array:
+		return json.Marshal(value)
+	default:
+		return nil, fmt.Errorf("values of kind %s cannot be stored", v.Kind())
+	}
+}
+
+// decodeValue deserializes a value written by encodeValue into dest, according to the type dest points to
+func decodeValue(data []byte, dest any, marshaler MarshalingAdapter) error {
+	v := reflect.ValueOf(dest).Elem()
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return marshaler.Unmarshal(data, dest)
+	case reflect.String:
+		v.SetString(string(data))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(string(data))
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(string(data), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(string(data), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(string(data), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(append([]byte(nil), data...))
+			return nil
+		}
+
+		return json.Unmarshal(data, dest)
+	default:
+		return json.Unmarshal(data, dest)
+	}
+
+	return nil
+}
+
+// isPointer reports whether dest is a non-nil pointer values can be decoded into
+func isPointer(dest any) bool {
+	v := reflect.ValueOf(dest)
+
+	return v.Kind() == reflect.Ptr && !v.IsNil()
+}
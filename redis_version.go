@@ -0,0 +1,167 @@
+package kvsync
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// putIfNewerScript writes KEYS[1] and its version KEYS[2] unless the stored version is higher than ARGV[2]
+var putIfNewerScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[2])
+if current and tonumber(current) > tonumber(ARGV[2]) then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+	redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+	redis.call('SET', KEYS[2], ARGV[2])
+end
+return 1
+`)
+
+// putBatchIfNewerScript writes the values of KEYS[1], KEYS[3]... and their versions KEYS[2], KEYS[4]... unless
+// one of the stored versions is higher than ARGV[1]. Every value is followed in ARGV by its TTL, the number of
+// its elements (-1 for a string value rather than a native list) and its elements.
+var putBatchIfNewerScript = redis.NewScript(`
+local version = tonumber(ARGV[1])
+for i = 2, #KEYS, 2 do
+	local current = redis.call('GET', KEYS[i])
+	if current and tonumber(current) > version then
+		return 0
+	end
+end
+local arg = 2
+for i = 1, #KEYS, 2 do
+	local ttl = tonumber(ARGV[arg])
+	local count = tonumber(ARGV[arg + 1])
+	arg = arg + 2
+	if count < 0 then
+		redis.call('SET', KEYS[i], ARGV[arg])
+		arg = arg + 1
+	else
+		redis.call('DEL', KEYS[i])
+		for j = 0, count - 1 do
+			redis.call('RPUSH', KEYS[i], ARGV[arg + j])
+		end
+		arg = arg + count
+	end
+	redis.call('SET', KEYS[i + 1], ARGV[1])
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[i], ttl)
+		redis.call('PEXPIRE', KEYS[i + 1], ttl)
+	end
+end
+return 1
+`)
+
+// PutIfNewer atomically writes a value unless the stored version is higher. The version is kept under
+// a companion key sharing the value's hash slot. Versioned values are never chunked.
+func (r *RedisStore) PutIfNewer(key string, value any, version int64, ttl time.Duration) (bool, error) {
+	if r.Marshaler == nil {
+		r.Marshaler = &BSONMarshalingAdapter{}
+	}
+
+	if ttl <= 0 {
+		ttl = r.expiration(value)
+	}
+	ttl = jitter(ttl, r.TTLJitter)
+
+	// native lists are replaced as a whole, their versions are not tracked
+	if r.NativeLists && isList(value) {
+		return true, r.putList(key, value, ttl, r.Marshaler)
+	}
+
+	b, err := encodeValue(value, r.Marshaler)
+	if err != nil {
+		return false, &MarshalError{Key: key, Err: err}
+	}
+
+	prefixedKey := r.prefixedKey(key)
+
+	written, err := putIfNewerScript.Run(
+		context.Background(),
+		r.Client,
+		[]string{prefixedKey, versionKey(prefixedKey)},
+		b, version, ttl.Milliseconds(),
+	).Int()
+
+	return written == 1, redisError(key, err)
+}
+
+// versionKey returns the key holding the version of a value, in the same hash slot as the value
+func versionKey(prefixedKey string) string {
+	if _, ok := hashTag(prefixedKey); ok {
+		return prefixedKey + ":version"
+	}
+
+	return "{" + prefixedKey + "}:version"
+}
+
+// PutBatchIfNewer writes the entries of a versioned entity in a single pipeline, each unless its stored version
+// is higher. When Atomic is set, a single script writes either all entries or none of them when one of the
+// stored versions is higher. Versioned values are never chunked.
+func (r *RedisStore) PutBatchIfNewer(entries []BatchEntry, version int64) []error {
+	if r.Marshaler == nil {
+		r.Marshaler = &BSONMarshalingAdapter{}
+	}
+
+	ctx := context.Background()
+	payloads, lists, ttls, errs := r.encodeBatch(entries)
+
+	if r.Atomic {
+		for _, err := range errs {
+			if err != nil {
+				return batchErrors(len(entries), fmt.Errorf("atomic batch aborted: %w", err))
+			}
+		}
+
+		keys := make([]string, 0, 2*len(entries))
+		args := []any{version}
+		for i, entry := range entries {
+			keys = append(keys, r.prefixedKey(entry.Key), versionKey(r.prefixedKey(entry.Key)))
+			args = append(args, versionedBatchArgs(payloads[i], lists[i], ttls[i])...)
+		}
+
+		err := putBatchIfNewerScript.Run(ctx, r.Client, keys, args...).Err()
+
+		return batchErrors(len(entries), redisError("", err))
+	}
+
+	cmds := make([]*redis.Cmd, len(entries))
+
+	_, _ = r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, entry := range entries {
+			if errs[i] != nil {
+				continue
+			}
+
+			prefixedKey := r.prefixedKey(entry.Key)
+			args := append([]any{version}, versionedBatchArgs(payloads[i], lists[i], ttls[i])...)
+			// EVALSHA can't fall back to EVAL within a pipeline
+			cmds[i] = putBatchIfNewerScript.Eval(ctx, pipe, []string{prefixedKey, versionKey(prefixedKey)}, args...)
+		}
+
+		return nil
+	})
+
+	for i, cmd := range cmds {
+		if cmd != nil {
+			errs[i] = redisError(entries[i].Key, cmd.Err())
+		}
+	}
+
+	return errs
+}
+
+// versionedBatchArgs returns the arguments of putBatchIfNewerScript for a value or a native list
+func versionedBatchArgs(payload []byte, list []any, ttl time.Duration) []any {
+	if list == nil {
+		return []any{ttl.Milliseconds(), -1, payload}
+	}
+
+	return append([]any{ttl.Milliseconds(), len(list)}, list...)
+}
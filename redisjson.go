@@ -0,0 +1,154 @@
+package kvsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"reflect"
+	"time"
+)
+
+// RedisJSONStore is a KVStore storing values as JSON documents through the RedisJSON module
+// (JSON.SET/JSON.GET), so that consumers can run server-side JSONPath queries on synced entities
+type RedisJSONStore struct {
+	Client     redis.Cmdable
+	Prefix     string
+	Expiration time.Duration
+	// TTLJitter randomizes expirations within a fraction of the TTL, see RedisStore.TTLJitter
+	TTLJitter float64
+}
+
+func (r *RedisJSONStore) Put(key string, value any) error {
+	return r.put(key, value, jitter(r.expiration(value), r.TTLJitter))
+}
+
+// PutWithTTL stores a value with an expiration overriding both RedisJSONStore.Expiration and Expirable
+func (r *RedisJSONStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	return r.put(key, value, jitter(ttl, r.TTLJitter))
+}
+
+func (r *RedisJSONStore) put(key string, value any, ttl time.Duration) error {
+	if !isStruct(value) {
+		return errors.New("value must be a struct")
+	}
+
+	b, err := json.Marshal(applyFieldTags(value))
+	if err != nil {
+		return &MarshalError{Key: key, Err: err}
+	}
+
+	ctx := context.Background()
+	prefixedKey := r.prefixedKey(key)
+
+	// JSON.SET has no expiration argument, MULTI/EXEC keeps the document and its TTL consistent
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.JSONSet(ctx, prefixedKey, "$", b)
+		if ttl > 0 {
+			pipe.Expire(ctx, prefixedKey, ttl)
+		}
+
+		return nil
+	})
+
+	return redisError(key, err)
+}
+
+func (r *RedisJSONStore) Fetch(key string, dest any) error {
+	if reflect.TypeOf(dest).Kind() != reflect.Ptr || !isStruct(dest) {
+		return ErrNotPointer
+	}
+
+	val, err := r.Client.JSONGet(context.Background(), r.prefixedKey(key)).Result()
+	if err != nil {
+		return redisError(key, err)
+	}
+
+	if val == "" {
+		return &keyNotFoundError{key: key, cause: redis.Nil}
+	}
+
+	if err = unmarshalFieldTags([]byte(val), dest, json.Unmarshal); err != nil {
+		return &MarshalError{Key: key, Unmarshal: true, Err: err}
+	}
+
+	return nil
+}
+
+// FetchPath evaluates a JSONPath expression against a stored document and unmarshals the matches,
+// which JSON.GET returns as an array, into dest
+func (r *RedisJSONStore) FetchPath(key string, path string, dest any) error {
+	val, err := r.Client.JSONGet(context.Background(), r.prefixedKey(key), path).Result()
+	if err != nil {
+		return redisError(key, err)
+	}
+
+	if val == "" {
+		return &keyNotFoundError{key: key, cause: redis.Nil}
+	}
+
+	if err = json.Unmarshal([]byte(val), dest); err != nil {
+		return &MarshalError{Key: key, Unmarshal: true, Err: err}
+	}
+
+	return nil
+}
+
+func (r *RedisJSONStore) Exists(key string) (bool, error) {
+	n, err := r.Client.Exists(context.Background(), r.prefixedKey(key)).Result()
+	if err != nil {
+		return false, redisError(key, err)
+	}
+
+	return n > 0, nil
+}
+
+// TTL returns the time left before a key expires with PTTL, zero if it doesn't
+func (r *RedisJSONStore) TTL(key string) (time.Duration, error) {
+	return redisTTL(r.Client, key, r.prefixedKey(key))
+}
+
+// Touch makes a key expire after ttl, or RedisJSONStore.Expiration when ttl is not positive
+func (r *RedisJSONStore) Touch(key string, ttl time.Duration) error {
+	ctx := context.Background()
+	if ttl <= 0 {
+		ttl = r.Expiration
+	}
+
+	var found *redis.IntCmd
+	_, err := r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		found = pipe.Exists(ctx, r.prefixedKey(key))
+		expire(ctx, pipe, r.prefixedKey(key), jitter(ttl, r.TTLJitter))
+
+		return nil
+	})
+	if err != nil {
+		return redisError(key, err)
+	}
+
+	if found.Val() == 0 {
+		return &keyNotFoundError{key: key}
+	}
+
+	return nil
+}
+
+func (r *RedisJSONStore) Delete(key string) error {
+	return redisError(key, r.Client.Del(context.Background(), r.prefixedKey(key)).Err())
+}
+
+func (r *RedisJSONStore) expiration(value any) time.Duration {
+	if e, ok := value.(Expirable); ok {
+		return e.SyncExpiration()
+	}
+
+	return r.Expiration
+}
+
+func (r *RedisJSONStore) prefixedKey(key string) string {
+	if r.Prefix == "" {
+		r.Prefix = "kvsync:"
+	}
+
+	return r.Prefix + key
+}
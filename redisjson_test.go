@@ -0,0 +1,159 @@
+package kvsync_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ndthuan/kvsync"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// redisJSONEmulator is a go-redis hook emulating the RedisJSON commands on miniredis, which lacks the module:
+// documents are stored as strings, JSON.SET is sent as SET and JSON.GET as GET, evaluating "$.Field" paths
+type redisJSONEmulator struct{}
+
+func (e redisJSONEmulator) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (e redisJSONEmulator) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		jsonCmd, ok := cmd.(*redis.JSONCmd)
+		if !ok || cmd.Name() != "json.get" {
+			return next(ctx, cmd)
+		}
+
+		args := cmd.Args()
+		get := redis.NewStringCmd(ctx, "get", args[1])
+		if err := next(ctx, get); err != nil {
+			jsonCmd.SetErr(err)
+			return err
+		}
+		doc := get.Val()
+
+		if len(args) < 3 || doc == "" {
+			jsonCmd.SetVal(doc)
+			return nil
+		}
+
+		var fields map[string]json.RawMessage
+		_ = json.Unmarshal([]byte(doc), &fields)
+		jsonCmd.SetVal("[" + string(fields[strings.TrimPrefix(args[2].(string), "$.")]) + "]")
+
+		return nil
+	}
+}
+
+func (e redisJSONEmulator) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if cmd.Name() == "json.set" {
+				// JSON.SET key path document, like SET key document KEEPTTL, keeps the expiration of the key
+				args := cmd.Args()
+				args[0], args[2], args[3] = "set", args[3], "keepttl"
+			}
+		}
+
+		return next(ctx, cmds)
+	}
+}
+
+func setUpRedisJSONStore(t *testing.T) (*kvsync.RedisJSONStore, *miniredis.Miniredis) {
+	miniRedis := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: miniRedis.Addr()})
+	client.AddHook(redisJSONEmulator{})
+
+	return &kvsync.RedisJSONStore{Client: client}, miniRedis
+}
+
+type TaggedDocument struct {
+	ID     int
+	Name   string
+	Secret string `kvsync:"-"`
+}
+
+func TestRedisJSONStore(t *testing.T) {
+	store, miniRedis := setUpRedisJSONStore(t)
+	store.Expiration = time.Hour
+
+	assert.NoError(t, store.Put("user:1", &TaggedDocument{ID: 1, Name: "Alice", Secret: "hash"}))
+	assert.Equal(t, time.Hour, miniRedis.TTL("kvsync:user:1"))
+
+	doc, err := miniRedis.Get("kvsync:user:1")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"ID":1,"Name":"Alice"}`, doc, "documents are plain JSON honoring field tags")
+
+	var fetched TaggedDocument
+	assert.NoError(t, store.Fetch("user:1", &fetched))
+	assert.Equal(t, TaggedDocument{ID: 1, Name: "Alice"}, fetched)
+
+	var names []string
+	assert.NoError(t, store.FetchPath("user:1", "$.Name", &names))
+	assert.Equal(t, []string{"Alice"}, names)
+
+	assert.NoError(t, store.Put("session:1", Session{ID: 1, Token: "token"}))
+	assert.Equal(t, 30*time.Minute, miniRedis.TTL("kvsync:session:1"), "Expirable overrides the expiration")
+
+	assert.NoError(t, store.PutWithTTL("user:2", TaggedDocument{ID: 2}, time.Minute))
+	assert.Equal(t, time.Minute, miniRedis.TTL("kvsync:user:2"))
+
+	found, err := store.Exists("user:2")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	ttl, err := store.TTL("user:2")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, ttl)
+
+	assert.NoError(t, store.Touch("user:2", 0))
+	assert.Equal(t, time.Hour, miniRedis.TTL("kvsync:user:2"))
+	assert.ErrorIs(t, store.Touch("user:3", time.Hour), kvsync.ErrKeyNotFound)
+
+	assert.NoError(t, store.Delete("user:2"))
+	found, err = store.Exists("user:2")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.ErrorIs(t, store.Fetch("user:2", &fetched), kvsync.ErrKeyNotFound)
+	assert.ErrorIs(t, store.FetchPath("user:2", "$.Name", &names), kvsync.ErrKeyNotFound)
+}
+
+func TestRedisJSONStore_Errors(t *testing.T) {
+	store, miniRedis := setUpRedisJSONStore(t)
+	store.Prefix = "json:"
+
+	assert.Error(t, store.Put("user:1", "not a struct"))
+
+	var marshalErr *kvsync.MarshalError
+	assert.ErrorAs(t, store.Put("user:1", struct{ C chan int }{}), &marshalErr)
+
+	var fetched TaggedDocument
+	assert.ErrorIs(t, store.Fetch("user:1", fetched), kvsync.ErrNotPointer)
+
+	miniRedis.Set("json:empty", "")
+	assert.ErrorIs(t, store.Fetch("empty", &fetched), kvsync.ErrKeyNotFound)
+	assert.ErrorIs(t, store.FetchPath("empty", "$.Name", &fetched), kvsync.ErrKeyNotFound)
+
+	miniRedis.Set("json:invalid", `{"ID":"one"}`)
+	assert.ErrorAs(t, store.Fetch("invalid", &fetched), &marshalErr)
+	assert.True(t, marshalErr.Unmarshal)
+	assert.ErrorAs(t, store.FetchPath("invalid", "$.ID", &fetched), &marshalErr)
+
+	miniRedis.Close()
+
+	assert.ErrorIs(t, store.Put("user:1", TaggedDocument{ID: 1}), kvsync.ErrStoreUnavailable)
+	assert.ErrorIs(t, store.Fetch("user:1", &fetched), kvsync.ErrStoreUnavailable)
+	assert.ErrorIs(t, store.FetchPath("user:1", "$.Name", &fetched), kvsync.ErrStoreUnavailable)
+	assert.ErrorIs(t, store.Delete("user:1"), kvsync.ErrStoreUnavailable)
+	assert.ErrorIs(t, store.Touch("user:1", time.Minute), kvsync.ErrStoreUnavailable)
+
+	_, err := store.Exists("user:1")
+	assert.ErrorIs(t, err, kvsync.ErrStoreUnavailable)
+	_, err = store.TTL("user:1")
+	assert.ErrorIs(t, err, kvsync.ErrStoreUnavailable)
+}
@@ -0,0 +1,68 @@
+package kvsync
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var registeredModels sync.Map
+
+// RegisterModel registers a model type by its ModelName so that values stored in an Envelope can be
+// decoded by FetchAny without knowing their type in advance
+func RegisterModel[T any]() {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	registeredModels.Store(t.String(), t)
+}
+
+// registeredModel returns a pointer to a new value of a registered model type
+func registeredModel(name string) (any, error) {
+	t, ok := registeredModels.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("model %s is not registered", name)
+	}
+
+	return reflect.New(t.(reflect.Type)).Interface(), nil
+}
+
+// EnvelopeDecoder is implemented by marshalers that wrap values in an Envelope, such as EnvelopeMarshaler
+type EnvelopeDecoder interface {
+	Decode(data []byte) (Envelope, error)
+}
+
+// AnyFetcher is implemented by stores able to fetch values of registered models without a typed destination
+type AnyFetcher interface {
+	FetchAny(key string) (any, error)
+}
+
+// decodeAny decodes an enveloped value into a new value of its registered type
+func decodeAny(data []byte, marshaler MarshalingAdapter) (any, error) {
+	decoder, ok := marshaler.(EnvelopeDecoder)
+	if !ok {
+		return nil, fmt.Errorf("marshaler %T does not write envelopes", marshaler)
+	}
+
+	envelope, err := decoder.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if envelope.Type == "" {
+		return nil, fmt.Errorf("value has no envelope")
+	}
+
+	dest, err := registeredModel(envelope.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = marshaler.Unmarshal(data, dest); err != nil {
+		return nil, err
+	}
+
+	return reflect.ValueOf(dest).Elem().Interface(), nil
+}
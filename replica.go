@@ -0,0 +1,90 @@
+package kvsync
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// ReadReplicaStore writes to Primary and reads from Replicas in turn, e.g. RedisStores of the primary and the
+// replica endpoints of a Redis deployment. Without replicas, reads go to Primary.
+type ReadReplicaStore struct {
+	Primary  KVStore
+	Replicas []KVStore
+	// FallbackToPrimary reads from Primary when a replica misses or fails, e.g. because of replication lag
+	FallbackToPrimary bool
+
+	next uint64
+}
+
+func (r *ReadReplicaStore) Fetch(key string, dest any) error {
+	if len(r.Replicas) == 0 {
+		return r.Primary.Fetch(key, dest)
+	}
+
+	replica := r.Replicas[(atomic.AddUint64(&r.next, 1)-1)%uint64(len(r.Replicas))]
+
+	err := replica.Fetch(key, dest)
+	if err != nil && r.FallbackToPrimary {
+		return r.Primary.Fetch(key, dest)
+	}
+
+	return err
+}
+
+// Exists checks a key on the next replica like Fetch, falling back to Primary on misses if FallbackToPrimary
+func (r *ReadReplicaStore) Exists(key string) (bool, error) {
+	if len(r.Replicas) == 0 {
+		return exists(r.Primary, key)
+	}
+
+	replica := r.Replicas[(atomic.AddUint64(&r.next, 1)-1)%uint64(len(r.Replicas))]
+
+	found, err := exists(replica, key)
+	if (err != nil || !found) && r.FallbackToPrimary {
+		return exists(r.Primary, key)
+	}
+
+	return found, err
+}
+
+func (r *ReadReplicaStore) Put(key string, value any) error {
+	return r.Primary.Put(key, value)
+}
+
+func (r *ReadReplicaStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	return putWithTTL(r.Primary, key, value, ttl)
+}
+
+func (r *ReadReplicaStore) Delete(key string) error {
+	return deleteKey(r.Primary, key)
+}
+
+// TTL inspects Primary, whose expirations replicas follow
+func (r *ReadReplicaStore) TTL(key string) (time.Duration, error) {
+	return keyTTL(r.Primary, key)
+}
+
+func (r *ReadReplicaStore) Touch(key string, ttl time.Duration) error {
+	return touchKey(r.Primary, key, ttl)
+}
+
+// Keys scans the keys of Primary
+func (r *ReadReplicaStore) Keys(prefix string, limit int, cursor string) ([]string, string, error) {
+	return scan(r.Primary, prefix, limit, cursor)
+}
+
+// Ping pings Primary and every replica
+func (r *ReadReplicaStore) Ping(ctx context.Context) error {
+	if err := ping(ctx, r.Primary); err != nil {
+		return err
+	}
+
+	for _, replica := range r.Replicas {
+		if err := ping(ctx, replica); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReadReplicaStore(t *testing.T) {
+	primary := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	replicas := []kvsync.KVStore{
+		&kvsync.InMemoryStore{Store: map[string]any{"user:1": User{ID: 1, Name: "replica-1"}}},
+		&kvsync.InMemoryStore{Store: map[string]any{"user:1": User{ID: 1, Name: "replica-2"}}},
+	}
+
+	store := &kvsync.ReadReplicaStore{Primary: primary, Replicas: replicas}
+
+	assert.NoError(t, store.Put("user:2", User{ID: 2, Name: "primary"}))
+	assert.Len(t, primary.Store, 1)
+
+	var names []string
+	for i := 0; i < 4; i++ {
+		var user User
+		assert.NoError(t, store.Fetch("user:1", &user))
+		names = append(names, user.Name)
+	}
+	assert.Equal(t, []string{"replica-1", "replica-2", "replica-1", "replica-2"}, names)
+
+	// not replicated yet
+	var user User
+	assert.ErrorIs(t, store.Fetch("user:2", &user), kvsync.ErrKeyNotFound)
+
+	store.FallbackToPrimary = true
+	assert.NoError(t, store.Fetch("user:2", &user))
+	assert.Equal(t, "primary", user.Name)
+
+	assert.NoError(t, store.Delete("user:2"))
+	assert.Empty(t, primary.Store)
+}
+
+func TestReadReplicaStore_OptionalInterfaces(t *testing.T) {
+	primary := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	assertOptionalInterfaces(t, &kvsync.ReadReplicaStore{Primary: primary})
+
+	replica := &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{Store: make(map[string]any)}}
+	store := &kvsync.ReadReplicaStore{Primary: primary, Replicas: []kvsync.KVStore{replica}}
+
+	assert.NoError(t, store.Put("user:1", User{ID: 1}))
+
+	found, err := store.Exists("user:1")
+	assert.NoError(t, err)
+	assert.False(t, found, "not replicated yet")
+
+	store.FallbackToPrimary = true
+	found, err = store.Exists("user:1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	assert.NoError(t, store.Ping(context.Background()))
+
+	replica.ErrorRate = 1
+	assert.ErrorIs(t, store.Ping(context.Background()), kvsync.ErrStoreUnavailable)
+
+	var user User
+	assert.NoError(t, store.Fetch("user:1", &user), "a failing replica falls back to the primary")
+
+	assertOptionalInterfacesFail(t, &kvsync.ReadReplicaStore{Primary: replica}, kvsync.ErrStoreUnavailable)
+}
@@ -0,0 +1,178 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"time"
+)
+
+// resyncBatchSize is the number of rows loaded per query by ResyncSince
+const resyncBatchSize = 500
+
+// ResyncWatermark is the UpdatedAt of the last row ResyncSince synced for a model, kept in the KVStore
+type ResyncWatermark struct {
+	Model     string
+	UpdatedAt time.Time
+}
+
+// ResyncSince syncs the rows of a model updated at or after since, in UpdatedAt order, and persists the
+// watermark reached so that a zero since resumes from it, returning the number of rows synced. Rows written
+// by transactions committing long after their UpdatedAt can be missed, a periodic full resync covers them.
+func (k *kvSync) ResyncSince(ctx context.Context, db *gorm.DB, model any, since time.Time) (int, error) {
+	if since.IsZero() {
+		watermark, err := k.ResyncWatermark(model)
+		if err != nil {
+			return 0, err
+		}
+		since = watermark.UpdatedAt
+	}
+
+	synced := 0
+	err := updatedSince(ctx, db, model, since, resyncBatchSize, func(rows reflect.Value, lastUpdatedAt time.Time) error {
+		for i := 0; i < rows.Len(); i++ {
+			if err := k.Sync(rows.Index(i).Interface()); err != nil {
+				return err
+			}
+			synced++
+		}
+
+		return k.saveResyncWatermark(model, lastUpdatedAt)
+	})
+
+	return synced, err
+}
+
+// updatedSince calls fn with the rows of a model updated at or after since, a batch at a time in UpdatedAt
+// order, along with the UpdatedAt of the last row of the batch
+func updatedSince(ctx context.Context, db *gorm.DB, model any, since time.Time, batchSize int, fn func(rows reflect.Value, lastUpdatedAt time.Time) error) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+
+	updatedAt := stmt.Schema.LookUpField("UpdatedAt")
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if updatedAt == nil || pk == nil {
+		return fmt.Errorf("model %s needs an UpdatedAt field and a primary key", stmt.Schema.Name)
+	}
+
+	modelType := reflect.TypeOf(resolvePointer(model))
+	updatedAtColumn := clause.Column{Name: updatedAt.DBName}
+	pkColumn := clause.Column{Name: pk.DBName}
+
+	var lastUpdatedAt time.Time
+	var lastPK any
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		query := db.WithContext(ctx).Model(model).
+			Order(clause.OrderBy{Columns: []clause.OrderByColumn{{Column: updatedAtColumn}, {Column: pkColumn}}}).
+			Limit(batchSize)
+		if lastPK == nil {
+			query = query.Where(clause.Gte{Column: updatedAtColumn, Value: since})
+		} else {
+			// keyset pagination, rows sharing an UpdatedAt are told apart by primary key
+			query = query.Where(clause.Or(
+				clause.Gt{Column: updatedAtColumn, Value: lastUpdatedAt},
+				clause.And(clause.Eq{Column: updatedAtColumn, Value: lastUpdatedAt}, clause.Gt{Column: pkColumn, Value: lastPK}),
+			))
+		}
+
+		rows := reflect.New(reflect.SliceOf(modelType))
+		if err := query.Find(rows.Interface()).Error; err != nil {
+			return err
+		}
+
+		slice := rows.Elem()
+		if slice.Len() == 0 {
+			return nil
+		}
+
+		last := slice.Index(slice.Len() - 1)
+		value, _ := updatedAt.ValueOf(ctx, last)
+		lastUpdatedAt, _ = value.(time.Time)
+		lastPK, _ = pk.ValueOf(ctx, last)
+
+		if err := fn(slice, lastUpdatedAt); err != nil {
+			return err
+		}
+	}
+}
+
+// ResyncWatermark returns the watermark ResyncSince reached for a model, zero if it never ran
+func (k *kvSync) ResyncWatermark(model any) (ResyncWatermark, error) {
+	var watermark ResyncWatermark
+	if err := k.store.Fetch(resyncWatermarkKey(model), &watermark); err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return watermark, err
+	}
+
+	return watermark, nil
+}
+
+func (k *kvSync) saveResyncWatermark(model any, updatedAt time.Time) error {
+	if k.dryRun {
+		return nil
+	}
+
+	return k.store.Put(resyncWatermarkKey(model), ResyncWatermark{Model: ModelName(model), UpdatedAt: updatedAt})
+}
+
+func resyncWatermarkKey(model any) string {
+	return "resync:watermark:" + ModelName(model)
+}
+
+// FullResyncTask returns a scheduled task syncing every row of a model in primary key order
+func FullResyncTask(kvSync KVSync, db *gorm.DB, model any) TaskFunc {
+	return func(ctx context.Context) error {
+		pk, err := primaryField(db, model)
+		if err != nil {
+			return err
+		}
+
+		modelType := reflect.TypeOf(resolvePointer(model))
+		pkColumn := clause.Column{Name: pk.DBName}
+		var lastPK any
+
+		for {
+			query := db.WithContext(ctx).Model(model).Order(clause.OrderByColumn{Column: pkColumn}).Limit(resyncBatchSize)
+			if lastPK != nil {
+				query = query.Where(clause.Gt{Column: pkColumn, Value: lastPK})
+			}
+
+			rows := reflect.New(reflect.SliceOf(modelType))
+			if err := query.Find(rows.Interface()).Error; err != nil {
+				return err
+			}
+
+			slice := rows.Elem()
+			if slice.Len() == 0 {
+				return nil
+			}
+
+			for i := 0; i < slice.Len(); i++ {
+				if err := kvSync.Sync(slice.Index(i).Interface()); err != nil {
+					return err
+				}
+			}
+
+			lastPK, _ = pk.ValueOf(ctx, slice.Index(slice.Len()-1))
+		}
+	}
+}
+
+// IncrementalResyncTask returns a scheduled task syncing the rows of a model updated since its last run,
+// see ResyncSince
+func IncrementalResyncTask(kvSync KVSync, db *gorm.DB, model any) TaskFunc {
+	return func(ctx context.Context) error {
+		_, err := kvSync.ResyncSince(ctx, db, model, time.Time{})
+
+		return err
+	}
+}
@@ -0,0 +1,62 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestResyncSince(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i, uuid := range []string{"old", "recent-1", "recent-2", "recent-3"} {
+		user := &SyncedUser{UUID: uuid}
+		assert.NoError(t, db.Create(user).Error)
+		// recent-2 and recent-3 share their UpdatedAt
+		updatedAt := base.Add(time.Duration(i) * time.Hour)
+		if i == 3 {
+			updatedAt = base.Add(2 * time.Hour)
+		}
+		assert.NoError(t, db.Model(user).UpdateColumn("updated_at", updatedAt).Error)
+	}
+
+	synced, err := kvSync.ResyncSince(context.Background(), db, &SyncedUser{}, base.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, synced)
+	assert.NotContains(t, store.Store, "user:uuid:old")
+	assert.Contains(t, store.Store, "user:uuid:recent-1")
+	assert.Contains(t, store.Store, "user:uuid:recent-3")
+
+	watermark, err := kvSync.ResyncWatermark(&SyncedUser{})
+	assert.NoError(t, err)
+	assert.True(t, base.Add(2*time.Hour).Equal(watermark.UpdatedAt), watermark.UpdatedAt)
+
+	// a zero since resumes from the watermark, rows updated at the watermark are synced again
+	synced, err = kvSync.ResyncSince(context.Background(), db, &SyncedUser{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, synced)
+}
+
+func TestResyncWatermark_Missing(t *testing.T) {
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: &kvsync.InMemoryStore{
+			Store: make(map[string]any),
+		},
+	})
+
+	watermark, err := kvSync.ResyncWatermark(&SyncedUser{})
+	assert.NoError(t, err)
+	assert.True(t, watermark.UpdatedAt.IsZero())
+}
@@ -0,0 +1,149 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy is how a RetryStore retries the calls failing with a class of errors
+type RetryPolicy struct {
+	// Attempts is the number of attempts including the first one, defaults to 3
+	Attempts int
+	// Backoff is the delay before the first retry, doubled before each next one, defaults to 50ms
+	Backoff time.Duration
+	// MaxBackoff caps the delay between attempts, defaults to 1 second
+	MaxBackoff time.Duration
+}
+
+// RetryStore retries the calls of a store failing with transient errors, with exponential backoff. All its
+// operations are idempotent. Unlike the retries of the sync pipeline, see DeadLetterQueue, it also retries
+// the calls of manual Sync and Fetch callers.
+type RetryStore struct {
+	Store KVStore
+	// Policies map error classes, matched with errors.Is in no particular order, to how they are retried.
+	// Defaults to retrying ErrStoreUnavailable with the default RetryPolicy, other errors such as misses are
+	// never retried.
+	Policies map[error]RetryPolicy
+}
+
+func (r *RetryStore) Fetch(key string, dest any) error {
+	return r.retry(func() error {
+		return r.Store.Fetch(key, dest)
+	})
+}
+
+func (r *RetryStore) Put(key string, value any) error {
+	return r.retry(func() error {
+		return r.Store.Put(key, value)
+	})
+}
+
+func (r *RetryStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	return r.retry(func() error {
+		return putWithTTL(r.Store, key, value, ttl)
+	})
+}
+
+func (r *RetryStore) Delete(key string) error {
+	return r.retry(func() error {
+		return deleteKey(r.Store, key)
+	})
+}
+
+func (r *RetryStore) Exists(key string) (found bool, err error) {
+	err = r.retry(func() error {
+		found, err = exists(r.Store, key)
+		return err
+	})
+
+	return found, err
+}
+
+func (r *RetryStore) TTL(key string) (ttl time.Duration, err error) {
+	err = r.retry(func() error {
+		ttl, err = keyTTL(r.Store, key)
+		return err
+	})
+
+	return ttl, err
+}
+
+func (r *RetryStore) Touch(key string, ttl time.Duration) error {
+	return r.retry(func() error {
+		return touchKey(r.Store, key, ttl)
+	})
+}
+
+func (r *RetryStore) Keys(prefix string, limit int, cursor string) (keys []string, next string, err error) {
+	err = r.retry(func() error {
+		keys, next, err = scan(r.Store, prefix, limit, cursor)
+		return err
+	})
+
+	return keys, next, err
+}
+
+// Ping pings the store once, so that health checks report failures right away
+func (r *RetryStore) Ping(ctx context.Context) error {
+	return ping(ctx, r.Store)
+}
+
+func (r *RetryStore) retry(call func() error) error {
+	err := call()
+
+	for attempt := 1; err != nil; attempt++ {
+		policy, ok := r.policy(err)
+		if !ok || attempt >= policy.attempts() {
+			return err
+		}
+
+		time.Sleep(policy.backoff(attempt))
+		err = call()
+	}
+
+	return err
+}
+
+func (r *RetryStore) policy(err error) (RetryPolicy, bool) {
+	if r.Policies == nil {
+		return RetryPolicy{}, errors.Is(err, ErrStoreUnavailable)
+	}
+
+	for class, policy := range r.Policies {
+		if errors.Is(err, class) {
+			return policy, true
+		}
+	}
+
+	return RetryPolicy{}, false
+}
+
+func (p RetryPolicy) attempts() int {
+	if p.Attempts < 1 {
+		return 3
+	}
+
+	return p.Attempts
+}
+
+// backoff returns the delay after the given attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff, maxBackoff := p.Backoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = 50 * time.Millisecond
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = time.Second
+	}
+
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+
+	return backoff
+}
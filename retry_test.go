@@ -0,0 +1,109 @@
+package kvsync_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var errThrottled = errors.New("throttled")
+
+// flakyStore fails the first calls with the given errors
+type flakyStore struct {
+	*kvsync.InMemoryStore
+	errs  []error
+	calls int
+}
+
+func (f *flakyStore) fail() error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+
+	return err
+}
+
+func (f *flakyStore) Put(key string, value any) error {
+	if err := f.fail(); err != nil {
+		return err
+	}
+
+	return f.InMemoryStore.Put(key, value)
+}
+
+func (f *flakyStore) Fetch(key string, dest any) error {
+	if err := f.fail(); err != nil {
+		return err
+	}
+
+	return f.InMemoryStore.Fetch(key, dest)
+}
+
+func TestRetryStore(t *testing.T) {
+	unavailable := fmt.Errorf("dial tcp: %w", kvsync.ErrStoreUnavailable)
+	flaky := &flakyStore{InMemoryStore: &kvsync.InMemoryStore{Store: make(map[string]any)}}
+
+	store := &kvsync.RetryStore{
+		Store: flaky,
+		Policies: map[error]kvsync.RetryPolicy{
+			kvsync.ErrStoreUnavailable: {Attempts: 3, Backoff: time.Millisecond},
+			errThrottled:               {Attempts: 5, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond},
+		},
+	}
+
+	flaky.errs = []error{unavailable, unavailable}
+	assert.NoError(t, store.Put("user:1", User{ID: 1}))
+	assert.Equal(t, 3, flaky.calls)
+
+	flaky.calls, flaky.errs = 0, []error{unavailable, unavailable, unavailable}
+	assert.ErrorIs(t, store.Put("user:1", User{ID: 1}), kvsync.ErrStoreUnavailable)
+	assert.Equal(t, 3, flaky.calls)
+
+	flaky.calls, flaky.errs = 0, []error{errThrottled, errThrottled, errThrottled, errThrottled}
+	var user User
+	assert.NoError(t, store.Fetch("user:1", &user))
+	assert.Equal(t, 5, flaky.calls)
+
+	// misses are not retried
+	flaky.calls = 0
+	assert.ErrorIs(t, store.Fetch("user:2", &user), kvsync.ErrKeyNotFound)
+	assert.Equal(t, 1, flaky.calls)
+}
+
+func TestRetryStore_DefaultPolicy(t *testing.T) {
+	flaky := &flakyStore{
+		InMemoryStore: &kvsync.InMemoryStore{Store: make(map[string]any)},
+		errs:          []error{fmt.Errorf("timeout: %w", kvsync.ErrStoreUnavailable), errThrottled},
+	}
+
+	store := kvsync.Retry(nil)(flaky)
+	assert.ErrorIs(t, store.Put("user:1", User{ID: 1}), errThrottled)
+	assert.Equal(t, 2, flaky.calls)
+}
+
+func TestRetryStore_OptionalInterfaces(t *testing.T) {
+	assertOptionalInterfaces(t, &kvsync.RetryStore{Store: &kvsync.InMemoryStore{Store: make(map[string]any)}})
+
+	chaos := &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{}, ErrorRate: 1}
+	store := &kvsync.RetryStore{
+		Store: chaos,
+		Policies: map[error]kvsync.RetryPolicy{
+			kvsync.ErrStoreUnavailable: {Attempts: 3, Backoff: 2 * time.Millisecond, MaxBackoff: 3 * time.Millisecond},
+		},
+	}
+
+	metrics := kvsync.WithMetrics(chaos)
+	store.Store = metrics
+	assertOptionalInterfacesFail(t, store, kvsync.ErrStoreUnavailable)
+
+	stats := metrics.Stats()
+	assert.Equal(t, int64(3), stats[kvsync.OpTouch].Calls)
+	assert.Equal(t, int64(1), stats[kvsync.OpPing].Calls, "pings are not retried")
+}
@@ -0,0 +1,143 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// RewarmLoader loads the entity behind an expired or evicted key from the database, given the rest of the key
+// after the prefix it is registered for, e.g. "42" for "user:id:42" registered for "user:id:". A nil entity
+// means there is nothing to re-warm.
+type RewarmLoader func(ctx context.Context, id string) (any, error)
+
+// Rewarmer subscribes to the expired and evicted keyspace notifications of Redis and re-syncs the affected
+// entities, keeping hot keys warm without waiting for the next write. Redis must publish these notifications,
+// e.g. with "CONFIG SET notify-keyspace-events Exe".
+type Rewarmer struct {
+	// Store is the store the keys are synced to, its Client must support PSubscribe, e.g. *redis.Client
+	Store  *RedisStore
+	KVSync KVSync
+	// Loaders load the entities of the keys starting with their prefixes, the longest matching prefix wins
+	Loaders map[string]RewarmLoader
+	// ErrorCallback is optionally invoked when an entity cannot be loaded or synced
+	ErrorCallback func(key string, err error)
+}
+
+type subscriber interface {
+	PSubscribe(ctx context.Context, channels ...string) *redis.PubSub
+}
+
+// Run re-warms the keys expired or evicted until the context is done
+func (r *Rewarmer) Run(ctx context.Context) error {
+	client, ok := r.Store.Client.(subscriber)
+	if !ok {
+		return errors.New("redis client does not support PSubscribe")
+	}
+
+	pubSub := client.PSubscribe(ctx, "__keyevent@*__:expired", "__keyevent@*__:evicted")
+	defer pubSub.Close()
+
+	if _, err := pubSub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubSub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			if key, ok := r.Store.unprefixedKey(message.Payload); ok {
+				r.Rewarm(ctx, key)
+			}
+		}
+	}
+}
+
+// Rewarm loads and syncs the entity of a key, keys without a loader are ignored
+func (r *Rewarmer) Rewarm(ctx context.Context, key string) {
+	prefix, loader, ok := r.loader(key)
+	if !ok {
+		return
+	}
+
+	entity, err := loader(ctx, strings.TrimPrefix(key, prefix))
+	if err == nil && entity != nil {
+		err = r.KVSync.SyncAndWait(ctx, entity)
+	}
+
+	if err != nil && r.ErrorCallback != nil {
+		r.ErrorCallback(key, err)
+	}
+}
+
+func (r *Rewarmer) loader(key string) (string, RewarmLoader, bool) {
+	return matchLoader(r.Loaders, key)
+}
+
+// matchLoader returns the loader registered for the longest prefix of a key
+func matchLoader(loaders map[string]RewarmLoader, key string) (string, RewarmLoader, bool) {
+	prefixes := make([]string, 0, len(loaders))
+	for prefix := range loaders {
+		prefixes = append(prefixes, prefix)
+	}
+
+	// longest prefixes first
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return prefix, loaders[prefix], true
+		}
+	}
+
+	return "", nil, false
+}
+
+// repair re-syncs the entity of a corrupted key from its repair loader, deleting the key when the entity is gone
+func (k *kvSync) repair(key string) error {
+	prefix, loader, ok := matchLoader(k.repairLoaders, key)
+	if !ok {
+		return ErrCorrupted
+	}
+
+	entity, err := loader(k.ctx, strings.TrimPrefix(key, prefix))
+	if err != nil {
+		return err
+	}
+
+	if entity == nil {
+		return deleteKey(k.store, key)
+	}
+
+	return k.Sync(entity)
+}
+
+// LoadByPrimaryKey returns a RewarmLoader loading rows of a model by primary key, for keys such as "user:id:42"
+func LoadByPrimaryKey(db *gorm.DB, model any) RewarmLoader {
+	return func(ctx context.Context, id string) (any, error) {
+		pk, err := primaryField(db, model)
+		if err != nil {
+			return nil, err
+		}
+
+		row, ok := findRow(db.WithContext(ctx), reflect.TypeOf(resolvePointer(model)), clause.Eq{Column: clause.Column{Name: pk.DBName}, Value: id})
+		if !ok {
+			return nil, nil
+		}
+
+		return row, nil
+	}
+}
@@ -0,0 +1,70 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRewarmer(t *testing.T) {
+	store, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.Create(&SyncedUser{UUID: "rewarmed-uuid"}).Error)
+
+	var errs []error
+	var mutex sync.Mutex
+	rewarmer := &kvsync.Rewarmer{
+		Store:  store,
+		KVSync: kvSync,
+		Loaders: map[string]kvsync.RewarmLoader{
+			"user:id:": kvsync.LoadByPrimaryKey(db, &SyncedUser{}),
+		},
+		ErrorCallback: func(key string, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			errs = append(errs, err)
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- rewarmer.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return miniRedis.PubSubNumPat() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// keys without a loader, of other prefixes or of chunks are ignored
+	miniRedis.Publish("__keyevent@0__:expired", "kvsync:user:uuid:rewarmed-uuid")
+	miniRedis.Publish("__keyevent@0__:expired", "other:user:id:1")
+	miniRedis.Publish("__keyevent@0__:evicted", "kvsync:user:id:1:chunk:0")
+	// missing rows are not re-warmed
+	miniRedis.Publish("__keyevent@0__:evicted", "kvsync:user:id:2")
+	miniRedis.Publish("__keyevent@0__:expired", "kvsync:user:id:1")
+
+	assert.Eventually(t, func() bool {
+		return miniRedis.Exists("kvsync:user:uuid:rewarmed-uuid")
+	}, time.Second, 10*time.Millisecond)
+	assert.Len(t, miniRedis.Keys(), 3)
+
+	cancel()
+	assert.NoError(t, <-done)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Empty(t, errs)
+}
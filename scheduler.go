@@ -0,0 +1,257 @@
+package kvsync
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Schedule determines when a scheduled task runs next, a zero time meaning never
+type Schedule interface {
+	Next(from time.Time) time.Time
+}
+
+type interval time.Duration
+
+func (i interval) Next(from time.Time) time.Time {
+	return from.Add(time.Duration(i))
+}
+
+// Every returns a Schedule running a task at a fixed interval
+func Every(d time.Duration) Schedule {
+	return interval(d)
+}
+
+type daily struct {
+	hour     int
+	minute   int
+	location *time.Location
+}
+
+func (d daily) Next(from time.Time) time.Time {
+	from = from.In(d.location)
+	next := time.Date(from.Year(), from.Month(), from.Day(), d.hour, d.minute, 0, 0, d.location)
+	if !next.After(from) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next
+}
+
+// DailyAt returns a Schedule running a task once a day at the given time of day
+func DailyAt(hour, minute int, location *time.Location) Schedule {
+	if location == nil {
+		location = time.UTC
+	}
+
+	return daily{hour: hour, minute: minute, location: location}
+}
+
+// Locker provides leader election so that only one replica runs a scheduled task at a time
+type Locker interface {
+	// TryLock acquires the named lock for ttl, returning false if it is held elsewhere. Acquiring a lock already
+	// held by the same Locker extends it, which renews the locks of long-running tasks.
+	TryLock(ctx context.Context, name string, ttl time.Duration) (bool, error)
+	Unlock(ctx context.Context, name string) error
+}
+
+// TaskFunc is a recurring maintenance task such as a resync, a verification or a sweep
+type TaskFunc func(ctx context.Context) error
+
+// TaskStatus is the last-run status of a scheduled task
+type TaskStatus struct {
+	Name         string
+	Running      bool
+	LastRun      time.Time
+	LastDuration time.Duration
+	// LastErr is left out of JSON, see AdminTaskStatus.LastError
+	LastErr  error `json:"-"`
+	NextRun  time.Time
+	Runs     int64
+	Failures int64
+	// Skipped counts the runs skipped because another replica held the lock or the kill switch was engaged
+	Skipped int64
+}
+
+type scheduledTask struct {
+	schedule Schedule
+	task     TaskFunc
+	status   TaskStatus
+}
+
+// Scheduler runs recurring maintenance tasks, optionally under leader election
+type Scheduler struct {
+	// Locker is optional, without it every replica runs every task
+	Locker Locker
+	// LockTTL is the lease of the last run of a schedule, defaults to 1 hour. Other runs keep their lock until
+	// the next run is due, so that replicas whose ticks lag behind skip the run instead of repeating it. Leases
+	// are renewed while a task runs, and a task whose lock is taken over by another replica is cancelled.
+	LockTTL time.Duration
+	// KillSwitch optionally skips all runs while engaged
+	KillSwitch *KillSwitch
+
+	tasks map[string]*scheduledTask
+	mutex sync.Mutex
+}
+
+// Add registers a task, it must be called before Start
+func (s *Scheduler) Add(name string, schedule Schedule, task TaskFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.tasks == nil {
+		s.tasks = make(map[string]*scheduledTask)
+	}
+
+	s.tasks[name] = &scheduledTask{
+		schedule: schedule,
+		task:     task,
+		status:   TaskStatus{Name: name},
+	}
+}
+
+// Start runs the registered tasks in the background until the context is done.
+// Runs of the same task never overlap.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for name, t := range s.tasks {
+		go s.loop(ctx, name, t)
+	}
+}
+
+// Status returns the status of all registered tasks sorted by name
+func (s *Scheduler) Status() []TaskStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	statuses := make([]TaskStatus, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		statuses = append(statuses, t.status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+func (s *Scheduler) loop(ctx context.Context, name string, t *scheduledTask) {
+	for {
+		next := t.schedule.Next(time.Now())
+		if next.IsZero() {
+			// the schedule never matches, e.g. a cron expression for February 30th
+			return
+		}
+
+		s.mutex.Lock()
+		t.status.NextRun = next
+		s.mutex.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.run(ctx, name, t)
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, name string, t *scheduledTask) {
+	if s.KillSwitch.Engaged() {
+		s.mutex.Lock()
+		t.status.Skipped++
+		s.mutex.Unlock()
+
+		return
+	}
+
+	task := t.task
+	if s.Locker != nil {
+		locked, err := s.Locker.TryLock(ctx, "scheduler:"+name, s.lease(t))
+		if err != nil || !locked {
+			s.mutex.Lock()
+			t.status.Skipped++
+			s.mutex.Unlock()
+
+			return
+		}
+
+		task = s.renewing(name, t)
+	}
+
+	s.mutex.Lock()
+	t.status.Running = true
+	s.mutex.Unlock()
+
+	started := time.Now()
+	err := task(ctx)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	t.status.Running = false
+	t.status.LastRun = started
+	t.status.LastDuration = time.Since(started)
+	t.status.LastErr = err
+	t.status.Runs++
+	if err != nil {
+		t.status.Failures++
+	}
+}
+
+// renewing wraps a task to renew its lock while it runs, cancelling it when another replica took the lock over.
+// Once done, the lock is renewed a last time to be kept until the next run is due.
+func (s *Scheduler) renewing(name string, t *scheduledTask) TaskFunc {
+	return func(ctx context.Context) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(s.lease(t) / 2)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					// a failed renewal is retried on the next tick, before the lease left runs out
+					if locked, err := s.Locker.TryLock(ctx, "scheduler:"+name, s.lease(t)); err == nil && !locked {
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+
+		err := t.task(ctx)
+		close(done)
+
+		_, _ = s.Locker.TryLock(context.Background(), "scheduler:"+name, s.lease(t))
+
+		return err
+	}
+}
+
+// lease returns how long a run holds its lock: until the next run is due, the lock expiring by itself rather
+// than being released so that the run happens once per interval across replicas
+func (s *Scheduler) lease(t *scheduledTask) time.Duration {
+	now := time.Now()
+	if next := t.schedule.Next(now); !next.IsZero() && next.After(now) {
+		return next.Sub(now)
+	}
+
+	if s.LockTTL <= 0 {
+		return time.Hour
+	}
+
+	return s.LockTTL
+}
@@ -0,0 +1,270 @@
+package kvsync_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type denyingLocker struct{}
+
+func (d denyingLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	return false, nil
+}
+
+func (d denyingLocker) Unlock(ctx context.Context, name string) error {
+	return nil
+}
+
+func TestScheduler(t *testing.T) {
+	scheduler := &kvsync.Scheduler{}
+	scheduler.Add("verify", kvsync.Every(10*time.Millisecond), func(ctx context.Context) error {
+		return nil
+	})
+	scheduler.Add("sweep", kvsync.Every(10*time.Millisecond), func(ctx context.Context) error {
+		return errors.New("sweep error")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler.Start(ctx)
+
+	assert.Eventually(t, func() bool {
+		statuses := scheduler.Status()
+		return statuses[0].Runs >= 2 && statuses[1].Runs >= 2
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+
+	statuses := scheduler.Status()
+	assert.Equal(t, "sweep", statuses[0].Name)
+	assert.Equal(t, statuses[0].Runs, statuses[0].Failures)
+	assert.Error(t, statuses[0].LastErr)
+	assert.Equal(t, "verify", statuses[1].Name)
+	assert.Zero(t, statuses[1].Failures)
+	assert.NoError(t, statuses[1].LastErr)
+}
+
+func TestScheduler_Locker(t *testing.T) {
+	scheduler := &kvsync.Scheduler{Locker: denyingLocker{}}
+	scheduler.Add("verify", kvsync.Every(10*time.Millisecond), func(ctx context.Context) error {
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scheduler.Start(ctx)
+
+	assert.Eventually(t, func() bool {
+		return scheduler.Status()[0].Skipped >= 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Zero(t, scheduler.Status()[0].Runs)
+}
+
+// leases are the locks of replicas sharing a leasingLocker, expiring in real time unlike miniredis keys
+type leases struct {
+	owners    map[string]string
+	expiresAt map[string]time.Time
+	mutex     sync.Mutex
+}
+
+// leasingLocker is a re-entrant Locker of a replica, like a RedisLocker
+type leasingLocker struct {
+	leases *leases
+	owner  string
+}
+
+func (l leasingLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	l.leases.mutex.Lock()
+	defer l.leases.mutex.Unlock()
+
+	if owner := l.leases.owners[name]; owner != l.owner && time.Now().Before(l.leases.expiresAt[name]) {
+		return false, nil
+	}
+
+	l.leases.owners[name] = l.owner
+	l.leases.expiresAt[name] = time.Now().Add(ttl)
+
+	return true, nil
+}
+
+func (l leasingLocker) Unlock(ctx context.Context, name string) error {
+	l.leases.mutex.Lock()
+	defer l.leases.mutex.Unlock()
+
+	if l.leases.owners[name] == l.owner {
+		delete(l.leases.owners, name)
+		delete(l.leases.expiresAt, name)
+	}
+
+	return nil
+}
+
+func TestScheduler_StaggeredReplicas(t *testing.T) {
+	shared := &leases{owners: make(map[string]string), expiresAt: make(map[string]time.Time)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	replicas := make([]*kvsync.Scheduler, 2)
+	for i := range replicas {
+		replicas[i] = &kvsync.Scheduler{Locker: leasingLocker{leases: shared, owner: fmt.Sprintf("replica-%d", i)}}
+		replicas[i].Add("verify", kvsync.Every(40*time.Millisecond), func(ctx context.Context) error {
+			return nil
+		})
+		replicas[i].Start(ctx)
+
+		// the second replica ticks 15ms after the first one
+		time.Sleep(15 * time.Millisecond)
+	}
+
+	assert.Eventually(t, func() bool {
+		return replicas[0].Status()[0].Runs >= 5
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Zero(t, replicas[1].Status()[0].Runs, "the lock is kept until the next run")
+	assert.GreaterOrEqual(t, replicas[1].Status()[0].Skipped, int64(4))
+}
+
+func TestScheduler_LongRunningTask(t *testing.T) {
+	shared := &leases{owners: make(map[string]string), expiresAt: make(map[string]time.Time)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var running, overlaps, runs int32
+	replicas := make([]*kvsync.Scheduler, 2)
+	for i := range replicas {
+		replicas[i] = &kvsync.Scheduler{Locker: leasingLocker{leases: shared, owner: fmt.Sprintf("replica-%d", i)}}
+		replicas[i].Add("resync", kvsync.Every(20*time.Millisecond), func(ctx context.Context) error {
+			if atomic.AddInt32(&running, 1) > 1 {
+				atomic.AddInt32(&overlaps, 1)
+			}
+			defer atomic.AddInt32(&running, -1)
+
+			// runs take several intervals, the lease is renewed meanwhile
+			time.Sleep(100 * time.Millisecond)
+			atomic.AddInt32(&runs, 1)
+
+			return nil
+		})
+		replicas[i].Start(ctx)
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&runs) >= 3
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.Zero(t, atomic.LoadInt32(&overlaps), "replicas never run the task at the same time")
+}
+
+func TestScheduler_LostLock(t *testing.T) {
+	shared := &leases{owners: make(map[string]string), expiresAt: make(map[string]time.Time)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cancelled := make(chan struct{})
+	scheduler := &kvsync.Scheduler{Locker: leasingLocker{leases: shared, owner: "replica-0"}}
+	scheduler.Add("resync", kvsync.Every(20*time.Millisecond), func(ctx context.Context) error {
+		// another replica takes the lock over, e.g. after a pause longer than the lease
+		shared.mutex.Lock()
+		shared.owners["scheduler:resync"] = "replica-1"
+		shared.expiresAt["scheduler:resync"] = time.Now().Add(time.Hour)
+		shared.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			close(cancelled)
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+	scheduler.Start(ctx)
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the task is not cancelled when its lock is lost")
+	}
+
+	assert.Eventually(t, func() bool {
+		status := scheduler.Status()[0]
+		return status.Runs == 1 && errors.Is(status.LastErr, context.Canceled)
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestDailyAt(t *testing.T) {
+	schedule := kvsync.DailyAt(1, 30, time.UTC)
+
+	assert.Equal(t,
+		time.Date(2024, 6, 1, 1, 30, 0, 0, time.UTC),
+		schedule.Next(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t,
+		time.Date(2024, 6, 2, 1, 30, 0, 0, time.UTC),
+		schedule.Next(time.Date(2024, 6, 1, 1, 30, 0, 0, time.UTC)))
+}
+
+func TestCron(t *testing.T) {
+	from := time.Date(2024, 6, 1, 12, 34, 56, 0, time.UTC) // a Saturday
+
+	tests := map[string]time.Time{
+		"* * * * *":        time.Date(2024, 6, 1, 12, 35, 0, 0, time.UTC),
+		"*/15 * * * *":     time.Date(2024, 6, 1, 12, 45, 0, 0, time.UTC),
+		"0 2-5 * * *":      time.Date(2024, 6, 2, 2, 0, 0, 0, time.UTC),
+		"30 3 * * 1,3,5":   time.Date(2024, 6, 3, 3, 30, 0, 0, time.UTC),
+		"0 0 * * 7":        time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC),
+		"0 0 1 * *":        time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 15 * 1":       time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":       time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		"5/20 12 1 6 *":    time.Date(2024, 6, 1, 12, 45, 0, 0, time.UTC),
+		"0 0 30 2 *":       {},
+		"0 9 * 12 1-5":     time.Date(2024, 12, 2, 9, 0, 0, 0, time.UTC),
+		"0,30 13,14 * * *": time.Date(2024, 6, 1, 13, 0, 0, 0, time.UTC),
+	}
+
+	for expr, expected := range tests {
+		schedule, err := kvsync.Cron(expr, nil)
+		if assert.NoError(t, err, expr) {
+			assert.Equal(t, expected, schedule.Next(from), expr)
+		}
+	}
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		_, err := kvsync.Cron(expr, nil)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestResyncTasks(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	for _, uuid := range []string{"task-1", "task-2"} {
+		assert.NoError(t, db.Create(&SyncedUser{UUID: uuid}).Error)
+	}
+
+	assert.NoError(t, kvsync.FullResyncTask(kvSync, db, &SyncedUser{})(context.Background()))
+	assert.Len(t, store.Store, 6)
+
+	store.Store = make(map[string]any)
+	assert.NoError(t, kvsync.IncrementalResyncTask(kvSync, db, &SyncedUser{})(context.Background()))
+	assert.Contains(t, store.Store, "user:uuid:task-2")
+
+	watermark, err := kvSync.ResyncWatermark(&SyncedUser{})
+	assert.NoError(t, err)
+	assert.False(t, watermark.UpdatedAt.IsZero())
+}
@@ -0,0 +1,133 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+// ShadowMismatch describes a key whose value differs between the primary store and the shadow store
+type ShadowMismatch struct {
+	Key         string
+	Value       any
+	ShadowValue any
+	// ShadowErr is the error of the shadow read, e.g. ErrKeyNotFound for keys missing from the shadow store
+	ShadowErr error
+}
+
+// ShadowStore serves reads and writes from Store while comparing every read with Shadow in the background,
+// e.g. to validate a new marshaler or backend against production traffic before cutting over. Shadow reads
+// never affect callers, mismatches are reported to MismatchCallback. Values are compared as by Verifier.
+type ShadowStore struct {
+	Store  KVStore
+	Shadow KVStore
+	// MismatchCallback is invoked for every mismatch, from a background goroutine
+	MismatchCallback func(ShadowMismatch)
+	// MirrorWrites also writes and deletes keys in Shadow, ignoring its errors, unless Shadow is filled otherwise
+	MirrorWrites bool
+	// SampleRate is the fraction of reads compared, between 0 and 1, defaults to all of them
+	SampleRate float64
+}
+
+func (s *ShadowStore) Fetch(key string, dest any) error {
+	if err := s.Store.Fetch(key, dest); err != nil {
+		return err
+	}
+
+	if s.SampleRate > 0 && s.SampleRate < 1 && rand.Float64() >= s.SampleRate {
+		return nil
+	}
+
+	go s.compare(key, reflect.ValueOf(dest).Elem().Interface())
+
+	return nil
+}
+
+func (s *ShadowStore) Put(key string, value any) error {
+	if err := s.Store.Put(key, value); err != nil {
+		return err
+	}
+
+	if s.MirrorWrites {
+		_ = s.Shadow.Put(key, value)
+	}
+
+	return nil
+}
+
+func (s *ShadowStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	if err := putWithTTL(s.Store, key, value, ttl); err != nil {
+		return err
+	}
+
+	if s.MirrorWrites {
+		_ = putWithTTL(s.Shadow, key, value, ttl)
+	}
+
+	return nil
+}
+
+func (s *ShadowStore) Delete(key string) error {
+	err := deleteKey(s.Store, key)
+
+	if s.MirrorWrites && (err == nil || errors.Is(err, ErrKeyNotFound)) {
+		_ = deleteKey(s.Shadow, key)
+	}
+
+	return err
+}
+
+// Exists checks Store only
+func (s *ShadowStore) Exists(key string) (bool, error) {
+	return exists(s.Store, key)
+}
+
+// TTL inspects Store only
+func (s *ShadowStore) TTL(key string) (time.Duration, error) {
+	return keyTTL(s.Store, key)
+}
+
+func (s *ShadowStore) Touch(key string, ttl time.Duration) error {
+	if err := touchKey(s.Store, key, ttl); err != nil {
+		return err
+	}
+
+	if s.MirrorWrites {
+		_ = touchKey(s.Shadow, key, ttl)
+	}
+
+	return nil
+}
+
+// Keys scans the keys of Store only
+func (s *ShadowStore) Keys(prefix string, limit int, cursor string) ([]string, string, error) {
+	return scan(s.Store, prefix, limit, cursor)
+}
+
+// Ping pings Store only, Shadow being irrelevant to callers
+func (s *ShadowStore) Ping(ctx context.Context) error {
+	return ping(ctx, s.Store)
+}
+
+func (s *ShadowStore) compare(key string, value any) {
+	shadowValue := reflect.New(reflect.TypeOf(value))
+
+	err := s.Shadow.Fetch(key, shadowValue.Interface())
+	if err == nil {
+		var equal bool
+		if equal, err = equalJSON(value, shadowValue.Interface()); err == nil && equal {
+			return
+		}
+	}
+
+	if s.MismatchCallback != nil {
+		s.MismatchCallback(ShadowMismatch{
+			Key:         key,
+			Value:       value,
+			ShadowValue: shadowValue.Elem().Interface(),
+			ShadowErr:   err,
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package kvsync_test
+
+import (
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShadowStore(t *testing.T) {
+	primary := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	shadow, s := setUpStore()
+	defer s.Close()
+	shadow.Marshaler = &kvsync.CanonicalJSONMarshalingAdapter{}
+
+	var mismatches []kvsync.ShadowMismatch
+	var mutex sync.Mutex
+
+	store := &kvsync.ShadowStore{
+		Store:        primary,
+		Shadow:       shadow,
+		MirrorWrites: true,
+		MismatchCallback: func(mismatch kvsync.ShadowMismatch) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			mismatches = append(mismatches, mismatch)
+		},
+	}
+
+	assert.NoError(t, store.Put("user:1", User{ID: 1, Name: "Alice"}))
+	assert.NoError(t, store.Put("user:2", User{ID: 2, Name: "Bob"}))
+	assert.NoError(t, shadow.Put("user:2", User{ID: 2, Name: "Robert"}))
+	primary.Store["user:3"] = User{ID: 3, Name: "Carol"}
+
+	for _, key := range []string{"user:1", "user:2", "user:3"} {
+		var user User
+		assert.NoError(t, store.Fetch(key, &user))
+	}
+
+	var user User
+	assert.ErrorIs(t, store.Fetch("user:4", &user), kvsync.ErrKeyNotFound, "missing from the primary")
+
+	assert.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return len(mismatches) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	byKey := make(map[string]kvsync.ShadowMismatch)
+	for _, mismatch := range mismatches {
+		byKey[mismatch.Key] = mismatch
+	}
+
+	assert.Equal(t, User{ID: 2, Name: "Bob"}, byKey["user:2"].Value)
+	assert.Equal(t, User{ID: 2, Name: "Robert"}, byKey["user:2"].ShadowValue)
+	assert.NoError(t, byKey["user:2"].ShadowErr)
+	assert.ErrorIs(t, byKey["user:3"].ShadowErr, kvsync.ErrKeyNotFound)
+
+	assert.NoError(t, store.Delete("user:1"))
+	assert.ErrorIs(t, shadow.Fetch("user:1", &user), kvsync.ErrKeyNotFound)
+}
+
+func TestShadowStore_OptionalInterfaces(t *testing.T) {
+	shadow := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	store := &kvsync.ShadowStore{Store: &kvsync.InMemoryStore{Store: make(map[string]any)}, Shadow: shadow, MirrorWrites: true}
+
+	assertOptionalInterfaces(t, store)
+
+	assert.NoError(t, store.PutWithTTL("user:1", User{ID: 1}, time.Minute))
+	assert.NoError(t, store.Touch("user:1", time.Hour))
+
+	ttl, err := shadow.TTL("user:1")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second), "writes are mirrored")
+
+	assertOptionalInterfacesFail(t, &kvsync.ShadowStore{
+		Store:        &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{}, ErrorRate: 1},
+		Shadow:       shadow,
+		MirrorWrites: true,
+	}, kvsync.ErrStoreUnavailable)
+	assert.Contains(t, shadow.Store, "user:1", "failed writes are not mirrored")
+}
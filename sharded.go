@@ -0,0 +1,294 @@
+package kvsync
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Shard is a store of a ShardedStore, named so that its keys stay put when shards are added or removed
+type Shard struct {
+	Name  string
+	Store KVStore
+}
+
+// ShardedStore distributes keys across shards with consistent hashing, so that adding or removing a shard
+// only moves the keys of its neighbours on the hash ring. Each key is written to Replicas distinct shards
+// and read from the first one having it. Shards must not change once the store is in use.
+type ShardedStore struct {
+	Shards []Shard
+	// Replicas is the number of shards each key is written to, defaults to 1
+	Replicas int
+	// VirtualNodes is the number of points of each shard on the hash ring, defaults to 100
+	VirtualNodes int
+
+	ring []ringPoint
+	once sync.Once
+}
+
+type ringPoint struct {
+	hash  uint64
+	shard int
+}
+
+// Fetch reads a key from its first replica having it
+func (s *ShardedStore) Fetch(key string, dest any) error {
+	var firstErr error
+	for _, shard := range s.replicas(key) {
+		err := shard.Fetch(key, dest)
+		if err == nil {
+			return nil
+		}
+
+		if firstErr == nil || errors.Is(firstErr, ErrKeyNotFound) && !errors.Is(err, ErrKeyNotFound) {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Put writes a key to all of its replicas, returning the first error
+func (s *ShardedStore) Put(key string, value any) error {
+	return s.each(key, func(shard KVStore) error {
+		return shard.Put(key, value)
+	})
+}
+
+func (s *ShardedStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	return s.each(key, func(shard KVStore) error {
+		return putWithTTL(shard, key, value, ttl)
+	})
+}
+
+// Delete deletes a key from all of its replicas, returning ErrKeyNotFound only when none had it
+func (s *ShardedStore) Delete(key string) error {
+	notFound := 0
+	replicas := s.replicas(key)
+
+	for _, shard := range replicas {
+		if err := deleteKey(shard, key); errors.Is(err, ErrKeyNotFound) {
+			notFound++
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if notFound == len(replicas) {
+		return &keyNotFoundError{key: key}
+	}
+
+	return nil
+}
+
+// TTL inspects the replicas of a key until one has it
+func (s *ShardedStore) TTL(key string) (time.Duration, error) {
+	var firstErr error
+	for _, shard := range s.replicas(key) {
+		ttl, err := keyTTL(shard, key)
+		if err == nil {
+			return ttl, nil
+		}
+
+		if firstErr == nil || errors.Is(firstErr, ErrKeyNotFound) && !errors.Is(err, ErrKeyNotFound) {
+			firstErr = err
+		}
+	}
+
+	return 0, firstErr
+}
+
+// Touch extends the expiration of a key on all of its replicas, returning ErrKeyNotFound only when none
+// had it
+func (s *ShardedStore) Touch(key string, ttl time.Duration) error {
+	notFound := 0
+	replicas := s.replicas(key)
+
+	for _, shard := range replicas {
+		if err := touchKey(shard, key, ttl); errors.Is(err, ErrKeyNotFound) {
+			notFound++
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if notFound == len(replicas) {
+		return &keyNotFoundError{key: key}
+	}
+
+	return nil
+}
+
+// Exists checks the replicas of a key until one has it
+func (s *ShardedStore) Exists(key string) (bool, error) {
+	var firstErr error
+	for _, shard := range s.replicas(key) {
+		found, err := exists(shard, key)
+		if err == nil && found {
+			return true, nil
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return false, firstErr
+}
+
+// Keys scans the shards one after another, the cursor being the index of the shard followed by its own
+// cursor. Keys are returned by the shard they are read from first only, so replicas are not listed twice.
+func (s *ShardedStore) Keys(prefix string, limit int, cursor string) ([]string, string, error) {
+	shard := 0
+	if cursor != "" {
+		index, shardCursor, _ := strings.Cut(cursor, ":")
+
+		var err error
+		if shard, err = strconv.Atoi(index); err != nil || shard < 0 || shard >= len(s.Shards) {
+			return nil, "", errors.New("invalid cursor " + cursor)
+		}
+		cursor = shardCursor
+	}
+
+	for ; shard < len(s.Shards); shard++ {
+		keys, next, err := scan(s.Shards[shard].Store, prefix, limit, cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		owned := keys[:0]
+		for _, key := range keys {
+			if s.replicaIndexes(key)[0] == shard {
+				owned = append(owned, key)
+			}
+		}
+
+		if next != "" {
+			return owned, strconv.Itoa(shard) + ":" + next, nil
+		}
+
+		cursor = ""
+		if len(owned) > 0 && shard+1 < len(s.Shards) {
+			return owned, strconv.Itoa(shard+1) + ":", nil
+		}
+		if len(owned) > 0 {
+			return owned, "", nil
+		}
+	}
+
+	return []string{}, "", nil
+}
+
+// Ping pings every shard
+func (s *ShardedStore) Ping(ctx context.Context) error {
+	for _, shard := range s.Shards {
+		if err := ping(ctx, shard.Store); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ShardOf returns the name of the shard a key is read from first
+func (s *ShardedStore) ShardOf(key string) string {
+	return s.Shards[s.replicaIndexes(key)[0]].Name
+}
+
+func (s *ShardedStore) each(key string, op func(shard KVStore) error) error {
+	var firstErr error
+	for _, shard := range s.replicas(key) {
+		if err := op(shard); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (s *ShardedStore) replicas(key string) []KVStore {
+	indexes := s.replicaIndexes(key)
+
+	stores := make([]KVStore, len(indexes))
+	for i, index := range indexes {
+		stores[i] = s.Shards[index].Store
+	}
+
+	return stores
+}
+
+// replicaIndexes walks the ring clockwise from the hash of a key, collecting distinct shards
+func (s *ShardedStore) replicaIndexes(key string) []int {
+	s.once.Do(s.buildRing)
+
+	replicas := s.Replicas
+	if replicas < 1 {
+		replicas = 1
+	}
+	if replicas > len(s.Shards) {
+		replicas = len(s.Shards)
+	}
+
+	h := hashKey(key)
+	start := sort.Search(len(s.ring), func(i int) bool {
+		return s.ring[i].hash >= h
+	})
+
+	indexes := make([]int, 0, replicas)
+	for i := 0; i < len(s.ring) && len(indexes) < replicas; i++ {
+		shard := s.ring[(start+i)%len(s.ring)].shard
+		if !containsInt(indexes, shard) {
+			indexes = append(indexes, shard)
+		}
+	}
+
+	return indexes
+}
+
+func (s *ShardedStore) buildRing() {
+	virtualNodes := s.VirtualNodes
+	if virtualNodes < 1 {
+		virtualNodes = 100
+	}
+
+	s.ring = make([]ringPoint, 0, len(s.Shards)*virtualNodes)
+	for i, shard := range s.Shards {
+		for v := 0; v < virtualNodes; v++ {
+			s.ring = append(s.ring, ringPoint{hash: hashKey(shard.Name + "#" + strconv.Itoa(v)), shard: i})
+		}
+	}
+
+	sort.Slice(s.ring, func(i, j int) bool {
+		return s.ring[i].hash < s.ring[j].hash
+	})
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+
+	// FNV barely mixes the last bytes, which is all that differs between virtual nodes
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+
+	return x
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,149 @@
+package kvsync_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestShardedStore(t *testing.T) {
+	shards := make([]kvsync.Shard, 3)
+	for i := range shards {
+		shards[i] = kvsync.Shard{
+			Name:  fmt.Sprintf("shard-%d", i),
+			Store: &kvsync.InMemoryStore{Store: make(map[string]any)},
+		}
+	}
+
+	store := &kvsync.ShardedStore{Shards: shards, Replicas: 2}
+
+	for i := 0; i < 300; i++ {
+		assert.NoError(t, store.Put(fmt.Sprintf("user:%d", i), User{ID: i}))
+	}
+
+	total := 0
+	for _, shard := range shards {
+		count := len(shard.Store.(*kvsync.InMemoryStore).Store)
+		assert.InDelta(t, 200, count, 60, "keys are spread evenly")
+		total += count
+	}
+	assert.Equal(t, 600, total, "keys are written to two shards")
+
+	// the other replica serves the key
+	first := store.ShardOf("user:42")
+	for _, shard := range shards {
+		if shard.Name == first {
+			assert.NoError(t, shard.Store.(kvsync.Deleter).Delete("user:42"))
+		}
+	}
+
+	var user User
+	assert.NoError(t, store.Fetch("user:42", &user))
+	assert.Equal(t, 42, user.ID)
+
+	assert.NoError(t, store.Delete("user:42"))
+	assert.ErrorIs(t, store.Fetch("user:42", &user), kvsync.ErrKeyNotFound)
+}
+
+func TestShardedStore_AddShard(t *testing.T) {
+	shards := make([]kvsync.Shard, 4)
+	for i := range shards {
+		shards[i] = kvsync.Shard{
+			Name:  fmt.Sprintf("shard-%d", i),
+			Store: &kvsync.InMemoryStore{Store: make(map[string]any)},
+		}
+	}
+
+	before := &kvsync.ShardedStore{Shards: shards[:3]}
+	after := &kvsync.ShardedStore{Shards: shards}
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		if shard := after.ShardOf(key); shard != before.ShardOf(key) {
+			assert.Equal(t, "shard-3", shard, "keys only move to the new shard")
+			moved++
+		}
+	}
+
+	assert.InDelta(t, 250, moved, 75)
+}
+
+func TestShardedStore_Keys(t *testing.T) {
+	shards := make([]kvsync.Shard, 3)
+	for i := range shards {
+		shards[i] = kvsync.Shard{
+			Name:  fmt.Sprintf("shard-%d", i),
+			Store: &kvsync.InMemoryStore{Store: make(map[string]any)},
+		}
+	}
+
+	store := &kvsync.ShardedStore{Shards: shards, Replicas: 2}
+
+	expected := make([]string, 0, 50)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		expected = append(expected, key)
+		assert.NoError(t, store.Put(key, User{ID: i}))
+	}
+	assert.NoError(t, store.Put("order:1", Order{ID: 1}))
+
+	var keys []string
+	cursor := ""
+	for {
+		page, next, err := store.Keys("user:", 7, cursor)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(page), 7)
+
+		keys = append(keys, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	assert.ElementsMatch(t, expected, keys, "replicated keys are listed once")
+
+	_, _, err := store.Keys("user:", 7, "9:")
+	assert.Error(t, err)
+}
+
+func TestShardedStore_OptionalInterfaces(t *testing.T) {
+	shards := make([]kvsync.Shard, 3)
+	for i := range shards {
+		shards[i] = kvsync.Shard{
+			Name:  fmt.Sprintf("shard-%d", i),
+			Store: &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{Store: make(map[string]any)}},
+		}
+	}
+
+	store := &kvsync.ShardedStore{Shards: shards, Replicas: 2}
+	assertOptionalInterfaces(t, store)
+
+	// the other replica serves the key
+	assert.NoError(t, store.PutWithTTL("user:1", User{ID: 1}, time.Minute))
+	for _, shard := range shards {
+		if shard.Name == store.ShardOf("user:1") {
+			shard.Store.(*kvsync.ChaosStore).ErrorRate = 1
+		}
+	}
+
+	found, err := store.Exists("user:1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	ttl, err := store.TTL("user:1")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+
+	_, err = store.TTL("user:2")
+	assert.Error(t, err)
+	assert.ErrorIs(t, store.Ping(context.Background()), kvsync.ErrStoreUnavailable)
+
+	for _, shard := range shards {
+		shard.Store.(*kvsync.ChaosStore).ErrorRate = 1
+	}
+	assertOptionalInterfacesFail(t, store, kvsync.ErrStoreUnavailable)
+}
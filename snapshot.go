@@ -0,0 +1,46 @@
+package kvsync
+
+import (
+	"time"
+)
+
+// SnapshotTimeFormat is the UTC timestamp format of snapshot keys
+const SnapshotTimeFormat = "2006-01-02T15:04:05Z"
+
+// SnapshotKey returns the key of the snapshot of a key taken at a point in time, e.g. "user:1@2024-06-01T12:00:00Z"
+func SnapshotKey(key string, at time.Time) string {
+	return key + "@" + at.UTC().Format(SnapshotTimeFormat)
+}
+
+// withSnapshots adds a snapshot key for every key spec with a SnapshotRetention, storing the same value
+func withSnapshots(specs map[string]KeySpec, values map[string]any, at time.Time) (map[string]KeySpec, map[string]any) {
+	var snapshots map[string]KeySpec
+	for keyName, spec := range specs {
+		if spec.SnapshotRetention <= 0 {
+			continue
+		}
+
+		if snapshots == nil {
+			snapshots = make(map[string]KeySpec)
+		}
+		snapshots[keyName+"@snapshot"] = KeySpec{Key: SnapshotKey(spec.Key, at), TTL: spec.SnapshotRetention}
+	}
+
+	if snapshots == nil {
+		return specs, values
+	}
+
+	allSpecs := make(map[string]KeySpec, len(specs)+len(snapshots))
+	allValues := make(map[string]any, len(specs)+len(snapshots))
+	for keyName, spec := range specs {
+		allSpecs[keyName] = spec
+		allValues[keyName] = values[keyName]
+
+		if snapshot, ok := snapshots[keyName+"@snapshot"]; ok {
+			allSpecs[keyName+"@snapshot"] = snapshot
+			allValues[keyName+"@snapshot"] = values[keyName]
+		}
+	}
+
+	return allSpecs, allValues
+}
@@ -0,0 +1,101 @@
+package kvsync
+
+import (
+	"sync"
+)
+
+// Stats is a snapshot of the state of a KVSync
+type Stats struct {
+	// Workers, Queued and QueueCapacity sum up all pools
+	Workers int
+	// Queued is the number of entities waiting for a worker, prioritized ones included
+	Queued        int
+	QueueCapacity int
+	// Pools are the pools dedicated to models by ModelName, see Options.Pools
+	Pools       map[string]PoolStats
+	Paused      bool
+	KillSwitch  bool
+	DeadLetters int
+	// Models are the sync counters of every model synced since the KVSync was created, by ModelName
+	Models map[string]ModelStats
+	// Tenants are the keys and bytes written by tenant, see Options.Quotas
+	Tenants map[string]TenantStats
+	// Tasks are the statuses of the tasks of Options.Scheduler, sorted by name
+	Tasks []TaskStatus
+}
+
+// ModelStats counts the keys of a model written by the workers
+type ModelStats struct {
+	Synced int64
+	Failed int64
+	// Disabled tells whether syncing is disabled due to the model's error rate, see ErrorRateOptions
+	Disabled bool
+}
+
+type statsTracker struct {
+	models map[string]*ModelStats
+	mutex  sync.Mutex
+}
+
+func (t *statsTracker) observe(model string, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.models == nil {
+		t.models = make(map[string]*ModelStats)
+	}
+
+	m, ok := t.models[model]
+	if !ok {
+		m = &ModelStats{}
+		t.models[model] = m
+	}
+
+	if err != nil {
+		m.Failed++
+	} else {
+		m.Synced++
+	}
+}
+
+// Stats returns the queue depth, pause state and sync counters
+func (k *kvSync) Stats() Stats {
+	shared := k.pool.stats()
+	stats := Stats{
+		Workers:       shared.Workers,
+		Queued:        shared.Queued,
+		QueueCapacity: shared.QueueCapacity,
+		Pools:         make(map[string]PoolStats, len(k.pools)),
+		Paused:        k.Paused(),
+		KillSwitch:    k.killSwitch.Engaged(),
+		Tenants:       k.quotas.stats(),
+	}
+
+	for model, pool := range k.pools {
+		poolStats := pool.stats()
+		stats.Pools[model] = poolStats
+		stats.Workers += poolStats.Workers
+		stats.Queued += poolStats.Queued
+		stats.QueueCapacity += poolStats.QueueCapacity
+	}
+
+	if k.deadLetters != nil {
+		stats.DeadLetters = k.deadLetters.Len()
+	}
+
+	if k.scheduler != nil {
+		stats.Tasks = k.scheduler.Status()
+	}
+
+	k.stats.mutex.Lock()
+	defer k.stats.mutex.Unlock()
+
+	stats.Models = make(map[string]ModelStats, len(k.stats.models))
+	for model, m := range k.stats.models {
+		modelStats := *m
+		modelStats.Disabled = k.errorRates.isDisabled(model)
+		stats.Models[model] = modelStats
+	}
+
+	return stats
+}
@@ -0,0 +1,68 @@
+package kvsync
+
+import (
+	"time"
+)
+
+// Priority orders queued syncs, the workers take high priority entities first
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+)
+
+// SyncOption overrides the defaults for a single sync, e.g. Sync(user, WithTTL(time.Minute))
+type SyncOption func(*syncOptions)
+
+type syncOptions struct {
+	ttl       time.Duration
+	marshaler MarshalingAdapter
+	priority  Priority
+}
+
+// WithTTL expires all keys of the entity after ttl, overriding per-key TTLs and the runtime config
+func WithTTL(ttl time.Duration) SyncOption {
+	return func(o *syncOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithMarshaler serializes the entity with a different marshaler than the store's. The store must implement
+// MarshalingStore, and values are written key by key, without batching or version checks.
+func WithMarshaler(marshaler MarshalingAdapter) SyncOption {
+	return func(o *syncOptions) {
+		o.marshaler = marshaler
+	}
+}
+
+// WithPriority queues the entity ahead of normal priority ones, it only affects queued syncs such as SyncAndWait
+func WithPriority(priority Priority) SyncOption {
+	return func(o *syncOptions) {
+		o.priority = priority
+	}
+}
+
+func newSyncOptions(opts []SyncOption) syncOptions {
+	var o syncOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// withTTL returns the specs with the TTL of the options, if any
+func (o syncOptions) withTTL(specs map[string]KeySpec) map[string]KeySpec {
+	if o.ttl <= 0 {
+		return specs
+	}
+
+	overridden := make(map[string]KeySpec, len(specs))
+	for keyName, spec := range specs {
+		spec.TTL = o.ttl
+		overridden[keyName] = spec
+	}
+
+	return overridden
+}
@@ -0,0 +1,77 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSync_Options(t *testing.T) {
+	redisStore, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	redisStore.Expiration = 24 * time.Hour
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: redisStore,
+	})
+
+	assert.NoError(t, kvSync.Sync(&Product{ID: 1, SKU: "sku-1"}, kvsync.WithTTL(time.Minute)))
+	assert.Equal(t, time.Minute, miniRedis.TTL("kvsync:product:id:1"))
+	assert.Equal(t, time.Minute, miniRedis.TTL("kvsync:product:sku:sku-1"), "per-key TTLs are overridden")
+
+	jsonMarshaler := &kvsync.CanonicalJSONMarshalingAdapter{}
+	assert.NoError(t, kvSync.SyncAndWait(context.Background(), &Product{ID: 2, SKU: "sku-2"}, kvsync.WithMarshaler(jsonMarshaler)))
+
+	raw, err := miniRedis.Get("kvsync:product:id:2")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"ID":2,"SKU":"sku-2"}`, raw)
+	assert.Equal(t, 24*time.Hour, miniRedis.TTL("kvsync:product:id:2"))
+
+	inMemory := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: &kvsync.InMemoryStore{Store: make(map[string]any)},
+	})
+	assert.Error(t, inMemory.SyncAndWait(context.Background(), &Product{ID: 3}, kvsync.WithMarshaler(jsonMarshaler)))
+}
+
+func TestSyncAndWait_Priority(t *testing.T) {
+	store := &blockingPutStore{InMemoryStore: kvsync.InMemoryStore{Store: make(map[string]any)}, release: make(chan struct{})}
+
+	var mutex sync.Mutex
+	var order []string
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store:     store,
+		Workers:   1,
+		QueueSize: 1,
+		ReportCallback: func(r kvsync.Report) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			order = append(order, r.Model.(Product).SKU)
+		},
+	})
+
+	var wg sync.WaitGroup
+	syncProduct := func(product *Product, opts ...kvsync.SyncOption) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, kvSync.SyncAndWait(context.Background(), product, opts...))
+		}()
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// the worker blocks on the first product while the others are queued
+	syncProduct(&Product{ID: 1, SKU: "first"})
+	syncProduct(&Product{ID: 2, SKU: "normal"})
+	syncProduct(&Product{ID: 3, SKU: "urgent"}, kvsync.WithPriority(kvsync.PriorityHigh))
+
+	close(store.release)
+	wg.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []string{"first", "first", "urgent", "urgent", "normal", "normal"}, order)
+}
@@ -0,0 +1,216 @@
+package kvsync
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// TieredStore layers a local store, typically an InMemoryStore, in front of a shared one. Reads are served by
+// the local store when possible and fill it on a miss, writes and deletes go to both. Local copies only
+// expire when the local store expires entries, e.g. with InMemoryStore.Expiration, so with several instances an
+// Invalidator is needed for them to drop the copies others changed.
+type TieredStore struct {
+	Local  KVStore
+	Remote KVStore
+	// Invalidator optionally broadcasts the keys written or deleted to the other instances, see Listen
+	Invalidator Invalidator
+	// InvalidateOnReport leaves the invalidations to Observe, which publishes them with the trace IDs of the
+	// writes of a KVSync. Keys written or deleted by other callers are then no longer invalidated.
+	InvalidateOnReport bool
+}
+
+func (t *TieredStore) Fetch(key string, dest any) error {
+	if err := t.Local.Fetch(key, dest); err == nil {
+		return nil
+	}
+
+	if err := t.Remote.Fetch(key, dest); err != nil {
+		return err
+	}
+
+	_ = t.Local.Put(key, reflect.ValueOf(dest).Elem().Interface())
+
+	return nil
+}
+
+func (t *TieredStore) Put(key string, value any) error {
+	if err := t.Remote.Put(key, value); err != nil {
+		return err
+	}
+
+	return t.putLocal(key, value, 0)
+}
+
+// PutWithTTL expires the remote and local copies after ttl if the remote store implements TTLStore
+func (t *TieredStore) PutWithTTL(key string, value any, ttl time.Duration) error {
+	ttlStore, ok := t.Remote.(TTLStore)
+	if !ok {
+		return t.Put(key, value)
+	}
+
+	if err := ttlStore.PutWithTTL(key, value, ttl); err != nil {
+		return err
+	}
+
+	return t.putLocal(key, value, ttl)
+}
+
+func (t *TieredStore) Delete(key string) error {
+	if err := deleteKey(t.Remote, key); err != nil {
+		return err
+	}
+
+	if err := deleteKey(t.Local, key); err != nil {
+		return err
+	}
+
+	return t.invalidate(key)
+}
+
+// Exists checks the local store, then the remote one
+func (t *TieredStore) Exists(key string) (bool, error) {
+	if found, err := exists(t.Local, key); err == nil && found {
+		return true, nil
+	}
+
+	return exists(t.Remote, key)
+}
+
+// TTL inspects the remote store
+func (t *TieredStore) TTL(key string) (time.Duration, error) {
+	return keyTTL(t.Remote, key)
+}
+
+// Touch extends the expiration of the remote key, then of its local copy if any
+func (t *TieredStore) Touch(key string, ttl time.Duration) error {
+	if err := touchKey(t.Remote, key, ttl); err != nil {
+		return err
+	}
+
+	_ = touchKey(t.Local, key, ttl)
+
+	return nil
+}
+
+// Keys scans the keys of the remote store, the local one holding a subset of them
+func (t *TieredStore) Keys(prefix string, limit int, cursor string) ([]string, string, error) {
+	return scan(t.Remote, prefix, limit, cursor)
+}
+
+// Listen drops the local copies of the keys other instances write or delete until the context is done
+func (t *TieredStore) Listen(ctx context.Context) error {
+	return t.Invalidator.Subscribe(ctx, func(key string) {
+		_ = deleteKey(t.Local, key)
+	})
+}
+
+func (t *TieredStore) putLocal(key string, value any, ttl time.Duration) error {
+	if err := putWithTTL(t.Local, key, value, ttl); err != nil {
+		return err
+	}
+
+	return t.invalidate(key)
+}
+
+func (t *TieredStore) invalidate(key string) error {
+	if t.Invalidator == nil || t.InvalidateOnReport {
+		return nil
+	}
+
+	return t.Invalidator.Publish(context.Background(), key)
+}
+
+// Observe is a ReportCallback publishing the invalidations of the keys a KVSync wrote or deleted under the trace
+// ID of their report when InvalidateOnReport is set, see KVSync.Subscribe
+func (t *TieredStore) Observe(report Report) {
+	if t.Invalidator == nil || !t.InvalidateOnReport || report.Err != nil || report.DryRun || report.Key == "" {
+		return
+	}
+
+	_ = t.Invalidator.Publish(WithTraceID(context.Background(), report.TraceID), report.Key)
+}
+
+// Invalidator broadcasts invalidated keys across instances, e.g. over Redis pub/sub or NATS.
+// Subscribers are not notified of the keys their own instance publishes. The trace ID of the context, if any,
+// should be carried along to correlate invalidations with the writes causing them.
+type Invalidator interface {
+	Publish(ctx context.Context, key string) error
+	// Subscribe invokes invalidate for every key published by other instances until the context is done
+	Subscribe(ctx context.Context, invalidate func(key string)) error
+}
+
+// RedisInvalidator is an Invalidator over Redis pub/sub
+type RedisInvalidator struct {
+	Client redis.UniversalClient
+	// Channel defaults to "kvsync:invalidations"
+	Channel string
+	// Instance identifies this instance in messages, defaults to a random ID
+	Instance string
+
+	once sync.Once
+}
+
+type invalidation struct {
+	Instance string `json:"instance"`
+	Key      string `json:"key"`
+	TraceID  string `json:"trace_id,omitempty"`
+}
+
+func (i *RedisInvalidator) Publish(ctx context.Context, key string) error {
+	b, err := json.Marshal(invalidation{Instance: i.instance(), Key: key, TraceID: TraceID(ctx)})
+	if err != nil {
+		return err
+	}
+
+	return redisError(key, i.Client.Publish(ctx, i.channel(), b).Err())
+}
+
+func (i *RedisInvalidator) Subscribe(ctx context.Context, invalidate func(key string)) error {
+	pubSub := i.Client.Subscribe(ctx, i.channel())
+	defer pubSub.Close()
+
+	if _, err := pubSub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubSub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			var inv invalidation
+			if err := json.Unmarshal([]byte(message.Payload), &inv); err != nil || inv.Instance == i.instance() {
+				continue
+			}
+
+			invalidate(inv.Key)
+		}
+	}
+}
+
+func (i *RedisInvalidator) channel() string {
+	if i.Channel == "" {
+		return "kvsync:invalidations"
+	}
+
+	return i.Channel
+}
+
+func (i *RedisInvalidator) instance() string {
+	i.once.Do(func() {
+		if i.Instance == "" {
+			i.Instance = newTraceID()
+		}
+	})
+
+	return i.Instance
+}
@@ -0,0 +1,127 @@
+package kvsync_test
+
+import (
+	"context"
+	"github.com/ndthuan/kvsync"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTieredStore(t *testing.T) {
+	remote, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	newInstance := func() (*kvsync.TieredStore, *kvsync.InMemoryStore) {
+		local := &kvsync.InMemoryStore{
+			Store: make(map[string]any),
+		}
+
+		return &kvsync.TieredStore{
+			Local:  local,
+			Remote: remote,
+			Invalidator: &kvsync.RedisInvalidator{
+				Client: redis.NewClient(&redis.Options{Addr: miniRedis.Addr()}),
+			},
+		}, local
+	}
+
+	a, localA := newInstance()
+	b, localB := newInstance()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = a.Listen(ctx)
+	}()
+	go func() {
+		_ = b.Listen(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return miniRedis.PubSubNumSub("kvsync:invalidations")["kvsync:invalidations"] == 2
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, a.Put("user:id:1", SyncedUser{Username: "first"}))
+	assert.Contains(t, localA.Store, "user:id:1")
+
+	// reads fill the local store
+	var user SyncedUser
+	assert.NoError(t, b.Fetch("user:id:1", &user))
+	assert.Equal(t, "first", user.Username)
+	assert.Contains(t, localB.Store, "user:id:1")
+
+	// writes of an instance drop the local copies of the others, but not its own
+	assert.NoError(t, a.Put("user:id:1", SyncedUser{Username: "second"}))
+	assert.Eventually(t, func() bool {
+		_, err := localB.FetchAny("user:id:1")
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, localA.Store, "user:id:1")
+
+	assert.NoError(t, b.Fetch("user:id:1", &user))
+	assert.Equal(t, "second", user.Username)
+
+	assert.NoError(t, a.Delete("user:id:1"))
+	assert.Eventually(t, func() bool {
+		_, err := localB.FetchAny("user:id:1")
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.ErrorIs(t, b.Fetch("user:id:1", &user), kvsync.ErrKeyNotFound)
+}
+
+func TestTieredStore_InvalidateOnReport(t *testing.T) {
+	remote, miniRedis := setUpStore()
+	defer miniRedis.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: miniRedis.Addr()})
+	subscription := client.Subscribe(context.Background(), "kvsync:invalidations")
+	defer subscription.Close()
+	_, err := subscription.Receive(context.Background())
+	assert.NoError(t, err)
+	messages := subscription.Channel()
+
+	tiered := &kvsync.TieredStore{
+		Local:              &kvsync.InMemoryStore{Store: make(map[string]any)},
+		Remote:             remote,
+		Invalidator:        &kvsync.RedisInvalidator{Client: client},
+		InvalidateOnReport: true,
+	}
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: tiered})
+	kvSync.Subscribe(tiered.Observe)
+
+	assert.NoError(t, tiered.Put("user:direct", SyncedUser{}), "writes outside of KVSync are not invalidated")
+	assert.NoError(t, kvSync.SyncAndWait(kvsync.WithTraceID(context.Background(), "trace-1"), SyncedUser{UUID: "traced-uuid"}))
+
+	for i := 0; i < 3; i++ {
+		select {
+		case message := <-messages:
+			assert.Contains(t, message.Payload, `"trace_id":"trace-1"`)
+			assert.NotContains(t, message.Payload, `"key":"user:direct"`)
+		case <-time.After(time.Second):
+			t.Fatal("invalidation not published")
+		}
+	}
+}
+
+func TestTieredStore_OptionalInterfaces(t *testing.T) {
+	local := &kvsync.InMemoryStore{Store: make(map[string]any)}
+	remote := &kvsync.ChaosStore{Store: &kvsync.InMemoryStore{Store: make(map[string]any)}}
+	store := &kvsync.TieredStore{Local: local, Remote: remote}
+
+	assertOptionalInterfaces(t, store)
+
+	assert.NoError(t, store.PutWithTTL("user:1", User{ID: 1}, time.Minute))
+	ttl, err := local.TTL("user:1")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second), "the local copy expires with the remote key")
+
+	remote.ErrorRate = 1
+	found, err := store.Exists("user:1")
+	assert.NoError(t, err)
+	assert.True(t, found, "served by the local store")
+
+	assert.ErrorIs(t, store.Put("user:1", User{ID: 1}), kvsync.ErrStoreUnavailable)
+	assertOptionalInterfacesFail(t, &kvsync.TieredStore{Local: &kvsync.InMemoryStore{Store: make(map[string]any)}, Remote: remote}, kvsync.ErrStoreUnavailable)
+}
@@ -0,0 +1,55 @@
+package kvsync
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type traceIDKey struct{}
+
+type actorKey struct{}
+
+// WithTraceID returns a context carrying a trace ID. Statements run with it, e.g. through
+// db.WithContext(ctx), are synced under this ID instead of a generated one, so that the database
+// write and the resulting cache writes can be correlated in logs.
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceID returns the trace ID carried by a context, or an empty string. The contexts passed to
+// model hooks such as BeforeSync carry the trace ID of the sync.
+func TraceID(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey{}).(string)
+
+	return traceID
+}
+
+// WithActor returns a context carrying the user or service on whose behalf statements run, recorded by the
+// AuditSink for the syncs and deletes they trigger
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns the actor carried by a context, or an empty string
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+
+	return actor
+}
+
+// traceIDFrom adopts the trace ID of a context, generating a new one when it has none
+func traceIDFrom(ctx context.Context) string {
+	if traceID := TraceID(ctx); traceID != "" {
+		return traceID
+	}
+
+	return newTraceID()
+}
+
+func newTraceID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
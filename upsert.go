@@ -0,0 +1,47 @@
+package kvsync
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+)
+
+// upsertClause returns the ON CONFLICT clause of a create statement, if any
+func upsertClause(db *gorm.DB) (clause.OnConflict, bool) {
+	c, ok := db.Statement.Clauses[clause.OnConflict{}.Name()]
+	if !ok {
+		return clause.OnConflict{}, false
+	}
+
+	onConflict, ok := c.Expression.(clause.OnConflict)
+
+	return onConflict, ok
+}
+
+// loadUpserted reloads a row written by an upsert, whose stored values differ from the statement's when
+// the row already existed. Rows are looked up by the conflict columns, or by primary key when there are none;
+// rows left untouched by DO NOTHING without conflict columns are skipped since their key is unknown.
+func loadUpserted(db *gorm.DB, onConflict clause.OnConflict, model any) (any, bool) {
+	model = resolvePointer(model)
+	if len(onConflict.Columns) == 0 || db.Statement.Schema == nil {
+		return loadRow(db, model)
+	}
+
+	val := reflect.ValueOf(model)
+	if val.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	conds := make([]clause.Expression, 0, len(onConflict.Columns))
+	for _, column := range onConflict.Columns {
+		field := db.Statement.Schema.LookUpField(column.Name)
+		if field == nil {
+			return loadRow(db, model)
+		}
+
+		value, _ := field.ValueOf(db.Statement.Context, val)
+		conds = append(conds, clause.Eq{Column: clause.Column{Name: field.DBName}, Value: value})
+	}
+
+	return findRow(db, val.Type(), conds...)
+}
@@ -0,0 +1,100 @@
+package kvsync_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"testing"
+	"time"
+)
+
+type UpsertedUser struct {
+	ID       uint
+	UUID     string `gorm:"uniqueIndex"`
+	Username string
+	Visits   int
+}
+
+func (u UpsertedUser) SyncKeys() map[string]string {
+	return map[string]string{
+		"id":   fmt.Sprintf("upserted:id:%d", u.ID),
+		"uuid": fmt.Sprintf("upserted:uuid:%s", u.UUID),
+	}
+}
+
+func TestPlugin_Upserts(t *testing.T) {
+	store := &kvsync.InMemoryStore{
+		Store: make(map[string]any),
+	}
+
+	reports := make(chan kvsync.Report, 10)
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{
+		Store: store,
+		ReportCallback: func(r kvsync.Report) {
+			reports <- r
+		},
+	})
+
+	db := setUpDB()
+	defer tearDownDB(db)
+	assert.NoError(t, db.AutoMigrate(&UpsertedUser{}))
+	defer func() {
+		_ = db.Migrator().DropTable(&UpsertedUser{})
+	}()
+	assert.NoError(t, db.Use(kvsync.Plugin(kvSync)))
+
+	waitReports := func(n int) {
+		for i := 0; i < n; i++ {
+			select {
+			case r := <-reports:
+				assert.NoError(t, r.Err)
+			case <-time.After(time.Second):
+				t.Fatal("no report received")
+			}
+		}
+	}
+	fetch := func(uuid string) UpsertedUser {
+		fetched := UpsertedUser{UUID: uuid}
+		assert.NoError(t, kvSync.Fetch(&fetched, "uuid"))
+		return fetched
+	}
+
+	assert.NoError(t, db.Create(&UpsertedUser{UUID: "alice", Username: "alice", Visits: 1}).Error)
+	waitReports(2)
+
+	// the stored row, not the statement's values, is synced when the row already exists
+	assert.NoError(t, db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "uuid"}},
+		DoUpdates: clause.Assignments(map[string]any{"visits": gorm.Expr("visits + 1")}),
+	}).Create(&UpsertedUser{UUID: "alice", Username: "ignored", Visits: 5}).Error)
+	waitReports(2)
+	assert.Equal(t, UpsertedUser{ID: 1, UUID: "alice", Username: "alice", Visits: 2}, fetch("alice"))
+
+	assert.NoError(t, db.Clauses(clause.OnConflict{DoNothing: true}).Create(&UpsertedUser{UUID: "alice", Username: "ignored"}).Error)
+	assert.NotContains(t, store.Store, "upserted:id:0")
+
+	assert.NoError(t, db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&[]UpsertedUser{
+		{ID: 1, UUID: "alice", Username: "alice-2"},
+		{UUID: "bob", Username: "bob"},
+	}).Error)
+	waitReports(4)
+	assert.Equal(t, "alice-2", fetch("alice").Username)
+	assert.Equal(t, "bob", fetch("bob").Username)
+
+	// Save of a new row with its primary key set falls back to an insert
+	assert.NoError(t, db.Save(&UpsertedUser{ID: 9, UUID: "carol", Username: "carol"}).Error)
+	waitReports(2)
+	assert.Equal(t, uint(9), fetch("carol").ID)
+
+	var dave UpsertedUser
+	assert.NoError(t, db.Where(UpsertedUser{UUID: "dave"}).Attrs(UpsertedUser{Username: "dave"}).FirstOrCreate(&dave).Error)
+	waitReports(2)
+	assert.Equal(t, "dave", fetch("dave").Username)
+
+	assert.NoError(t, db.Where(UpsertedUser{UUID: "dave"}).Assign(UpsertedUser{Username: "dave-2"}).FirstOrCreate(&dave).Error)
+	waitReports(2)
+	assert.Equal(t, "dave-2", fetch("dave").Username)
+}
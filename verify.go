@@ -0,0 +1,158 @@
+package kvsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"time"
+)
+
+// VerifyResult lists the keys of the rows a verification went through that are missing or out of date
+type VerifyResult struct {
+	Rows       int
+	Keys       int
+	Missing    []string
+	Mismatched []string
+}
+
+// Verifier compares the rows of a model with the values stored under their keys
+type Verifier struct {
+	DB    *gorm.DB
+	Store KVStore
+	// BatchSize is the number of rows loaded per query, defaults to 500
+	BatchSize int
+}
+
+// Verify loads all rows of a model in primary key order and checks the value of each of their keys.
+// Values are compared as JSON, after applying field tags, so stored values must decode into the model.
+func (v *Verifier) Verify(ctx context.Context, model any) (VerifyResult, error) {
+	var result VerifyResult
+
+	modelType := reflect.TypeOf(resolvePointer(model))
+
+	pk, err := primaryField(v.DB, model)
+	if err != nil {
+		return result, err
+	}
+
+	batchSize := v.BatchSize
+	if batchSize < 1 {
+		batchSize = 500
+	}
+
+	var lastPK any
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		rows := reflect.New(reflect.SliceOf(modelType))
+
+		query := v.DB.WithContext(ctx).Order(pk.DBName).Limit(batchSize)
+		if lastPK != nil {
+			query = query.Where(clause.Gt{Column: clause.Column{Name: pk.DBName}, Value: lastPK})
+		}
+
+		if err := query.Find(rows.Interface()).Error; err != nil {
+			return result, err
+		}
+
+		slice := rows.Elem()
+		if slice.Len() == 0 {
+			return result, nil
+		}
+
+		for i := 0; i < slice.Len(); i++ {
+			if err := v.verify(slice.Index(i).Interface(), &result); err != nil {
+				return result, err
+			}
+		}
+
+		lastPK, _ = pk.ValueOf(ctx, slice.Index(slice.Len()-1))
+	}
+}
+
+func (v *Verifier) verify(entity any, result *VerifyResult) error {
+	specs, ok := syncKeySpecs(entity)
+	if !ok {
+		return fmt.Errorf("model %s has no sync keys", ModelName(entity))
+	}
+
+	result.Rows++
+
+	for keyName, value := range views(entity, specs) {
+		key := specs[keyName].Key
+		result.Keys++
+
+		stored := reflect.New(reflect.TypeOf(value))
+		if err := v.Store.Fetch(key, stored.Interface()); err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				result.Missing = append(result.Missing, key)
+
+				continue
+			}
+
+			return err
+		}
+
+		equal, err := equalJSON(value, stored.Interface())
+		if err != nil {
+			return err
+		}
+
+		if !equal {
+			result.Mismatched = append(result.Mismatched, key)
+		}
+	}
+
+	return nil
+}
+
+// equalJSON compares values by their JSON encoding, ignoring the fields omitted by field tags and timestamps
+// beyond the millisecond precision of BSON
+func equalJSON(a, b any) (bool, error) {
+	aCopy, bCopy := addressableCopy(resolvePointer(a)), addressableCopy(resolvePointer(b))
+	normalizeTimes(aCopy.Elem())
+	normalizeTimes(bCopy.Elem())
+
+	aJSON, err := json.Marshal(applyFieldTags(aCopy.Interface()))
+	if err != nil {
+		return false, err
+	}
+
+	bJSON, err := json.Marshal(applyFieldTags(bCopy.Interface()))
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(aJSON, bJSON), nil
+}
+
+// normalizeTimes truncates the settable timestamps of a value to milliseconds in UTC
+func normalizeTimes(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			normalizeTimes(v.Elem())
+		}
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			if v.CanSet() {
+				v.Set(reflect.ValueOf(t.UTC().Truncate(time.Millisecond)))
+			}
+
+			return
+		}
+
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				normalizeTimes(v.Field(i))
+			}
+		}
+	}
+}
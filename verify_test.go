@@ -0,0 +1,49 @@
+package kvsync_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestVerifier(t *testing.T) {
+	db := setUpDB()
+	defer tearDownDB(db)
+
+	store, mr := setUpStore()
+	defer mr.Close()
+
+	users := make([]*SyncedUser, 3)
+	for i := range users {
+		users[i] = &SyncedUser{
+			UUID:     fmt.Sprintf("verify-uuid-%d", i+1),
+			Username: fmt.Sprintf("verify-username-%d", i+1),
+		}
+		db.Create(users[i])
+	}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: store})
+	for _, user := range users {
+		assert.NoError(t, kvSync.SyncAndWait(context.Background(), user))
+	}
+
+	verifier := &kvsync.Verifier{DB: db, Store: store, BatchSize: 2}
+
+	result, err := verifier.Verify(context.Background(), &SyncedUser{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Rows)
+	assert.Equal(t, 9, result.Keys)
+	assert.Empty(t, result.Missing)
+	assert.Empty(t, result.Mismatched)
+
+	// updated without syncing
+	db.Model(users[1]).Update("username", "verify-renamed")
+	assert.NoError(t, store.Delete("user:id:3"))
+
+	result, err = verifier.Verify(context.Background(), &SyncedUser{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user:id:3"}, result.Missing)
+	assert.ElementsMatch(t, []string{"user:id:2", "user:uuid:verify-uuid-2", "user:composite:2_verify-uuid-2"}, result.Mismatched)
+}
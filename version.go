@@ -0,0 +1,57 @@
+package kvsync
+
+import (
+	"reflect"
+	"time"
+)
+
+// Versioned is an optional interface for models carrying a data version. Writes of a versioned model
+// are compare-and-set: a value with a lower version than the stored one is discarded, so that an older
+// update processed late by a worker can't overwrite a newer one.
+type Versioned interface {
+	SyncVersion() int64
+}
+
+// VersionedStore is implemented by stores supporting compare-and-set writes
+type VersionedStore interface {
+	// PutIfNewer writes a value unless the stored version is higher than version, reporting whether
+	// the value was written. A positive ttl overrides the store's expiration.
+	PutIfNewer(key string, value any, version int64, ttl time.Duration) (bool, error)
+}
+
+// VersionedBatchStore is implemented by stores able to write the keys of a versioned entity in a single round
+// trip, see BatchStore and VersionedStore
+type VersionedBatchStore interface {
+	// PutBatchIfNewer writes the entries unless their stored versions are higher than version, returning one
+	// error (or nil) per entry in the same order. A stale entry is not an error.
+	PutBatchIfNewer(entries []BatchEntry, version int64) []error
+}
+
+// entityVersion returns the version of an entity from Versioned or, when useUpdatedAt is set,
+// from its UpdatedAt field (e.g. gorm.Model's)
+func entityVersion(entity any, useUpdatedAt bool) (int64, bool) {
+	if versioned, ok := entity.(Versioned); ok {
+		return versioned.SyncVersion(), true
+	}
+
+	if !useUpdatedAt {
+		return 0, false
+	}
+
+	val := reflect.ValueOf(entity)
+	if val.Kind() != reflect.Struct {
+		return 0, false
+	}
+
+	field := val.FieldByName("UpdatedAt")
+	if !field.IsValid() {
+		return 0, false
+	}
+
+	updatedAt, ok := field.Interface().(time.Time)
+	if !ok || updatedAt.IsZero() {
+		return 0, false
+	}
+
+	return updatedAt.UnixNano(), true
+}
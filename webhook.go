@@ -0,0 +1,253 @@
+package kvsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WebhookFailure summarizes a failed report in a WebhookPayload
+type WebhookFailure struct {
+	Model     string    `json:"model"`
+	KeyName   string    `json:"key_name,omitempty"`
+	Key       string    `json:"key,omitempty"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	Operation Operation `json:"operation,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// WebhookPayload is the JSON body POSTed by a WebhookNotifier
+type WebhookPayload struct {
+	// Count is the number of failures, also by model in Models
+	Count    int              `json:"count"`
+	Models   map[string]int   `json:"models"`
+	Failures []WebhookFailure `json:"failures"`
+}
+
+// WebhookNotifier POSTs batches of failed reports to a webhook, e.g. one posting to an incident channel.
+// Subscribe Notify to the reports of a KVSync and Run it. Reports of filtered entities and missing keys are
+// not failures. Batches still failing after Attempts are passed to ErrorCallback and dropped.
+type WebhookNotifier struct {
+	URL string
+	// Client defaults to a client timing out after 10 seconds
+	Client *http.Client
+	// Header is added to every request, e.g. for authentication
+	Header http.Header
+	// BatchSize is the number of failures posted at once, a full batch is posted right away, defaults to 100
+	BatchSize int
+	// Interval is how often pending failures are posted, defaults to 10 seconds
+	Interval time.Duration
+	// Attempts is the number of attempts to post a batch, defaults to 3
+	Attempts int
+	// Backoff is the wait before the second attempt, doubled for every further one, defaults to 1 second
+	Backoff time.Duration
+	// ErrorCallback is optionally invoked with the batches that could not be posted
+	ErrorCallback func(err error, payload WebhookPayload)
+
+	pending []WebhookFailure
+	full    chan struct{}
+	once    sync.Once
+	mutex   sync.Mutex
+}
+
+// Notify queues a report to post if it is a failure, it is a ReportCallback
+func (w *WebhookNotifier) Notify(r Report) {
+	if r.Err == nil || errors.Is(r.Err, ErrFiltered) || errors.Is(r.Err, ErrKeyNotFound) {
+		return
+	}
+
+	w.setUp()
+
+	w.mutex.Lock()
+	w.pending = append(w.pending, WebhookFailure{
+		Model:     ModelName(r.Model),
+		KeyName:   r.KeyName,
+		Key:       r.Key,
+		Error:     r.Err.Error(),
+		Attempts:  r.Attempt,
+		TraceID:   r.TraceID,
+		Operation: r.Operation,
+		Timestamp: r.Timestamp,
+	})
+	full := len(w.pending) >= w.batchSize()
+	w.mutex.Unlock()
+
+	if full {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run posts the pending failures every Interval, or as soon as a batch is full, until the context is done.
+// The failures pending then are posted once more.
+func (w *WebhookNotifier) Run(ctx context.Context) {
+	w.setUp()
+
+	ticker := time.NewTicker(w.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = w.Flush(context.Background())
+			return
+		case <-ticker.C:
+		case <-w.full:
+		}
+
+		_ = w.Flush(ctx)
+	}
+}
+
+// Flush posts the pending failures in batches, returning the first error
+func (w *WebhookNotifier) Flush(ctx context.Context) error {
+	var firstErr error
+	for {
+		w.mutex.Lock()
+		n := len(w.pending)
+		if n > w.batchSize() {
+			n = w.batchSize()
+		}
+		batch := w.pending[:n:n]
+		w.pending = w.pending[n:]
+		w.mutex.Unlock()
+
+		if len(batch) == 0 {
+			return firstErr
+		}
+
+		payload := newWebhookPayload(batch)
+		if err := w.post(ctx, payload); err != nil {
+			if w.ErrorCallback != nil {
+				w.ErrorCallback(err, payload)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+}
+
+func newWebhookPayload(failures []WebhookFailure) WebhookPayload {
+	payload := WebhookPayload{
+		Count:    len(failures),
+		Models:   make(map[string]int),
+		Failures: failures,
+	}
+
+	for _, failure := range failures {
+		payload.Models[failure.Model]++
+	}
+
+	return payload
+}
+
+// post posts a payload, retrying network errors, 429 and 5xx responses
+func (w *WebhookNotifier) post(ctx context.Context, payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.backoff()
+	for attempt := 1; ; attempt++ {
+		retry, err := w.send(ctx, body)
+		if err == nil || !retry || attempt >= w.attempts() {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func (w *WebhookNotifier) send(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	for name, values := range w.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client().Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+
+	return retry, fmt.Errorf("webhook responded %s", resp.Status)
+}
+
+func (w *WebhookNotifier) setUp() {
+	w.once.Do(func() {
+		w.full = make(chan struct{}, 1)
+	})
+}
+
+var defaultWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func (w *WebhookNotifier) client() *http.Client {
+	if w.Client == nil {
+		return defaultWebhookClient
+	}
+
+	return w.Client
+}
+
+func (w *WebhookNotifier) batchSize() int {
+	if w.BatchSize < 1 {
+		return 100
+	}
+
+	return w.BatchSize
+}
+
+func (w *WebhookNotifier) interval() time.Duration {
+	if w.Interval <= 0 {
+		return 10 * time.Second
+	}
+
+	return w.Interval
+}
+
+func (w *WebhookNotifier) attempts() int {
+	if w.Attempts < 1 {
+		return 3
+	}
+
+	return w.Attempts
+}
+
+func (w *WebhookNotifier) backoff() time.Duration {
+	if w.Backoff <= 0 {
+		return time.Second
+	}
+
+	return w.Backoff
+}
@@ -0,0 +1,151 @@
+package kvsync_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ndthuan/kvsync"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type webhookServer struct {
+	*httptest.Server
+	payloads []kvsync.WebhookPayload
+	statuses []int
+	mutex    sync.Mutex
+}
+
+func newWebhookServer(statuses ...int) *webhookServer {
+	w := &webhookServer{statuses: statuses}
+	w.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+
+		status := http.StatusOK
+		if len(w.statuses) > 0 {
+			status, w.statuses = w.statuses[0], w.statuses[1:]
+		}
+
+		if r.Header.Get("Authorization") != "Bearer token" {
+			status = http.StatusUnauthorized
+		}
+
+		if status == http.StatusOK {
+			var payload kvsync.WebhookPayload
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			w.payloads = append(w.payloads, payload)
+		}
+		rw.WriteHeader(status)
+	}))
+
+	return w
+}
+
+func (w *webhookServer) received() []kvsync.WebhookPayload {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return append([]kvsync.WebhookPayload(nil), w.payloads...)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server := newWebhookServer(http.StatusServiceUnavailable)
+	defer server.Close()
+
+	notifier := &kvsync.WebhookNotifier{
+		URL:       server.URL,
+		Header:    http.Header{"Authorization": {"Bearer token"}},
+		BatchSize: 2,
+		Interval:  time.Hour,
+		Backoff:   time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		notifier.Run(ctx)
+		close(done)
+	}()
+
+	notifier.Notify(kvsync.Report{Model: User{}, Key: "user:1"})
+	notifier.Notify(kvsync.Report{Model: User{}, Key: "user:1", Err: kvsync.ErrFiltered})
+	notifier.Notify(kvsync.Report{Model: User{}, Key: "user:2", Err: errors.New("timeout"), Attempt: 2})
+	notifier.Notify(kvsync.Report{Model: Order{}, Key: "order:1", Err: errors.New("timeout"), Attempt: 1})
+
+	// a full batch is posted right away, and retried
+	assert.Eventually(t, func() bool {
+		return len(server.received()) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	payload := server.received()[0]
+	assert.Equal(t, 2, payload.Count)
+	assert.Equal(t, map[string]int{"kvsync_test.User": 1, "kvsync_test.Order": 1}, payload.Models)
+	assert.Equal(t, "user:2", payload.Failures[0].Key)
+	assert.Equal(t, "timeout", payload.Failures[0].Error)
+	assert.Equal(t, 2, payload.Failures[0].Attempts)
+
+	// pending failures are posted on shutdown
+	notifier.Notify(kvsync.Report{Model: User{}, Key: "user:3", Err: errors.New("timeout")})
+	cancel()
+	<-done
+
+	assert.Len(t, server.received(), 2)
+	assert.Equal(t, "user:3", server.received()[1].Failures[0].Key)
+}
+
+func TestWebhookNotifier_Failure(t *testing.T) {
+	server := newWebhookServer(http.StatusInternalServerError, http.StatusInternalServerError)
+	defer server.Close()
+
+	var dropped []kvsync.WebhookPayload
+	notifier := &kvsync.WebhookNotifier{
+		URL:      server.URL,
+		Header:   http.Header{"Authorization": {"Bearer token"}},
+		Attempts: 2,
+		Backoff:  time.Millisecond,
+		ErrorCallback: func(err error, payload kvsync.WebhookPayload) {
+			dropped = append(dropped, payload)
+		},
+	}
+
+	notifier.Notify(kvsync.Report{Model: User{}, Key: "user:1", Err: errors.New("timeout")})
+	assert.EqualError(t, notifier.Flush(context.Background()), "webhook responded 500 Internal Server Error")
+	assert.Len(t, dropped, 1)
+	assert.Empty(t, server.received())
+
+	// client errors are not retried
+	notifier.Header = nil
+	notifier.Notify(kvsync.Report{Model: User{}, Key: "user:1", Err: errors.New("timeout")})
+	assert.EqualError(t, notifier.Flush(context.Background()), fmt.Sprintf("webhook responded %d %s", http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized)))
+	assert.Len(t, dropped, 2)
+
+	assert.NoError(t, notifier.Flush(context.Background()), "nothing pending")
+}
+
+func TestWebhookNotifier_Subscribe(t *testing.T) {
+	server := newWebhookServer()
+	defer server.Close()
+
+	notifier := &kvsync.WebhookNotifier{URL: server.URL, Header: http.Header{"Authorization": {"Bearer token"}}}
+
+	kvSync := kvsync.NewKVSync(context.Background(), kvsync.Options{Store: erroneousStore{}})
+	kvSync.Subscribe(notifier.Notify)
+
+	assert.Error(t, kvSync.SyncAndWait(context.Background(), &SyncedUser{UUID: "webhook-uuid"}))
+
+	assert.Eventually(t, func() bool {
+		_ = notifier.Flush(context.Background())
+		received := server.received()
+		count := 0
+		for _, payload := range received {
+			count += payload.Count
+		}
+		return count == 3
+	}, time.Second, 5*time.Millisecond)
+}